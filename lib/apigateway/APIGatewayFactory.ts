@@ -18,7 +18,16 @@ export class APIGatewayFactory {
     return new aws_apigatewayv2.HttpApi(this.stack, "HttpApi", {
       apiName: this.stack.stackName,
       corsPreflight: {
-        allowHeaders: ["Content-Type", "Authorization"],
+        allowHeaders: [
+          "Content-Type",
+          "Authorization",
+          "X-API-Key",
+          "If-Match",
+          "If-None-Match",
+          "If-Modified-Since",
+          "Idempotency-Key",
+        ],
+        exposeHeaders: ["ETag", "Last-Modified", "Idempotent-Replayed"],
         allowMethods: [
           aws_apigatewayv2.CorsHttpMethod.GET,
           aws_apigatewayv2.CorsHttpMethod.POST,
@@ -52,6 +61,20 @@ export class APIGatewayFactory {
       getAllPostsLambda,
       deletePostLambda,
       loginAdminLambda,
+      loginAdminMfaLambda,
+      enrollTotpLambda,
+      verifyTotpLambda,
+      createApiKeyLambda,
+      getAllApiKeysLambda,
+      revokeApiKeyLambda,
+      oidcAuthorizeLambda,
+      oidcCallbackLambda,
+      getAuditEntriesLambda,
+      getDeletedPostsLambda,
+      restorePostLambda,
+      purgePostLambda,
+      syncPostsLambda,
+      getOpenApiDocumentLambda,
     } = this.stack.lambdas;
 
     this.gateway.addRoutes({
@@ -110,5 +133,141 @@ export class APIGatewayFactory {
         loginAdminLambda,
       ),
     });
+
+    this.gateway.addRoutes({
+      path: "/api/v1/auth/login/admin/mfa",
+      methods: [aws_apigatewayv2.HttpMethod.POST],
+      integration: new cdk.aws_apigatewayv2_integrations.HttpLambdaIntegration(
+        "LoginAdminMfaIntegration",
+        loginAdminMfaLambda,
+      ),
+    });
+
+    this.gateway.addRoutes({
+      path: "/api/v1/auth/totp/enroll",
+      methods: [aws_apigatewayv2.HttpMethod.POST],
+      integration: new cdk.aws_apigatewayv2_integrations.HttpLambdaIntegration(
+        "EnrollTotpIntegration",
+        enrollTotpLambda,
+      ),
+      authorizer,
+    });
+
+    this.gateway.addRoutes({
+      path: "/api/v1/auth/totp/verify",
+      methods: [aws_apigatewayv2.HttpMethod.POST],
+      integration: new cdk.aws_apigatewayv2_integrations.HttpLambdaIntegration(
+        "VerifyTotpIntegration",
+        verifyTotpLambda,
+      ),
+      authorizer,
+    });
+
+    this.gateway.addRoutes({
+      path: "/api/v1/auth/api-keys",
+      methods: [aws_apigatewayv2.HttpMethod.POST],
+      integration: new cdk.aws_apigatewayv2_integrations.HttpLambdaIntegration(
+        "CreateApiKeyIntegration",
+        createApiKeyLambda,
+      ),
+      authorizer,
+    });
+
+    this.gateway.addRoutes({
+      path: "/api/v1/auth/api-keys",
+      methods: [aws_apigatewayv2.HttpMethod.GET],
+      integration: new cdk.aws_apigatewayv2_integrations.HttpLambdaIntegration(
+        "GetAllApiKeysIntegration",
+        getAllApiKeysLambda,
+      ),
+      authorizer,
+    });
+
+    this.gateway.addRoutes({
+      path: "/api/v1/auth/api-keys/{key_id}",
+      methods: [aws_apigatewayv2.HttpMethod.DELETE],
+      integration: new cdk.aws_apigatewayv2_integrations.HttpLambdaIntegration(
+        "RevokeApiKeyIntegration",
+        revokeApiKeyLambda,
+      ),
+      authorizer,
+    });
+
+    this.gateway.addRoutes({
+      path: "/api/v1/auth/oidc/authorize",
+      methods: [aws_apigatewayv2.HttpMethod.GET],
+      integration: new cdk.aws_apigatewayv2_integrations.HttpLambdaIntegration(
+        "OidcAuthorizeIntegration",
+        oidcAuthorizeLambda,
+      ),
+    });
+
+    this.gateway.addRoutes({
+      path: "/api/v1/auth/oidc/callback",
+      methods: [aws_apigatewayv2.HttpMethod.POST],
+      integration: new cdk.aws_apigatewayv2_integrations.HttpLambdaIntegration(
+        "OidcCallbackIntegration",
+        oidcCallbackLambda,
+      ),
+    });
+
+    this.gateway.addRoutes({
+      path: "/api/v1/audit",
+      methods: [aws_apigatewayv2.HttpMethod.GET],
+      integration: new cdk.aws_apigatewayv2_integrations.HttpLambdaIntegration(
+        "GetAuditEntriesIntegration",
+        getAuditEntriesLambda,
+      ),
+      authorizer,
+    });
+
+    this.gateway.addRoutes({
+      path: "/api/v1/posts/trash",
+      methods: [aws_apigatewayv2.HttpMethod.GET],
+      integration: new cdk.aws_apigatewayv2_integrations.HttpLambdaIntegration(
+        "GetDeletedPostsIntegration",
+        getDeletedPostsLambda,
+      ),
+      authorizer,
+    });
+
+    this.gateway.addRoutes({
+      path: "/api/v1/posts/{post_id}/restore",
+      methods: [aws_apigatewayv2.HttpMethod.POST],
+      integration: new cdk.aws_apigatewayv2_integrations.HttpLambdaIntegration(
+        "RestorePostIntegration",
+        restorePostLambda,
+      ),
+      authorizer,
+    });
+
+    this.gateway.addRoutes({
+      path: "/api/v1/posts/{post_id}/purge",
+      methods: [aws_apigatewayv2.HttpMethod.DELETE],
+      integration: new cdk.aws_apigatewayv2_integrations.HttpLambdaIntegration(
+        "PurgePostIntegration",
+        purgePostLambda,
+      ),
+      authorizer,
+    });
+
+    this.gateway.addRoutes({
+      path: "/api/v1/posts/sync",
+      methods: [aws_apigatewayv2.HttpMethod.POST],
+      integration: new cdk.aws_apigatewayv2_integrations.HttpLambdaIntegration(
+        "SyncPostsIntegration",
+        syncPostsLambda,
+      ),
+      authorizer,
+    });
+
+    this.gateway.addRoutes({
+      path: "/openapi.json",
+      methods: [aws_apigatewayv2.HttpMethod.GET],
+      integration: new cdk.aws_apigatewayv2_integrations.HttpLambdaIntegration(
+        "GetOpenApiDocumentIntegration",
+        getOpenApiDocumentLambda,
+      ),
+    });
   }
 }
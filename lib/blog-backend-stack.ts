@@ -1,19 +1,26 @@
 import * as cdk from "aws-cdk-lib";
 import * as s3 from "aws-cdk-lib/aws-s3";
 import * as dynamodb from "aws-cdk-lib/aws-dynamodb";
+import * as lambda from "aws-cdk-lib/aws-lambda";
 import * as authorizers from "aws-cdk-lib/aws-apigatewayv2-authorizers";
 import { Construct } from "constructs";
 import { LambdaFactory, ProjectLambdas } from "./lambda/LambdaFactory";
 import { APIGatewayFactory } from "./apigateway/APIGatewayFactory";
 import { S3Factory } from "./s3/S3Factory";
 import { DynamoDBFactory } from "./dynamodb/DynamoDBFactory";
+import { EventsFactory } from "./events/EventsFactory";
+import { SecretsFactory } from "./secrets/SecretsFactory";
 
 export class BlogBackendStack extends cdk.Stack {
   public authorizer: authorizers.HttpLambdaAuthorizer;
+  public authorizerFunction: lambda.Function;
   public lambdas: ProjectLambdas;
   public bucket: s3.Bucket;
   public postTable: dynamodb.TableV2;
   public authTable: dynamodb.TableV2;
+  public apiKeyTable: dynamodb.TableV2;
+  public auditLogTable: dynamodb.TableV2;
+  public idempotencyTable: dynamodb.TableV2;
 
   constructor(scope: Construct, id: string, props?: cdk.StackProps) {
     super(scope, id, props);
@@ -26,23 +33,35 @@ export class BlogBackendStack extends cdk.Stack {
     const dynamodbFactory = new DynamoDBFactory(this);
     this.postTable = dynamodbFactory.getPostTable();
     this.authTable = dynamodbFactory.getAuthTable();
+    this.apiKeyTable = dynamodbFactory.getApiKeyTable();
+    this.auditLogTable = dynamodbFactory.getAuditLogTable();
+    this.idempotencyTable = dynamodbFactory.getIdempotencyTable();
+
+    // Secrets Manager for signing keys
+    const secretsFactory = new SecretsFactory(this);
 
     // Lambdas for API functionality
     const lambdaFactory = new LambdaFactory(this);
     this.authorizer = lambdaFactory.getAuthorizer();
+    this.authorizerFunction = lambdaFactory.getAuthorizerFunction();
     this.lambdas = lambdaFactory.getLambdas();
 
     // API Gateway for exposing lambdas
     new APIGatewayFactory(this);
 
+    // EventBridge rules for scheduled jobs
+    new EventsFactory(this);
+
     this.grantPermissions({
       s3Factory: s3Factory,
       dynamodbFactory: dynamodbFactory,
+      secretsFactory: secretsFactory,
     });
   }
 
   private grantPermissions(factories: { [key: string]: any }): void {
     factories["s3Factory"].grantPermissions();
     factories["dynamodbFactory"].grantPermissions();
+    factories["secretsFactory"].grantPermissions();
   }
 }
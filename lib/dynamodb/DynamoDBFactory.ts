@@ -6,11 +6,17 @@ export class DynamoDBFactory {
   private stack: BlogBackendStack;
   private postTable: dynamodb.TableV2;
   private authTable: dynamodb.TableV2;
+  private apiKeyTable: dynamodb.TableV2;
+  private auditLogTable: dynamodb.TableV2;
+  private idempotencyTable: dynamodb.TableV2;
 
   constructor(stack: BlogBackendStack) {
     this.stack = stack;
     this.postTable = this.makePostTable();
     this.authTable = this.makeAuthTable();
+    this.apiKeyTable = this.makeApiKeyTable();
+    this.auditLogTable = this.makeAuditLogTable();
+    this.idempotencyTable = this.makeIdempotencyTable();
 
     this.makeCfnOutputs();
   }
@@ -20,7 +26,8 @@ export class DynamoDBFactory {
       tableName: `${this.stack.stackName}-PostMetadataTable`,
       partitionKey: { name: "id", type: dynamodb.AttributeType.STRING },
       sortKey: { name: "createdAt", type: dynamodb.AttributeType.NUMBER },
-      removalPolicy: cdk.RemovalPolicy.DESTROY,
+      // Deleting the stack must not take the posts with it
+      removalPolicy: cdk.RemovalPolicy.RETAIN,
     });
   }
 
@@ -29,6 +36,42 @@ export class DynamoDBFactory {
       tableName: `${this.stack.stackName}-AuthTable`,
       partitionKey: { name: "username", type: dynamodb.AttributeType.STRING },
       sortKey: { name: "modifiedAt", type: dynamodb.AttributeType.NUMBER },
+      removalPolicy: cdk.RemovalPolicy.RETAIN,
+    });
+  }
+
+  private makeApiKeyTable(): dynamodb.TableV2 {
+    return new dynamodb.TableV2(this.stack, "ApiKeyTable", {
+      tableName: `${this.stack.stackName}-ApiKeyTable`,
+      partitionKey: { name: "id", type: dynamodb.AttributeType.STRING },
+      removalPolicy: cdk.RemovalPolicy.RETAIN,
+    });
+  }
+
+  private makeAuditLogTable(): dynamodb.TableV2 {
+    return new dynamodb.TableV2(this.stack, "AuditLogTable", {
+      tableName: `${this.stack.stackName}-AuditLogTable`,
+      partitionKey: { name: "actor", type: dynamodb.AttributeType.STRING },
+      sortKey: { name: "sortKey", type: dynamodb.AttributeType.STRING },
+      globalSecondaryIndexes: [
+        {
+          indexName: "TargetIndex",
+          partitionKey: {
+            name: "targetId",
+            type: dynamodb.AttributeType.STRING,
+          },
+          sortKey: { name: "sortKey", type: dynamodb.AttributeType.STRING },
+        },
+      ],
+      removalPolicy: cdk.RemovalPolicy.RETAIN,
+    });
+  }
+
+  private makeIdempotencyTable(): dynamodb.TableV2 {
+    return new dynamodb.TableV2(this.stack, "IdempotencyTable", {
+      tableName: `${this.stack.stackName}-IdempotencyTable`,
+      partitionKey: { name: "key", type: dynamodb.AttributeType.STRING },
+      timeToLiveAttribute: "expiresAt",
       removalPolicy: cdk.RemovalPolicy.DESTROY,
     });
   }
@@ -54,6 +97,20 @@ export class DynamoDBFactory {
       getAllPostsLambda,
       deletePostLambda,
       loginAdminLambda,
+      loginAdminMfaLambda,
+      enrollTotpLambda,
+      verifyTotpLambda,
+      createApiKeyLambda,
+      getAllApiKeysLambda,
+      revokeApiKeyLambda,
+      oidcCallbackLambda,
+      getAuditEntriesLambda,
+      getDeletedPostsLambda,
+      restorePostLambda,
+      purgePostLambda,
+      syncPostsLambda,
+      purgeTrashJobLambda,
+      exportSiteJobLambda,
     } = this.stack.lambdas;
 
     this.postTable.grantWriteData(createPostLambda);
@@ -64,7 +121,44 @@ export class DynamoDBFactory {
     this.postTable.grantReadWriteData(updatePostLambda);
     this.postTable.grantReadWriteData(deletePostLambda);
 
+    this.postTable.grantReadData(getDeletedPostsLambda);
+    this.postTable.grantReadWriteData(restorePostLambda);
+    this.postTable.grantReadWriteData(purgePostLambda);
+    this.postTable.grantReadWriteData(purgeTrashJobLambda);
+    this.postTable.grantReadWriteData(syncPostsLambda);
+    this.postTable.grantReadData(exportSiteJobLambda);
+
     this.authTable.grantReadData(loginAdminLambda);
+    this.authTable.grantReadWriteData(loginAdminMfaLambda);
+    this.authTable.grantReadWriteData(enrollTotpLambda);
+    this.authTable.grantReadWriteData(verifyTotpLambda);
+
+    this.apiKeyTable.grantWriteData(createApiKeyLambda);
+    this.apiKeyTable.grantReadData(getAllApiKeysLambda);
+    this.apiKeyTable.grantReadWriteData(revokeApiKeyLambda);
+    this.apiKeyTable.grantReadWriteData(this.stack.authorizerFunction);
+
+    // The audit log is append-only, so writers only get PutItem
+    [
+      createPostLambda,
+      updatePostLambda,
+      deletePostLambda,
+      loginAdminLambda,
+      loginAdminMfaLambda,
+      enrollTotpLambda,
+      verifyTotpLambda,
+      createApiKeyLambda,
+      revokeApiKeyLambda,
+      oidcCallbackLambda,
+      restorePostLambda,
+      purgePostLambda,
+      purgeTrashJobLambda,
+      syncPostsLambda,
+    ].forEach((fn) => this.auditLogTable.grant(fn, "dynamodb:PutItem"));
+
+    this.auditLogTable.grantReadData(getAuditEntriesLambda);
+
+    this.idempotencyTable.grantReadWriteData(createPostLambda);
   }
 
   public getPostTable(): dynamodb.TableV2 {
@@ -74,4 +168,16 @@ export class DynamoDBFactory {
   public getAuthTable(): dynamodb.TableV2 {
     return this.authTable;
   }
+
+  public getApiKeyTable(): dynamodb.TableV2 {
+    return this.apiKeyTable;
+  }
+
+  public getAuditLogTable(): dynamodb.TableV2 {
+    return this.auditLogTable;
+  }
+
+  public getIdempotencyTable(): dynamodb.TableV2 {
+    return this.idempotencyTable;
+  }
 }
@@ -0,0 +1,35 @@
+import * as cdk from "aws-cdk-lib";
+import * as events from "aws-cdk-lib/aws-events";
+import * as targets from "aws-cdk-lib/aws-events-targets";
+import { BlogBackendStack } from "../blog-backend-stack";
+
+export class EventsFactory {
+  private stack: BlogBackendStack;
+
+  constructor(stack: BlogBackendStack) {
+    this.stack = stack;
+
+    this.makePurgeTrashRule();
+    this.makeExportSiteRule();
+  }
+
+  private makePurgeTrashRule(): events.Rule {
+    const { purgeTrashJobLambda } = this.stack.lambdas;
+
+    return new events.Rule(this.stack, "PurgeTrashRule", {
+      ruleName: `${this.stack.stackName}-PurgeTrash`,
+      schedule: events.Schedule.rate(cdk.Duration.days(1)),
+      targets: [new targets.LambdaFunction(purgeTrashJobLambda)],
+    });
+  }
+
+  private makeExportSiteRule(): events.Rule {
+    const { exportSiteJobLambda } = this.stack.lambdas;
+
+    return new events.Rule(this.stack, "ExportSiteRule", {
+      ruleName: `${this.stack.stackName}-ExportSite`,
+      schedule: events.Schedule.rate(cdk.Duration.hours(1)),
+      targets: [new targets.LambdaFunction(exportSiteJobLambda)],
+    });
+  }
+}
@@ -1,44 +1,117 @@
 import * as cdk from "aws-cdk-lib";
 import * as lambda from "aws-cdk-lib/aws-lambda";
+import * as iam from "aws-cdk-lib/aws-iam";
 import * as authorizers from "aws-cdk-lib/aws-apigatewayv2-authorizers";
 import { BlogBackendStack } from "../blog-backend-stack";
 
 export class LambdaFactory {
   private stack: BlogBackendStack;
   private authorizer: authorizers.HttpLambdaAuthorizer;
+  private authorizerFunction: lambda.Function;
   private lambdas: ProjectLambdas;
 
   constructor(stack: BlogBackendStack) {
     this.stack = stack;
-    this.authorizer = this.makeAuthorizerLambda();
-
-    this.lambdas = {
-      createPostLambda: this.makeCreatePostLambda(),
-      updatePostLambda: this.makeUpdatePostLambda(),
-      getPostByIdLambda: this.makeGetPostByIdLambda(),
-      getAllPostsLambda: this.makeGetAllPostsLambda(),
-      deletePostLambda: this.makeDeletePostLambda(),
-      loginAdminLambda: this.makeLoginAdminLambda(),
+    this.authorizerFunction = this.makeAuthorizerFunction();
+    this.authorizer = this.makeAuthorizer();
+
+    const apiLambdaFactories: { [key: string]: () => lambda.Function } = {
+      createPostLambda: () => this.makeCreatePostLambda(),
+      updatePostLambda: () => this.makeUpdatePostLambda(),
+      getPostByIdLambda: () => this.makeGetPostByIdLambda(),
+      getAllPostsLambda: () => this.makeGetAllPostsLambda(),
+      deletePostLambda: () => this.makeDeletePostLambda(),
+      loginAdminLambda: () => this.makeLoginAdminLambda(),
+      loginAdminMfaLambda: () => this.makeLoginAdminMfaLambda(),
+      enrollTotpLambda: () => this.makeEnrollTotpLambda(),
+      verifyTotpLambda: () => this.makeVerifyTotpLambda(),
+      createApiKeyLambda: () => this.makeCreateApiKeyLambda(),
+      getAllApiKeysLambda: () => this.makeGetAllApiKeysLambda(),
+      revokeApiKeyLambda: () => this.makeRevokeApiKeyLambda(),
+      oidcAuthorizeLambda: () => this.makeOidcAuthorizeLambda(),
+      oidcCallbackLambda: () => this.makeOidcCallbackLambda(),
+      getAuditEntriesLambda: () => this.makeGetAuditEntriesLambda(),
+      getDeletedPostsLambda: () => this.makeGetDeletedPostsLambda(),
+      restorePostLambda: () => this.makeRestorePostLambda(),
+      purgePostLambda: () => this.makePurgePostLambda(),
+      syncPostsLambda: () => this.makeSyncPostsLambda(),
+      getOpenApiDocumentLambda: () => this.makeGetOpenApiDocumentLambda(),
     };
+
+    // With -c singleFunction=true every route is served by one Router
+    // function, so small deployments share warm clients across routes
+    const singleFunction = this.stack.node.tryGetContext("singleFunction");
+    const router =
+      singleFunction === true || singleFunction === "true"
+        ? this.makeRouterLambda()
+        : undefined;
+
+    this.lambdas = {};
+    for (const [name, makeLambda] of Object.entries(apiLambdaFactories)) {
+      this.lambdas[name] = router ?? makeLambda();
+    }
+    this.lambdas.purgeTrashJobLambda = this.makePurgeTrashJobLambda();
+    this.lambdas.exportSiteJobLambda = this.makeExportSiteJobLambda();
+
+    // Handlers echo CORS headers themselves, matching the gateway's config
+    const allowedOrigins = cdk.Fn.join(",", [
+      "http://localhost:3000",
+      cdk.Fn.importValue("BlogFrontendStack-BlogURL"),
+    ]);
+    new Set(Object.values(this.lambdas)).forEach((fn) =>
+      fn.addEnvironment("CORS_ALLOWED_ORIGINS", allowedOrigins),
+    );
+
+    // With -c configSsmPath=/blog/prod settings may also be kept in SSM
+    const configSsmPath = this.stack.node.tryGetContext("configSsmPath");
+    if (configSsmPath) {
+      this.grantConfigParameters(configSsmPath);
+    }
+  }
+
+  private grantConfigParameters(path: string): void {
+    const parameterArn = this.stack.formatArn({
+      service: "ssm",
+      resource: "parameter",
+      resourceName: `${path.replace(/^\/|\/$/g, "")}/*`,
+    });
+
+    new Set([this.authorizerFunction, ...Object.values(this.lambdas)]).forEach(
+      (fn) => {
+        fn.addEnvironment("CONFIG_SSM_PATH", path);
+        fn.addToRolePolicy(
+          new iam.PolicyStatement({
+            actions: ["ssm:GetParametersByPath"],
+            resources: [parameterArn],
+          }),
+        );
+      },
+    );
   }
 
-  private makeAuthorizerLambda(): authorizers.HttpLambdaAuthorizer {
-    const lambdaFn = new lambda.Function(this.stack, "AuthorizerFunction", {
+  private makeAuthorizerFunction(): lambda.Function {
+    return new lambda.Function(this.stack, "AuthorizerFunction", {
       functionName: `${this.stack.stackName}-Authorizer`,
       runtime: lambda.Runtime.PROVIDED_AL2023,
       timeout: cdk.Duration.seconds(30),
       handler: "main",
       code: lambda.Code.fromAsset("src/api/auth/authorizer/build"),
       environment: {
-        JWT_SECRET: process.env.JWT_SECRET || "",
+        API_KEY_TABLE_NAME: this.stack.apiKeyTable.tableName,
       },
     });
+  }
 
+  private makeAuthorizer(): authorizers.HttpLambdaAuthorizer {
     return new authorizers.HttpLambdaAuthorizer(
       "BlogLambdaAuthorizer",
-      lambdaFn,
+      this.authorizerFunction,
       {
         responseTypes: [authorizers.HttpLambdaResponseType.SIMPLE],
+        // Requests may authenticate with either Authorization or X-API-Key,
+        // so neither header can be a required identity source
+        identitySource: [],
+        resultsCacheTtl: cdk.Duration.seconds(0),
       },
     );
   }
@@ -53,6 +126,8 @@ export class LambdaFactory {
       environment: {
         S3_BUCKET_NAME: this.stack.bucket.bucketName,
         POST_METADATA_TABLE_NAME: this.stack.postTable.tableName,
+        AUDIT_LOG_TABLE_NAME: this.stack.auditLogTable.tableName,
+        IDEMPOTENCY_TABLE_NAME: this.stack.idempotencyTable.tableName,
       },
     });
   }
@@ -67,6 +142,7 @@ export class LambdaFactory {
       environment: {
         S3_BUCKET_NAME: this.stack.bucket.bucketName,
         POST_METADATA_TABLE_NAME: this.stack.postTable.tableName,
+        AUDIT_LOG_TABLE_NAME: this.stack.auditLogTable.tableName,
       },
     });
   }
@@ -81,6 +157,8 @@ export class LambdaFactory {
       environment: {
         S3_BUCKET_NAME: this.stack.bucket.bucketName,
         S3_URL_EXPIRY_SECONDS: "3600",
+        CACHE_MAX_AGE_SECONDS: "300",
+        INLINE_CONTENT_MAX_BYTES: "524288",
         POST_METADATA_TABLE_NAME: this.stack.postTable.tableName,
       },
     });
@@ -96,6 +174,7 @@ export class LambdaFactory {
       environment: {
         POST_METADATA_TABLE_NAME: this.stack.postTable.tableName,
         DEFAULT_PAGE_SIZE: "20",
+        CACHE_MAX_AGE_SECONDS: "60",
       },
     });
   }
@@ -109,6 +188,7 @@ export class LambdaFactory {
       handler: "bootstrap",
       environment: {
         POST_METADATA_TABLE_NAME: this.stack.postTable.tableName,
+        AUDIT_LOG_TABLE_NAME: this.stack.auditLogTable.tableName,
       },
     });
   }
@@ -122,7 +202,274 @@ export class LambdaFactory {
       handler: "bootstrap",
       environment: {
         AUTH_TABLE_NAME: this.stack.authTable.tableName,
-        JWT_SECRET: process.env.JWT_SECRET || "",
+        AUDIT_LOG_TABLE_NAME: this.stack.auditLogTable.tableName,
+      },
+    });
+  }
+
+  private makeLoginAdminMfaLambda(): lambda.Function {
+    return new lambda.Function(this.stack, "LoginAdminMfa", {
+      functionName: `${this.stack.stackName}-LoginAdminMfa`,
+      runtime: lambda.Runtime.PROVIDED_AL2023,
+      timeout: cdk.Duration.seconds(30),
+      code: lambda.Code.fromAsset("src/api/auth/login/mfa/build"),
+      handler: "bootstrap",
+      environment: {
+        AUTH_TABLE_NAME: this.stack.authTable.tableName,
+        AUDIT_LOG_TABLE_NAME: this.stack.auditLogTable.tableName,
+      },
+    });
+  }
+
+  private makeEnrollTotpLambda(): lambda.Function {
+    return new lambda.Function(this.stack, "EnrollTotp", {
+      functionName: `${this.stack.stackName}-EnrollTotp`,
+      runtime: lambda.Runtime.PROVIDED_AL2023,
+      timeout: cdk.Duration.seconds(30),
+      code: lambda.Code.fromAsset("src/api/auth/totp/enroll/build"),
+      handler: "bootstrap",
+      environment: {
+        AUTH_TABLE_NAME: this.stack.authTable.tableName,
+        AUDIT_LOG_TABLE_NAME: this.stack.auditLogTable.tableName,
+      },
+    });
+  }
+
+  private makeVerifyTotpLambda(): lambda.Function {
+    return new lambda.Function(this.stack, "VerifyTotp", {
+      functionName: `${this.stack.stackName}-VerifyTotp`,
+      runtime: lambda.Runtime.PROVIDED_AL2023,
+      timeout: cdk.Duration.seconds(30),
+      code: lambda.Code.fromAsset("src/api/auth/totp/verify/build"),
+      handler: "bootstrap",
+      environment: {
+        AUTH_TABLE_NAME: this.stack.authTable.tableName,
+        AUDIT_LOG_TABLE_NAME: this.stack.auditLogTable.tableName,
+      },
+    });
+  }
+
+  private makeCreateApiKeyLambda(): lambda.Function {
+    return new lambda.Function(this.stack, "CreateApiKey", {
+      functionName: `${this.stack.stackName}-CreateApiKey`,
+      runtime: lambda.Runtime.PROVIDED_AL2023,
+      timeout: cdk.Duration.seconds(30),
+      code: lambda.Code.fromAsset("src/api/auth/apikeys/create/build"),
+      handler: "bootstrap",
+      environment: {
+        API_KEY_TABLE_NAME: this.stack.apiKeyTable.tableName,
+        AUDIT_LOG_TABLE_NAME: this.stack.auditLogTable.tableName,
+      },
+    });
+  }
+
+  private makeGetAllApiKeysLambda(): lambda.Function {
+    return new lambda.Function(this.stack, "GetAllApiKeys", {
+      functionName: `${this.stack.stackName}-GetAllApiKeys`,
+      runtime: lambda.Runtime.PROVIDED_AL2023,
+      timeout: cdk.Duration.seconds(30),
+      code: lambda.Code.fromAsset("src/api/auth/apikeys/getall/build"),
+      handler: "bootstrap",
+      environment: {
+        API_KEY_TABLE_NAME: this.stack.apiKeyTable.tableName,
+      },
+    });
+  }
+
+  private makeRevokeApiKeyLambda(): lambda.Function {
+    return new lambda.Function(this.stack, "RevokeApiKey", {
+      functionName: `${this.stack.stackName}-RevokeApiKey`,
+      runtime: lambda.Runtime.PROVIDED_AL2023,
+      timeout: cdk.Duration.seconds(30),
+      code: lambda.Code.fromAsset("src/api/auth/apikeys/revoke/build"),
+      handler: "bootstrap",
+      environment: {
+        API_KEY_TABLE_NAME: this.stack.apiKeyTable.tableName,
+        AUDIT_LOG_TABLE_NAME: this.stack.auditLogTable.tableName,
+      },
+    });
+  }
+
+  private makeOidcAuthorizeLambda(): lambda.Function {
+    return new lambda.Function(this.stack, "OidcAuthorize", {
+      functionName: `${this.stack.stackName}-OidcAuthorize`,
+      runtime: lambda.Runtime.PROVIDED_AL2023,
+      timeout: cdk.Duration.seconds(30),
+      code: lambda.Code.fromAsset("src/api/auth/oidc/authorize/build"),
+      handler: "bootstrap",
+      environment: {
+        OIDC_ISSUER_URL: process.env.OIDC_ISSUER_URL || "",
+        OIDC_CLIENT_ID: process.env.OIDC_CLIENT_ID || "",
+        OIDC_REDIRECT_URI: process.env.OIDC_REDIRECT_URI || "",
+      },
+    });
+  }
+
+  private makeOidcCallbackLambda(): lambda.Function {
+    return new lambda.Function(this.stack, "OidcCallback", {
+      functionName: `${this.stack.stackName}-OidcCallback`,
+      runtime: lambda.Runtime.PROVIDED_AL2023,
+      timeout: cdk.Duration.seconds(30),
+      code: lambda.Code.fromAsset("src/api/auth/oidc/callback/build"),
+      handler: "bootstrap",
+      environment: {
+        OIDC_ISSUER_URL: process.env.OIDC_ISSUER_URL || "",
+        OIDC_CLIENT_ID: process.env.OIDC_CLIENT_ID || "",
+        OIDC_REDIRECT_URI: process.env.OIDC_REDIRECT_URI || "",
+        OIDC_ADMIN_EMAILS: process.env.OIDC_ADMIN_EMAILS || "",
+        OIDC_ADMIN_GROUPS: process.env.OIDC_ADMIN_GROUPS || "",
+        OIDC_GROUPS_CLAIM: process.env.OIDC_GROUPS_CLAIM || "groups",
+        AUDIT_LOG_TABLE_NAME: this.stack.auditLogTable.tableName,
+      },
+    });
+  }
+
+  private makeGetAuditEntriesLambda(): lambda.Function {
+    return new lambda.Function(this.stack, "GetAuditEntries", {
+      functionName: `${this.stack.stackName}-GetAuditEntries`,
+      runtime: lambda.Runtime.PROVIDED_AL2023,
+      timeout: cdk.Duration.seconds(30),
+      code: lambda.Code.fromAsset("src/api/audit/getall/build"),
+      handler: "bootstrap",
+      environment: {
+        AUDIT_LOG_TABLE_NAME: this.stack.auditLogTable.tableName,
+        DEFAULT_PAGE_SIZE: "50",
+      },
+    });
+  }
+
+  private makeGetDeletedPostsLambda(): lambda.Function {
+    return new lambda.Function(this.stack, "GetDeletedPosts", {
+      functionName: `${this.stack.stackName}-GetDeletedPosts`,
+      runtime: lambda.Runtime.PROVIDED_AL2023,
+      timeout: cdk.Duration.seconds(30),
+      code: lambda.Code.fromAsset("src/api/post/trash/build"),
+      handler: "bootstrap",
+      environment: {
+        POST_METADATA_TABLE_NAME: this.stack.postTable.tableName,
+        DEFAULT_PAGE_SIZE: "20",
+      },
+    });
+  }
+
+  private makeRestorePostLambda(): lambda.Function {
+    return new lambda.Function(this.stack, "RestorePost", {
+      functionName: `${this.stack.stackName}-RestorePost`,
+      runtime: lambda.Runtime.PROVIDED_AL2023,
+      timeout: cdk.Duration.seconds(30),
+      code: lambda.Code.fromAsset("src/api/post/restore/build"),
+      handler: "bootstrap",
+      environment: {
+        POST_METADATA_TABLE_NAME: this.stack.postTable.tableName,
+        AUDIT_LOG_TABLE_NAME: this.stack.auditLogTable.tableName,
+      },
+    });
+  }
+
+  private makePurgePostLambda(): lambda.Function {
+    return new lambda.Function(this.stack, "PurgePost", {
+      functionName: `${this.stack.stackName}-PurgePost`,
+      runtime: lambda.Runtime.PROVIDED_AL2023,
+      timeout: cdk.Duration.seconds(30),
+      code: lambda.Code.fromAsset("src/api/post/purge/build"),
+      handler: "bootstrap",
+      environment: {
+        S3_BUCKET_NAME: this.stack.bucket.bucketName,
+        POST_METADATA_TABLE_NAME: this.stack.postTable.tableName,
+        AUDIT_LOG_TABLE_NAME: this.stack.auditLogTable.tableName,
+      },
+    });
+  }
+
+  private makeSyncPostsLambda(): lambda.Function {
+    return new lambda.Function(this.stack, "SyncPosts", {
+      functionName: `${this.stack.stackName}-SyncPosts`,
+      runtime: lambda.Runtime.PROVIDED_AL2023,
+      // The HTTP API gives up after 30 seconds, so larger trees are better
+      // synced with the contentsync command
+      timeout: cdk.Duration.seconds(30),
+      code: lambda.Code.fromAsset("src/api/post/sync/build"),
+      handler: "bootstrap",
+      environment: {
+        S3_BUCKET_NAME: this.stack.bucket.bucketName,
+        POST_METADATA_TABLE_NAME: this.stack.postTable.tableName,
+        AUDIT_LOG_TABLE_NAME: this.stack.auditLogTable.tableName,
+      },
+    });
+  }
+
+  private makeGetOpenApiDocumentLambda(): lambda.Function {
+    return new lambda.Function(this.stack, "GetOpenApiDocument", {
+      functionName: `${this.stack.stackName}-GetOpenApiDocument`,
+      runtime: lambda.Runtime.PROVIDED_AL2023,
+      timeout: cdk.Duration.seconds(30),
+      code: lambda.Code.fromAsset("src/api/openapi/build"),
+      handler: "bootstrap",
+    });
+  }
+
+  private makeRouterLambda(): lambda.Function {
+    return new lambda.Function(this.stack, "Router", {
+      functionName: `${this.stack.stackName}-Router`,
+      runtime: lambda.Runtime.PROVIDED_AL2023,
+      timeout: cdk.Duration.seconds(30),
+      code: lambda.Code.fromAsset("src/api/router/build"),
+      handler: "bootstrap",
+      environment: {
+        S3_BUCKET_NAME: this.stack.bucket.bucketName,
+        S3_URL_EXPIRY_SECONDS: "3600",
+        POST_METADATA_TABLE_NAME: this.stack.postTable.tableName,
+        AUTH_TABLE_NAME: this.stack.authTable.tableName,
+        API_KEY_TABLE_NAME: this.stack.apiKeyTable.tableName,
+        AUDIT_LOG_TABLE_NAME: this.stack.auditLogTable.tableName,
+        IDEMPOTENCY_TABLE_NAME: this.stack.idempotencyTable.tableName,
+        // Shared by every route, so use the shorter listing cache lifetime
+        CACHE_MAX_AGE_SECONDS: "60",
+        INLINE_CONTENT_MAX_BYTES: "524288",
+        DEFAULT_PAGE_SIZE: "20",
+        OIDC_ISSUER_URL: process.env.OIDC_ISSUER_URL || "",
+        OIDC_CLIENT_ID: process.env.OIDC_CLIENT_ID || "",
+        OIDC_REDIRECT_URI: process.env.OIDC_REDIRECT_URI || "",
+        OIDC_ADMIN_EMAILS: process.env.OIDC_ADMIN_EMAILS || "",
+        OIDC_ADMIN_GROUPS: process.env.OIDC_ADMIN_GROUPS || "",
+        OIDC_GROUPS_CLAIM: process.env.OIDC_GROUPS_CLAIM || "groups",
+      },
+    });
+  }
+
+  private makePurgeTrashJobLambda(): lambda.Function {
+    return new lambda.Function(this.stack, "PurgeTrashJob", {
+      functionName: `${this.stack.stackName}-PurgeTrashJob`,
+      runtime: lambda.Runtime.PROVIDED_AL2023,
+      timeout: cdk.Duration.seconds(30),
+      code: lambda.Code.fromAsset("src/jobs/post/purge/build"),
+      handler: "bootstrap",
+      environment: {
+        S3_BUCKET_NAME: this.stack.bucket.bucketName,
+        POST_METADATA_TABLE_NAME: this.stack.postTable.tableName,
+        AUDIT_LOG_TABLE_NAME: this.stack.auditLogTable.tableName,
+        TRASH_RETENTION_DAYS: "30",
+      },
+    });
+  }
+
+  private makeExportSiteJobLambda(): lambda.Function {
+    return new lambda.Function(this.stack, "ExportSiteJob", {
+      functionName: `${this.stack.stackName}-ExportSiteJob`,
+      runtime: lambda.Runtime.PROVIDED_AL2023,
+      timeout: cdk.Duration.minutes(5),
+      code: lambda.Code.fromAsset("src/jobs/site/export/build"),
+      handler: "bootstrap",
+      environment: {
+        S3_BUCKET_NAME: this.stack.bucket.bucketName,
+        POST_METADATA_TABLE_NAME: this.stack.postTable.tableName,
+        DEFAULT_PAGE_SIZE: "20",
+        // The mirror stands in for the frontend, so it links to the same URL
+        SITE_URL:
+          process.env.SITE_URL ||
+          cdk.Fn.importValue("BlogFrontendStack-BlogURL"),
+        SITE_TITLE: process.env.SITE_TITLE || "",
+        SITE_EXPORT_PREFIX: SITE_EXPORT_PREFIX,
       },
     });
   }
@@ -134,8 +481,15 @@ export class LambdaFactory {
   public getAuthorizer(): authorizers.HttpLambdaAuthorizer {
     return this.authorizer;
   }
+
+  public getAuthorizerFunction(): lambda.Function {
+    return this.authorizerFunction;
+  }
 }
 
+// Where the static site export is written in the posts bucket
+export const SITE_EXPORT_PREFIX = "site/";
+
 export type ProjectLambdas = {
   [key: string]: lambda.Function;
 };
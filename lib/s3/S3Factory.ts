@@ -1,6 +1,7 @@
 import * as cdk from "aws-cdk-lib";
 import * as s3 from "aws-cdk-lib/aws-s3";
 import { BlogBackendStack } from "../blog-backend-stack";
+import { SITE_EXPORT_PREFIX } from "../lambda/LambdaFactory";
 
 export class S3Factory {
   private stack: BlogBackendStack;
@@ -17,6 +18,16 @@ export class S3Factory {
     return new s3.Bucket(this.stack, "PostsBucket", {
       bucketName: `${this.stack.stackName}-PostsBucket`.toLowerCase(),
       versioned: true,
+      lifecycleRules: [
+        {
+          // Each hourly export replaces pages; old versions of the mirror
+          // have no use beyond undoing a bad run
+          id: "ExpireOldSiteExports",
+          prefix: SITE_EXPORT_PREFIX,
+          noncurrentVersionExpiration: cdk.Duration.days(7),
+          expiredObjectDeleteMarker: true,
+        },
+      ],
       cors: [
         {
           allowedOrigins: [
@@ -41,13 +52,33 @@ export class S3Factory {
   }
 
   public grantPermissions(): void {
-    const { createPostLambda, updatePostLambda, getPostByIdLambda } =
-      this.stack.lambdas;
+    const {
+      createPostLambda,
+      updatePostLambda,
+      getPostByIdLambda,
+      purgePostLambda,
+      purgeTrashJobLambda,
+      syncPostsLambda,
+      exportSiteJobLambda,
+    } = this.stack.lambdas;
 
     this.bucket.grantWrite(createPostLambda);
     this.bucket.grantWrite(updatePostLambda);
 
     this.bucket.grantRead(getPostByIdLambda);
+
+    // Syncing reads the Markdown of posts saved before content hashes
+    this.bucket.grantReadWrite(syncPostsLambda);
+
+    // Purging removes every version of a post's objects
+    this.bucket.grantRead(purgePostLambda);
+    this.bucket.grantDelete(purgePostLambda);
+    this.bucket.grantRead(purgeTrashJobLambda);
+    this.bucket.grantDelete(purgeTrashJobLambda);
+
+    // The site export reads post HTML and replaces only its own prefix
+    this.bucket.grantRead(exportSiteJobLambda);
+    this.bucket.grantWrite(exportSiteJobLambda, `${SITE_EXPORT_PREFIX}*`);
   }
 
   public getBucket(): s3.Bucket {
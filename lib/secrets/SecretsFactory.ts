@@ -0,0 +1,80 @@
+import * as cdk from "aws-cdk-lib";
+import * as lambda from "aws-cdk-lib/aws-lambda";
+import * as secretsmanager from "aws-cdk-lib/aws-secretsmanager";
+import { BlogBackendStack } from "../blog-backend-stack";
+
+export class SecretsFactory {
+  private stack: BlogBackendStack;
+  private jwtSecret: secretsmanager.Secret;
+  private oidcClientSecret?: secretsmanager.Secret;
+
+  constructor(stack: BlogBackendStack) {
+    this.stack = stack;
+    this.jwtSecret = this.makeJwtSecret();
+    if (process.env.OIDC_ISSUER_URL) {
+      this.oidcClientSecret = this.makeOidcClientSecret();
+    }
+  }
+
+  private secretsPrefix(): string {
+    return `${this.stack.stackName}/`;
+  }
+
+  private makeJwtSecret(): secretsmanager.Secret {
+    return new secretsmanager.Secret(this.stack, "JwtSecret", {
+      secretName: `${this.secretsPrefix()}JWT_SECRET`,
+      description: "Signing key for access, MFA challenge and OIDC state tokens",
+      generateSecretString: {
+        passwordLength: 64,
+        excludePunctuation: true,
+      },
+      removalPolicy: cdk.RemovalPolicy.DESTROY,
+    });
+  }
+
+  // Created with a placeholder; the identity provider's client secret is put
+  // in after deploying, so it never passes through the deployer's shell
+  private makeOidcClientSecret(): secretsmanager.Secret {
+    return new secretsmanager.Secret(this.stack, "OidcClientSecret", {
+      secretName: `${this.secretsPrefix()}OIDC_CLIENT_SECRET`,
+      description: "Client secret issued by the OIDC identity provider",
+      generateSecretString: {
+        passwordLength: 64,
+        excludePunctuation: true,
+      },
+      removalPolicy: cdk.RemovalPolicy.DESTROY,
+    });
+  }
+
+  public grantPermissions(): void {
+    const {
+      loginAdminLambda,
+      loginAdminMfaLambda,
+      oidcAuthorizeLambda,
+      oidcCallbackLambda,
+    } = this.stack.lambdas;
+
+    const functions = new Set<lambda.Function>([
+      this.stack.authorizerFunction,
+      loginAdminLambda,
+      loginAdminMfaLambda,
+      oidcAuthorizeLambda,
+      oidcCallbackLambda,
+    ]);
+
+    // Functions read the secret at runtime and pick up rotations after
+    // SECRETS_CACHE_TTL_SECONDS, so it never lands in the environment
+    functions.forEach((fn) => {
+      this.jwtSecret.grantRead(fn);
+      fn.addEnvironment("SECRETS_PROVIDER", "secretsmanager");
+      fn.addEnvironment("SECRETS_PREFIX", this.secretsPrefix());
+    });
+
+    // Only the token exchange sends the client secret
+    this.oidcClientSecret?.grantRead(oidcCallbackLambda);
+  }
+
+  public getJwtSecret(): secretsmanager.Secret {
+    return this.jwtSecret;
+  }
+}
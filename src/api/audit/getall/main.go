@@ -0,0 +1,24 @@
+package main
+
+import (
+	"context"
+
+	"github.com/JaxonAdams/blog-backend/src/models"
+	"github.com/JaxonAdams/blog-backend/src/router"
+	"github.com/JaxonAdams/blog-backend/src/routes"
+	"github.com/JaxonAdams/blog-backend/src/services/aws/dynamodb"
+	"github.com/JaxonAdams/blog-backend/src/services/config"
+	"github.com/JaxonAdams/blog-backend/src/services/logging"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+func main() {
+	cfg := config.MustLoad(context.TODO(), config.AuditLogTableName)
+
+	services := models.HandlerServices{
+		Config:          cfg,
+		Logger:          logging.New(),
+		DynamoDBService: dynamodb.New(context.TODO(), cfg),
+	}
+	lambda.Start(router.New(services, []routes.Route{routes.GetAuditEntries}))
+}
@@ -2,22 +2,52 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"log/slog"
 	"strings"
 
+	"github.com/JaxonAdams/blog-backend/src/models"
+	apikeyservice "github.com/JaxonAdams/blog-backend/src/services/apikey"
+	"github.com/JaxonAdams/blog-backend/src/services/aws/dynamodb"
+	"github.com/JaxonAdams/blog-backend/src/services/config"
 	"github.com/JaxonAdams/blog-backend/src/services/jwt"
+	"github.com/JaxonAdams/blog-backend/src/services/logging"
+	"github.com/JaxonAdams/blog-backend/src/services/secrets"
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-lambda-go/lambda"
 )
 
-func createRequestHandler() func(ctx context.Context, request events.APIGatewayV2CustomAuthorizerV2Request) (events.APIGatewayV2CustomAuthorizerSimpleResponse, error) {
+func createRequestHandler(services models.HandlerServices) func(ctx context.Context, request events.APIGatewayV2CustomAuthorizerV2Request) (events.APIGatewayV2CustomAuthorizerSimpleResponse, error) {
 	return func(ctx context.Context, request events.APIGatewayV2CustomAuthorizerV2Request) (events.APIGatewayV2CustomAuthorizerSimpleResponse, error) {
+		logger := logging.ForInvocation(services.Logger, ctx).With(
+			slog.String("api_request_id", request.RequestContext.RequestID),
+			slog.String("route", request.RouteKey),
+		)
+
+		if apiKey := request.Headers["x-api-key"]; apiKey != "" {
+			key, err := apikeyservice.Authenticate(apiKey, services, ctx)
+			if err != nil {
+				logger.Warn("API key rejected", "error", err)
+				return unauthorized(), nil
+			}
+
+			return events.APIGatewayV2CustomAuthorizerSimpleResponse{
+				IsAuthorized: true,
+				Context: map[string]any{
+					"role":   "api_key",
+					"sub":    fmt.Sprintf("apikey:%s", key.ID),
+					"scopes": strings.Join(key.Scopes, " "),
+				},
+			}, nil
+		}
+
 		authHeader := request.Headers["authorization"]
 		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
 			return unauthorized(), nil
 		}
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
-		claims, err := jwt.ParseJWT(tokenString)
+		claims, err := services.JWT.ParseJWT(tokenString, ctx)
 		if err != nil {
 			return unauthorized(), err
 		}
@@ -39,6 +69,15 @@ func unauthorized() events.APIGatewayV2CustomAuthorizerSimpleResponse {
 }
 
 func main() {
-	handler := createRequestHandler()
+	cfg := config.MustLoad(context.TODO(), config.APIKeyTableName)
+	secretProvider := secrets.New(context.TODO(), cfg)
+
+	handler := createRequestHandler(models.HandlerServices{
+		Config:          cfg,
+		Secrets:         secretProvider,
+		JWT:             jwt.NewSigner(secretProvider),
+		Logger:          logging.New(),
+		DynamoDBService: dynamodb.New(context.TODO(), cfg),
+	})
 	lambda.Start(handler)
 }
@@ -2,41 +2,28 @@ package main
 
 import (
 	"context"
-	"errors"
 
-	"github.com/JaxonAdams/blog-backend/src/helpers"
 	"github.com/JaxonAdams/blog-backend/src/models"
+	"github.com/JaxonAdams/blog-backend/src/router"
+	"github.com/JaxonAdams/blog-backend/src/routes"
 	"github.com/JaxonAdams/blog-backend/src/services/aws/dynamodb"
-	loginservice "github.com/JaxonAdams/blog-backend/src/services/login"
-	"github.com/aws/aws-lambda-go/events"
+	"github.com/JaxonAdams/blog-backend/src/services/config"
+	"github.com/JaxonAdams/blog-backend/src/services/jwt"
+	"github.com/JaxonAdams/blog-backend/src/services/logging"
+	"github.com/JaxonAdams/blog-backend/src/services/secrets"
 	"github.com/aws/aws-lambda-go/lambda"
 )
 
-func createRequestHandler(services models.HandlerServices) func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-	return func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-		parsedRequest, err := helpers.ParseAdminLoginInput(request)
-		if err != nil {
-			return helpers.MakeErrorResponse(400, map[string]string{"message": err.Error()}), nil
-		}
-
-		token, err := loginservice.LogInAdmin(parsedRequest, services, ctx)
-		if err != nil {
-			var notFoundErr dynamodb.ErrCodeNotFound
-			var unauthorizedError loginservice.ErrCodeUnauthorized
-			if errors.As(err, &notFoundErr) || errors.As(err, &unauthorizedError) {
-				return helpers.MakeErrorResponse(401, map[string]string{"message": "Unauthorized"}), nil
-			}
-			return helpers.MakeErrorResponse(500, map[string]string{"message": err.Error()}), nil
-		}
-
-		return helpers.MakeSuccessResponse(200, map[string]any{"token": token}), nil
-	}
-}
-
 func main() {
+	cfg := config.MustLoad(context.TODO(), config.AuthTableName, config.AuditLogTableName)
+	secretProvider := secrets.New(context.TODO(), cfg)
+
 	services := models.HandlerServices{}
-	services.DynamoDBService = dynamodb.New(context.TODO())
+	services.Config = cfg
+	services.Secrets = secretProvider
+	services.JWT = jwt.NewSigner(secretProvider)
+	services.Logger = logging.New()
+	services.DynamoDBService = dynamodb.New(context.TODO(), cfg)
 
-	handler := createRequestHandler(services)
-	lambda.Start(handler)
+	lambda.Start(router.New(services, []routes.Route{routes.LogInAdmin}))
 }
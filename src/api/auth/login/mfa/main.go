@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+
+	"github.com/JaxonAdams/blog-backend/src/models"
+	"github.com/JaxonAdams/blog-backend/src/router"
+	"github.com/JaxonAdams/blog-backend/src/routes"
+	"github.com/JaxonAdams/blog-backend/src/services/aws/dynamodb"
+	"github.com/JaxonAdams/blog-backend/src/services/config"
+	"github.com/JaxonAdams/blog-backend/src/services/jwt"
+	"github.com/JaxonAdams/blog-backend/src/services/logging"
+	"github.com/JaxonAdams/blog-backend/src/services/secrets"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+func main() {
+	cfg := config.MustLoad(context.TODO(), config.AuthTableName, config.AuditLogTableName)
+	secretProvider := secrets.New(context.TODO(), cfg)
+
+	services := models.HandlerServices{}
+	services.Config = cfg
+	services.Secrets = secretProvider
+	services.JWT = jwt.NewSigner(secretProvider)
+	services.Logger = logging.New()
+	services.DynamoDBService = dynamodb.New(context.TODO(), cfg)
+
+	lambda.Start(router.New(services, []routes.Route{routes.CompleteMFALogin}))
+}
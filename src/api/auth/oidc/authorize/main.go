@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+
+	"github.com/JaxonAdams/blog-backend/src/models"
+	"github.com/JaxonAdams/blog-backend/src/router"
+	"github.com/JaxonAdams/blog-backend/src/routes"
+	"github.com/JaxonAdams/blog-backend/src/services/config"
+	"github.com/JaxonAdams/blog-backend/src/services/jwt"
+	"github.com/JaxonAdams/blog-backend/src/services/logging"
+	"github.com/JaxonAdams/blog-backend/src/services/oidc"
+	"github.com/JaxonAdams/blog-backend/src/services/secrets"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+func main() {
+	cfg := config.MustLoad(context.TODO())
+	secretProvider := secrets.New(context.TODO(), cfg)
+
+	services := models.HandlerServices{
+		Config:     cfg,
+		Secrets:    secretProvider,
+		JWT:        jwt.NewSigner(secretProvider),
+		Logger:     logging.New(),
+		OIDCClient: oidc.NewFromConfig(cfg, secretProvider),
+	}
+	lambda.Start(router.New(services, []routes.Route{routes.BeginOIDCLogin}))
+}
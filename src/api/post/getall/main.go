@@ -3,33 +3,22 @@ package main
 import (
 	"context"
 
-	"github.com/JaxonAdams/blog-backend/src/helpers"
 	"github.com/JaxonAdams/blog-backend/src/models"
+	"github.com/JaxonAdams/blog-backend/src/router"
+	"github.com/JaxonAdams/blog-backend/src/routes"
 	"github.com/JaxonAdams/blog-backend/src/services/aws/dynamodb"
-	postservice "github.com/JaxonAdams/blog-backend/src/services/post"
-	"github.com/aws/aws-lambda-go/events"
+	"github.com/JaxonAdams/blog-backend/src/services/config"
+	"github.com/JaxonAdams/blog-backend/src/services/logging"
 	"github.com/aws/aws-lambda-go/lambda"
 )
 
-func createRequestHandler(services models.HandlerServices) func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-	return func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-		parsedRequest, err := helpers.ParseGetPostsInput(request)
-		if err != nil {
-			return helpers.MakeErrorResponse(400, map[string]string{"message": err.Error()}), nil
-		}
-
-		posts, metadata, err := postservice.GetAllPosts(parsedRequest, services, ctx)
-		if err != nil {
-			return helpers.MakeErrorResponse(500, map[string]string{"message": err.Error()}), nil
-		}
+func main() {
+	cfg := config.MustLoad(context.TODO(), config.PostTableName)
 
-		return helpers.MakeSuccessResponse(200, map[string]any{"posts": posts, "_metadata": metadata}), nil
+	services := models.HandlerServices{
+		Config:          cfg,
+		Logger:          logging.New(),
+		DynamoDBService: dynamodb.New(context.TODO(), cfg),
 	}
-}
-
-func main() {
-	handler := createRequestHandler(models.HandlerServices{
-		DynamoDBService: dynamodb.New(context.TODO()),
-	})
-	lambda.Start(handler)
+	lambda.Start(router.New(services, []routes.Route{routes.GetAllPosts}))
 }
@@ -2,41 +2,25 @@ package main
 
 import (
 	"context"
-	"errors"
 
-	"github.com/JaxonAdams/blog-backend/src/helpers"
 	"github.com/JaxonAdams/blog-backend/src/models"
+	"github.com/JaxonAdams/blog-backend/src/router"
+	"github.com/JaxonAdams/blog-backend/src/routes"
 	"github.com/JaxonAdams/blog-backend/src/services/aws/dynamodb"
 	"github.com/JaxonAdams/blog-backend/src/services/aws/s3"
-	postservice "github.com/JaxonAdams/blog-backend/src/services/post"
-	"github.com/aws/aws-lambda-go/events"
+	"github.com/JaxonAdams/blog-backend/src/services/config"
+	"github.com/JaxonAdams/blog-backend/src/services/logging"
 	"github.com/aws/aws-lambda-go/lambda"
 )
 
-func createRequestHandler(services models.HandlerServices) func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-	return func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
-		parsedRequest, err := helpers.ParseGetPostByIdInput(request)
-		if err != nil {
-			return helpers.MakeErrorResponse(400, map[string]string{"message": err.Error()}), nil
-		}
-
-		post, err := postservice.GetPostByID(parsedRequest.ID, services, ctx)
-		if err != nil {
-			var notFoundErr dynamodb.ErrCodeNotFound
-			if errors.As(err, &notFoundErr) {
-				return helpers.MakeErrorResponse(404, map[string]string{"message": "Not found"}), nil
-			}
-			return helpers.MakeErrorResponse(500, map[string]string{"message": err.Error()}), nil
-		}
+func main() {
+	cfg := config.MustLoad(context.TODO(), config.BucketName, config.PostTableName)
 
-		return helpers.MakeSuccessResponse(200, map[string]any{"post": post}), nil
+	services := models.HandlerServices{
+		Config:          cfg,
+		Logger:          logging.New(),
+		S3Service:       s3.New(context.TODO(), cfg),
+		DynamoDBService: dynamodb.New(context.TODO(), cfg),
 	}
-}
-
-func main() {
-	handler := createRequestHandler(models.HandlerServices{
-		S3Service:       s3.New(context.TODO()),
-		DynamoDBService: dynamodb.New(context.TODO()),
-	})
-	lambda.Start(handler)
+	lambda.Start(router.New(services, []routes.Route{routes.GetPostByID}))
 }
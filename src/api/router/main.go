@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+
+	"github.com/JaxonAdams/blog-backend/src/models"
+	"github.com/JaxonAdams/blog-backend/src/router"
+	"github.com/JaxonAdams/blog-backend/src/routes"
+	"github.com/JaxonAdams/blog-backend/src/services/aws/dynamodb"
+	"github.com/JaxonAdams/blog-backend/src/services/aws/s3"
+	"github.com/JaxonAdams/blog-backend/src/services/config"
+	"github.com/JaxonAdams/blog-backend/src/services/jwt"
+	"github.com/JaxonAdams/blog-backend/src/services/logging"
+	"github.com/JaxonAdams/blog-backend/src/services/oidc"
+	"github.com/JaxonAdams/blog-backend/src/services/secrets"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+func main() {
+	cfg := config.MustLoad(context.TODO(), config.BucketName, config.PostTableName, config.AuthTableName, config.APIKeyTableName, config.AuditLogTableName, config.IdempotencyTableName)
+	secretProvider := secrets.New(context.TODO(), cfg)
+
+	services := models.HandlerServices{
+		Config:          cfg,
+		Secrets:         secretProvider,
+		JWT:             jwt.NewSigner(secretProvider),
+		Logger:          logging.New(),
+		S3Service:       s3.New(context.TODO(), cfg),
+		DynamoDBService: dynamodb.New(context.TODO(), cfg),
+		OIDCClient:      oidc.NewFromConfig(cfg, secretProvider),
+	}
+	lambda.Start(router.New(services, routes.All()))
+}
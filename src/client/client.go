@@ -0,0 +1,367 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JaxonAdams/blog-backend/src/models"
+	"github.com/JaxonAdams/blog-backend/src/services/apperror"
+	loginservice "github.com/JaxonAdams/blog-backend/src/services/login"
+)
+
+// ErrMFARequired is returned by LogIn when the account has TOTP enabled and
+// the client has no MFACode to ask for a code.
+var ErrMFARequired = errors.New("MFA code required")
+
+// Refresh tokens this long before they expire, so a request never races its
+// token's expiry.
+const tokenRefreshMargin = time.Minute
+
+// Client calls the blog API. Fields may be changed before the first request.
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	// Sent as X-API-Key when set; otherwise requests carry the login JWT
+	APIKey string
+	// Asked for a TOTP or recovery code when logging in requires one
+	MFACode func(ctx context.Context) (code string, recoveryCode string, err error)
+	// Retries after the first attempt for requests that are safe to repeat
+	MaxRetries int
+
+	mu       sync.Mutex
+	token    string
+	username string
+	password string
+}
+
+// New returns a client for the API at baseURL, e.g. https://api.example.com.
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		HTTPClient: &http.Client{
+			Timeout:       30 * time.Second,
+			CheckRedirect: stripCredentials,
+		},
+		MaxRetries: 3,
+	}
+}
+
+// stripCredentials keeps API keys from following redirects to other hosts,
+// such as presigned S3 URLs. Go already drops Authorization itself.
+func stripCredentials(request *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	if request.URL.Host != via[0].URL.Host {
+		request.Header.Del("X-API-Key")
+	}
+	return nil
+}
+
+// LogIn exchanges admin credentials for a JWT. The credentials are kept so
+// the token can be renewed when it expires.
+func (c *Client) LogIn(ctx context.Context, username, password string) error {
+	c.mu.Lock()
+	c.username, c.password = username, password
+	c.mu.Unlock()
+
+	return c.refreshToken(ctx)
+}
+
+// Token returns the current JWT, e.g. to save it between runs.
+func (c *Client) Token() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token
+}
+
+// UseToken authenticates with a JWT obtained elsewhere. Without stored
+// credentials it cannot be renewed.
+func (c *Client) UseToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = token
+}
+
+func (c *Client) refreshToken(ctx context.Context) error {
+	c.mu.Lock()
+	input := models.AdminLoginInput{Username: c.username, Password: c.password}
+	c.mu.Unlock()
+
+	var result loginservice.AdminLoginResult
+	if err := c.do(ctx, request{method: http.MethodPost, path: "/api/v1/auth/login/admin", body: input, anonymous: true}, &result); err != nil {
+		return err
+	}
+
+	token := result.Token
+	if result.MFARequired {
+		if c.MFACode == nil {
+			return ErrMFARequired
+		}
+
+		code, recoveryCode, err := c.MFACode(ctx)
+		if err != nil {
+			return err
+		}
+
+		mfaInput := models.AdminMFALoginInput{ChallengeToken: result.ChallengeToken, Code: code, RecoveryCode: recoveryCode}
+		var response models.TokenResponse
+		if err := c.do(ctx, request{method: http.MethodPost, path: "/api/v1/auth/login/admin/mfa", body: mfaInput, anonymous: true}, &response); err != nil {
+			return err
+		}
+		token = response.Token
+	}
+
+	c.UseToken(token)
+	return nil
+}
+
+// authorize sets the request's credentials, renewing an expired or
+// soon-to-expire token first.
+func (c *Client) authorize(ctx context.Context, header http.Header) error {
+	if c.APIKey != "" {
+		header.Set("X-API-Key", c.APIKey)
+		return nil
+	}
+
+	c.mu.Lock()
+	token, canRefresh := c.token, c.username != ""
+	c.mu.Unlock()
+
+	if canRefresh && (token == "" || tokenExpiresBefore(token, time.Now().Add(tokenRefreshMargin))) {
+		if err := c.refreshToken(ctx); err != nil {
+			return fmt.Errorf("failed to refresh token: %w", err)
+		}
+		token = c.Token()
+	}
+
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+	return nil
+}
+
+// tokenExpiresBefore reads the token's exp claim without verifying it; the
+// server does that.
+func tokenExpiresBefore(token string, t time.Time) bool {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return false
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return false
+	}
+
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil || claims.Exp == 0 {
+		return false
+	}
+
+	return time.Unix(claims.Exp, 0).Before(t)
+}
+
+type request struct {
+	method string
+	path   string
+	body   any
+	header http.Header
+	// Login requests carry no credentials
+	anonymous bool
+}
+
+// response is the raw reply to a request that succeeded.
+type response struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// do sends req and decodes the data envelope of the response into out,
+// unless out is nil.
+func (c *Client) do(ctx context.Context, req request, out any) error {
+	resp, err := c.send(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	if out == nil || len(resp.body) == 0 {
+		return nil
+	}
+
+	envelope := struct {
+		Data any `json:"data"`
+	}{Data: out}
+	if err := json.Unmarshal(resp.body, &envelope); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return nil
+}
+
+// send makes the request, retrying when that is safe, and turns problem
+// responses into *Error.
+func (c *Client) send(ctx context.Context, req request) (response, error) {
+	var body []byte
+	if req.body != nil {
+		encoded, err := json.Marshal(req.body)
+		if err != nil {
+			return response{}, fmt.Errorf("failed to encode request: %w", err)
+		}
+		body = encoded
+	}
+
+	retryable := isIdempotent(req.method) || req.header.Get("Idempotency-Key") != ""
+	reauthorized := false
+
+	for attempt := 0; ; attempt++ {
+		resp, err := c.sendOnce(ctx, req, body)
+
+		var apiErr *Error
+		switch {
+		case err == nil:
+			return resp, nil
+		case attempt > 0 && req.method == http.MethodDelete && errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound:
+			// An attempt that failed in transit may still have deleted it
+			return response{status: http.StatusNoContent}, nil
+		case ctx.Err() != nil:
+			return response{}, ctx.Err()
+		case errors.As(err, &apiErr) && apiErr.Status == http.StatusUnauthorized && !req.anonymous && !reauthorized && c.canRefresh():
+			// The token may have been revoked or signed with a rotated
+			// secret, so log in again once before giving up
+			reauthorized = true
+			if err := c.refreshToken(ctx); err != nil {
+				return response{}, fmt.Errorf("failed to refresh token: %w", err)
+			}
+			attempt--
+			continue
+		case !retryable || attempt >= c.MaxRetries || !isTransient(err):
+			return response{}, err
+		}
+
+		select {
+		case <-time.After(backoff(attempt, err)):
+		case <-ctx.Done():
+			return response{}, ctx.Err()
+		}
+	}
+}
+
+func (c *Client) sendOnce(ctx context.Context, req request, body []byte) (response, error) {
+	httpRequest, err := http.NewRequestWithContext(ctx, req.method, c.BaseURL+req.path, bytes.NewReader(body))
+	if err != nil {
+		return response{}, err
+	}
+
+	for name, values := range req.header {
+		httpRequest.Header[name] = values
+	}
+	if body != nil {
+		httpRequest.Header.Set("Content-Type", "application/json")
+	}
+	if httpRequest.Header.Get("Accept") == "" {
+		httpRequest.Header.Set("Accept", "application/json")
+	}
+
+	if !req.anonymous {
+		if err := c.authorize(ctx, httpRequest.Header); err != nil {
+			return response{}, err
+		}
+	}
+
+	httpResponse, err := c.HTTPClient.Do(httpRequest)
+	if err != nil {
+		return response{}, transportError{err}
+	}
+	defer httpResponse.Body.Close()
+
+	responseBody, err := io.ReadAll(httpResponse.Body)
+	if err != nil {
+		return response{}, transportError{err}
+	}
+
+	if httpResponse.StatusCode >= 400 {
+		return response{}, newError(httpResponse, responseBody)
+	}
+
+	return response{status: httpResponse.StatusCode, header: httpResponse.Header, body: responseBody}, nil
+}
+
+func (c *Client) canRefresh() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.APIKey == "" && c.username != ""
+}
+
+// transportError marks failures to get any response, which are always worth
+// retrying for requests that are safe to repeat.
+type transportError struct {
+	err error
+}
+
+func (e transportError) Error() string {
+	return e.err.Error()
+}
+
+func (e transportError) Unwrap() error {
+	return e.err
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+func isTransient(err error) bool {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		return errors.As(err, &transportError{})
+	}
+
+	switch apiErr.Status {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+
+	// The first attempt of an idempotent request is still running
+	return apiErr.Code == apperror.CodeRequestInProgress
+}
+
+// backoff waits for Retry-After when the server sent one, and otherwise
+// doubles from 200ms with jitter, up to 5s.
+func backoff(attempt int, err error) time.Duration {
+	var apiErr *Error
+	if errors.As(err, &apiErr) && apiErr.retryAfter > 0 {
+		return apiErr.retryAfter
+	}
+
+	wait := min(200*time.Millisecond<<attempt, 5*time.Second)
+	return wait/2 + rand.N(wait/2+1)
+}
+
+func parseRetryAfter(value string) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		return time.Until(at)
+	}
+	return 0
+}
@@ -0,0 +1,487 @@
+package client
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/JaxonAdams/blog-backend/src/models"
+	postmodel "github.com/JaxonAdams/blog-backend/src/models/posts"
+	"github.com/JaxonAdams/blog-backend/src/services/apperror"
+	loginservice "github.com/JaxonAdams/blog-backend/src/services/login"
+)
+
+// testToken is an unsigned JWT expiring at exp; the client only reads exp.
+func testToken(n int, exp time.Time) string {
+	encode := func(v any) string {
+		b, _ := json.Marshal(v)
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	return encode(map[string]string{"alg": "none"}) + "." + encode(map[string]any{"n": n, "exp": exp.Unix()}) + ".sig"
+}
+
+// testAPI records the requests made to it. Logins issue a new token each
+// time, and every other request is answered by handle.
+type testAPI struct {
+	t      *testing.T
+	server *httptest.Server
+	// Expiry of the token issued by each login, in order; later logins reuse
+	// the last one
+	expiries []time.Time
+	// Logins ask for a TOTP code, which must be this
+	mfaCode string
+	handle  func(w http.ResponseWriter, r *http.Request, attempt int)
+
+	mu       sync.Mutex
+	logins   int
+	requests []*http.Request
+}
+
+func newTestAPI(t *testing.T, handle func(w http.ResponseWriter, r *http.Request, attempt int)) *testAPI {
+	t.Helper()
+
+	api := &testAPI{t: t, handle: handle, expiries: []time.Time{time.Now().Add(time.Hour)}}
+	api.server = httptest.NewServer(http.HandlerFunc(api.serve))
+	t.Cleanup(api.server.Close)
+	return api
+}
+
+func (api *testAPI) serve(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/api/v1/auth/login/admin" {
+		var input models.AdminLoginInput
+		json.NewDecoder(r.Body).Decode(&input)
+		if input.Username != "admin" || input.Password != "password" {
+			writeProblem(w, apperror.CodeUnauthorized, "invalid credentials", nil)
+			return
+		}
+
+		if api.mfaCode != "" {
+			writeData(w, http.StatusOK, loginservice.AdminLoginResult{MFARequired: true, ChallengeToken: "challenge"})
+			return
+		}
+		writeData(w, http.StatusOK, loginservice.AdminLoginResult{Token: api.issue()})
+		return
+	}
+	if r.URL.Path == "/api/v1/auth/login/admin/mfa" {
+		var input models.AdminMFALoginInput
+		json.NewDecoder(r.Body).Decode(&input)
+		if input.ChallengeToken != "challenge" || input.Code != api.mfaCode {
+			writeProblem(w, apperror.CodeUnauthorized, "invalid code", nil)
+			return
+		}
+		writeData(w, http.StatusOK, models.TokenResponse{Token: api.issue()})
+		return
+	}
+
+	api.mu.Lock()
+	api.requests = append(api.requests, r)
+	attempt := len(api.requests)
+	api.mu.Unlock()
+
+	api.handle(w, r, attempt)
+}
+
+func (api *testAPI) issue() string {
+	api.mu.Lock()
+	defer api.mu.Unlock()
+	api.logins++
+	return api.token(api.logins)
+}
+
+// token is the one issued by the nth login.
+func (api *testAPI) token(n int) string {
+	return testToken(n, api.expiries[min(n, len(api.expiries))-1])
+}
+
+func (api *testAPI) client() *Client {
+	c := New(api.server.URL)
+	c.HTTPClient = api.server.Client()
+	return c
+}
+
+func writeData(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]any{"data": data})
+}
+
+func writeProblem(w http.ResponseWriter, code apperror.Code, detail string, extensions map[string]any) {
+	problem := map[string]any{
+		"type":      code.TypeURI(),
+		"title":     code.Title(),
+		"status":    code.Status(),
+		"detail":    detail,
+		"requestId": "req-1",
+	}
+	for name, value := range extensions {
+		problem[name] = value
+	}
+
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(code.Status())
+	json.NewEncoder(w).Encode(problem)
+}
+
+func writePost(w http.ResponseWriter, id string) {
+	writeData(w, http.StatusOK, models.PostResponse{Post: postmodel.Post{ID: id, Title: "Title", Version: 1}})
+}
+
+func TestTokenRefresh(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		expiries []time.Time
+		// Tokens the API rejects with 401, by the login that issued them
+		revoked    map[int]bool
+		wantErr    apperror.Code
+		wantLogins int
+		// Login whose token each request carried
+		wantTokens []int
+	}{
+		{
+			name:       "valid token is reused",
+			wantLogins: 1,
+			wantTokens: []int{1},
+		},
+		{
+			name:       "token near expiry is renewed first",
+			expiries:   []time.Time{now.Add(30 * time.Second), now.Add(time.Hour)},
+			wantLogins: 2,
+			wantTokens: []int{2},
+		},
+		{
+			name:       "expired token is renewed first",
+			expiries:   []time.Time{now.Add(-time.Minute), now.Add(time.Hour)},
+			wantLogins: 2,
+			wantTokens: []int{2},
+		},
+		{
+			name:       "rejected token is renewed once",
+			revoked:    map[int]bool{1: true},
+			wantLogins: 2,
+			wantTokens: []int{1, 2},
+		},
+		{
+			name:       "renewed token is rejected too",
+			revoked:    map[int]bool{1: true, 2: true},
+			wantErr:    apperror.CodeUnauthorized,
+			wantLogins: 2,
+			wantTokens: []int{1, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var api *testAPI
+			api = newTestAPI(t, func(w http.ResponseWriter, r *http.Request, attempt int) {
+				for n := range api.logins {
+					if r.Header.Get("Authorization") == "Bearer "+api.token(n+1) && tt.revoked[n+1] {
+						writeProblem(w, apperror.CodeUnauthorized, "token revoked", nil)
+						return
+					}
+				}
+				writePost(w, "post-1")
+			})
+			if tt.expiries != nil {
+				api.expiries = tt.expiries
+			}
+
+			c := api.client()
+			ctx := context.Background()
+			if err := c.LogIn(ctx, "admin", "password"); err != nil {
+				t.Fatalf("LogIn() error = %v", err)
+			}
+
+			_, err := c.GetPost(ctx, "post-1")
+			if got := apperror.CodeOf(err); (err != nil || tt.wantErr != "") && got != tt.wantErr {
+				t.Fatalf("GetPost() error = %v, want %q", err, tt.wantErr)
+			}
+
+			if api.logins != tt.wantLogins {
+				t.Errorf("logged in %d times, want %d", api.logins, tt.wantLogins)
+			}
+			if len(api.requests) != len(tt.wantTokens) {
+				t.Fatalf("made %d requests, want %d", len(api.requests), len(tt.wantTokens))
+			}
+			for i, n := range tt.wantTokens {
+				if got := api.requests[i].Header.Get("Authorization"); got != "Bearer "+api.token(n) {
+					t.Errorf("request %d carried %q, want login %d's token", i+1, got, n)
+				}
+			}
+		})
+	}
+}
+
+func TestLogInMFA(t *testing.T) {
+	api := newTestAPI(t, func(w http.ResponseWriter, r *http.Request, attempt int) { writePost(w, "post-1") })
+	api.mfaCode = "123456"
+	ctx := context.Background()
+
+	c := api.client()
+	if err := c.LogIn(ctx, "admin", "password"); !errors.Is(err, ErrMFARequired) {
+		t.Fatalf("LogIn() without MFACode error = %v, want ErrMFARequired", err)
+	}
+
+	c.MFACode = func(ctx context.Context) (string, string, error) { return "123456", "", nil }
+	if err := c.LogIn(ctx, "admin", "password"); err != nil {
+		t.Fatalf("LogIn() error = %v", err)
+	}
+	if c.Token() != api.token(1) {
+		t.Errorf("Token() = %q, want the token from the MFA login", c.Token())
+	}
+}
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name string
+		// Makes the request under test
+		call func(c *Client) error
+		// Answers each attempt
+		handle       func(w http.ResponseWriter, r *http.Request, attempt int)
+		wantErr      bool
+		wantAttempts int
+		wantWait     time.Duration
+	}{
+		{
+			name: "GET is retried until it succeeds",
+			call: getPost,
+			handle: func(w http.ResponseWriter, r *http.Request, attempt int) {
+				if attempt < 3 {
+					http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+					return
+				}
+				writePost(w, "post-1")
+			},
+			wantAttempts: 3,
+		},
+		{
+			name: "GET gives up after MaxRetries",
+			call: getPost,
+			handle: func(w http.ResponseWriter, r *http.Request, attempt int) {
+				http.Error(w, "Bad Gateway", http.StatusBadGateway)
+			},
+			wantErr:      true,
+			wantAttempts: 3,
+		},
+		{
+			name: "Retry-After is honored",
+			call: getPost,
+			handle: func(w http.ResponseWriter, r *http.Request, attempt int) {
+				if attempt == 1 {
+					// API Gateway's throttling response
+					w.Header().Set("Retry-After", "1")
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(http.StatusTooManyRequests)
+					fmt.Fprint(w, `{"message":"Too Many Requests"}`)
+					return
+				}
+				writePost(w, "post-1")
+			},
+			wantAttempts: 2,
+			wantWait:     time.Second,
+		},
+		{
+			name: "client errors are not retried",
+			call: getPost,
+			handle: func(w http.ResponseWriter, r *http.Request, attempt int) {
+				writeProblem(w, apperror.CodeNotFound, "no post found", nil)
+			},
+			wantErr:      true,
+			wantAttempts: 1,
+		},
+		{
+			name: "PATCH is not retried",
+			call: func(c *Client) error {
+				_, err := c.UpdatePost(context.Background(), "post-1", 1, models.UpdatePostInput{})
+				return err
+			},
+			handle: func(w http.ResponseWriter, r *http.Request, attempt int) {
+				http.Error(w, "Service Unavailable", http.StatusServiceUnavailable)
+			},
+			wantErr:      true,
+			wantAttempts: 1,
+		},
+		{
+			name: "DELETE that finds the post gone on a retry succeeds",
+			call: deletePost,
+			handle: func(w http.ResponseWriter, r *http.Request, attempt int) {
+				if attempt == 1 {
+					http.Error(w, "Gateway Timeout", http.StatusGatewayTimeout)
+					return
+				}
+				writeProblem(w, apperror.CodeNotFound, "no post found", nil)
+			},
+			wantAttempts: 2,
+		},
+		{
+			name: "DELETE of a missing post fails",
+			call: deletePost,
+			handle: func(w http.ResponseWriter, r *http.Request, attempt int) {
+				writeProblem(w, apperror.CodeNotFound, "no post found", nil)
+			},
+			wantErr:      true,
+			wantAttempts: 1,
+		},
+		{
+			name: "POST with an idempotency key is retried while in progress",
+			call: func(c *Client) error {
+				_, err := c.CreatePost(context.Background(), models.CreatePostInput{Title: "Title", Content: "# Hello"})
+				return err
+			},
+			handle: func(w http.ResponseWriter, r *http.Request, attempt int) {
+				if attempt == 1 {
+					writeProblem(w, apperror.CodeRequestInProgress, "the first attempt is still running", nil)
+					return
+				}
+				writeData(w, http.StatusCreated, models.PostResponse{Post: postmodel.Post{ID: "post-1"}})
+			},
+			wantAttempts: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestAPI(t, tt.handle)
+			c := api.client()
+			c.MaxRetries = 2
+			c.UseToken(api.token(1))
+
+			start := time.Now()
+			err := tt.call(c)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, want error %v", err, tt.wantErr)
+			}
+			if elapsed := time.Since(start); elapsed < tt.wantWait {
+				t.Errorf("took %v, want at least %v", elapsed, tt.wantWait)
+			}
+
+			if len(api.requests) != tt.wantAttempts {
+				t.Fatalf("made %d attempts, want %d", len(api.requests), tt.wantAttempts)
+			}
+			// Every attempt must be recognisable as the same request
+			key := api.requests[0].Header.Get("Idempotency-Key")
+			for i, request := range api.requests[1:] {
+				if got := request.Header.Get("Idempotency-Key"); got != key {
+					t.Errorf("attempt %d sent Idempotency-Key %q, want %q", i+2, got, key)
+				}
+			}
+		})
+	}
+}
+
+func getPost(c *Client) error {
+	_, err := c.GetPost(context.Background(), "post-1")
+	return err
+}
+
+func deletePost(c *Client) error {
+	return c.DeletePost(context.Background(), "post-1")
+}
+
+func TestErrorDecoding(t *testing.T) {
+	tests := []struct {
+		name        string
+		handle      func(w http.ResponseWriter)
+		want        Error
+		wantVersion int64
+	}{
+		{
+			name: "problem with an extension",
+			handle: func(w http.ResponseWriter) {
+				writeProblem(w, apperror.CodeVersionConflict, "post-1 has changed", map[string]any{"currentVersion": 7})
+			},
+			want: Error{
+				Code:       apperror.CodeVersionConflict,
+				Status:     http.StatusPreconditionFailed,
+				Title:      "Version conflict",
+				Detail:     "post-1 has changed",
+				RequestID:  "req-1",
+				Extensions: map[string]any{"currentVersion": float64(7)},
+			},
+			wantVersion: 7,
+		},
+		{
+			name: "problem with field errors",
+			handle: func(w http.ResponseWriter) {
+				writeProblem(w, apperror.CodeValidationFailed, "one or more fields are invalid", map[string]any{
+					"errors": []apperror.FieldError{{Field: "title", Message: "is required"}},
+				})
+			},
+			want: Error{
+				Code:      apperror.CodeValidationFailed,
+				Status:    http.StatusBadRequest,
+				Title:     "Validation failed",
+				Detail:    "one or more fields are invalid",
+				RequestID: "req-1",
+				Fields:    []apperror.FieldError{{Field: "title", Message: "is required"}},
+			},
+		},
+		{
+			name: "API Gateway error",
+			handle: func(w http.ResponseWriter) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusForbidden)
+				fmt.Fprint(w, `{"message":"Forbidden"}`)
+			},
+			want: Error{
+				Code:   apperror.CodeForbidden,
+				Status: http.StatusForbidden,
+				Title:  "Forbidden",
+				Detail: `{"message":"Forbidden"}`,
+			},
+		},
+		{
+			name: "plain text error",
+			handle: func(w http.ResponseWriter) {
+				w.Header().Set("Content-Type", "text/plain")
+				w.WriteHeader(http.StatusInternalServerError)
+				fmt.Fprint(w, "upstream failed\n")
+			},
+			want: Error{
+				Code:   apperror.CodeInternal,
+				Status: http.StatusInternalServerError,
+				Title:  "Internal Server Error",
+				Detail: "upstream failed",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestAPI(t, func(w http.ResponseWriter, r *http.Request, attempt int) { tt.handle(w) })
+			c := api.client()
+			c.UseToken(api.token(1))
+
+			err := getPost(c)
+			var apiErr *Error
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("error = %v, want *Error", err)
+			}
+			if apperror.CodeOf(err) != tt.want.Code {
+				t.Errorf("CodeOf() = %q, want %q", apperror.CodeOf(err), tt.want.Code)
+			}
+
+			if !reflect.DeepEqual(*apiErr, tt.want) {
+				t.Errorf("error = %+v, want %+v", *apiErr, tt.want)
+			}
+
+			version, ok := apiErr.CurrentVersion()
+			if ok != (tt.wantVersion != 0) || version != tt.wantVersion {
+				t.Errorf("CurrentVersion() = %d, %v, want %d", version, ok, tt.wantVersion)
+			}
+			if !strings.Contains(err.Error(), tt.want.Detail) {
+				t.Errorf("Error() = %q, want it to include the detail", err.Error())
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/JaxonAdams/blog-backend/src/services/apperror"
+)
+
+// Error is a problem returned by the API. It implements apperror.Coded, so
+// apperror.CodeOf(err) gives the server's code, e.g. apperror.CodeNotFound.
+type Error struct {
+	Code      apperror.Code
+	Status    int
+	Title     string
+	Detail    string
+	RequestID string
+	Fields    []apperror.FieldError
+	// Members specific to the problem, e.g. currentVersion on a version conflict
+	Extensions map[string]any
+
+	retryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	message := fmt.Sprintf("%d %s: %s", e.Status, e.Title, e.Detail)
+	for _, field := range e.Fields {
+		message += fmt.Sprintf("; %s %s", field.Field, field.Message)
+	}
+	return message
+}
+
+func (e *Error) ErrorCode() apperror.Code {
+	return e.Code
+}
+
+// CurrentVersion is the post's version when an update fails with a version
+// conflict.
+func (e *Error) CurrentVersion() (int64, bool) {
+	version, ok := e.Extensions["currentVersion"].(float64)
+	return int64(version), ok
+}
+
+// newError reads a problem document. Responses that are not one, such as
+// API Gateway's own errors, keep their status and body as the detail.
+func newError(response *http.Response, body []byte) *Error {
+	apiErr := &Error{
+		Status:     response.StatusCode,
+		Title:      http.StatusText(response.StatusCode),
+		Detail:     strings.TrimSpace(string(body)),
+		retryAfter: parseRetryAfter(response.Header.Get("Retry-After")),
+	}
+
+	var problem map[string]json.RawMessage
+	var problemType string
+	if json.Unmarshal(body, &problem) != nil || json.Unmarshal(problem["type"], &problemType) != nil || problemType == "" {
+		apiErr.Code = codeForStatus(response.StatusCode)
+		return apiErr
+	}
+
+	json.Unmarshal(problem["title"], &apiErr.Title)
+	json.Unmarshal(problem["detail"], &apiErr.Detail)
+	json.Unmarshal(problem["requestId"], &apiErr.RequestID)
+	json.Unmarshal(problem["errors"], &apiErr.Fields)
+
+	apiErr.Code = apperror.Code(strings.TrimPrefix(problemType, apperror.TypeBaseURI))
+
+	for _, member := range []string{"type", "title", "status", "detail", "instance", "requestId", "errors"} {
+		delete(problem, member)
+	}
+	if len(problem) > 0 {
+		apiErr.Extensions = map[string]any{}
+		for name, value := range problem {
+			var decoded any
+			json.Unmarshal(value, &decoded)
+			apiErr.Extensions[name] = decoded
+		}
+	}
+
+	return apiErr
+}
+
+// codeForStatus picks the closest code for responses without a problem type.
+func codeForStatus(status int) apperror.Code {
+	switch status {
+	case http.StatusBadRequest:
+		return apperror.CodeInvalidRequest
+	case http.StatusUnauthorized:
+		return apperror.CodeUnauthorized
+	case http.StatusForbidden:
+		return apperror.CodeForbidden
+	case http.StatusNotFound:
+		return apperror.CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return apperror.CodeMethodNotAllowed
+	case http.StatusRequestEntityTooLarge:
+		return apperror.CodePayloadTooLarge
+	}
+	return apperror.CodeInternal
+}
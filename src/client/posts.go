@@ -0,0 +1,163 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"iter"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/JaxonAdams/blog-backend/src/models"
+	postmodel "github.com/JaxonAdams/blog-backend/src/models/posts"
+)
+
+func (c *Client) CreatePost(ctx context.Context, input models.CreatePostInput) (postmodel.Post, error) {
+	// The key lets a retried create return the first attempt's post instead
+	// of creating a duplicate
+	key := make([]byte, 16)
+	if _, err := rand.Read(key); err != nil {
+		return postmodel.Post{}, fmt.Errorf("failed to generate idempotency key: %w", err)
+	}
+
+	var response models.PostResponse
+	err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/api/v1/posts",
+		body:   input,
+		header: http.Header{"Idempotency-Key": {hex.EncodeToString(key)}},
+	}, &response)
+
+	return response.Post, err
+}
+
+// GetPost fetches a post's metadata, with its content inlined for each of
+// include ("html", "md").
+func (c *Client) GetPost(ctx context.Context, id string, include ...string) (postmodel.Post, error) {
+	path := "/api/v1/posts/" + url.PathEscape(id)
+	if len(include) > 0 {
+		path += "?include=" + url.QueryEscape(strings.Join(include, ","))
+	}
+
+	var response models.PostResponse
+	err := c.do(ctx, request{method: http.MethodGet, path: path}, &response)
+
+	return response.Post, err
+}
+
+// GetPostContent fetches a post's content as postmodel.FormatHTML or
+// postmodel.FormatMarkdown, following the redirect to S3 for large posts.
+func (c *Client) GetPostContent(ctx context.Context, id, format string) (string, error) {
+	resp, err := c.send(ctx, request{
+		method: http.MethodGet,
+		path:   "/api/v1/posts/" + url.PathEscape(id) + "." + format,
+		header: http.Header{"Accept": {"*/*"}},
+	})
+
+	return string(resp.body), err
+}
+
+// UpdatePost applies input to the post if it is still at version, the
+// version it was read at; the server refuses updates without one. If the
+// post has changed since, it fails with apperror.CodeVersionConflict and
+// (*Error).CurrentVersion gives the new version. Updates are never retried,
+// as a retry could apply them twice.
+func (c *Client) UpdatePost(ctx context.Context, id string, version int64, input models.UpdatePostInput) (postmodel.Post, error) {
+	input.ExpectedVersion = &version
+
+	var response models.PostResponse
+	err := c.do(ctx, request{method: http.MethodPatch, path: "/api/v1/posts/" + url.PathEscape(id), body: input}, &response)
+
+	return response.Post, err
+}
+
+// DeletePost moves the post to the trash. A retry that finds the post
+// already gone counts as success, as the failed attempt may have trashed it.
+func (c *Client) DeletePost(ctx context.Context, id string) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: "/api/v1/posts/" + url.PathEscape(id)}, nil)
+}
+
+// ListPostsPage fetches one page of posts. Pass the returned metadata's
+// NextStartKey to fetch the next page; it is empty after the last.
+func (c *Client) ListPostsPage(ctx context.Context, pageSize int, startKey string) (models.PostListResponse, error) {
+	var response models.PostListResponse
+	err := c.do(ctx, request{method: http.MethodGet, path: "/api/v1/posts" + pageQuery(pageSize, startKey)}, &response)
+
+	return response, err
+}
+
+// ListPosts yields every post, fetching pages of pageSize as it goes. A
+// pageSize of 0 uses the server's default.
+func (c *Client) ListPosts(ctx context.Context, pageSize int) iter.Seq2[postmodel.Post, error] {
+	return paginate(func(startKey string) ([]postmodel.Post, string, error) {
+		page, err := c.ListPostsPage(ctx, pageSize, startKey)
+		return page.Posts, page.Metadata.NextStartKey, err
+	})
+}
+
+// ListDeletedPosts yields every post in the trash.
+func (c *Client) ListDeletedPosts(ctx context.Context, pageSize int) iter.Seq2[postmodel.Post, error] {
+	return paginate(func(startKey string) ([]postmodel.Post, string, error) {
+		var page models.PostListResponse
+		err := c.do(ctx, request{method: http.MethodGet, path: "/api/v1/posts/trash" + pageQuery(pageSize, startKey)}, &page)
+		return page.Posts, page.Metadata.NextStartKey, err
+	})
+}
+
+func (c *Client) RestorePost(ctx context.Context, id string) (postmodel.Post, error) {
+	var response models.PostResponse
+	err := c.do(ctx, request{method: http.MethodPost, path: "/api/v1/posts/" + url.PathEscape(id) + "/restore"}, &response)
+
+	return response.Post, err
+}
+
+// PurgePost permanently deletes a post in the trash. As with DeletePost, a
+// retry that finds it gone succeeds.
+func (c *Client) PurgePost(ctx context.Context, id string) error {
+	return c.do(ctx, request{method: http.MethodDelete, path: "/api/v1/posts/" + url.PathEscape(id) + "/purge"}, nil)
+}
+
+// paginate yields the items of each page fetch returns until a page has no
+// next start key. It stops after yielding the first error.
+func paginate[T any](fetch func(startKey string) ([]T, string, error)) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		startKey := ""
+		for {
+			items, nextStartKey, err := fetch(startKey)
+			if err != nil {
+				var zero T
+				yield(zero, err)
+				return
+			}
+
+			for _, item := range items {
+				if !yield(item, nil) {
+					return
+				}
+			}
+
+			if nextStartKey == "" {
+				return
+			}
+			startKey = nextStartKey
+		}
+	}
+}
+
+func pageQuery(pageSize int, startKey string) string {
+	query := url.Values{}
+	if pageSize > 0 {
+		query.Set("pageSize", strconv.Itoa(pageSize))
+	}
+	if startKey != "" {
+		query.Set("startKey", startKey)
+	}
+
+	if len(query) == 0 {
+		return ""
+	}
+	return "?" + query.Encode()
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/JaxonAdams/blog-backend/src/models"
+	auditmodel "github.com/JaxonAdams/blog-backend/src/models/audit"
+	auditservice "github.com/JaxonAdams/blog-backend/src/services/audit"
+	"github.com/JaxonAdams/blog-backend/src/services/aws/dynamodb"
+	"github.com/JaxonAdams/blog-backend/src/services/aws/s3"
+	backupservice "github.com/JaxonAdams/blog-backend/src/services/backup"
+	"github.com/JaxonAdams/blog-backend/src/services/config"
+	"github.com/JaxonAdams/blog-backend/src/services/logging"
+)
+
+const actor = "system:backup-restore"
+
+const usage = `Usage:
+  backup export [-o file]                        Write every post and user to an archive
+  backup restore [-remap-ids] [-dry-run] <file>  Restore an archive
+
+Restores only create posts and users, so running one again is safe. Pass
+-remap-ids to give posts new IDs, e.g. when copying a blog alongside
+another. Restored users have no password or TOTP secret.
+
+It reads the same configuration as the Lambda functions, e.g. from
+CONFIG_FILE or S3_BUCKET_NAME, POST_METADATA_TABLE_NAME, AUTH_TABLE_NAME and
+AUDIT_LOG_TABLE_NAME.
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var err error
+	switch os.Args[1] {
+	case "export":
+		err = export(ctx, os.Args[2:])
+	case "restore":
+		err = restore(ctx, os.Args[2:])
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "backup:", err)
+		os.Exit(1)
+	}
+}
+
+func loadServices(ctx context.Context, required ...string) (models.HandlerServices, error) {
+	cfg, err := config.Load(ctx, required...)
+	if err != nil {
+		return models.HandlerServices{}, err
+	}
+
+	return models.HandlerServices{
+		Config:          cfg,
+		Logger:          logging.New().With("actor", actor),
+		S3Service:       s3.New(ctx, cfg),
+		DynamoDBService: dynamodb.New(ctx, cfg),
+	}, nil
+}
+
+func export(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	output := flags.String("o", "", "archive to write (default blog-backup-<time>.tar.gz)")
+	flags.Parse(args)
+
+	services, err := loadServices(ctx, config.BucketName, config.PostTableName, config.AuthTableName)
+	if err != nil {
+		return err
+	}
+
+	path := *output
+	if path == "" {
+		path = fmt.Sprintf("blog-backup-%s.tar.gz", time.Now().UTC().Format("20060102T150405Z"))
+	}
+
+	// Written beside the destination first, so a failed export never
+	// replaces a good archive
+	file, err := os.CreateTemp(filepath.Dir(path), ".blog-backup-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	manifest, err := backupservice.Export(file, services, ctx)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := os.Rename(file.Name(), path); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %d posts and %d users to %s (archive %s)\n", manifest.Posts, manifest.Users, path, manifest.ID)
+	return nil
+}
+
+func restore(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	remapIDs := flags.Bool("remap-ids", false, "give restored posts new IDs")
+	dryRun := flags.Bool("dry-run", false, "show what would be restored without writing anything")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return fmt.Errorf("restore needs an archive")
+	}
+
+	services, err := loadServices(ctx, config.BucketName, config.PostTableName, config.AuthTableName, config.AuditLogTableName)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	options := backupservice.RestoreOptions{RemapIDs: *remapIDs, DryRun: *dryRun}
+	report, restoreErr := backupservice.Restore(file, options, services, ctx)
+	if report.Manifest.ID == "" {
+		return restoreErr
+	}
+
+	for _, result := range report.Results {
+		if result.Post == nil {
+			continue
+		}
+		entry := auditservice.NewSystemEntry(actor, auditmodel.ActionPostCreate, result.TargetID, report.Manifest.ID)
+		entry.After = auditservice.PostMetadata(*result.Post)
+		auditservice.Record(entry, services, ctx)
+	}
+
+	printReport(report)
+	return restoreErr
+}
+
+func printReport(report backupservice.Report) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tSOURCE\tTARGET\tSTATUS")
+	for _, result := range report.Results {
+		status := string(result.Status)
+		if result.Error != "" {
+			status += ": " + result.Error
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", result.Kind, result.SourceID, result.TargetID, status)
+	}
+	w.Flush()
+
+	counts := report.Counts()
+	verb := "Restored"
+	if report.DryRun {
+		verb = "Would restore"
+	}
+	fmt.Printf("%s %d items from archive %s; %d unchanged, %d conflicts, %d failed\n",
+		verb, counts[backupservice.StatusCreated], report.Manifest.ID,
+		counts[backupservice.StatusUnchanged], counts[backupservice.StatusConflict], counts[backupservice.StatusFailed])
+
+	if users := report.CreatedUsers(); len(users) > 0 && !report.DryRun {
+		fmt.Printf("Set a password for %s before they can log in\n", strings.Join(users, ", "))
+	}
+}
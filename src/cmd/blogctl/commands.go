@@ -0,0 +1,403 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/JaxonAdams/blog-backend/src/models"
+	postmodel "github.com/JaxonAdams/blog-backend/src/models/posts"
+	"github.com/JaxonAdams/blog-backend/src/services/frontmatter"
+	"golang.org/x/term"
+)
+
+func (c *cli) login(ctx context.Context, args []string) error {
+	var username string
+	if len(args) > 0 {
+		username = args[0]
+	} else {
+		answer, err := c.prompt("Username: ")
+		if err != nil {
+			return err
+		}
+		username = answer
+	}
+
+	password, err := c.promptSecret("Password: ")
+	if err != nil {
+		return err
+	}
+
+	if err := c.client.LogIn(ctx, username, password); err != nil {
+		return err
+	}
+
+	c.settings.Token = c.client.Token()
+	if err := saveSettings(c.settings); err != nil {
+		return fmt.Errorf("failed to save token: %w", err)
+	}
+
+	fmt.Fprintln(c.stderr, "Logged in to", c.settings.URL)
+	return nil
+}
+
+// promptMFACode asks for a TOTP code, accepting a recovery code instead.
+func (c *cli) promptMFACode(ctx context.Context) (string, string, error) {
+	answer, err := c.prompt("TOTP code (or recovery code): ")
+	if err != nil {
+		return "", "", err
+	}
+
+	if len(answer) == 6 && strings.Trim(answer, "0123456789") == "" {
+		return answer, "", nil
+	}
+	return "", answer, nil
+}
+
+func (c *cli) promptSecret(question string) (string, error) {
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return c.prompt(question)
+	}
+
+	fmt.Fprint(c.stderr, question)
+	secret, err := term.ReadPassword(fd)
+	fmt.Fprintln(c.stderr)
+	return string(secret), err
+}
+
+func (c *cli) list(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("list", flag.ExitOnError)
+	trash := flags.Bool("trash", false, "list posts in the trash")
+	flags.Parse(args)
+
+	posts := c.client.ListPosts(ctx, 0)
+	if *trash {
+		posts = c.client.ListDeletedPosts(ctx, 0)
+	}
+
+	w := tabwriter.NewWriter(c.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tMODIFIED\tTITLE\tTAGS")
+	for post, err := range posts {
+		if err != nil {
+			return err
+		}
+		modified := post.LastModified().Local().Format(time.DateTime)
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", post.ID, modified, post.Title, strings.Join(post.Tags, ", "))
+	}
+
+	return w.Flush()
+}
+
+func (c *cli) pull(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("pull", flag.ExitOnError)
+	dir := flags.String("o", ".", "directory to write files to")
+	yes := flags.Bool("yes", false, "overwrite changed files without asking")
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		return errors.New("pull needs at least one post ID")
+	}
+
+	taken := map[string]bool{}
+	for _, id := range flags.Args() {
+		remote, err := c.fetch(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		// Titles can be shared or have no slug, so fall back to naming the
+		// file by ID as the site export does its pages
+		slug := remote.post.Slug()
+		if slug == "" || taken[slug] || holdsOtherPost(filepath.Join(*dir, slug+".md"), id) {
+			slug = remote.post.SlugWithID()
+		}
+		taken[slug] = true
+
+		path := filepath.Join(*dir, slug+".md")
+		if existing, err := os.ReadFile(path); err == nil {
+			ok, err := c.confirmChanges(path, "post "+id, string(existing), string(remote.file), *yes)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				continue
+			}
+		}
+
+		if err := os.WriteFile(path, remote.file, 0o644); err != nil {
+			return err
+		}
+		fmt.Fprintln(c.stderr, "Wrote", path)
+	}
+
+	return nil
+}
+
+func (c *cli) push(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("push", flag.ExitOnError)
+	yes := flags.Bool("yes", false, "overwrite changed posts without asking")
+	dryRun := flags.Bool("dry-run", false, "show what would change without changing anything")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return errors.New("push needs a directory")
+	}
+
+	var paths []string
+	err := filepath.WalkDir(flags.Arg(0), func(path string, entry os.DirEntry, err error) error {
+		if err == nil && !entry.IsDir() && strings.EqualFold(filepath.Ext(path), ".md") {
+			paths = append(paths, path)
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.sync(ctx, paths, *yes, *dryRun)
+}
+
+func (c *cli) newPost(args []string) error {
+	flags := flag.NewFlagSet("post new", flag.ExitOnError)
+	title := flags.String("title", "", "post title")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return errors.New("post new needs a file name")
+	}
+
+	path := flags.Arg(0)
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	}
+
+	content, err := frontmatter.Format(frontmatter.Post{Title: *title, Tags: []string{}}, "")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.stderr, "Wrote %s; publish it with: blogctl post publish %s\n", path, path)
+	return nil
+}
+
+func (c *cli) publish(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("post publish", flag.ExitOnError)
+	yes := flags.Bool("yes", false, "overwrite the post without asking")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return errors.New("post publish needs a file")
+	}
+
+	return c.sync(ctx, flags.Args(), *yes, false)
+}
+
+func (c *cli) edit(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("post edit", flag.ExitOnError)
+	yes := flags.Bool("yes", false, "save without asking")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return errors.New("post edit needs a post ID")
+	}
+
+	remote, err := c.fetch(ctx, flags.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp("", remote.post.Slug()+"-*.md")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(remote.file); err != nil {
+		return err
+	}
+	file.Close()
+
+	editor := os.Getenv("EDITOR")
+	if editor == "" {
+		editor = "vi"
+	}
+
+	// EDITOR may carry arguments, e.g. "code --wait"
+	editorArgs := append(strings.Fields(editor), file.Name())
+	cmd := exec.CommandContext(ctx, editorArgs[0], editorArgs[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("editor failed: %w", err)
+	}
+
+	edited, err := os.ReadFile(file.Name())
+	if err != nil {
+		return err
+	}
+
+	local, err := parseLocal(file.Name(), edited)
+	if err != nil {
+		return err
+	}
+
+	return c.update(ctx, remote, local, *yes)
+}
+
+func (c *cli) deletePost(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("post delete", flag.ExitOnError)
+	yes := flags.Bool("yes", false, "delete without asking")
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		return errors.New("post delete needs a post ID")
+	}
+
+	id := flags.Arg(0)
+	post, err := c.client.GetPost(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if !*yes {
+		ok, err := c.confirm(fmt.Sprintf("Move %q to the trash?", post.Title))
+		if err != nil || !ok {
+			return err
+		}
+	}
+
+	if err := c.client.DeletePost(ctx, id); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(c.stderr, "Moved", id, "to the trash")
+	return nil
+}
+
+// holdsOtherPost reports whether the file at path was pulled from a post
+// other than id.
+func holdsOtherPost(path, id string) bool {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+
+	var metadata frontmatter.Post
+	if _, err := frontmatter.Parse(content, &metadata); err != nil {
+		return false
+	}
+	return metadata.ID != "" && metadata.ID != id
+}
+
+// remotePost is a post with its Markdown, formatted as it would be saved.
+type remotePost struct {
+	post     postmodel.Post
+	markdown string
+	file     []byte
+}
+
+// fetch reads a post's metadata and downloads its Markdown from the
+// presigned URL the API returns.
+func (c *cli) fetch(ctx context.Context, id string) (remotePost, error) {
+	post, err := c.client.GetPost(ctx, id)
+	if err != nil {
+		return remotePost{}, err
+	}
+	if post.MdPostUrl == "" {
+		return remotePost{}, fmt.Errorf("post %s has no Markdown URL", id)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, post.MdPostUrl, nil)
+	if err != nil {
+		return remotePost{}, err
+	}
+
+	response, err := c.client.HTTPClient.Do(request)
+	if err != nil {
+		return remotePost{}, fmt.Errorf("failed to download post %s: %w", id, err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return remotePost{}, fmt.Errorf("failed to download post %s: %s", id, response.Status)
+	}
+
+	markdown, err := io.ReadAll(response.Body)
+	if err != nil {
+		return remotePost{}, err
+	}
+
+	file, err := frontmatter.Format(frontMatterOf(post), string(markdown))
+	if err != nil {
+		return remotePost{}, err
+	}
+
+	return remotePost{post: post, markdown: string(markdown), file: file}, nil
+}
+
+func frontMatterOf(post postmodel.Post) frontmatter.Post {
+	return frontmatter.Post{
+		ID:      post.ID,
+		Title:   post.Title,
+		Summary: post.Summary,
+		Tags:    post.Tags,
+	}
+}
+
+// update overwrites remote with local after showing what will change. The
+// expected version stops it from overwriting someone else's edit made since.
+func (c *cli) update(ctx context.Context, remote remotePost, local localPost, yes bool) error {
+	localFile, err := frontmatter.Format(frontMatterOf(local.asPost(remote.post.ID)), local.markdown)
+	if err != nil {
+		return err
+	}
+
+	ok, err := c.confirmChanges("post "+remote.post.ID, local.path, string(remote.file), string(localFile), yes)
+	if err != nil || !ok {
+		return err
+	}
+
+	input := models.UpdatePostInput{
+		Title:   &local.metadata.Title,
+		Summary: &local.metadata.Summary,
+		Tags:    &local.metadata.Tags,
+	}
+	if local.markdown != remote.markdown {
+		input.Content = &local.markdown
+	}
+
+	if _, err := c.client.UpdatePost(ctx, remote.post.ID, remote.post.Version, input); err != nil {
+		return err
+	}
+
+	fmt.Fprintln(c.stderr, "Updated", remote.post.ID)
+	return nil
+}
+
+// confirmChanges shows the diff from oldText to newText and asks before
+// overwriting. It reports false without asking when nothing changed.
+func (c *cli) confirmChanges(oldName, newName, oldText, newText string, yes bool) (bool, error) {
+	diff := unifiedDiff(oldName, newName, oldText, newText)
+	if diff == "" {
+		fmt.Fprintln(c.stderr, newName, "is unchanged")
+		return false, nil
+	}
+
+	fmt.Fprint(c.stdout, diff)
+	if yes {
+		return true, nil
+	}
+	return c.confirm("Overwrite " + oldName + "?")
+}
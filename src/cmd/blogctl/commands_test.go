@@ -0,0 +1,816 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/JaxonAdams/blog-backend/src/client"
+	"github.com/JaxonAdams/blog-backend/src/models"
+	auditmodel "github.com/JaxonAdams/blog-backend/src/models/audit"
+	idempotencymodel "github.com/JaxonAdams/blog-backend/src/models/idempotency"
+	postmodel "github.com/JaxonAdams/blog-backend/src/models/posts"
+	"github.com/JaxonAdams/blog-backend/src/router"
+	"github.com/JaxonAdams/blog-backend/src/routes"
+	"github.com/JaxonAdams/blog-backend/src/services/apperror"
+	"github.com/JaxonAdams/blog-backend/src/services/aws/dynamodb"
+	"github.com/JaxonAdams/blog-backend/src/services/aws/s3"
+	"github.com/JaxonAdams/blog-backend/src/services/config"
+	"github.com/JaxonAdams/blog-backend/src/services/frontmatter"
+	"github.com/JaxonAdams/blog-backend/src/services/jwt"
+	"github.com/JaxonAdams/blog-backend/src/services/secrets"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// memoryBucket keeps every version of each object, like the blog's
+// versioned bucket. Presigned URLs point at the test API's /bucket/ path.
+type memoryBucket struct {
+	// Panics on the methods blogctl never reaches
+	s3.Store
+
+	baseURL string
+
+	mu       sync.Mutex
+	uploads  int
+	versions map[string][]objectVersion
+}
+
+type objectVersion struct {
+	id      string
+	content string
+}
+
+func (b *memoryBucket) UploadPostHTML(postID, content string, ctx context.Context) (s3.UploadedObject, error) {
+	return b.put("posts/"+postID+".html", content), nil
+}
+
+func (b *memoryBucket) UploadPostMd(postID, content string, ctx context.Context) (s3.UploadedObject, error) {
+	return b.put("posts/"+postID+".md", content), nil
+}
+
+func (b *memoryBucket) RemoveUpload(object s3.UploadedObject, ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.versions[object.Key] = slices.DeleteFunc(b.versions[object.Key], func(v objectVersion) bool { return v.id == object.VersionID })
+	return nil
+}
+
+func (b *memoryBucket) GetPostHtmlURL(post postmodel.Post, ctx context.Context) (string, error) {
+	return b.baseURL + "/bucket/" + post.HtmlS3Key, nil
+}
+
+func (b *memoryBucket) GetPostMdURL(post postmodel.Post, ctx context.Context) (string, error) {
+	return b.baseURL + "/bucket/" + post.MdS3Key, nil
+}
+
+func (b *memoryBucket) ReadPostObject(key string, maxBytes int64, ctx context.Context) (string, error) {
+	content, ok := b.get(key)
+	if !ok {
+		return "", fmt.Errorf("no object %s", key)
+	}
+	if int64(len(content)) > maxBytes {
+		return "", s3.ErrCodeObjectTooLarge{Msg: key + " is too large"}
+	}
+	return content, nil
+}
+
+func (b *memoryBucket) put(key, content string) s3.UploadedObject {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.uploads++
+	version := objectVersion{id: strconv.Itoa(b.uploads), content: content}
+	b.versions[key] = append(b.versions[key], version)
+	return s3.UploadedObject{Key: key, VersionID: version.id}
+}
+
+// get returns the current version of key.
+func (b *memoryBucket) get(key string) (string, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	versions := b.versions[key]
+	if len(versions) == 0 {
+		return "", false
+	}
+	return versions[len(versions)-1].content, true
+}
+
+// memoryTables holds the posts and what writing them records, with the
+// conditions DynamoDBService puts on its writes.
+type memoryTables struct {
+	// Panics on the methods blogctl never reaches
+	dynamodb.Store
+
+	mu          sync.Mutex
+	posts       map[string]postmodel.Post
+	idempotency map[string]idempotencymodel.IdempotencyRecord
+	audit       []auditmodel.AuditEntry
+}
+
+func (m *memoryTables) UpsertPost(post postmodel.Post, ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.posts[post.ID] = post
+	return nil
+}
+
+func (m *memoryTables) UpsertPostIfVersion(post postmodel.Post, expectedVersion int64, ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if current, ok := m.posts[post.ID]; !ok || current.Version != expectedVersion {
+		return dynamodb.ErrCodeConditionFailed{Msg: "post " + post.ID + " has changed"}
+	}
+	m.posts[post.ID] = post
+	return nil
+}
+
+func (m *memoryTables) GetAllPosts(pageSize int32, startKey map[string]types.AttributeValue, ctx context.Context) ([]postmodel.Post, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	posts := []postmodel.Post{}
+	for _, post := range m.posts {
+		if !post.IsDeleted() {
+			posts = append(posts, post)
+		}
+	}
+	slices.SortFunc(posts, func(a, b postmodel.Post) int { return int(b.CreatedAt - a.CreatedAt) })
+	return posts, "", nil
+}
+
+func (m *memoryTables) GetPostById(id string, ctx context.Context) (postmodel.Post, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	post, ok := m.posts[id]
+	if !ok {
+		return postmodel.Post{}, dynamodb.ErrCodeNotFound{Msg: "no post found with id " + id}
+	}
+	return post, nil
+}
+
+func (m *memoryTables) PutAuditEntry(entry auditmodel.AuditEntry, ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.audit = append(m.audit, entry)
+	return nil
+}
+
+func (m *memoryTables) GetIdempotencyRecord(key string, ctx context.Context) (idempotencymodel.IdempotencyRecord, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	record, ok := m.idempotency[key]
+	if !ok {
+		return idempotencymodel.IdempotencyRecord{}, dynamodb.ErrCodeNotFound{Msg: "no idempotency record found for key " + key}
+	}
+	return record, nil
+}
+
+func (m *memoryTables) PutIdempotencyRecord(record idempotencymodel.IdempotencyRecord, claim bool, ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.idempotency[record.Key]; ok && claim {
+		return dynamodb.ErrCodeConditionFailed{Msg: "idempotency record already exists for key " + record.Key}
+	}
+	m.idempotency[record.Key] = record
+	return nil
+}
+
+func (m *memoryTables) DeleteIdempotencyRecord(key string, ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.idempotency, key)
+	return nil
+}
+
+// staticSecrets holds secrets in memory.
+type staticSecrets map[string]string
+
+func (s staticSecrets) GetSecret(ctx context.Context, name string) (string, error) {
+	value, ok := s[name]
+	if !ok {
+		return "", secrets.ErrCodeSecretNotFound{Msg: name + " is not set"}
+	}
+	return value, nil
+}
+
+// testAPI serves every route through the router, as the API Lambda does,
+// with API Gateway's part played by serve: it checks bearer tokens as the
+// authorizer would and turns requests into HTTP API events.
+type testAPI struct {
+	t        *testing.T
+	server   *httptest.Server
+	router   *router.Router
+	services models.HandlerServices
+	bucket   *memoryBucket
+	tables   *memoryTables
+	token    string
+}
+
+func newTestAPI(t *testing.T) *testAPI {
+	t.Helper()
+
+	api := &testAPI{
+		t:      t,
+		bucket: &memoryBucket{versions: map[string][]objectVersion{}},
+		tables: &memoryTables{
+			posts:       map[string]postmodel.Post{},
+			idempotency: map[string]idempotencymodel.IdempotencyRecord{},
+		},
+	}
+	api.server = httptest.NewServer(http.HandlerFunc(api.serve))
+	t.Cleanup(api.server.Close)
+	api.bucket.baseURL = api.server.URL
+
+	signer := jwt.NewSigner(staticSecrets{secrets.JWTSecret: "test-secret"})
+	api.services = models.HandlerServices{
+		Config: &config.Config{
+			DefaultPageSize:       10,
+			InlineContentMaxBytes: 512 * 1024,
+		},
+		S3Service:       api.bucket,
+		DynamoDBService: api.tables,
+		JWT:             signer,
+		Logger:          slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	api.router = router.New(api.services, routes.All())
+
+	token, err := signer.GenerateJWT("admin", "admin", context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.token = token
+
+	return api
+}
+
+func (api *testAPI) serve(w http.ResponseWriter, r *http.Request) {
+	if key, ok := strings.CutPrefix(r.URL.Path, "/bucket/"); ok {
+		content, ok := api.bucket.get(key)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, content)
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	event := events.APIGatewayV2HTTPRequest{
+		Version:        "2.0",
+		RawPath:        r.URL.Path,
+		RawQueryString: r.URL.RawQuery,
+		Headers:        map[string]string{},
+		Body:           string(body),
+		RequestContext: events.APIGatewayV2HTTPRequestContext{
+			RequestID: "test-request",
+			HTTP: events.APIGatewayV2HTTPRequestContextHTTPDescription{
+				Method:   r.Method,
+				Path:     r.URL.Path,
+				SourceIP: "127.0.0.1",
+			},
+		},
+	}
+	for name, values := range r.Header {
+		event.Headers[strings.ToLower(name)] = strings.Join(values, ",")
+	}
+	if query := r.URL.Query(); len(query) > 0 {
+		event.QueryStringParameters = map[string]string{}
+		for name, values := range query {
+			event.QueryStringParameters[name] = strings.Join(values, ",")
+		}
+	}
+
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		claims, err := api.services.JWT.ParseJWT(token, r.Context())
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnauthorized)
+			io.WriteString(w, `{"message":"Unauthorized"}`)
+			return
+		}
+		event.RequestContext.Authorizer = &events.APIGatewayV2HTTPRequestContextAuthorizerDescription{
+			Lambda: map[string]any{"role": claims.Role, "sub": claims.Subject},
+		}
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		api.t.Fatal(err)
+	}
+	reply, err := api.router.Invoke(r.Context(), payload)
+	if err != nil {
+		api.t.Errorf("router failed on %s %s: %v", r.Method, r.URL, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var response events.APIGatewayV2HTTPResponse
+	if err := json.Unmarshal(reply, &response); err != nil {
+		api.t.Fatal(err)
+	}
+	for name, value := range response.Headers {
+		w.Header().Set(name, value)
+	}
+	w.WriteHeader(response.StatusCode)
+	if response.IsBase64Encoded {
+		decoded, _ := base64.StdEncoding.DecodeString(response.Body)
+		w.Write(decoded)
+		return
+	}
+	io.WriteString(w, response.Body)
+}
+
+func (api *testAPI) client() *client.Client {
+	c := client.New(api.server.URL)
+	c.UseToken(api.token)
+	return c
+}
+
+// createPost adds a post through the API, as another user of it would.
+func (api *testAPI) createPost(title, markdown string, tags ...string) postmodel.Post {
+	api.t.Helper()
+
+	if tags == nil {
+		tags = []string{}
+	}
+	post, err := api.client().CreatePost(context.Background(), models.CreatePostInput{Title: title, Summary: "About " + title, Content: markdown, Tags: tags})
+	if err != nil {
+		api.t.Fatalf("CreatePost() error = %v", err)
+	}
+	return post
+}
+
+func (api *testAPI) post(id string) postmodel.Post {
+	api.t.Helper()
+
+	post, err := api.tables.GetPostById(id, context.Background())
+	if err != nil {
+		api.t.Fatal(err)
+	}
+	return post
+}
+
+func (api *testAPI) markdown(post postmodel.Post) string {
+	content, _ := api.bucket.get(post.MdS3Key)
+	return content
+}
+
+// testCLI runs commands against api, answering prompts with answers.
+type testCLI struct {
+	*cli
+	stdout, stderr *bytes.Buffer
+}
+
+func newTestCLI(api *testAPI, answers string) testCLI {
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	return testCLI{
+		cli: &cli{
+			client:   api.client(),
+			settings: settings{URL: api.server.URL},
+			stdin:    bufio.NewReader(strings.NewReader(answers)),
+			stdout:   stdout,
+			stderr:   stderr,
+		},
+		stdout: stdout,
+		stderr: stderr,
+	}
+}
+
+// postFile is the file pull writes for post.
+func postFile(post postmodel.Post, markdown string) string {
+	content, err := frontmatter.Format(frontMatterOf(post), markdown)
+	if err != nil {
+		panic(err)
+	}
+	return string(content)
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestPull(t *testing.T) {
+	tests := []struct {
+		name string
+		// Content of the file before pulling, if there is one
+		existing string
+		// The file already holds the post, from an earlier pull
+		pulledBefore bool
+		args         []string
+		answers      string
+		// Whether the file should hold the post afterwards
+		wantWritten bool
+		wantDiff    bool
+		wantPrompt  bool
+	}{
+		{
+			name:        "new file",
+			wantWritten: true,
+		},
+		{
+			name:         "unchanged file",
+			pulledBefore: true,
+		},
+		{
+			name:        "changed file is overwritten when confirmed",
+			existing:    "---\ntitle: Old title\n---\nLocal edits\n",
+			answers:     "y\n",
+			wantWritten: true,
+			wantDiff:    true,
+			wantPrompt:  true,
+		},
+		{
+			name:       "changed file is kept when declined",
+			existing:   "---\ntitle: Old title\n---\nLocal edits\n",
+			answers:    "n\n",
+			wantDiff:   true,
+			wantPrompt: true,
+		},
+		{
+			name:        "changed file is overwritten with -yes",
+			existing:    "---\ntitle: Old title\n---\nLocal edits\n",
+			args:        []string{"-yes"},
+			wantWritten: true,
+			wantDiff:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestAPI(t)
+			post := api.createPost("Hello World", "# Hello\n\nFirst post.\n", "go")
+			want := postFile(post, "# Hello\n\nFirst post.\n")
+
+			dir := t.TempDir()
+			path := filepath.Join(dir, "hello-world.md")
+			existing := tt.existing
+			if tt.pulledBefore {
+				existing = want
+			}
+			if existing != "" {
+				writeFile(t, path, existing)
+			}
+
+			c := newTestCLI(api, tt.answers)
+			args := append(append([]string{"-o", dir}, tt.args...), post.ID)
+			if err := c.pull(context.Background(), args); err != nil {
+				t.Fatalf("pull error = %v", err)
+			}
+
+			got := readFile(t, path)
+			switch {
+			case tt.wantWritten && got != want:
+				t.Errorf("file = %q, want the post %q", got, want)
+			case !tt.wantWritten && got != existing:
+				t.Errorf("file = %q, want it left as %q", got, existing)
+			}
+
+			diff := c.stdout.String()
+			if tt.wantDiff != (diff != "") {
+				t.Errorf("printed diff %q, want one: %v", diff, tt.wantDiff)
+			}
+			if tt.wantDiff && (!strings.Contains(diff, "--- "+path+"\n+++ post "+post.ID+"\n") ||
+				!strings.Contains(diff, "-Local edits\n") || !strings.Contains(diff, "+First post.\n")) {
+				t.Errorf("diff = %q, want the file's lines replaced by the post's", diff)
+			}
+			if prompted := strings.Contains(c.stderr.String(), "Overwrite "); prompted != tt.wantPrompt {
+				t.Errorf("stderr = %q, want a prompt: %v", c.stderr.String(), tt.wantPrompt)
+			}
+		})
+	}
+}
+
+func TestPullNamesFilesApart(t *testing.T) {
+	api := newTestAPI(t)
+	older := api.createPost("Hello World", "Older\n", "go")
+	newer := api.createPost("Hello, World!", "Newer\n", "go")
+	unslugged := api.createPost("こんにちは", "Untitled\n", "go")
+	other := api.createPost("Other", "Other\n", "go")
+
+	dir := t.TempDir()
+	// Pulled from another post before that was renamed
+	writeFile(t, filepath.Join(dir, "other.md"), "---\nid: post-elsewhere\ntitle: Other\n---\nElsewhere\n")
+
+	c := newTestCLI(api, "")
+	if err := c.pull(context.Background(), []string{"-o", dir, older.ID, newer.ID, unslugged.ID, other.ID}); err != nil {
+		t.Fatalf("pull error = %v", err)
+	}
+
+	for _, tt := range []struct {
+		file string
+		want string
+	}{
+		{file: "hello-world.md", want: postFile(older, "Older\n")},
+		{file: "hello-world-" + newer.ID[:8] + ".md", want: postFile(newer, "Newer\n")},
+		{file: unslugged.ID[:8] + ".md", want: postFile(unslugged, "Untitled\n")},
+		{file: "other-" + other.ID[:8] + ".md", want: postFile(other, "Other\n")},
+		{file: "other.md", want: "---\nid: post-elsewhere\ntitle: Other\n---\nElsewhere\n"},
+	} {
+		if got := readFile(t, filepath.Join(dir, tt.file)); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.file, got, tt.want)
+		}
+	}
+}
+
+func TestPush(t *testing.T) {
+	const markdown = "# Hello\n\nFirst post.\n"
+
+	tests := []struct {
+		name string
+		// Makes the file to push from the existing post; "" pushes a new post
+		file    func(post postmodel.Post) string
+		args    []string
+		answers string
+		// Content of the existing post afterwards, and of a created post
+		wantMarkdown string
+		wantCreated  string
+		wantDiff     bool
+		// Whether the file gains the ID of the post it was pushed to
+		wantID bool
+	}{
+		{
+			name:         "new post is created",
+			wantMarkdown: markdown,
+			wantCreated:  "New post.\n",
+			wantID:       true,
+		},
+		{
+			name:         "new post is not created with -dry-run",
+			args:         []string{"-dry-run"},
+			wantMarkdown: markdown,
+		},
+		{
+			name: "changed post is updated when confirmed",
+			file: func(post postmodel.Post) string {
+				return postFile(post, "# Hello\n\nEdited.\n")
+			},
+			answers:      "y\n",
+			wantMarkdown: "# Hello\n\nEdited.\n",
+			wantDiff:     true,
+			wantID:       true,
+		},
+		{
+			name: "changed post is kept when declined",
+			file: func(post postmodel.Post) string {
+				return postFile(post, "# Hello\n\nEdited.\n")
+			},
+			answers:      "n\n",
+			wantMarkdown: markdown,
+			wantDiff:     true,
+			wantID:       true,
+		},
+		{
+			name: "changed post is kept with -dry-run",
+			file: func(post postmodel.Post) string {
+				return postFile(post, "# Hello\n\nEdited.\n")
+			},
+			args:         []string{"-dry-run"},
+			wantMarkdown: markdown,
+			wantDiff:     true,
+			wantID:       true,
+		},
+		{
+			name: "file without an ID matches the post by slug",
+			file: func(post postmodel.Post) string {
+				post.ID = ""
+				return postFile(post, "# Hello\n\nEdited.\n")
+			},
+			args:         []string{"-yes"},
+			wantMarkdown: "# Hello\n\nEdited.\n",
+			wantDiff:     true,
+			wantID:       true,
+		},
+		{
+			name: "unchanged post is left alone",
+			file: func(post postmodel.Post) string {
+				return postFile(post, markdown)
+			},
+			wantMarkdown: markdown,
+			wantID:       true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestAPI(t)
+			post := api.createPost("Hello World", markdown, "go")
+
+			dir := t.TempDir()
+			path := filepath.Join(dir, "post.md")
+			if tt.file != nil {
+				writeFile(t, path, tt.file(post))
+			} else {
+				writeFile(t, path, "---\ntitle: Another Post\nsummary: Another\ntags: [go]\n---\nNew post.\n")
+			}
+
+			c := newTestCLI(api, tt.answers)
+			if err := c.push(context.Background(), append(tt.args, dir)); err != nil {
+				t.Fatalf("push error = %v", err)
+			}
+
+			updated := api.post(post.ID)
+			if got := api.markdown(updated); got != tt.wantMarkdown {
+				t.Errorf("post's Markdown = %q, want %q", got, tt.wantMarkdown)
+			}
+			if changed := updated.Version != post.Version; changed != (tt.wantMarkdown != markdown) {
+				t.Errorf("post went from version %d to %d", post.Version, updated.Version)
+			}
+
+			var created []postmodel.Post
+			for id, stored := range api.tables.posts {
+				if id != post.ID {
+					created = append(created, stored)
+				}
+			}
+			switch {
+			case tt.wantCreated == "" && len(created) > 0:
+				t.Errorf("created %+v, want no new post", created)
+			case tt.wantCreated != "" && len(created) != 1:
+				t.Fatalf("created %d posts, want 1", len(created))
+			case tt.wantCreated != "":
+				if got := api.markdown(created[0]); got != tt.wantCreated {
+					t.Errorf("created post's Markdown = %q, want %q", got, tt.wantCreated)
+				}
+			}
+
+			var metadata frontmatter.Post
+			if _, err := frontmatter.Parse([]byte(readFile(t, path)), &metadata); err != nil {
+				t.Fatal(err)
+			}
+			wantID := ""
+			switch {
+			case tt.wantID && tt.wantCreated != "":
+				wantID = created[0].ID
+			case tt.wantID:
+				wantID = post.ID
+			}
+			if metadata.ID != wantID {
+				t.Errorf("file's ID = %q, want %q", metadata.ID, wantID)
+			}
+
+			diff := c.stdout.String()
+			if tt.wantDiff != (diff != "") {
+				t.Errorf("printed diff %q, want one: %v", diff, tt.wantDiff)
+			}
+			if tt.wantDiff && (!strings.Contains(diff, "--- post "+post.ID+"\n") || !strings.Contains(diff, "-First post.\n") || !strings.Contains(diff, "+Edited.\n")) {
+				t.Errorf("diff = %q, want the post's lines replaced by the file's", diff)
+			}
+		})
+	}
+}
+
+// Environment of the editor started by TestEdit, which runs this test binary
+const (
+	editorEnv = "BLOGCTL_TEST_EDITOR"
+	// The editor first saves this over the post, as another user would
+	concurrentEditEnv = "BLOGCTL_TEST_CONCURRENT_EDIT"
+	apiURLEnv         = "BLOGCTL_TEST_API_URL"
+	apiTokenEnv       = "BLOGCTL_TEST_API_TOKEN"
+)
+
+// TestEditorProcess is the editor for TestEdit. It replaces the last line of
+// the file it is given.
+func TestEditorProcess(t *testing.T) {
+	if os.Getenv(editorEnv) != "1" {
+		t.Skip("run by TestEdit as $EDITOR")
+	}
+
+	path := os.Args[len(os.Args)-1]
+	if err := editAsOtherUser(path); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	content, err := os.ReadFile(path)
+	if err == nil {
+		lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+		lines[len(lines)-1] = "Edited."
+		err = os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o644)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func editAsOtherUser(path string) error {
+	markdown := os.Getenv(concurrentEditEnv)
+	if markdown == "" {
+		return nil
+	}
+
+	var metadata frontmatter.Post
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if _, err := frontmatter.Parse(content, &metadata); err != nil {
+		return err
+	}
+
+	c := client.New(os.Getenv(apiURLEnv))
+	c.UseToken(os.Getenv(apiTokenEnv))
+	post, err := c.GetPost(context.Background(), metadata.ID)
+	if err != nil {
+		return err
+	}
+	_, err = c.UpdatePost(context.Background(), post.ID, post.Version, models.UpdatePostInput{Content: &markdown})
+	return err
+}
+
+func TestEdit(t *testing.T) {
+	const markdown = "# Hello\n\nFirst post.\n"
+
+	tests := []struct {
+		name string
+		// Saved over the post while it is being edited
+		concurrentEdit string
+		args           []string
+		answers        string
+		wantMarkdown   string
+		wantErr        apperror.Code
+	}{
+		{
+			name:         "edit is saved when confirmed",
+			answers:      "y\n",
+			wantMarkdown: "# Hello\n\nEdited.\n",
+		},
+		{
+			name:         "edit is dropped when declined",
+			answers:      "n\n",
+			wantMarkdown: markdown,
+		},
+		{
+			name:           "post changed while editing",
+			concurrentEdit: "# Hello\n\nSomeone else's edit.\n",
+			args:           []string{"-yes"},
+			wantMarkdown:   "# Hello\n\nSomeone else's edit.\n",
+			wantErr:        apperror.CodeVersionConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			api := newTestAPI(t)
+			post := api.createPost("Hello World", markdown, "go")
+
+			t.Setenv("EDITOR", os.Args[0]+" -test.run=^TestEditorProcess$ --")
+			t.Setenv(editorEnv, "1")
+			t.Setenv(concurrentEditEnv, tt.concurrentEdit)
+			t.Setenv(apiURLEnv, api.server.URL)
+			t.Setenv(apiTokenEnv, api.token)
+
+			c := newTestCLI(api, tt.answers)
+			err := c.edit(context.Background(), append(tt.args, post.ID))
+			if got := apperror.CodeOf(err); (err != nil || tt.wantErr != "") && got != tt.wantErr {
+				t.Fatalf("edit error = %v, want %q", err, tt.wantErr)
+			}
+
+			if got := api.markdown(api.post(post.ID)); got != tt.wantMarkdown {
+				t.Errorf("post's Markdown = %q, want %q", got, tt.wantMarkdown)
+			}
+			if diff := c.stdout.String(); !strings.Contains(diff, "-First post.\n+Edited.\n") {
+				t.Errorf("diff = %q, want the edited line", diff)
+			}
+		})
+	}
+}
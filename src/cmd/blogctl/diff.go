@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+const diffContext = 3
+
+// unifiedDiff compares two texts line by line, returning "" when they are
+// equal.
+func unifiedDiff(oldName, newName, oldText, newText string) string {
+	if oldText == newText {
+		return ""
+	}
+
+	oldLines, newLines := splitLines(oldText), splitLines(newText)
+	ops := diffLines(oldLines, newLines)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", oldName, newName)
+
+	// Group changes closer than twice the context into one hunk
+	for start := 0; start < len(ops); {
+		if ops[start].kind == ' ' {
+			start++
+			continue
+		}
+
+		end := start
+		for i := start; i < len(ops); i++ {
+			if ops[i].kind != ' ' {
+				end = i + 1
+			} else if i-end >= 2*diffContext {
+				break
+			}
+		}
+
+		from, to := max(start-diffContext, 0), min(end+diffContext, len(ops))
+		writeHunk(&b, ops[from:to])
+		start = to
+	}
+
+	return b.String()
+}
+
+type diffOp struct {
+	kind rune // ' ', '-' or '+'
+	line string
+	// 1-based line numbers in the old and new texts
+	oldLine, newLine int
+}
+
+// diffLines finds a longest common subsequence of the two texts' lines and
+// reports everything else as removed or added.
+func diffLines(oldLines, newLines []string) []diffOp {
+	n, m := len(oldLines), len(newLines)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if oldLines[i] == newLines[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var ops []diffOp
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && oldLines[i] == newLines[j]:
+			ops = append(ops, diffOp{' ', oldLines[i], i + 1, j + 1})
+			i++
+			j++
+		case j == m || i < n && lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', oldLines[i], i + 1, j})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', newLines[j], i, j + 1})
+			j++
+		}
+	}
+
+	return ops
+}
+
+func writeHunk(b *strings.Builder, ops []diffOp) {
+	var oldStart, newStart, oldCount, newCount int
+	for _, op := range ops {
+		if op.kind != '+' {
+			if oldCount == 0 {
+				oldStart = op.oldLine
+			}
+			oldCount++
+		}
+		if op.kind != '-' {
+			if newCount == 0 {
+				newStart = op.newLine
+			}
+			newCount++
+		}
+	}
+
+	// Empty ranges start at the line before them
+	if oldCount == 0 {
+		oldStart = ops[0].oldLine
+	}
+	if newCount == 0 {
+		newStart = ops[0].newLine
+	}
+
+	fmt.Fprintf(b, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)
+	for _, op := range ops {
+		fmt.Fprintf(b, "%c%s\n", op.kind, op.line)
+	}
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
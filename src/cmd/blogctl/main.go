@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"github.com/JaxonAdams/blog-backend/src/client"
+)
+
+const usage = `Usage: blogctl [-url URL] <command> [arguments]
+
+Commands:
+  login [username]             Log in and save the token for later commands
+  list [-trash]                List posts
+  pull [-o dir] [-yes] <id>... Download posts as Markdown files
+  push [-yes] [-dry-run] <dir> Create or update a post for each .md file in dir
+  post new [-title T] <file>   Write a new Markdown file to fill in
+  post publish [-yes] <file>   Create or update the post for one file
+  post edit [-yes] <id>        Edit a post in $EDITOR
+  post delete [-yes] <id>      Move a post to the trash
+
+The API URL defaults to the one saved by login, or BLOG_API_URL. Set
+BLOG_API_KEY to authenticate with an API key instead of logging in.
+`
+
+// settings are saved between runs by login.
+type settings struct {
+	URL   string `json:"url"`
+	Token string `json:"token,omitempty"`
+}
+
+// cli carries what every command needs.
+type cli struct {
+	client   *client.Client
+	settings settings
+	stdin    *bufio.Reader
+	stdout   io.Writer
+	// Prompts and progress, kept apart from output such as diffs
+	stderr io.Writer
+}
+
+func main() {
+	flags := flag.NewFlagSet("blogctl", flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	apiURL := flags.String("url", "", "API URL, e.g. http://localhost:3000")
+	flags.Parse(os.Args[1:])
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := run(ctx, *apiURL, flags.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, "blogctl:", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, apiURL string, args []string) error {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	saved, err := loadSettings()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case apiURL != "":
+		saved.URL = apiURL
+	case os.Getenv("BLOG_API_URL") != "":
+		saved.URL = os.Getenv("BLOG_API_URL")
+	}
+	if saved.URL == "" {
+		return errors.New("no API URL; pass -url or set BLOG_API_URL")
+	}
+
+	c := &cli{
+		client:   client.New(saved.URL),
+		settings: saved,
+		stdin:    bufio.NewReader(os.Stdin),
+		stdout:   os.Stdout,
+		stderr:   os.Stderr,
+	}
+	c.client.MFACode = c.promptMFACode
+	if key := os.Getenv("BLOG_API_KEY"); key != "" {
+		c.client.APIKey = key
+	} else {
+		c.client.UseToken(saved.Token)
+	}
+
+	command, args := args[0], args[1:]
+	switch command {
+	case "login":
+		return c.login(ctx, args)
+	case "list":
+		return c.list(ctx, args)
+	case "pull":
+		return c.pull(ctx, args)
+	case "push":
+		return c.push(ctx, args)
+	case "post":
+		if len(args) == 0 {
+			return errors.New("post needs a subcommand: new, publish, edit or delete")
+		}
+		switch args[0] {
+		case "new":
+			return c.newPost(args[1:])
+		case "publish":
+			return c.publish(ctx, args[1:])
+		case "edit":
+			return c.edit(ctx, args[1:])
+		case "delete":
+			return c.deletePost(ctx, args[1:])
+		}
+		return fmt.Errorf("unknown post subcommand %q", args[0])
+	}
+
+	return fmt.Errorf("unknown command %q", command)
+}
+
+func settingsPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "blogctl", "config.json"), nil
+}
+
+func loadSettings() (settings, error) {
+	path, err := settingsPath()
+	if err != nil {
+		return settings{}, err
+	}
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return settings{}, nil
+	}
+	if err != nil {
+		return settings{}, err
+	}
+
+	var saved settings
+	if err := json.Unmarshal(content, &saved); err != nil {
+		return settings{}, fmt.Errorf("invalid settings in %s: %w", path, err)
+	}
+	return saved, nil
+}
+
+func saveSettings(saved settings) error {
+	path, err := settingsPath()
+	if err != nil {
+		return err
+	}
+
+	content, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// The token grants admin access until it expires
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0o600)
+}
+
+// prompt asks a question on stderr and reads the answer from stdin.
+func (c *cli) prompt(question string) (string, error) {
+	fmt.Fprint(c.stderr, question)
+	answer, err := c.stdin.ReadString('\n')
+	if err != nil && answer == "" {
+		return "", err
+	}
+	return strings.TrimSpace(answer), nil
+}
+
+// confirm asks a yes/no question, defaulting to no.
+func (c *cli) confirm(question string) (bool, error) {
+	answer, err := c.prompt(question + " [y/N] ")
+	if err != nil {
+		return false, err
+	}
+	return strings.EqualFold(answer, "y") || strings.EqualFold(answer, "yes"), nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/JaxonAdams/blog-backend/src/models"
+	postmodel "github.com/JaxonAdams/blog-backend/src/models/posts"
+	"github.com/JaxonAdams/blog-backend/src/services/frontmatter"
+)
+
+// localPost is a Markdown file with front matter.
+type localPost struct {
+	path     string
+	metadata frontmatter.Post
+	markdown string
+}
+
+func parseLocal(path string, content []byte) (localPost, error) {
+	var metadata frontmatter.Post
+	markdown, err := frontmatter.Parse(content, &metadata)
+	if err != nil {
+		return localPost{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if metadata.Title == "" {
+		return localPost{}, fmt.Errorf("%s: front matter needs a title", path)
+	}
+	if metadata.Tags == nil {
+		metadata.Tags = []string{}
+	}
+
+	return localPost{path: path, metadata: metadata, markdown: markdown}, nil
+}
+
+func (l localPost) slug() string {
+	if l.metadata.Slug != "" {
+		return l.metadata.Slug
+	}
+	return postmodel.Slugify(l.metadata.Title)
+}
+
+func (l localPost) asPost(id string) postmodel.Post {
+	return postmodel.Post{ID: id, Title: l.metadata.Title, Summary: l.metadata.Summary, Tags: l.metadata.Tags}
+}
+
+// sync creates a post for each file that matches none by ID or slug and
+// updates the rest. New posts' IDs are written back into their files.
+func (c *cli) sync(ctx context.Context, paths []string, yes, dryRun bool) error {
+	byID := map[string]postmodel.Post{}
+	bySlug := map[string]postmodel.Post{}
+	for post, err := range c.client.ListPosts(ctx, 100) {
+		if err != nil {
+			return err
+		}
+		byID[post.ID] = post
+		// Titles with no ASCII letters or digits have no slug to match by
+		if slug := post.Slug(); slug != "" {
+			bySlug[slug] = post
+		}
+	}
+
+	var failed []string
+	for _, path := range paths {
+		if err := c.syncFile(ctx, path, byID, bySlug, yes, dryRun); err != nil {
+			fmt.Fprintln(c.stderr, "Error:", err)
+			failed = append(failed, path)
+		}
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d files failed: %s", len(failed), len(paths), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+func (c *cli) syncFile(ctx context.Context, path string, byID, bySlug map[string]postmodel.Post, yes, dryRun bool) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	local, err := parseLocal(path, content)
+	if err != nil {
+		return err
+	}
+
+	match, found := byID[local.metadata.ID]
+	if !found && local.metadata.ID == "" && local.slug() != "" {
+		match, found = bySlug[local.slug()]
+	}
+	if !found && local.metadata.ID != "" {
+		return fmt.Errorf("%s: post %s does not exist", path, local.metadata.ID)
+	}
+
+	if !found {
+		if dryRun {
+			fmt.Fprintln(c.stderr, "Would create", path)
+			return nil
+		}
+
+		post, err := c.client.CreatePost(ctx, models.CreatePostInput{
+			Title:   local.metadata.Title,
+			Summary: local.metadata.Summary,
+			Tags:    local.metadata.Tags,
+			Content: local.markdown,
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		fmt.Fprintln(c.stderr, "Created", post.ID, "from", path)
+		return writeID(local, post.ID)
+	}
+
+	remote, err := c.fetch(ctx, match.ID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	if dryRun {
+		localFile, err := frontmatter.Format(frontMatterOf(local.asPost(match.ID)), local.markdown)
+		if err != nil {
+			return err
+		}
+		if diff := unifiedDiff("post "+match.ID, path, string(remote.file), string(localFile)); diff != "" {
+			fmt.Fprint(c.stdout, diff)
+		} else {
+			fmt.Fprintln(c.stderr, path, "is unchanged")
+		}
+		return nil
+	}
+
+	if err := c.update(ctx, remote, local, yes); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	if local.metadata.ID == "" {
+		return writeID(local, match.ID)
+	}
+	return nil
+}
+
+// writeID records the post's ID in its file, so later pushes match it even
+// after the title changes.
+func writeID(local localPost, id string) error {
+	local.metadata.ID = id
+	content, err := frontmatter.Format(local.metadata, local.markdown)
+	if err != nil {
+		return err
+	}
+
+	info, err := os.Stat(local.path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(local.path, content, info.Mode().Perm())
+}
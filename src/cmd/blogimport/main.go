@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"text/tabwriter"
+
+	"github.com/JaxonAdams/blog-backend/src/helpers"
+	"github.com/JaxonAdams/blog-backend/src/models"
+	auditmodel "github.com/JaxonAdams/blog-backend/src/models/audit"
+	auditservice "github.com/JaxonAdams/blog-backend/src/services/audit"
+	"github.com/JaxonAdams/blog-backend/src/services/aws/dynamodb"
+	"github.com/JaxonAdams/blog-backend/src/services/aws/s3"
+	"github.com/JaxonAdams/blog-backend/src/services/config"
+	importservice "github.com/JaxonAdams/blog-backend/src/services/import"
+	"github.com/JaxonAdams/blog-backend/src/services/logging"
+)
+
+const actor = "system:import"
+
+const usage = `Usage: blogimport [-dry-run] [-tag-map file.json] [-default-tag tag] <source> <path>
+
+Sources:
+  wordpress  a WXR file from Tools > Export
+  ghost      a JSON file from Settings > Labs > Export
+  hugo       a site directory, or its content directory
+  jekyll     a site directory containing _posts
+
+Published posts are converted to Markdown and created with their original
+publish dates. Posts whose slug already exists are left alone, so an import
+can be run again. Everything that could not be converted is listed.
+
+-dry-run only converts and reports; it needs no AWS access. Otherwise it
+reads the same configuration as the Lambda functions, e.g. from CONFIG_FILE
+or S3_BUCKET_NAME, POST_METADATA_TABLE_NAME and AUDIT_LOG_TABLE_NAME.
+`
+
+func main() {
+	flags := flag.NewFlagSet("blogimport", flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	dryRun := flags.Bool("dry-run", false, "convert and report without creating posts")
+	tagMap := flags.String("tag-map", "", "JSON object renaming categories and tags; \"\" drops one")
+	defaultTag := flags.String("default-tag", "", "tag for posts that have none")
+	flags.Parse(os.Args[1:])
+
+	if flags.NArg() != 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	options := importservice.Options{DefaultTag: *defaultTag}
+	if *tagMap != "" {
+		content, err := os.ReadFile(*tagMap)
+		if err == nil {
+			err = json.Unmarshal(content, &options.TagMap)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "blogimport: invalid tag map:", err)
+			os.Exit(2)
+		}
+	}
+
+	if err := run(ctx, flags.Arg(0), flags.Arg(1), options, *dryRun); err != nil {
+		fmt.Fprintln(os.Stderr, "blogimport:", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, source, path string, options importservice.Options, dryRun bool) error {
+	result, err := read(source, path, options)
+	if err != nil {
+		return err
+	}
+
+	printIssues(result)
+
+	if dryRun {
+		printPosts(result)
+		return nil
+	}
+
+	cfg, err := config.Load(ctx, config.BucketName, config.PostTableName, config.AuditLogTableName)
+	if err != nil {
+		return err
+	}
+
+	services := models.HandlerServices{
+		Config:          cfg,
+		Logger:          logging.New().With("actor", actor),
+		S3Service:       s3.New(ctx, cfg),
+		DynamoDBService: dynamodb.New(ctx, cfg),
+	}
+
+	// One ID ties together the audit entries of a run
+	runID := helpers.NewID()
+	applyErr := importservice.Apply(&result, services, ctx)
+	for _, post := range result.Posts {
+		if post.Created == nil {
+			continue
+		}
+		entry := auditservice.NewSystemEntry(actor, auditmodel.ActionPostCreate, post.PostID, runID)
+		entry.After = auditservice.PostMetadata(*post.Created)
+		auditservice.Record(entry, services, ctx)
+	}
+
+	printPosts(result)
+	return applyErr
+}
+
+func read(source, path string, options importservice.Options) (importservice.Result, error) {
+	switch source {
+	case "hugo":
+		return importservice.ReadHugo(path, options)
+	case "jekyll":
+		return importservice.ReadJekyll(path, options)
+	case "wordpress", "ghost":
+	default:
+		return importservice.Result{}, fmt.Errorf("unknown source %q", source)
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return importservice.Result{}, err
+	}
+	defer file.Close()
+
+	if source == "wordpress" {
+		return importservice.ReadWordPress(file, options)
+	}
+	return importservice.ReadGhost(file, options)
+}
+
+func printIssues(result importservice.Result) {
+	if len(result.Issues) == 0 {
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stderr, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SOURCE\tISSUE")
+	for _, issue := range result.Issues {
+		message := issue.Message
+		if issue.Skipped {
+			message = "skipped: " + message
+		}
+		fmt.Fprintf(w, "%s\t%s\n", issue.Source, message)
+	}
+	w.Flush()
+	fmt.Fprintln(os.Stderr)
+}
+
+func printPosts(result importservice.Result) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "STATUS\tPUBLISHED\tPOST\tTITLE\tSOURCE")
+	counts := map[importservice.Status]int{}
+	for _, post := range result.Posts {
+		counts[post.Status]++
+
+		status := string(post.Status)
+		if post.Error != "" {
+			status += ": " + post.Error
+		}
+		published := "-"
+		if !post.CreatedAt.IsZero() {
+			published = post.CreatedAt.Format("2006-01-02")
+		}
+		postID := post.PostID
+		if postID == "" {
+			postID = "-"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", status, published, postID, post.Input.Title, post.Source)
+	}
+	w.Flush()
+
+	var skipped int
+	for _, issue := range result.Issues {
+		if issue.Skipped {
+			skipped++
+		}
+	}
+
+	fmt.Printf("%d ready, %d created, %d already existed, %d failed; %d skipped\n",
+		counts[importservice.StatusReady], counts[importservice.StatusCreated],
+		counts[importservice.StatusExists], counts[importservice.StatusFailed], skipped)
+}
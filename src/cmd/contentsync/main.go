@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/JaxonAdams/blog-backend/src/helpers"
+	"github.com/JaxonAdams/blog-backend/src/models"
+	auditmodel "github.com/JaxonAdams/blog-backend/src/models/audit"
+	auditservice "github.com/JaxonAdams/blog-backend/src/services/audit"
+	"github.com/JaxonAdams/blog-backend/src/services/aws/dynamodb"
+	"github.com/JaxonAdams/blog-backend/src/services/aws/s3"
+	"github.com/JaxonAdams/blog-backend/src/services/config"
+	"github.com/JaxonAdams/blog-backend/src/services/logging"
+	syncservice "github.com/JaxonAdams/blog-backend/src/services/sync"
+)
+
+const actor = "system:content-sync"
+
+const usage = `Usage: contentsync [-dry-run] [-prune] <dir | archive.tar.gz>
+
+Makes the blog's posts match a tree of Markdown files with front matter:
+files with no matching post are created and changed files update their
+post. With -prune, posts no file matches are moved to the trash. A tree
+with no Markdown files is refused.
+
+It reads the same configuration as the Lambda functions, e.g. from
+CONFIG_FILE or S3_BUCKET_NAME, POST_METADATA_TABLE_NAME and
+AUDIT_LOG_TABLE_NAME.
+`
+
+func main() {
+	flags := flag.NewFlagSet("contentsync", flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	dryRun := flags.Bool("dry-run", false, "show the plan without changing anything")
+	prune := flags.Bool("prune", false, "move posts no file matches to the trash")
+	flags.Parse(os.Args[1:])
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := run(ctx, flags.Arg(0), *dryRun, *prune); err != nil {
+		fmt.Fprintln(os.Stderr, "contentsync:", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, source string, dryRun, prune bool) error {
+	files, err := readSource(source)
+	if err != nil {
+		return err
+	}
+
+	cfg, err := config.Load(ctx, config.BucketName, config.PostTableName, config.AuditLogTableName)
+	if err != nil {
+		return err
+	}
+
+	services := models.HandlerServices{
+		Config:          cfg,
+		Logger:          logging.New().With("actor", actor),
+		S3Service:       s3.New(ctx, cfg),
+		DynamoDBService: dynamodb.New(ctx, cfg),
+	}
+
+	plan, err := syncservice.BuildPlan(files, prune, services, ctx)
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		printPlan(plan)
+		return nil
+	}
+
+	// One ID ties together the audit entries of a run
+	runID := helpers.NewID()
+	plan, applyErr := syncservice.Apply(plan, services, ctx)
+	syncservice.RecordAudit(plan, func(action, targetID string) auditmodel.AuditEntry {
+		return auditservice.NewSystemEntry(actor, action, targetID, runID)
+	}, services, ctx)
+
+	printPlan(plan)
+	return applyErr
+}
+
+func readSource(source string) ([]syncservice.SourceFile, error) {
+	info, err := os.Stat(source)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return syncservice.ReadDir(source)
+	}
+
+	file, err := os.Open(source)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return syncservice.ReadTarball(file)
+}
+
+func printPlan(plan syncservice.Plan) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ACTION\tPOST\tPATH\tCHANGES")
+	for _, change := range plan.Changes {
+		if change.Action == syncservice.ActionUnchanged {
+			continue
+		}
+
+		details := strings.Join(change.Fields, ", ")
+		if change.Error != "" {
+			details = "failed: " + change.Error
+		}
+
+		postID := change.PostID
+		if postID == "" {
+			postID = "-"
+		}
+		path := change.Path
+		if path == "" {
+			path = "-"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", change.Action, postID, path, details)
+	}
+	w.Flush()
+
+	counts := plan.Counts()
+	verb := "Would make"
+	if plan.Applied {
+		verb = "Made"
+	}
+	fmt.Printf("%s %d creates, %d updates and %d deletes; %d posts unchanged\n",
+		verb, counts[syncservice.ActionCreate], counts[syncservice.ActionUpdate], counts[syncservice.ActionDelete], counts[syncservice.ActionUnchanged])
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+
+	"github.com/JaxonAdams/blog-backend/src/models"
+	"github.com/JaxonAdams/blog-backend/src/services/aws/dynamodb"
+	"github.com/JaxonAdams/blog-backend/src/services/aws/s3"
+	"github.com/JaxonAdams/blog-backend/src/services/config"
+	"github.com/JaxonAdams/blog-backend/src/services/logging"
+	siteservice "github.com/JaxonAdams/blog-backend/src/services/site"
+)
+
+const usage = `Usage: siteexport [-o dir | -s3] [-templates dir] [-page-size n]
+
+Renders every published post as a static site: paginated index and tag
+pages, a page per post, RSS and Atom feeds, and a sitemap. Links are made
+from SITE_URL.
+
+With -o, the site replaces the contents of dir once it has been rendered
+in full. dir must be empty or hold an earlier export. With -s3, it is
+written under SITE_EXPORT_PREFIX in the blog's bucket, as the scheduled
+Lambda does.
+
+It reads the same configuration as the Lambda functions, e.g. from
+CONFIG_FILE or S3_BUCKET_NAME, POST_METADATA_TABLE_NAME and SITE_URL.
+`
+
+func main() {
+	flags := flag.NewFlagSet("siteexport", flag.ExitOnError)
+	flags.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	output := flags.String("o", "site", "directory to write the site to")
+	toS3 := flags.Bool("s3", false, "write to SITE_EXPORT_PREFIX in the bucket instead of a directory")
+	templates := flags.String("templates", "", "directory of templates replacing the built-in ones")
+	pageSize := flags.Int("page-size", 0, "posts per index page (default DEFAULT_PAGE_SIZE)")
+	flags.Parse(os.Args[1:])
+
+	if flags.NArg() != 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	options := siteservice.Options{TemplateDir: *templates, PageSize: *pageSize}
+
+	var err error
+	if *toS3 {
+		err = exportToS3(ctx, options)
+	} else {
+		err = exportToDir(ctx, *output, options)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "siteexport:", err)
+		os.Exit(1)
+	}
+}
+
+func loadServices(ctx context.Context) (models.HandlerServices, error) {
+	cfg, err := config.Load(ctx, config.BucketName, config.PostTableName, config.SiteURL)
+	if err != nil {
+		return models.HandlerServices{}, err
+	}
+
+	return models.HandlerServices{
+		Config:          cfg,
+		Logger:          logging.New().With("actor", "system:site-export"),
+		S3Service:       s3.New(ctx, cfg),
+		DynamoDBService: dynamodb.New(ctx, cfg),
+	}, nil
+}
+
+func exportToS3(ctx context.Context, options siteservice.Options) error {
+	services, err := loadServices(ctx)
+	if err != nil {
+		return err
+	}
+
+	output := siteservice.NewS3Output(services.Config.Site.ExportPrefix, services, ctx)
+	summary, err := siteservice.Generate(output, options, services, ctx)
+	if err != nil {
+		return err
+	}
+
+	removed, err := output.RemoveStale()
+	if err != nil {
+		return err
+	}
+
+	printSummary(summary, "s3://"+services.Config.BucketName+"/"+services.Config.Site.ExportPrefix)
+	fmt.Printf("Left %d unchanged files as they were\n", output.Unchanged())
+	fmt.Printf("Removed %d stale files\n", removed)
+	return nil
+}
+
+func exportToDir(ctx context.Context, dir string, options siteservice.Options) error {
+	if err := checkReplaceable(dir); err != nil {
+		return err
+	}
+
+	services, err := loadServices(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Rendered beside the destination first, so a failed export never
+	// leaves a half-written site
+	staging, err := os.MkdirTemp(filepath.Dir(filepath.Clean(dir)), ".site-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(staging)
+
+	summary, err := siteservice.Generate(siteservice.DirOutput{Root: staging}, options, services, ctx)
+	if err != nil {
+		return err
+	}
+	if err := os.Chmod(staging, 0o755); err != nil {
+		return err
+	}
+
+	if err := replaceDir(dir, staging); err != nil {
+		return err
+	}
+
+	printSummary(summary, dir)
+	return nil
+}
+
+// checkReplaceable refuses to replace a directory that is neither empty nor
+// an earlier export.
+func checkReplaceable(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) || (err == nil && len(entries) == 0) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "sitemap.xml")); err != nil {
+		return fmt.Errorf("%s is not empty and does not hold an earlier export", dir)
+	}
+	return nil
+}
+
+func replaceDir(dir, staging string) error {
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return os.Rename(staging, dir)
+	}
+
+	previous := staging + "-previous"
+	if err := os.Rename(dir, previous); err != nil {
+		return err
+	}
+	if err := os.Rename(staging, dir); err != nil {
+		os.Rename(previous, dir)
+		return err
+	}
+	return os.RemoveAll(previous)
+}
+
+func printSummary(summary siteservice.Summary, target string) {
+	fmt.Printf("Wrote %d files for %d posts and %d tags to %s\n", summary.Files, summary.Posts, summary.Tags, target)
+}
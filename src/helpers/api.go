@@ -3,29 +3,44 @@ package helpers
 import (
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"os"
+	"reflect"
+	"slices"
 	"strconv"
+	"strings"
 
 	"github.com/JaxonAdams/blog-backend/src/models"
+	postmodel "github.com/JaxonAdams/blog-backend/src/models/posts"
+	"github.com/JaxonAdams/blog-backend/src/services/apperror"
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 )
 
 func UserHasAdminRole(request events.APIGatewayProxyRequest) bool {
-	lambdaCtx, ok := request.RequestContext.Authorizer["lambda"]
-	if !ok || lambdaCtx == nil {
+	role, ok := getAuthorizerValue(request, "role")
+	if !ok {
 		return false
 	}
 
-	roleValue, ok := lambdaCtx.(map[string]any)["role"]
+	return role == "admin"
+}
+
+func UserHasScope(request events.APIGatewayProxyRequest, scope string) bool {
+	if UserHasAdminRole(request) {
+		return true
+	}
 
-	role, ok := roleValue.(string)
+	scopes, ok := getAuthorizerValue(request, "scopes")
 	if !ok {
 		return false
 	}
 
-	return role == "admin"
+	return slices.Contains(strings.Fields(scopes), scope)
+}
+
+func GetRequestSubject(request events.APIGatewayProxyRequest) (string, bool) {
+	return getAuthorizerValue(request, "sub")
 }
 
 func ParseCreatePostInput(request events.APIGatewayProxyRequest) (models.CreatePostInput, error) {
@@ -33,36 +48,53 @@ func ParseCreatePostInput(request events.APIGatewayProxyRequest) (models.CreateP
 
 	err := json.Unmarshal([]byte(request.Body), &input)
 	if err != nil {
-		return models.CreatePostInput{}, err
+		return models.CreatePostInput{}, invalidBody(err)
 	}
 
-	if input.Title == "" || input.Content == "" {
-		return models.CreatePostInput{}, fmt.Errorf("fields title and content are required")
-	}
-
-	if len(input.Tags) == 0 {
-		return models.CreatePostInput{}, fmt.Errorf("at least one tag is required")
+	if err := ValidateInput(input); err != nil {
+		return models.CreatePostInput{}, err
 	}
 
 	return input, nil
 }
 
 func ParseGetPostByIdInput(request events.APIGatewayProxyRequest) (models.GetPostByIdInput, error) {
-	pathParams := request.PathParameters
+	id := request.PathParameters["post_id"]
+
+	// A .md or .html suffix selects the representation like an Accept header
+	var format string
+	if base, ok := strings.CutSuffix(id, ".md"); ok {
+		id, format = base, postmodel.FormatMarkdown
+	} else if base, ok := strings.CutSuffix(id, ".html"); ok {
+		id, format = base, postmodel.FormatHTML
+	}
 
-	id, exists := pathParams["post_id"]
-	if !exists {
-		return models.GetPostByIdInput{}, fmt.Errorf("post_id path param is required")
+	var include []string
+	if value := request.QueryStringParameters["include"]; value != "" {
+		for _, format := range strings.Split(value, ",") {
+			format = strings.TrimSpace(format)
+			if !slices.Contains(include, format) {
+				include = append(include, format)
+			}
+		}
 	}
 
-	return models.GetPostByIdInput{
-		ID: id,
-	}, nil
+	input := models.GetPostByIdInput{
+		ID:      id,
+		Include: include,
+		Format:  format,
+	}
+
+	if err := ValidateInput(input); err != nil {
+		return models.GetPostByIdInput{}, err
+	}
+
+	return input, nil
 }
 
-func ParseGetPostsInput(request events.APIGatewayProxyRequest) (models.GetPostsInput, error) {
+func ParseGetPostsInput(request events.APIGatewayProxyRequest, defaultPageSize int) (models.GetPostsInput, error) {
 	var startKey map[string]types.AttributeValue
-	pageSize, _ := strconv.Atoi(os.Getenv("DEFAULT_PAGE_SIZE"))
+	pageSize := defaultPageSize
 
 	queryStringParams := request.QueryStringParameters
 
@@ -75,15 +107,57 @@ func ParseGetPostsInput(request events.APIGatewayProxyRequest) (models.GetPostsI
 	if v, exists := queryStringParams["startKey"]; exists && v != "" {
 		sk, err := decodeStartKey(v)
 		if err != nil {
-			return models.GetPostsInput{}, err
+			return models.GetPostsInput{}, apperror.Validation(apperror.FieldError{Field: "startKey", Message: err.Error()})
 		}
 		startKey = sk
 	}
 
-	return models.GetPostsInput{
+	input := models.GetPostsInput{
 		PageSize: pageSize,
 		StartKey: startKey,
-	}, nil
+	}
+
+	if err := ValidateInput(input); err != nil {
+		return models.GetPostsInput{}, err
+	}
+
+	return input, nil
+}
+
+func ParseGetAuditEntriesInput(request events.APIGatewayProxyRequest, defaultPageSize int) (models.GetAuditEntriesInput, error) {
+	postsInput, err := ParseGetPostsInput(request, defaultPageSize)
+	if err != nil {
+		return models.GetAuditEntriesInput{}, err
+	}
+
+	input := models.GetAuditEntriesInput{
+		Actor:    request.QueryStringParameters["actor"],
+		TargetID: request.QueryStringParameters["target"],
+		PageSize: postsInput.PageSize,
+		StartKey: postsInput.StartKey,
+	}
+
+	if v, exists := request.QueryStringParameters["from"]; exists && v != "" {
+		from, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return models.GetAuditEntriesInput{}, apperror.Validation(apperror.FieldError{Field: "from", Message: "must be a unix timestamp in milliseconds"})
+		}
+		input.From = from
+	}
+
+	if v, exists := request.QueryStringParameters["to"]; exists && v != "" {
+		to, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return models.GetAuditEntriesInput{}, apperror.Validation(apperror.FieldError{Field: "to", Message: "must be a unix timestamp in milliseconds"})
+		}
+		input.To = to
+	}
+
+	if err := ValidateInput(input); err != nil {
+		return models.GetAuditEntriesInput{}, err
+	}
+
+	return input, nil
 }
 
 func ParseUpdatePostInput(request events.APIGatewayProxyRequest) (models.UpdatePostInput, error) {
@@ -91,16 +165,23 @@ func ParseUpdatePostInput(request events.APIGatewayProxyRequest) (models.UpdateP
 
 	err := json.Unmarshal([]byte(request.Body), &input)
 	if err != nil {
-		return models.UpdatePostInput{}, err
+		return models.UpdatePostInput{}, invalidBody(err)
 	}
 
-	pathParams := request.PathParameters
+	input.ID = request.PathParameters["post_id"]
+
+	// An If-Match header takes precedence over an expectedVersion field
+	if ifMatch := GetHeader(request, "If-Match"); ifMatch != "" {
+		version, err := ParseETagVersion(ifMatch)
+		if err != nil {
+			return models.UpdatePostInput{}, apperror.New(apperror.CodeInvalidRequest, err.Error())
+		}
+		input.ExpectedVersion = &version
+	}
 
-	id, exists := pathParams["post_id"]
-	if !exists {
-		return models.UpdatePostInput{}, fmt.Errorf("post_id path param is required")
+	if err := ValidateInput(input); err != nil {
+		return models.UpdatePostInput{}, err
 	}
-	input.ID = id
 
 	return input, nil
 }
@@ -108,14 +189,68 @@ func ParseUpdatePostInput(request events.APIGatewayProxyRequest) (models.UpdateP
 func ParseDeletePostInput(request events.APIGatewayProxyRequest) (models.DeletePostInput, error) {
 	var input models.DeletePostInput
 
-	pathParams := request.PathParameters
+	input.ID = request.PathParameters["post_id"]
 
-	id, exists := pathParams["post_id"]
-	if !exists {
-		return models.DeletePostInput{}, fmt.Errorf("post_id path param is required")
+	if err := ValidateInput(input); err != nil {
+		return models.DeletePostInput{}, err
 	}
 
-	input.ID = id
+	return input, nil
+}
+
+func ParseRestorePostInput(request events.APIGatewayProxyRequest) (models.RestorePostInput, error) {
+	var input models.RestorePostInput
+
+	input.ID = request.PathParameters["post_id"]
+
+	if err := ValidateInput(input); err != nil {
+		return models.RestorePostInput{}, err
+	}
+
+	return input, nil
+}
+
+func ParsePurgePostInput(request events.APIGatewayProxyRequest) (models.PurgePostInput, error) {
+	var input models.PurgePostInput
+
+	input.ID = request.PathParameters["post_id"]
+
+	if err := ValidateInput(input); err != nil {
+		return models.PurgePostInput{}, err
+	}
+
+	return input, nil
+}
+
+func ParseSyncPostsInput(request events.APIGatewayProxyRequest) (models.SyncPostsInput, error) {
+	// Nothing changes unless the caller asks for it
+	input := models.SyncPostsInput{DryRun: true}
+
+	for name, value := range map[string]*bool{"dryRun": &input.DryRun, "prune": &input.Prune} {
+		v, exists := request.QueryStringParameters[name]
+		if !exists {
+			continue
+		}
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			return models.SyncPostsInput{}, apperror.Validation(apperror.FieldError{Field: name, Message: "must be true or false"})
+		}
+		*value = parsed
+	}
+
+	// API Gateway base64-encodes binary bodies
+	input.Archive = []byte(request.Body)
+	if request.IsBase64Encoded {
+		archive, err := base64.StdEncoding.DecodeString(request.Body)
+		if err != nil {
+			return models.SyncPostsInput{}, apperror.New(apperror.CodeInvalidRequest, "request body is not valid base64")
+		}
+		input.Archive = archive
+	}
+
+	if err := ValidateInput(input); err != nil {
+		return models.SyncPostsInput{}, err
+	}
 
 	return input, nil
 }
@@ -125,39 +260,118 @@ func ParseAdminLoginInput(request events.APIGatewayProxyRequest) (models.AdminLo
 
 	err := json.Unmarshal([]byte(request.Body), &input)
 	if err != nil {
+		return models.AdminLoginInput{}, invalidBody(err)
+	}
+
+	if err := ValidateInput(input); err != nil {
 		return models.AdminLoginInput{}, err
 	}
 
 	return input, nil
 }
 
-func MakeSuccessResponse(statusCode int, data any) events.APIGatewayProxyResponse {
-	response := map[string]any{
-		"data": data,
+func ParseAdminMFALoginInput(request events.APIGatewayProxyRequest) (models.AdminMFALoginInput, error) {
+	var input models.AdminMFALoginInput
+
+	err := json.Unmarshal([]byte(request.Body), &input)
+	if err != nil {
+		return models.AdminMFALoginInput{}, invalidBody(err)
 	}
 
-	body, err := json.Marshal(response)
+	if err := ValidateInput(input); err != nil {
+		return models.AdminMFALoginInput{}, err
+	}
+
+	return input, nil
+}
+
+func ParseTOTPVerifyInput(request events.APIGatewayProxyRequest) (models.TOTPVerifyInput, error) {
+	var input models.TOTPVerifyInput
+
+	err := json.Unmarshal([]byte(request.Body), &input)
 	if err != nil {
-		panic(err)
+		return models.TOTPVerifyInput{}, invalidBody(err)
 	}
 
-	return events.APIGatewayProxyResponse{
-		StatusCode: statusCode,
-		Headers: map[string]string{
-			"Content-Type": "application/json",
-		},
-		Body: string(body),
+	if err := ValidateInput(input); err != nil {
+		return models.TOTPVerifyInput{}, err
+	}
+
+	return input, nil
+}
+
+func ParseOIDCCallbackInput(request events.APIGatewayProxyRequest) (models.OIDCCallbackInput, error) {
+	var input models.OIDCCallbackInput
+
+	err := json.Unmarshal([]byte(request.Body), &input)
+	if err != nil {
+		return models.OIDCCallbackInput{}, invalidBody(err)
+	}
+
+	if err := ValidateInput(input); err != nil {
+		return models.OIDCCallbackInput{}, err
+	}
+
+	return input, nil
+}
+
+func ParseCreateAPIKeyInput(request events.APIGatewayProxyRequest) (models.CreateAPIKeyInput, error) {
+	var input models.CreateAPIKeyInput
+
+	err := json.Unmarshal([]byte(request.Body), &input)
+	if err != nil {
+		return models.CreateAPIKeyInput{}, invalidBody(err)
+	}
+
+	if err := ValidateInput(input); err != nil {
+		return models.CreateAPIKeyInput{}, err
+	}
+
+	return input, nil
+}
+
+func ParseRevokeAPIKeyInput(request events.APIGatewayProxyRequest) (models.RevokeAPIKeyInput, error) {
+	input := models.RevokeAPIKeyInput{
+		ID: request.PathParameters["key_id"],
+	}
+
+	if err := ValidateInput(input); err != nil {
+		return models.RevokeAPIKeyInput{}, err
+	}
+
+	return input, nil
+}
+
+func GetHeader(request events.APIGatewayProxyRequest, name string) string {
+	for k, v := range request.Headers {
+		if strings.EqualFold(k, name) {
+			return v
+		}
+	}
+
+	return ""
+}
+
+func ParseETagVersion(etag string) (int64, error) {
+	value := strings.TrimPrefix(strings.TrimSpace(etag), "W/")
+	value = strings.Trim(value, "\"")
+
+	version, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || version < 0 {
+		return 0, fmt.Errorf("invalid ETag %s", etag)
 	}
+
+	return version, nil
 }
 
-func MakeErrorResponse(statusCode int, errorInfo any) events.APIGatewayProxyResponse {
+func MakeSuccessResponse(statusCode int, data any) (events.APIGatewayProxyResponse, error) {
 	response := map[string]any{
-		"error": errorInfo,
+		"data": data,
 	}
 
 	body, err := json.Marshal(response)
 	if err != nil {
-		panic(err)
+		return events.APIGatewayProxyResponse{}, fmt.Errorf("failed to encode response: %w", err)
 	}
 
 	return events.APIGatewayProxyResponse{
@@ -166,7 +380,120 @@ func MakeErrorResponse(statusCode int, errorInfo any) events.APIGatewayProxyResp
 			"Content-Type": "application/json",
 		},
 		Body: string(body),
+	}, nil
+}
+
+func MakeRawResponse(statusCode int, contentType, body string) events.APIGatewayProxyResponse {
+	return events.APIGatewayProxyResponse{
+		StatusCode: statusCode,
+		Headers: map[string]string{
+			"Content-Type": contentType,
+		},
+		Body: body,
+	}
+}
+
+// NegotiateContentType picks the offer the Accept header ranks highest, with
+// ties going to the earlier offer. A missing header accepts the first offer.
+func NegotiateContentType(accept string, offers []string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return offers[0], true
+	}
+
+	type acceptRange struct {
+		mediaRange string
+		q          float64
 	}
+
+	var ranges []acceptRange
+	for _, part := range strings.Split(accept, ",") {
+		mediaRange, params, _ := strings.Cut(part, ";")
+		r := acceptRange{mediaRange: strings.ToLower(strings.TrimSpace(mediaRange)), q: 1}
+		for _, param := range strings.Split(params, ";") {
+			key, value, ok := strings.Cut(param, "=")
+			if ok && strings.TrimSpace(key) == "q" {
+				if q, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+					r.q = q
+				}
+			}
+		}
+		ranges = append(ranges, r)
+	}
+
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		offerType, _, _ := strings.Cut(offer, "/")
+
+		// The most specific matching range decides the offer's quality
+		q, specificity := 0.0, -1
+		for _, r := range ranges {
+			var s int
+			switch r.mediaRange {
+			case offer:
+				s = 2
+			case offerType + "/*":
+				s = 1
+			case "*/*":
+				s = 0
+			default:
+				continue
+			}
+			if s > specificity {
+				q, specificity = r.q, s
+			}
+		}
+
+		if q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+
+	return best, best != ""
+}
+
+// invalidBody reports a body that could not be decoded without exposing Go
+// type names from the decoder.
+func invalidBody(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) && typeErr.Field != "" {
+		return apperror.Validation(apperror.FieldError{Field: typeErr.Field, Message: fmt.Sprintf("must be a %s", jsonTypeName(typeErr.Type.Kind()))})
+	}
+
+	return apperror.New(apperror.CodeInvalidRequest, "request body must be a valid JSON object")
+}
+
+func jsonTypeName(kind reflect.Kind) string {
+	switch kind {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Slice, reflect.Array:
+		return "list"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	default:
+		return "number"
+	}
+}
+
+func getAuthorizerValue(request events.APIGatewayProxyRequest, key string) (string, bool) {
+	lambdaCtx, ok := request.RequestContext.Authorizer["lambda"]
+	if !ok || lambdaCtx == nil {
+		return "", false
+	}
+
+	ctxMap, ok := lambdaCtx.(map[string]any)
+	if !ok {
+		return "", false
+	}
+
+	value, ok := ctxMap[key].(string)
+	if !ok || value == "" {
+		return "", false
+	}
+
+	return value, true
 }
 
 func decodeStartKey(encoded string) (map[string]types.AttributeValue, error) {
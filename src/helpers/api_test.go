@@ -0,0 +1,260 @@
+package helpers
+
+import (
+	"encoding/base64"
+	"reflect"
+	"testing"
+
+	"github.com/JaxonAdams/blog-backend/src/models"
+	"github.com/JaxonAdams/blog-backend/src/services/apperror"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestParseUpdatePostInput(t *testing.T) {
+	tests := []struct {
+		name        string
+		body        string
+		ifMatch     string
+		wantVersion *int64
+		wantCode    apperror.Code
+	}{
+		{name: "no version", body: `{"title":"New"}`},
+		{name: "version from the body", body: `{"expectedVersion":4}`, wantVersion: ptr[int64](4)},
+		{name: "version 0 from the body", body: `{"expectedVersion":0}`, wantVersion: ptr[int64](0)},
+		{name: "version 0 from If-Match", body: `{}`, ifMatch: `"0"`, wantVersion: ptr[int64](0)},
+		{name: "weak If-Match", body: `{}`, ifMatch: `W/"7"`, wantVersion: ptr[int64](7)},
+		{name: "If-Match wins over the body", body: `{"expectedVersion":2}`, ifMatch: `"3"`, wantVersion: ptr[int64](3)},
+		{name: "invalid If-Match", body: `{}`, ifMatch: `"abc"`, wantCode: apperror.CodeInvalidRequest},
+		{name: "negative version", body: `{"expectedVersion":-1}`, wantCode: apperror.CodeValidationFailed},
+		{name: "wrong type", body: `{"expectedVersion":"4"}`, wantCode: apperror.CodeValidationFailed},
+		{name: "not JSON", body: `title=New`, wantCode: apperror.CodeInvalidRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := events.APIGatewayProxyRequest{
+				Body:           tt.body,
+				PathParameters: map[string]string{"post_id": "post-1"},
+				Headers:        map[string]string{},
+			}
+			if tt.ifMatch != "" {
+				request.Headers["if-match"] = tt.ifMatch
+			}
+
+			input, err := ParseUpdatePostInput(request)
+			if tt.wantCode != "" {
+				if code := apperror.CodeOf(err); code != tt.wantCode {
+					t.Fatalf("ParseUpdatePostInput() error = %v, want code %q", err, tt.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseUpdatePostInput() error = %v", err)
+			}
+			if input.ID != "post-1" {
+				t.Errorf("ID = %q, want post-1", input.ID)
+			}
+			if !reflect.DeepEqual(input.ExpectedVersion, tt.wantVersion) {
+				t.Errorf("ExpectedVersion = %v, want %v", deref(input.ExpectedVersion), deref(tt.wantVersion))
+			}
+		})
+	}
+}
+
+func TestParseSyncPostsInput(t *testing.T) {
+	tests := []struct {
+		name     string
+		query    map[string]string
+		body     string
+		base64   bool
+		want     models.SyncPostsInput
+		wantCode apperror.Code
+	}{
+		{
+			name: "dry run by default",
+			body: "archive",
+			want: models.SyncPostsInput{DryRun: true, Archive: []byte("archive")},
+		},
+		{
+			name:  "apply and prune",
+			query: map[string]string{"dryRun": "false", "prune": "1"},
+			body:  "archive",
+			want:  models.SyncPostsInput{Prune: true, Archive: []byte("archive")},
+		},
+		{
+			name:   "base64 body",
+			body:   base64.StdEncoding.EncodeToString([]byte{0x1f, 0x8b}),
+			base64: true,
+			want:   models.SyncPostsInput{DryRun: true, Archive: []byte{0x1f, 0x8b}},
+		},
+		{
+			name:     "invalid flag",
+			query:    map[string]string{"prune": "maybe"},
+			body:     "archive",
+			wantCode: apperror.CodeValidationFailed,
+		},
+		{
+			name:     "invalid base64",
+			body:     "not base64!",
+			base64:   true,
+			wantCode: apperror.CodeInvalidRequest,
+		},
+		{
+			name:     "empty body",
+			wantCode: apperror.CodeValidationFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input, err := ParseSyncPostsInput(events.APIGatewayProxyRequest{
+				QueryStringParameters: tt.query,
+				Body:                  tt.body,
+				IsBase64Encoded:       tt.base64,
+			})
+			if tt.wantCode != "" {
+				if code := apperror.CodeOf(err); code != tt.wantCode {
+					t.Fatalf("ParseSyncPostsInput() error = %v, want code %q", err, tt.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSyncPostsInput() error = %v", err)
+			}
+			if !reflect.DeepEqual(input, tt.want) {
+				t.Errorf("ParseSyncPostsInput() = %+v, want %+v", input, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseGetPostByIdInput(t *testing.T) {
+	tests := []struct {
+		name     string
+		id       string
+		include  string
+		want     models.GetPostByIdInput
+		wantCode apperror.Code
+	}{
+		{name: "plain ID", id: "post-1", want: models.GetPostByIdInput{ID: "post-1"}},
+		{name: "Markdown suffix", id: "post-1.md", want: models.GetPostByIdInput{ID: "post-1", Format: "md"}},
+		{name: "HTML suffix", id: "post-1.html", want: models.GetPostByIdInput{ID: "post-1", Format: "html"}},
+		{name: "include is deduplicated", id: "post-1", include: "html, md,html", want: models.GetPostByIdInput{ID: "post-1", Include: []string{"html", "md"}}},
+		{name: "unknown include", id: "post-1", include: "pdf", wantCode: apperror.CodeValidationFailed},
+		{name: "missing ID", wantCode: apperror.CodeValidationFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := events.APIGatewayProxyRequest{PathParameters: map[string]string{"post_id": tt.id}}
+			if tt.include != "" {
+				request.QueryStringParameters = map[string]string{"include": tt.include}
+			}
+
+			input, err := ParseGetPostByIdInput(request)
+			if tt.wantCode != "" {
+				if code := apperror.CodeOf(err); code != tt.wantCode {
+					t.Fatalf("ParseGetPostByIdInput() error = %v, want code %q", err, tt.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseGetPostByIdInput() error = %v", err)
+			}
+			if !reflect.DeepEqual(input, tt.want) {
+				t.Errorf("ParseGetPostByIdInput() = %+v, want %+v", input, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseGetPostsInput(t *testing.T) {
+	startKey := base64.StdEncoding.EncodeToString([]byte(`{"id":{"S":"post-1"},"createdAt":{"N":"12"}}`))
+
+	tests := []struct {
+		name         string
+		query        map[string]string
+		wantPageSize int
+		wantStartKey bool
+		wantCode     apperror.Code
+	}{
+		{name: "default page size", wantPageSize: 10},
+		{name: "page size", query: map[string]string{"pageSize": "25"}, wantPageSize: 25},
+		{name: "unparseable page size falls back", query: map[string]string{"pageSize": "many"}, wantPageSize: 10},
+		{name: "page size too large", query: map[string]string{"pageSize": "500"}, wantCode: apperror.CodeValidationFailed},
+		{name: "start key", query: map[string]string{"startKey": startKey}, wantPageSize: 10, wantStartKey: true},
+		{name: "invalid start key", query: map[string]string{"startKey": "%%%"}, wantCode: apperror.CodeValidationFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			input, err := ParseGetPostsInput(events.APIGatewayProxyRequest{QueryStringParameters: tt.query}, 10)
+			if tt.wantCode != "" {
+				if code := apperror.CodeOf(err); code != tt.wantCode {
+					t.Fatalf("ParseGetPostsInput() error = %v, want code %q", err, tt.wantCode)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseGetPostsInput() error = %v", err)
+			}
+			if input.PageSize != tt.wantPageSize {
+				t.Errorf("PageSize = %d, want %d", input.PageSize, tt.wantPageSize)
+			}
+			if (input.StartKey != nil) != tt.wantStartKey {
+				t.Errorf("StartKey = %v, want set: %v", input.StartKey, tt.wantStartKey)
+			}
+		})
+	}
+}
+
+func TestParseCreatePostInput(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantCode   apperror.Code
+		wantFields []apperror.FieldError
+	}{
+		{name: "valid", body: `{"title":"Hello","summary":"A post","tags":["go"],"content":"# Hello"}`},
+		{
+			name:       "wrong type is reported by field",
+			body:       `{"title":"Hello","summary":"A post","tags":"go","content":"# Hello"}`,
+			wantCode:   apperror.CodeValidationFailed,
+			wantFields: []apperror.FieldError{{Field: "tags", Message: "must be a list"}},
+		},
+		{
+			name:     "not an object",
+			body:     `[]`,
+			wantCode: apperror.CodeInvalidRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseCreatePostInput(events.APIGatewayProxyRequest{Body: tt.body})
+			if tt.wantCode == "" {
+				if err != nil {
+					t.Fatalf("ParseCreatePostInput() error = %v", err)
+				}
+				return
+			}
+			if code := apperror.CodeOf(err); code != tt.wantCode {
+				t.Fatalf("ParseCreatePostInput() error = %v, want code %q", err, tt.wantCode)
+			}
+			if tt.wantFields != nil && !reflect.DeepEqual(apperror.FieldsOf(err), tt.wantFields) {
+				t.Errorf("fields = %+v, want %+v", apperror.FieldsOf(err), tt.wantFields)
+			}
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func deref(v *int64) any {
+	if v == nil {
+		return nil
+	}
+	return *v
+}
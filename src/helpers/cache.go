@@ -0,0 +1,69 @@
+package helpers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// BodyETag builds a weak ETag from a response body.
+func BodyETag(body string) string {
+	sum := sha256.Sum256([]byte(body))
+	return fmt.Sprintf("W/\"%s\"", hex.EncodeToString(sum[:16]))
+}
+
+// IsNotModified evaluates If-None-Match and If-Modified-Since against the
+// current representation. A zero lastModified skips the date comparison.
+func IsNotModified(request events.APIGatewayProxyRequest, etag string, lastModified time.Time) bool {
+	// If-None-Match takes precedence over If-Modified-Since (RFC 9110 13.2.2)
+	if ifNoneMatch := GetHeader(request, "If-None-Match"); ifNoneMatch != "" {
+		for _, candidate := range strings.Split(ifNoneMatch, ",") {
+			candidate = strings.TrimSpace(candidate)
+			if candidate == "*" || opaqueTag(candidate) == opaqueTag(etag) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if lastModified.IsZero() {
+		return false
+	}
+
+	since, err := http.ParseTime(GetHeader(request, "If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+
+	return !lastModified.Truncate(time.Second).After(since)
+}
+
+func SetCacheHeaders(response *events.APIGatewayProxyResponse, etag string, lastModified time.Time, maxAge time.Duration) {
+	if response.Headers == nil {
+		response.Headers = map[string]string{}
+	}
+
+	response.Headers["ETag"] = etag
+	response.Headers["Cache-Control"] = fmt.Sprintf("public, max-age=%d, must-revalidate", int(maxAge.Seconds()))
+	if !lastModified.IsZero() {
+		response.Headers["Last-Modified"] = lastModified.UTC().Format(http.TimeFormat)
+	}
+}
+
+func MakeNotModifiedResponse(etag string, lastModified time.Time, maxAge time.Duration) events.APIGatewayProxyResponse {
+	response := events.APIGatewayProxyResponse{StatusCode: 304}
+	SetCacheHeaders(&response, etag, lastModified, maxAge)
+
+	return response
+}
+
+// opaqueTag strips the weak indicator so tags compare weakly, as
+// If-None-Match requires.
+func opaqueTag(etag string) string {
+	return strings.TrimPrefix(strings.TrimSpace(etag), "W/")
+}
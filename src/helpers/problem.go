@@ -0,0 +1,74 @@
+package helpers
+
+import (
+	"encoding/json"
+	"errors"
+	"maps"
+
+	"github.com/JaxonAdams/blog-backend/src/models"
+	"github.com/JaxonAdams/blog-backend/src/services/apperror"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// MakeProblemResponse maps err to an RFC 7807 problem document. Internal
+// errors are logged and replaced with a generic detail, and authentication
+// failures never say which check failed.
+func MakeProblemResponse(err error, request events.APIGatewayProxyRequest, services models.HandlerServices) events.APIGatewayProxyResponse {
+	code := apperror.CodeOf(err)
+
+	detail := err.Error()
+	switch code {
+	case apperror.CodeInternal:
+		services.Logger.Error("Request failed", "error", err)
+		detail = "An unexpected error occurred"
+	case apperror.CodeUnauthorized:
+		services.Logger.Info("Authentication failed", "error", err)
+		detail = "Authentication failed"
+	}
+
+	problem := map[string]any{}
+
+	var extended apperror.Extended
+	if errors.As(err, &extended) {
+		maps.Copy(problem, extended.ProblemExtensions())
+	}
+
+	problem["type"] = code.TypeURI()
+	problem["title"] = code.Title()
+	problem["status"] = code.Status()
+	problem["detail"] = detail
+
+	if request.Path != "" {
+		problem["instance"] = request.Path
+	}
+
+	if requestID := request.RequestContext.RequestID; requestID != "" {
+		problem["requestId"] = requestID
+	}
+
+	if fields := apperror.FieldsOf(err); len(fields) > 0 {
+		problem["errors"] = fields
+	}
+
+	body, marshalErr := json.Marshal(problem)
+	if marshalErr != nil {
+		services.Logger.Error("Failed to encode problem details", "error", marshalErr)
+		body = []byte(`{"title":"Internal server error","status":500}`)
+		code = apperror.CodeInternal
+	}
+
+	headers := map[string]string{}
+
+	var headed apperror.Headed
+	if errors.As(err, &headed) {
+		maps.Copy(headers, headed.ProblemHeaders())
+	}
+
+	headers["Content-Type"] = "application/problem+json"
+
+	return events.APIGatewayProxyResponse{
+		StatusCode: code.Status(),
+		Headers:    headers,
+		Body:       string(body),
+	}
+}
@@ -0,0 +1,132 @@
+package helpers
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/JaxonAdams/blog-backend/src/services/apperror"
+	"github.com/go-playground/validator/v10"
+)
+
+// SlugPattern is what the slug validation rule accepts, e.g. post tags
+var SlugPattern = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`)
+
+var validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+
+	// Report fields by the names clients send, not the Go field names
+	v.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+
+	v.RegisterValidation("slug", func(fl validator.FieldLevel) bool {
+		return SlugPattern.MatchString(fl.Field().String())
+	})
+
+	return v
+}
+
+// ValidateInput checks input against its validate tags, returning every
+// failing field at once.
+func ValidateInput(input any) error {
+	err := validate.Struct(input)
+	if err == nil {
+		return nil
+	}
+
+	var validationErrs validator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		return err
+	}
+
+	fields := make([]apperror.FieldError, 0, len(validationErrs))
+	for _, fieldErr := range validationErrs {
+		fields = append(fields, apperror.FieldError{
+			Field:   fieldPath(fieldErr),
+			Message: describeFieldError(fieldErr),
+		})
+	}
+
+	return apperror.Validation(fields...)
+}
+
+// fieldPath drops the struct names from the namespace, leaving e.g. tags[2].
+func fieldPath(fieldErr validator.FieldError) string {
+	var parts []string
+	for i, part := range strings.Split(fieldErr.Namespace(), ".") {
+		// The root struct and any embedded structs are named after their type
+		if i == 0 || (part != "" && part[0] >= 'A' && part[0] <= 'Z') {
+			continue
+		}
+		parts = append(parts, part)
+	}
+
+	return strings.Join(parts, ".")
+}
+
+func describeFieldError(fieldErr validator.FieldError) string {
+	unit := "characters"
+	switch fieldErr.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		unit = "items"
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		unit = ""
+	}
+
+	switch fieldErr.Tag() {
+	case "required":
+		return "is required"
+	case "required_without":
+		return fmt.Sprintf("is required when %s is not set", jsonName(fieldErr.Param()))
+	case "min":
+		if unit != "" && fieldErr.Param() == "1" {
+			return "must not be empty"
+		}
+		if unit == "" {
+			return fmt.Sprintf("must be at least %s", fieldErr.Param())
+		}
+		return fmt.Sprintf("must have at least %s %s", fieldErr.Param(), unit)
+	case "max":
+		if unit == "" {
+			return fmt.Sprintf("must be at most %s", fieldErr.Param())
+		}
+		return fmt.Sprintf("must have at most %s %s", fieldErr.Param(), unit)
+	case "len":
+		return fmt.Sprintf("must be exactly %s %s", fieldErr.Param(), unit)
+	case "gt":
+		return fmt.Sprintf("must be greater than %s", fieldErr.Param())
+	case "numeric":
+		return "must contain only digits"
+	case "oneof":
+		return fmt.Sprintf("must be one of %s", strings.ReplaceAll(fieldErr.Param(), " ", ", "))
+	case "slug":
+		return "must be lowercase letters and numbers separated by single hyphens"
+	default:
+		return fmt.Sprintf("failed the %s rule", fieldErr.Tag())
+	}
+}
+
+// jsonName converts a Go field name used in a rule parameter, such as
+// RecoveryCode, to its snake_case JSON name.
+func jsonName(field string) string {
+	var b strings.Builder
+	for i, r := range field {
+		if r >= 'A' && r <= 'Z' {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r += 'a' - 'A'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
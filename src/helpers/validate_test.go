@@ -0,0 +1,92 @@
+package helpers
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/JaxonAdams/blog-backend/src/models"
+	"github.com/JaxonAdams/blog-backend/src/services/apperror"
+)
+
+func TestValidateInput(t *testing.T) {
+	version := func(v int64) *int64 { return &v }
+	text := func(s string) *string { return &s }
+
+	tests := []struct {
+		name  string
+		input any
+		want  []apperror.FieldError
+	}{
+		{
+			name:  "valid post",
+			input: models.CreatePostInput{Title: "Hello", Summary: "A post", Tags: []string{"go", "web-dev"}, Content: "# Hello"},
+		},
+		{
+			name:  "missing fields are all reported",
+			input: models.CreatePostInput{},
+			want: []apperror.FieldError{
+				{Field: "title", Message: "is required"},
+				{Field: "summary", Message: "is required"},
+				{Field: "tags", Message: "is required"},
+				{Field: "content", Message: "is required"},
+			},
+		},
+		{
+			name:  "tags are reported by index",
+			input: models.CreatePostInput{Title: "Hello", Summary: "A post", Tags: []string{"go", "Not A Slug"}, Content: "# Hello"},
+			want: []apperror.FieldError{
+				{Field: "tags[1]", Message: "must be lowercase letters and numbers separated by single hyphens"},
+			},
+		},
+		{
+			name:  "expected version 0 is allowed",
+			input: models.UpdatePostInput{GetPostByIdInput: models.GetPostByIdInput{ID: "post-1"}, ExpectedVersion: version(0)},
+		},
+		{
+			name:  "negative expected version",
+			input: models.UpdatePostInput{GetPostByIdInput: models.GetPostByIdInput{ID: "post-1"}, ExpectedVersion: version(-1)},
+			want:  []apperror.FieldError{{Field: "expectedVersion", Message: "must be at least 0"}},
+		},
+		{
+			name:  "empty title in an update",
+			input: models.UpdatePostInput{GetPostByIdInput: models.GetPostByIdInput{ID: "post-1"}, Title: text("")},
+			want:  []apperror.FieldError{{Field: "title", Message: "must not be empty"}},
+		},
+		{
+			name:  "code or recovery code",
+			input: models.AdminMFALoginInput{ChallengeToken: "token"},
+			want:  []apperror.FieldError{{Field: "code", Message: "is required when recovery_code is not set"}},
+		},
+		{
+			name:  "code must be six digits",
+			input: models.TOTPVerifyInput{Code: "12a45"},
+			want: []apperror.FieldError{
+				{Field: "code", Message: "must contain only digits"},
+			},
+		},
+		{
+			name:  "page size bounds",
+			input: models.GetPostsInput{PageSize: 101},
+			want:  []apperror.FieldError{{Field: "pageSize", Message: "must be at most 100"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateInput(tt.input)
+			if tt.want == nil {
+				if err != nil {
+					t.Fatalf("ValidateInput() error = %v", err)
+				}
+				return
+			}
+
+			if code := apperror.CodeOf(err); code != apperror.CodeValidationFailed {
+				t.Fatalf("ValidateInput() code = %q, want %q", code, apperror.CodeValidationFailed)
+			}
+			if got := apperror.FieldsOf(err); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("fields = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/JaxonAdams/blog-backend/src/models"
+	auditmodel "github.com/JaxonAdams/blog-backend/src/models/audit"
+	auditservice "github.com/JaxonAdams/blog-backend/src/services/audit"
+	"github.com/JaxonAdams/blog-backend/src/services/aws/dynamodb"
+	"github.com/JaxonAdams/blog-backend/src/services/aws/s3"
+	"github.com/JaxonAdams/blog-backend/src/services/config"
+	"github.com/JaxonAdams/blog-backend/src/services/logging"
+	postservice "github.com/JaxonAdams/blog-backend/src/services/post"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+func createEventHandler(services models.HandlerServices) func(ctx context.Context, event events.CloudWatchEvent) error {
+	return func(ctx context.Context, event events.CloudWatchEvent) error {
+		services := services
+		services.Logger = logging.ForInvocation(services.Logger, ctx).With(
+			slog.String("event_id", event.ID),
+			slog.String("actor", "system:trash-purge"),
+		)
+
+		retention := services.Config.TrashRetention
+		purged, err := postservice.PurgeExpiredPosts(retention, services, ctx)
+
+		for _, id := range purged {
+			entry := auditservice.NewSystemEntry("system:trash-purge", auditmodel.ActionPostPurge, id, event.ID)
+			auditservice.Record(entry, services, ctx)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		services.Logger.Info("Purged expired posts from the trash", "count", len(purged), "retention_days", int(retention.Hours()/24))
+		return nil
+	}
+}
+
+func main() {
+	cfg := config.MustLoad(context.TODO(), config.BucketName, config.PostTableName, config.AuditLogTableName)
+
+	handler := createEventHandler(models.HandlerServices{
+		Config:          cfg,
+		Logger:          logging.New(),
+		S3Service:       s3.New(context.TODO(), cfg),
+		DynamoDBService: dynamodb.New(context.TODO(), cfg),
+	})
+	lambda.Start(handler)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/JaxonAdams/blog-backend/src/models"
+	"github.com/JaxonAdams/blog-backend/src/services/aws/dynamodb"
+	"github.com/JaxonAdams/blog-backend/src/services/aws/s3"
+	"github.com/JaxonAdams/blog-backend/src/services/config"
+	"github.com/JaxonAdams/blog-backend/src/services/logging"
+	siteservice "github.com/JaxonAdams/blog-backend/src/services/site"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+func createEventHandler(services models.HandlerServices) func(ctx context.Context, event events.CloudWatchEvent) error {
+	return func(ctx context.Context, event events.CloudWatchEvent) error {
+		services := services
+		services.Logger = logging.ForInvocation(services.Logger, ctx).With(
+			slog.String("event_id", event.ID),
+			slog.String("actor", "system:site-export"),
+		)
+
+		prefix := services.Config.Site.ExportPrefix
+		output := siteservice.NewS3Output(prefix, services, ctx)
+
+		summary, err := siteservice.Generate(output, siteservice.Options{}, services, ctx)
+		if err != nil {
+			return err
+		}
+
+		// Only a complete export may replace the previous one
+		removed, err := output.RemoveStale()
+		if err != nil {
+			return err
+		}
+
+		services.Logger.Info("Exported the static site",
+			"prefix", prefix, "posts", summary.Posts, "tags", summary.Tags, "files", summary.Files, "unchanged", output.Unchanged(), "removed", removed)
+		return nil
+	}
+}
+
+func main() {
+	cfg := config.MustLoad(context.TODO(), config.BucketName, config.PostTableName, config.SiteURL)
+
+	handler := createEventHandler(models.HandlerServices{
+		Config:          cfg,
+		Logger:          logging.New(),
+		S3Service:       s3.New(context.TODO(), cfg),
+		DynamoDBService: dynamodb.New(context.TODO(), cfg),
+	})
+	lambda.Start(handler)
+}
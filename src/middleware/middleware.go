@@ -0,0 +1,193 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/JaxonAdams/blog-backend/src/helpers"
+	"github.com/JaxonAdams/blog-backend/src/models"
+	auditmodel "github.com/JaxonAdams/blog-backend/src/models/audit"
+	"github.com/JaxonAdams/blog-backend/src/services/apperror"
+	"github.com/JaxonAdams/blog-backend/src/services/logging"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// DefaultMaxBodyBytes leaves room for the largest post content plus its JSON
+// envelope, well under API Gateway's payload limit.
+const DefaultMaxBodyBytes = 2 * 1024 * 1024
+
+// Headers browsers may read from cross-origin responses
+var exposedHeaders = []string{"ETag", "Last-Modified", "Idempotent-Replayed"}
+
+// Handler is the business logic of an API route. The services it receives
+// carry a logger scoped to the request.
+type Handler func(ctx context.Context, request events.APIGatewayProxyRequest, services models.HandlerServices) (events.APIGatewayProxyResponse, error)
+
+type Middleware func(next Handler) Handler
+
+// Wrap applies the standard middleware followed by any route-specific ones.
+// route names the route in logs, e.g. "GET /api/v1/posts/{post_id}".
+func Wrap(services models.HandlerServices, route string, handler Handler, middlewares ...Middleware) func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	chain := append([]Middleware{
+		Logging(route),
+		// Outside Recover, so a panic's 500 is still readable cross-origin
+		CORS(services.Config.CORSAllowedOrigins),
+		Recover(),
+		Errors(),
+		MaxBodySize(DefaultMaxBodyBytes),
+	}, middlewares...)
+
+	// The first middleware listed runs outermost
+	for i := len(chain) - 1; i >= 0; i-- {
+		handler = chain[i](handler)
+	}
+
+	return func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+		return handler(ctx, request, services)
+	}
+}
+
+// Logging scopes the services' logger to the request and logs each request
+// with its status and duration. Requests that matched no route are logged
+// under their own method and path.
+func Logging(route string) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, request events.APIGatewayProxyRequest, services models.HandlerServices) (events.APIGatewayProxyResponse, error) {
+			actor, ok := helpers.GetRequestSubject(request)
+			if !ok {
+				actor = auditmodel.UnauthenticatedUser
+			}
+
+			name := route
+			if name == "" {
+				name = fmt.Sprintf("%s %s", request.HTTPMethod, request.Path)
+			}
+
+			services.Logger = logging.ForInvocation(services.Logger, ctx).With(
+				slog.String("api_request_id", request.RequestContext.RequestID),
+				slog.String("route", name),
+				slog.String("actor", actor),
+			)
+
+			start := time.Now()
+			response, err := next(ctx, request, services)
+
+			services.Logger.Info("Request completed",
+				"status", response.StatusCode,
+				"duration_ms", time.Since(start).Milliseconds(),
+			)
+
+			return response, err
+		}
+	}
+}
+
+// Recover turns a panic into a 500 problem response instead of crashing the
+// execution environment.
+func Recover() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, request events.APIGatewayProxyRequest, services models.HandlerServices) (response events.APIGatewayProxyResponse, err error) {
+			defer func() {
+				if recovered := recover(); recovered != nil {
+					services.Logger.Error("Recovered from panic", "panic", fmt.Sprint(recovered), "stack", string(debug.Stack()))
+					response = helpers.MakeProblemResponse(fmt.Errorf("panic: %v", recovered), request, services)
+					err = nil
+				}
+			}()
+
+			return next(ctx, request, services)
+		}
+	}
+}
+
+// Errors maps any error returned by the handler to a problem response.
+func Errors() Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, request events.APIGatewayProxyRequest, services models.HandlerServices) (events.APIGatewayProxyResponse, error) {
+			response, err := next(ctx, request, services)
+			if err != nil {
+				return helpers.MakeProblemResponse(err, request, services), nil
+			}
+
+			return response, nil
+		}
+	}
+}
+
+// CORS echoes the request's origin when it is allowed, so responses stay
+// readable when the API is called directly.
+func CORS(allowedOrigins []string) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, request events.APIGatewayProxyRequest, services models.HandlerServices) (events.APIGatewayProxyResponse, error) {
+			response, err := next(ctx, request, services)
+
+			origin := helpers.GetHeader(request, "Origin")
+			if origin == "" || !slices.Contains(allowedOrigins, origin) {
+				return response, err
+			}
+
+			if response.Headers == nil {
+				response.Headers = map[string]string{}
+			}
+			response.Headers["Access-Control-Allow-Origin"] = origin
+			response.Headers["Access-Control-Expose-Headers"] = strings.Join(exposedHeaders, ", ")
+			if vary := response.Headers["Vary"]; vary != "" {
+				response.Headers["Vary"] = vary + ", Origin"
+			} else {
+				response.Headers["Vary"] = "Origin"
+			}
+
+			return response, err
+		}
+	}
+}
+
+// RequireAdmin rejects callers without the admin role.
+func RequireAdmin() Middleware {
+	return require(helpers.UserHasAdminRole)
+}
+
+// RequireScope rejects callers whose API key lacks scope. Admins hold every scope.
+func RequireScope(scope string) Middleware {
+	return require(func(request events.APIGatewayProxyRequest) bool {
+		return helpers.UserHasScope(request, scope)
+	})
+}
+
+// RequireSubject rejects requests the authorizer did not attach a subject to.
+func RequireSubject() Middleware {
+	return require(func(request events.APIGatewayProxyRequest) bool {
+		_, ok := helpers.GetRequestSubject(request)
+		return ok
+	})
+}
+
+// MaxBodySize rejects request bodies larger than limit bytes.
+func MaxBodySize(limit int) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, request events.APIGatewayProxyRequest, services models.HandlerServices) (events.APIGatewayProxyResponse, error) {
+			if len(request.Body) > limit {
+				return events.APIGatewayProxyResponse{}, apperror.New(apperror.CodePayloadTooLarge, fmt.Sprintf("request body must be at most %d bytes", limit))
+			}
+
+			return next(ctx, request, services)
+		}
+	}
+}
+
+func require(allowed func(request events.APIGatewayProxyRequest) bool) Middleware {
+	return func(next Handler) Handler {
+		return func(ctx context.Context, request events.APIGatewayProxyRequest, services models.HandlerServices) (events.APIGatewayProxyResponse, error) {
+			if !allowed(request) {
+				return events.APIGatewayProxyResponse{}, apperror.ErrForbidden
+			}
+
+			return next(ctx, request, services)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"testing"
+
+	"github.com/JaxonAdams/blog-backend/src/models"
+	"github.com/JaxonAdams/blog-backend/src/services/config"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestWrap(t *testing.T) {
+	const origin = "https://blog.example.com"
+
+	tests := []struct {
+		name       string
+		route      string
+		handler    Handler
+		wantStatus int
+		wantRoute  string
+	}{
+		{
+			name:  "handled request",
+			route: "GET /api/v1/posts/{post_id}",
+			handler: func(ctx context.Context, request events.APIGatewayProxyRequest, services models.HandlerServices) (events.APIGatewayProxyResponse, error) {
+				return events.APIGatewayProxyResponse{StatusCode: http.StatusOK}, nil
+			},
+			wantStatus: http.StatusOK,
+			wantRoute:  "GET /api/v1/posts/{post_id}",
+		},
+		{
+			name:  "panic",
+			route: "GET /api/v1/posts/{post_id}",
+			handler: func(ctx context.Context, request events.APIGatewayProxyRequest, services models.HandlerServices) (events.APIGatewayProxyResponse, error) {
+				panic("boom")
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantRoute:  "GET /api/v1/posts/{post_id}",
+		},
+		{
+			name: "no matching route",
+			handler: func(ctx context.Context, request events.APIGatewayProxyRequest, services models.HandlerServices) (events.APIGatewayProxyResponse, error) {
+				return events.APIGatewayProxyResponse{StatusCode: http.StatusNotFound}, nil
+			},
+			wantStatus: http.StatusNotFound,
+			wantRoute:  "GET /api/v1/posts/abc",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var logs bytes.Buffer
+			services := models.HandlerServices{
+				Config: &config.Config{CORSAllowedOrigins: []string{origin}},
+				Logger: slog.New(slog.NewJSONHandler(&logs, nil)),
+			}
+
+			// An HTTP API request, which carries no Resource
+			request := events.APIGatewayProxyRequest{
+				HTTPMethod: http.MethodGet,
+				Path:       "/api/v1/posts/abc",
+				Headers:    map[string]string{"origin": origin},
+			}
+
+			response, err := Wrap(services, tt.route, tt.handler)(context.Background(), request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if response.StatusCode != tt.wantStatus {
+				t.Errorf("status = %d, want %d", response.StatusCode, tt.wantStatus)
+			}
+			if got := response.Headers["Access-Control-Allow-Origin"]; got != origin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, origin)
+			}
+
+			var completed struct {
+				Msg   string `json:"msg"`
+				Route string `json:"route"`
+			}
+			lines := bytes.Split(bytes.TrimSpace(logs.Bytes()), []byte("\n"))
+			if err := json.Unmarshal(lines[len(lines)-1], &completed); err != nil {
+				t.Fatal(err)
+			}
+			if completed.Msg != "Request completed" || completed.Route != tt.wantRoute {
+				t.Errorf("last log = %+v, want Request completed for %s", completed, tt.wantRoute)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package apikeymodel
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const (
+	ScopePostsWrite  = "posts:write"
+	ScopePostsDelete = "posts:delete"
+)
+
+// ValidScopes has no posts:read-drafts yet. Posts have no draft state, so
+// nothing would check it; add it along with drafts.
+var ValidScopes = []string{
+	ScopePostsWrite,
+	ScopePostsDelete,
+}
+
+type APIKey struct {
+	ID         string   `json:"id" validate:"required"`
+	Name       string   `json:"name" validate:"required"`
+	KeyHash    string   `json:"-" dynamodbav:"keyHash"`
+	Scopes     []string `json:"scopes" validate:"required"`
+	CreatedBy  string   `json:"created_by" dynamodbav:"createdBy"`
+	CreatedAt  int64    `json:"created_at" validate:"required"`
+	ExpiresAt  int64    `json:"expires_at,omitempty" dynamodbav:"expiresAt,omitempty"`
+	LastUsedAt int64    `json:"last_used_at,omitempty" dynamodbav:"lastUsedAt,omitempty"`
+	RevokedAt  int64    `json:"revoked_at,omitempty" dynamodbav:"revokedAt,omitempty"`
+}
+
+func (k APIKey) DynamoFormat() map[string]types.AttributeValue {
+	item := map[string]types.AttributeValue{
+		"id":        &types.AttributeValueMemberS{Value: k.ID},
+		"name":      &types.AttributeValueMemberS{Value: k.Name},
+		"keyHash":   &types.AttributeValueMemberS{Value: k.KeyHash},
+		"scopes":    &types.AttributeValueMemberSS{Value: k.Scopes},
+		"createdBy": &types.AttributeValueMemberS{Value: k.CreatedBy},
+		"createdAt": &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", k.CreatedAt)},
+	}
+
+	if k.ExpiresAt > 0 {
+		item["expiresAt"] = &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", k.ExpiresAt)}
+	}
+
+	return item
+}
+
+func (k APIKey) HasScope(scope string) bool {
+	return slices.Contains(k.Scopes, scope)
+}
+
+func IsValidScope(scope string) bool {
+	return slices.Contains(ValidScopes, scope)
+}
@@ -0,0 +1,37 @@
+package auditmodel
+
+import "fmt"
+
+const (
+	ActionPostCreate    = "post.create"
+	ActionPostUpdate    = "post.update"
+	ActionPostDelete    = "post.delete"
+	ActionPostRestore   = "post.restore"
+	ActionPostPurge     = "post.purge"
+	ActionLogin         = "auth.login"
+	ActionLoginFailed   = "auth.login_failed"
+	ActionMFALogin      = "auth.mfa_login"
+	ActionOIDCLogin     = "auth.oidc_login"
+	ActionTOTPEnroll    = "auth.totp_enroll"
+	ActionTOTPVerify    = "auth.totp_verify"
+	ActionAPIKeyCreate  = "apikey.create"
+	ActionAPIKeyRevoke  = "apikey.revoke"
+	UnauthenticatedUser = "anonymous"
+)
+
+type AuditEntry struct {
+	ID        string         `json:"id" dynamodbav:"id"`
+	Actor     string         `json:"actor" dynamodbav:"actor"`
+	Action    string         `json:"action" dynamodbav:"action"`
+	TargetID  string         `json:"target_id,omitempty" dynamodbav:"targetId,omitempty"`
+	Before    map[string]any `json:"before,omitempty" dynamodbav:"before,omitempty"`
+	After     map[string]any `json:"after,omitempty" dynamodbav:"after,omitempty"`
+	SourceIP  string         `json:"source_ip,omitempty" dynamodbav:"sourceIp,omitempty"`
+	RequestID string         `json:"request_id,omitempty" dynamodbav:"requestId,omitempty"`
+	Timestamp int64          `json:"timestamp" dynamodbav:"timestamp"`
+	SortKey   string         `json:"-" dynamodbav:"sortKey"`
+}
+
+func MakeSortKey(timestamp int64, id string) string {
+	return fmt.Sprintf("%013d#%s", timestamp, id)
+}
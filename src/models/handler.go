@@ -1,11 +1,22 @@
 package models
 
 import (
+	"log/slog"
+
 	"github.com/JaxonAdams/blog-backend/src/services/aws/dynamodb"
 	"github.com/JaxonAdams/blog-backend/src/services/aws/s3"
+	"github.com/JaxonAdams/blog-backend/src/services/config"
+	"github.com/JaxonAdams/blog-backend/src/services/jwt"
+	"github.com/JaxonAdams/blog-backend/src/services/oidc"
+	"github.com/JaxonAdams/blog-backend/src/services/secrets"
 )
 
 type HandlerServices struct {
-	S3Service       *s3.S3Service
-	DynamoDBService *dynamodb.DynamoDBService
+	Config          *config.Config
+	S3Service       s3.Store
+	DynamoDBService dynamodb.Store
+	OIDCClient      *oidc.Client
+	Secrets         secrets.Provider
+	JWT             *jwt.Signer
+	Logger          *slog.Logger
 }
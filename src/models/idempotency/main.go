@@ -0,0 +1,20 @@
+package idempotencymodel
+
+const (
+	StatusInProgress = "in_progress"
+	StatusCompleted  = "completed"
+)
+
+type IdempotencyRecord struct {
+	Key             string            `dynamodbav:"key"`
+	RequestHash     string            `dynamodbav:"requestHash"`
+	Status          string            `dynamodbav:"status"`
+	ResponseStatus  int               `dynamodbav:"responseStatus,omitempty"`
+	ResponseBody    string            `dynamodbav:"responseBody,omitempty"`
+	ResponseHeaders map[string]string `dynamodbav:"responseHeaders,omitempty"`
+	CreatedAt       int64             `dynamodbav:"createdAt"`
+	ExpiresAt       int64             `dynamodbav:"expiresAt"`
+	// Unix milliseconds after which an in-progress claim is abandoned and
+	// another request may take it over
+	LeaseExpiresAt int64 `dynamodbav:"leaseExpiresAt,omitempty"`
+}
@@ -1,11 +1,22 @@
 package postmodel
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 )
 
+// Representations a post can be served as
+const (
+	FormatJSON     = "json"
+	FormatHTML     = "html"
+	FormatMarkdown = "md"
+)
+
 type Post struct {
 	ID          string   `json:"id" validate:"required"`
 	Title       string   `json:"title" validate:"required"`
@@ -13,14 +24,20 @@ type Post struct {
 	Tags        []string `json:"tags" validate:"required"`
 	HtmlPostUrl string   `json:"html_post_url,omitempty" dynamodbav:"html_post_url,omitempty"`
 	MdPostUrl   string   `json:"md_post_url,omitempty" dynamodbav:"md_post_url,omitempty"`
+	HtmlContent string   `json:"html_content,omitempty" dynamodbav:"-"`
+	MdContent   string   `json:"md_content,omitempty" dynamodbav:"-"`
 	HtmlS3Key   string   `json:"html_s3_key" dynamodbav:"html_s3_key"`
 	MdS3Key     string   `json:"md_s3_key" dynamodbav:"md_s3_key"`
 	CreatedAt   int64    `json:"created_at" validate:"required"`
 	ModifiedAt  int64    `json:"modified_at" validate:"required"`
+	DeletedAt   int64    `json:"deleted_at,omitempty" dynamodbav:"deletedAt,omitempty"`
+	Version     int64    `json:"version" dynamodbav:"version"`
+	// SHA-256 of the Markdown, to spot unchanged content without reading S3
+	ContentHash string `json:"content_hash,omitempty" dynamodbav:"content_hash,omitempty"`
 }
 
 func (p Post) DynamoFormat() map[string]types.AttributeValue {
-	return map[string]types.AttributeValue{
+	item := map[string]types.AttributeValue{
 		"id":          &types.AttributeValueMemberS{Value: p.ID},
 		"title":       &types.AttributeValueMemberS{Value: p.Title},
 		"summary":     &types.AttributeValueMemberS{Value: p.Summary},
@@ -29,7 +46,68 @@ func (p Post) DynamoFormat() map[string]types.AttributeValue {
 		"md_s3_key":   &types.AttributeValueMemberS{Value: p.MdS3Key},
 		"createdAt":   &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", p.CreatedAt)},
 		"modifiedAt":  &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", p.ModifiedAt)},
+		"version":     &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", p.Version)},
+	}
+
+	if p.DeletedAt > 0 {
+		item["deletedAt"] = &types.AttributeValueMemberN{Value: fmt.Sprintf("%d", p.DeletedAt)}
+	}
+
+	if p.ContentHash != "" {
+		item["content_hash"] = &types.AttributeValueMemberS{Value: p.ContentHash}
+	}
+
+	return item
+}
+
+func (p Post) ETag() string {
+	return VersionETag(p.Version)
+}
+
+// FormatETag gives each representation of a version its own validator. The
+// JSON form keeps the plain version tag that If-Match expects.
+func (p Post) FormatETag(format string) string {
+	if format == "" || format == FormatJSON {
+		return p.ETag()
 	}
+
+	return fmt.Sprintf("\"%d-%s\"", p.Version, format)
+}
+
+func VersionETag(version int64) string {
+	return fmt.Sprintf("\"%d\"", version)
+}
+
+func (p Post) LastModified() time.Time {
+	return time.UnixMilli(p.ModifiedAt)
+}
+
+func (p Post) IsDeleted() bool {
+	return p.DeletedAt > 0
+}
+
+func HashContent(markdown string) string {
+	sum := sha256.Sum256([]byte(markdown))
+	return hex.EncodeToString(sum[:])
+}
+
+// Slug names the post in URLs and file names, e.g. "hello-world".
+func (p Post) Slug() string {
+	return Slugify(p.Title)
+}
+
+// SlugWithID is Slug followed by the start of the ID, e.g.
+// "hello-world-1a2b3c4d", for when the slug is empty or another post has it.
+func (p Post) SlugWithID() string {
+	return strings.Trim(p.Slug()+"-"+p.ID[:min(8, len(p.ID))], "-")
+}
+
+// Slugify lowercases s and joins its runs of letters and digits with hyphens.
+func Slugify(s string) string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	})
+	return strings.Join(words, "-")
 }
 
 type PartialPostUpdate struct {
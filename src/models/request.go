@@ -3,34 +3,90 @@ package models
 import "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 
 type CreatePostInput struct {
-	Title   string   `json:"title" validate:"required"`
-	Summary string   `json:"summary" validate:"required"`
-	Tags    []string `json:"tags" validate:"required"`
-	Content string   `json:"content" validate:"required"`
+	Title   string   `json:"title" validate:"required,max=200"`
+	Summary string   `json:"summary" validate:"required,max=500"`
+	Tags    []string `json:"tags" validate:"required,min=1,max=10,dive,slug,max=32"`
+	Content string   `json:"content" validate:"required,max=1000000"`
 }
 
 type GetPostByIdInput struct {
-	ID string `json:"string" validate:"required"`
+	ID      string   `json:"post_id" validate:"required,max=128"`
+	Include []string `json:"include,omitempty" validate:"dive,oneof=html md"`
+	Format  string   `json:"-" validate:"omitempty,oneof=json html md"`
 }
 
 type GetPostsInput struct {
-	PageSize int
-	StartKey map[string]types.AttributeValue
+	PageSize int                             `json:"pageSize" validate:"min=0,max=100"`
+	StartKey map[string]types.AttributeValue `json:"startKey"`
 }
 
 type UpdatePostInput struct {
 	GetPostByIdInput
-	Title   *string   `json:"title" validate:"required"`
-	Summary *string   `json:"summary" validate:"required"`
-	Tags    *[]string `json:"tags" validate:"required"`
-	Content *string   `json:"content" validate:"required"`
+	Title           *string   `json:"title" validate:"omitnil,min=1,max=200"`
+	Summary         *string   `json:"summary" validate:"omitnil,max=500"`
+	Tags            *[]string `json:"tags" validate:"omitnil,min=1,max=10,dive,slug,max=32"`
+	Content         *string   `json:"content" validate:"omitnil,min=1,max=1000000"`
+	ExpectedVersion *int64    `json:"expectedVersion" validate:"omitnil,min=0"`
 }
 
 type DeletePostInput struct {
 	GetPostByIdInput
 }
 
+type RestorePostInput struct {
+	GetPostByIdInput
+}
+
+type PurgePostInput struct {
+	GetPostByIdInput
+}
+
+type SyncPostsInput struct {
+	// Only plans the sync unless set to false
+	DryRun bool `json:"dryRun"`
+	// Moves posts no file matches to the trash
+	Prune bool `json:"prune"`
+	// A tar archive of Markdown files, optionally gzipped
+	Archive []byte `json:"-" validate:"required,min=1"`
+}
+
 type AdminLoginInput struct {
-	Username string `json:"username" validate:"required"`
-	Password string `json:"password" validate:"required"`
+	Username string `json:"username" validate:"required,max=128"`
+	// bcrypt ignores anything past 72 bytes
+	Password string `json:"password" validate:"required,max=72"`
+}
+
+type TOTPVerifyInput struct {
+	Code string `json:"code" validate:"required,numeric,len=6"`
+}
+
+type AdminMFALoginInput struct {
+	ChallengeToken string `json:"challenge_token" validate:"required"`
+	Code           string `json:"code" validate:"required_without=RecoveryCode,omitempty,numeric,len=6"`
+	RecoveryCode   string `json:"recovery_code" validate:"omitempty,max=64"`
+}
+
+type CreateAPIKeyInput struct {
+	Name      string   `json:"name" validate:"required,max=100"`
+	Scopes    []string `json:"scopes" validate:"required,min=1,max=10,dive,required"`
+	ExpiresAt int64    `json:"expires_at" validate:"omitempty,gt=0"`
+}
+
+type RevokeAPIKeyInput struct {
+	ID string `json:"key_id" validate:"required,max=128"`
+}
+
+type OIDCCallbackInput struct {
+	Code       string `json:"code" validate:"required,max=2048"`
+	State      string `json:"state" validate:"required,max=512"`
+	StateToken string `json:"state_token" validate:"required"`
+}
+
+type GetAuditEntriesInput struct {
+	Actor    string                          `json:"actor" validate:"max=256"`
+	TargetID string                          `json:"target" validate:"max=256"`
+	From     int64                           `json:"from" validate:"min=0"`
+	To       int64                           `json:"to" validate:"min=0"`
+	PageSize int                             `json:"pageSize" validate:"min=0,max=100"`
+	StartKey map[string]types.AttributeValue `json:"startKey"`
 }
@@ -0,0 +1,46 @@
+package models
+
+import (
+	apikeymodel "github.com/JaxonAdams/blog-backend/src/models/apikeys"
+	auditmodel "github.com/JaxonAdams/blog-backend/src/models/audit"
+	postmodel "github.com/JaxonAdams/blog-backend/src/models/posts"
+)
+
+// PageMetadata accompanies each page of a listing. NextStartKey is passed
+// back as startKey for the next page, and is empty on the last one.
+type PageMetadata struct {
+	NextStartKey string `json:"nextStartKey"`
+}
+
+type PostResponse struct {
+	Post postmodel.Post `json:"post"`
+}
+
+type PostListResponse struct {
+	Posts    []postmodel.Post `json:"posts"`
+	Metadata PageMetadata     `json:"_metadata"`
+}
+
+type TokenResponse struct {
+	Token string `json:"token"`
+}
+
+type TOTPVerifyResponse struct {
+	TOTPEnabled   bool     `json:"totp_enabled"`
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type CreateAPIKeyResponse struct {
+	APIKey apikeymodel.APIKey `json:"api_key"`
+	// Shown only once; only its hash is stored
+	Key string `json:"key"`
+}
+
+type APIKeyListResponse struct {
+	APIKeys []apikeymodel.APIKey `json:"api_keys"`
+}
+
+type AuditEntryListResponse struct {
+	Entries  []auditmodel.AuditEntry `json:"entries"`
+	Metadata PageMetadata            `json:"_metadata"`
+}
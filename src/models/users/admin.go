@@ -1,9 +1,25 @@
 package usermodel
 
+import "log/slog"
+
 type AdminUser struct {
-	Username   string `json:"username" validate:"required"`
-	Role       string `json:"role" validate:"required"`
-	HashedPW   string `json:"password_hash" validate:"required"`
-	CreatedAt  int64  `json:"created_at" validate:"required"`
-	ModifiedAt int64  `json:"modified_at" validate:"required"`
+	Username    string `json:"username" validate:"required"`
+	Role        string `json:"role" validate:"required"`
+	HashedPW    string `json:"password_hash" validate:"required"`
+	TOTPSecret  string `json:"-" dynamodbav:"totp_secret,omitempty"`
+	TOTPEnabled bool   `json:"totp_enabled" dynamodbav:"totp_enabled"`
+	// Time step of the last TOTP code accepted, so it cannot be used again
+	TOTPLastStep  int64    `json:"-" dynamodbav:"totp_last_step,omitempty"`
+	RecoveryCodes []string `json:"-" dynamodbav:"recovery_codes,omitempty,stringset"`
+	CreatedAt     int64    `json:"created_at" validate:"required"`
+	ModifiedAt    int64    `json:"modified_at" validate:"required"`
+}
+
+// LogValue keeps credentials out of logs when a user is logged directly.
+func (u AdminUser) LogValue() slog.Value {
+	return slog.GroupValue(
+		slog.String("username", u.Username),
+		slog.String("role", u.Role),
+		slog.Bool("totp_enabled", u.TOTPEnabled),
+	)
 }
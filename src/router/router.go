@@ -0,0 +1,276 @@
+package router
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/JaxonAdams/blog-backend/src/middleware"
+	"github.com/JaxonAdams/blog-backend/src/models"
+	"github.com/JaxonAdams/blog-backend/src/routes"
+	"github.com/JaxonAdams/blog-backend/src/services/apperror"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+type lambdaHandler func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error)
+
+type boundRoute struct {
+	method   string
+	path     string
+	segments []string
+	handler  lambdaHandler
+}
+
+// Router serves every API route from a single function, so all routes share
+// one set of warm AWS clients. Per-function deployments use a Router with
+// one route, so both read HTTP API events the same way.
+type Router struct {
+	routes   []boundRoute
+	services models.HandlerServices
+}
+
+func New(services models.HandlerServices, routeList []routes.Route) *Router {
+	router := &Router{services: services}
+
+	for _, route := range routeList {
+		router.routes = append(router.routes, boundRoute{
+			method:   route.Method,
+			path:     route.Path,
+			segments: splitPath(route.Path),
+			handler:  route.Bind(services),
+		})
+	}
+
+	return router
+}
+
+// Invoke implements lambda.Handler. It accepts both API Gateway v1 proxy
+// events and v2 HTTP API events, replying in the same format.
+func (r *Router) Invoke(ctx context.Context, payload []byte) ([]byte, error) {
+	var envelope struct {
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(payload, &envelope); err != nil {
+		return nil, fmt.Errorf("failed to decode event: %w", err)
+	}
+
+	if envelope.Version == "2.0" {
+		var event events.APIGatewayV2HTTPRequest
+		if err := json.Unmarshal(payload, &event); err != nil {
+			return nil, fmt.Errorf("failed to decode HTTP API event: %w", err)
+		}
+
+		response, err := r.Route(ctx, fromV2Request(event))
+		if err != nil {
+			return nil, err
+		}
+
+		return json.Marshal(toV2Response(response))
+	}
+
+	var event events.APIGatewayProxyRequest
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("failed to decode proxy event: %w", err)
+	}
+
+	response, err := r.Route(ctx, fromV1Request(event))
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(response)
+}
+
+// Route dispatches request to the route matching its method and path, filling
+// in the route's path parameters.
+func (r *Router) Route(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	route, params, allowed := r.match(request.HTTPMethod, request.Path)
+	if route == nil {
+		var err error = apperror.New(apperror.CodeNotFound, fmt.Sprintf("no route matches %s", request.Path))
+		if len(allowed) > 0 {
+			err = ErrCodeMethodNotAllowed{
+				Msg:     fmt.Sprintf("%s is not supported on %s", request.HTTPMethod, request.Path),
+				Allowed: allowed,
+			}
+		}
+
+		return middleware.Wrap(r.services, "", fail(err))(ctx, request)
+	}
+
+	request.Resource = route.path
+	request.PathParameters = params
+
+	return route.handler(ctx, request)
+}
+
+// match prefers the route with the most literal segments, so /posts/trash
+// wins over /posts/{post_id}. When only the method differs it returns the
+// methods the path does support.
+func (r *Router) match(method, path string) (*boundRoute, map[string]string, []string) {
+	segments := splitPath(path)
+
+	var best *boundRoute
+	var bestParams map[string]string
+	bestLiterals := -1
+	var allowed []string
+
+	for i := range r.routes {
+		route := &r.routes[i]
+
+		params, literals, ok := matchSegments(route.segments, segments)
+		if !ok {
+			continue
+		}
+
+		if route.method != method {
+			if !slices.Contains(allowed, route.method) {
+				allowed = append(allowed, route.method)
+			}
+			continue
+		}
+
+		if literals > bestLiterals {
+			best, bestParams, bestLiterals = route, params, literals
+		}
+	}
+
+	return best, bestParams, allowed
+}
+
+func matchSegments(pattern, segments []string) (map[string]string, int, bool) {
+	if len(pattern) != len(segments) {
+		return nil, 0, false
+	}
+
+	params := map[string]string{}
+	literals := 0
+	for i, part := range pattern {
+		if strings.HasPrefix(part, "{") && strings.HasSuffix(part, "}") {
+			if segments[i] == "" {
+				return nil, 0, false
+			}
+			params[strings.Trim(part, "{}")] = segments[i]
+			continue
+		}
+
+		if part != segments[i] {
+			return nil, 0, false
+		}
+		literals++
+	}
+
+	return params, literals, true
+}
+
+func splitPath(path string) []string {
+	return strings.Split(strings.Trim(path, "/"), "/")
+}
+
+func fail(err error) middleware.Handler {
+	return func(ctx context.Context, request events.APIGatewayProxyRequest, services models.HandlerServices) (events.APIGatewayProxyResponse, error) {
+		return events.APIGatewayProxyResponse{}, err
+	}
+}
+
+// fromV1Request moves a REST API authorizer's context under "lambda", where
+// HTTP API events put it and the handlers look for it.
+func fromV1Request(event events.APIGatewayProxyRequest) events.APIGatewayProxyRequest {
+	if authorizer := event.RequestContext.Authorizer; len(authorizer) > 0 {
+		if _, ok := authorizer["lambda"]; !ok {
+			event.RequestContext.Authorizer = map[string]any{"lambda": authorizer}
+		}
+	}
+
+	return decodeBody(event)
+}
+
+func fromV2Request(event events.APIGatewayV2HTTPRequest) events.APIGatewayProxyRequest {
+	path := event.RawPath
+	if stage := event.RequestContext.Stage; stage != "" && stage != "$default" {
+		path = strings.TrimPrefix(path, "/"+stage)
+	}
+
+	headers := event.Headers
+	if len(event.Cookies) > 0 {
+		if headers == nil {
+			headers = map[string]string{}
+		}
+		headers["cookie"] = strings.Join(event.Cookies, "; ")
+	}
+
+	request := events.APIGatewayProxyRequest{
+		HTTPMethod:            event.RequestContext.HTTP.Method,
+		Path:                  path,
+		Headers:               headers,
+		QueryStringParameters: event.QueryStringParameters,
+		PathParameters:        event.PathParameters,
+		StageVariables:        event.StageVariables,
+		Body:                  event.Body,
+		IsBase64Encoded:       event.IsBase64Encoded,
+		RequestContext: events.APIGatewayProxyRequestContext{
+			RequestID:  event.RequestContext.RequestID,
+			Stage:      event.RequestContext.Stage,
+			DomainName: event.RequestContext.DomainName,
+			APIID:      event.RequestContext.APIID,
+			HTTPMethod: event.RequestContext.HTTP.Method,
+			Path:       path,
+			Identity: events.APIGatewayRequestIdentity{
+				SourceIP:  event.RequestContext.HTTP.SourceIP,
+				UserAgent: event.RequestContext.HTTP.UserAgent,
+			},
+		},
+	}
+
+	if authorizer := event.RequestContext.Authorizer; authorizer != nil && authorizer.Lambda != nil {
+		request.RequestContext.Authorizer = map[string]any{"lambda": authorizer.Lambda}
+	}
+
+	return decodeBody(request)
+}
+
+func toV2Response(response events.APIGatewayProxyResponse) events.APIGatewayV2HTTPResponse {
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode:        response.StatusCode,
+		Headers:           response.Headers,
+		MultiValueHeaders: response.MultiValueHeaders,
+		Body:              response.Body,
+		IsBase64Encoded:   response.IsBase64Encoded,
+	}
+}
+
+// decodeBody hands handlers the raw body whichever way API Gateway encoded it.
+func decodeBody(request events.APIGatewayProxyRequest) events.APIGatewayProxyRequest {
+	if !request.IsBase64Encoded {
+		return request
+	}
+
+	body, err := base64.StdEncoding.DecodeString(request.Body)
+	if err != nil {
+		return request
+	}
+
+	request.Body = string(body)
+	request.IsBase64Encoded = false
+
+	return request
+}
+
+type ErrCodeMethodNotAllowed struct {
+	Msg     string
+	Allowed []string
+}
+
+func (e ErrCodeMethodNotAllowed) Error() string {
+	return e.Msg
+}
+
+func (e ErrCodeMethodNotAllowed) ErrorCode() apperror.Code {
+	return apperror.CodeMethodNotAllowed
+}
+
+func (e ErrCodeMethodNotAllowed) ProblemHeaders() map[string]string {
+	return map[string]string{"Allow": strings.Join(e.Allowed, ", ")}
+}
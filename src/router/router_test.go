@@ -0,0 +1,91 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"testing"
+
+	"github.com/JaxonAdams/blog-backend/src/models"
+	"github.com/JaxonAdams/blog-backend/src/routes"
+	"github.com/JaxonAdams/blog-backend/src/services/config"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func TestInvokeSourceIP(t *testing.T) {
+	services := models.HandlerServices{
+		Config: &config.Config{},
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	var got events.APIGatewayProxyRequest
+	router := New(services, []routes.Route{{
+		Method: http.MethodGet,
+		Path:   "/api/v1/posts/{post_id}",
+		Handle: func(ctx context.Context, request events.APIGatewayProxyRequest, services models.HandlerServices) (events.APIGatewayProxyResponse, error) {
+			got = request
+			return events.APIGatewayProxyResponse{StatusCode: http.StatusOK}, nil
+		},
+	}})
+
+	tests := []struct {
+		name    string
+		payload string
+	}{
+		{
+			name: "HTTP API event",
+			payload: `{
+				"version": "2.0",
+				"rawPath": "/api/v1/posts/abc",
+				"requestContext": {
+					"requestId": "req-1",
+					"stage": "$default",
+					"http": {"method": "GET", "path": "/api/v1/posts/abc", "sourceIp": "203.0.113.7", "userAgent": "blogctl"}
+				}
+			}`,
+		},
+		{
+			name: "REST API event",
+			payload: `{
+				"httpMethod": "GET",
+				"path": "/api/v1/posts/abc",
+				"requestContext": {
+					"requestId": "req-1",
+					"identity": {"sourceIp": "203.0.113.7", "userAgent": "blogctl"}
+				}
+			}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got = events.APIGatewayProxyRequest{}
+
+			reply, err := router.Invoke(context.Background(), []byte(tt.payload))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var response struct {
+				StatusCode int `json:"statusCode"`
+			}
+			if err := json.Unmarshal(reply, &response); err != nil {
+				t.Fatal(err)
+			}
+			if response.StatusCode != http.StatusOK {
+				t.Fatalf("status = %d, want 200", response.StatusCode)
+			}
+
+			if got.RequestContext.Identity.SourceIP != "203.0.113.7" {
+				t.Errorf("SourceIP = %q, want 203.0.113.7", got.RequestContext.Identity.SourceIP)
+			}
+			if got.RequestContext.Identity.UserAgent != "blogctl" {
+				t.Errorf("UserAgent = %q, want blogctl", got.RequestContext.Identity.UserAgent)
+			}
+			if got.PathParameters["post_id"] != "abc" {
+				t.Errorf("post_id = %q, want abc", got.PathParameters["post_id"])
+			}
+		})
+	}
+}
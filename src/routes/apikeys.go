@@ -0,0 +1,57 @@
+package routes
+
+import (
+	"context"
+
+	"github.com/JaxonAdams/blog-backend/src/helpers"
+	"github.com/JaxonAdams/blog-backend/src/models"
+	auditmodel "github.com/JaxonAdams/blog-backend/src/models/audit"
+	apikeyservice "github.com/JaxonAdams/blog-backend/src/services/apikey"
+	auditservice "github.com/JaxonAdams/blog-backend/src/services/audit"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func createAPIKey(ctx context.Context, request events.APIGatewayProxyRequest, services models.HandlerServices) (events.APIGatewayProxyResponse, error) {
+	createdBy, _ := helpers.GetRequestSubject(request)
+
+	parsedRequest, err := helpers.ParseCreateAPIKeyInput(request)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	apiKey, rawKey, err := apikeyservice.CreateAPIKey(parsedRequest, createdBy, services, ctx)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	entry := auditservice.NewEntry(request, auditmodel.ActionAPIKeyCreate, apiKey.ID)
+	entry.After = map[string]any{"name": apiKey.Name, "scopes": apiKey.Scopes, "expires_at": apiKey.ExpiresAt}
+	auditservice.Record(entry, services, ctx)
+
+	return helpers.MakeSuccessResponse(201, models.CreateAPIKeyResponse{APIKey: apiKey, Key: rawKey})
+}
+
+func getAllAPIKeys(ctx context.Context, request events.APIGatewayProxyRequest, services models.HandlerServices) (events.APIGatewayProxyResponse, error) {
+	apiKeys, err := apikeyservice.GetAllAPIKeys(services, ctx)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	return helpers.MakeSuccessResponse(200, models.APIKeyListResponse{APIKeys: apiKeys})
+}
+
+func revokeAPIKey(ctx context.Context, request events.APIGatewayProxyRequest, services models.HandlerServices) (events.APIGatewayProxyResponse, error) {
+	parsedRequest, err := helpers.ParseRevokeAPIKeyInput(request)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	err = apikeyservice.RevokeAPIKey(parsedRequest.ID, services, ctx)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	auditservice.Record(auditservice.NewEntry(request, auditmodel.ActionAPIKeyRevoke, parsedRequest.ID), services, ctx)
+
+	return events.APIGatewayProxyResponse{StatusCode: 204}, nil
+}
@@ -0,0 +1,24 @@
+package routes
+
+import (
+	"context"
+
+	"github.com/JaxonAdams/blog-backend/src/helpers"
+	"github.com/JaxonAdams/blog-backend/src/models"
+	auditservice "github.com/JaxonAdams/blog-backend/src/services/audit"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func getAuditEntries(ctx context.Context, request events.APIGatewayProxyRequest, services models.HandlerServices) (events.APIGatewayProxyResponse, error) {
+	parsedRequest, err := helpers.ParseGetAuditEntriesInput(request, services.Config.DefaultPageSize)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	entries, metadata, err := auditservice.GetAuditEntries(parsedRequest, services, ctx)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	return helpers.MakeSuccessResponse(200, models.AuditEntryListResponse{Entries: entries, Metadata: metadata})
+}
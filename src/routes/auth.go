@@ -0,0 +1,132 @@
+package routes
+
+import (
+	"context"
+
+	"github.com/JaxonAdams/blog-backend/src/helpers"
+	"github.com/JaxonAdams/blog-backend/src/models"
+	auditmodel "github.com/JaxonAdams/blog-backend/src/models/audit"
+	auditservice "github.com/JaxonAdams/blog-backend/src/services/audit"
+	loginservice "github.com/JaxonAdams/blog-backend/src/services/login"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func logInAdmin(ctx context.Context, request events.APIGatewayProxyRequest, services models.HandlerServices) (events.APIGatewayProxyResponse, error) {
+	parsedRequest, err := helpers.ParseAdminLoginInput(request)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	result, err := loginservice.LogInAdmin(parsedRequest, services, ctx)
+
+	// Anyone can send any username, so it only names the actor once the
+	// password has been checked; a failed attempt stays anonymous
+	entry := auditservice.NewEntry(request, auditmodel.ActionLogin, parsedRequest.Username)
+	if err != nil {
+		entry.Action = auditmodel.ActionLoginFailed
+		entry.After = map[string]any{"username": parsedRequest.Username}
+	} else {
+		entry.Actor = parsedRequest.Username
+		if result.MFARequired {
+			entry.After = map[string]any{"mfa_required": true}
+		}
+	}
+	auditservice.Record(entry, services, ctx)
+
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	return helpers.MakeSuccessResponse(200, result)
+}
+
+func completeMFALogin(ctx context.Context, request events.APIGatewayProxyRequest, services models.HandlerServices) (events.APIGatewayProxyResponse, error) {
+	parsedRequest, err := helpers.ParseAdminMFALoginInput(request)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	token, err := loginservice.CompleteAdminMFALogin(parsedRequest, services, ctx)
+
+	entry := auditservice.NewEntry(request, auditmodel.ActionMFALogin, "")
+	if claims, err := services.JWT.ParseMFAChallengeJWT(parsedRequest.ChallengeToken, ctx); err == nil {
+		entry.Actor = claims.Subject
+		entry.TargetID = claims.Subject
+	}
+	if err != nil {
+		entry.Action = auditmodel.ActionLoginFailed
+		entry.After = map[string]any{"step": "mfa"}
+	}
+	auditservice.Record(entry, services, ctx)
+
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	return helpers.MakeSuccessResponse(200, models.TokenResponse{Token: token})
+}
+
+func enrollTOTP(ctx context.Context, request events.APIGatewayProxyRequest, services models.HandlerServices) (events.APIGatewayProxyResponse, error) {
+	username, _ := helpers.GetRequestSubject(request)
+
+	enrollment, err := loginservice.EnrollTOTP(username, services, ctx)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	auditservice.Record(auditservice.NewEntry(request, auditmodel.ActionTOTPEnroll, username), services, ctx)
+
+	return helpers.MakeSuccessResponse(200, enrollment)
+}
+
+func verifyTOTP(ctx context.Context, request events.APIGatewayProxyRequest, services models.HandlerServices) (events.APIGatewayProxyResponse, error) {
+	username, _ := helpers.GetRequestSubject(request)
+
+	parsedRequest, err := helpers.ParseTOTPVerifyInput(request)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	recoveryCodes, err := loginservice.VerifyTOTP(username, parsedRequest, services, ctx)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	auditservice.Record(auditservice.NewEntry(request, auditmodel.ActionTOTPVerify, username), services, ctx)
+
+	return helpers.MakeSuccessResponse(200, models.TOTPVerifyResponse{TOTPEnabled: true, RecoveryCodes: recoveryCodes})
+}
+
+func beginOIDCLogin(ctx context.Context, request events.APIGatewayProxyRequest, services models.HandlerServices) (events.APIGatewayProxyResponse, error) {
+	authorization, err := loginservice.BeginOIDCLogin(services, ctx)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	return helpers.MakeSuccessResponse(200, authorization)
+}
+
+func completeOIDCLogin(ctx context.Context, request events.APIGatewayProxyRequest, services models.HandlerServices) (events.APIGatewayProxyResponse, error) {
+	parsedRequest, err := helpers.ParseOIDCCallbackInput(request)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	token, err := loginservice.CompleteOIDCLogin(parsedRequest, services, ctx)
+
+	entry := auditservice.NewEntry(request, auditmodel.ActionOIDCLogin, "")
+	if err != nil {
+		entry.Action = auditmodel.ActionLoginFailed
+		entry.After = map[string]any{"step": "oidc"}
+	} else if claims, err := services.JWT.ParseJWT(token, ctx); err == nil {
+		entry.Actor = claims.Subject
+		entry.TargetID = claims.Subject
+	}
+	auditservice.Record(entry, services, ctx)
+
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	return helpers.MakeSuccessResponse(200, models.TokenResponse{Token: token})
+}
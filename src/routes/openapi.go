@@ -0,0 +1,79 @@
+package routes
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JaxonAdams/blog-backend/src/helpers"
+	"github.com/JaxonAdams/blog-backend/src/models"
+	"github.com/JaxonAdams/blog-backend/src/services/openapi"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// The document describes the route serving it, so it is built in init to
+// avoid an initialization cycle.
+var openAPIDocument func() (string, error)
+
+func init() {
+	openAPIDocument = sync.OnceValues(func() (string, error) {
+		document, err := OpenAPIDocument()
+		if err != nil {
+			return "", err
+		}
+
+		body, err := json.Marshal(document)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode OpenAPI document: %w", err)
+		}
+
+		return string(body), nil
+	})
+}
+
+// OpenAPIDocument describes every route in All. It fails if a route's
+// documented types do not fit its path.
+func OpenAPIDocument() (openapi.Document, error) {
+	var operations []openapi.Operation
+	for _, route := range All() {
+		operations = append(operations, route.Operation())
+	}
+
+	return openapi.Generate("Blog API", "v1", operations)
+}
+
+// Operation describes the route for the OpenAPI document. It is identified
+// by its handler's name, e.g. getPostByID.
+func (r Route) Operation() openapi.Operation {
+	handlerName := runtime.FuncForPC(reflect.ValueOf(r.Handle).Pointer()).Name()
+
+	return openapi.Operation{
+		ID:     handlerName[strings.LastIndex(handlerName, ".")+1:],
+		Method: r.Method,
+		Path:   r.Path,
+		Doc:    r.Doc,
+	}
+}
+
+func getOpenAPIDocument(ctx context.Context, request events.APIGatewayProxyRequest, services models.HandlerServices) (events.APIGatewayProxyResponse, error) {
+	body, err := openAPIDocument()
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	etag := helpers.BodyETag(body)
+	maxAge := services.Config.CacheMaxAge
+	if helpers.IsNotModified(request, etag, time.Time{}) {
+		return helpers.MakeNotModifiedResponse(etag, time.Time{}, maxAge), nil
+	}
+
+	response := helpers.MakeRawResponse(200, "application/json", body)
+	helpers.SetCacheHeaders(&response, etag, time.Time{}, maxAge)
+
+	return response, nil
+}
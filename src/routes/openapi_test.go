@@ -0,0 +1,17 @@
+package routes
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestOpenAPIDocument(t *testing.T) {
+	document, err := OpenAPIDocument()
+	if err != nil {
+		t.Fatalf("OpenAPIDocument() error = %v", err)
+	}
+
+	if _, err := json.Marshal(document); err != nil {
+		t.Fatalf("failed to encode the document: %v", err)
+	}
+}
@@ -0,0 +1,353 @@
+package routes
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/JaxonAdams/blog-backend/src/helpers"
+	"github.com/JaxonAdams/blog-backend/src/models"
+	auditmodel "github.com/JaxonAdams/blog-backend/src/models/audit"
+	postmodel "github.com/JaxonAdams/blog-backend/src/models/posts"
+	"github.com/JaxonAdams/blog-backend/src/services/apperror"
+	auditservice "github.com/JaxonAdams/blog-backend/src/services/audit"
+	"github.com/JaxonAdams/blog-backend/src/services/aws/s3"
+	idempotencyservice "github.com/JaxonAdams/blog-backend/src/services/idempotency"
+	postservice "github.com/JaxonAdams/blog-backend/src/services/post"
+	syncservice "github.com/JaxonAdams/blog-backend/src/services/sync"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func createPost(ctx context.Context, request events.APIGatewayProxyRequest, services models.HandlerServices) (events.APIGatewayProxyResponse, error) {
+	parsedRequest, err := helpers.ParseCreatePostInput(request)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	// Retries carrying the same Idempotency-Key get the original response
+	idempotencyKey := helpers.GetHeader(request, "Idempotency-Key")
+	if len(idempotencyKey) > idempotencyservice.MaxKeyLength {
+		err := apperror.New(apperror.CodeInvalidRequest, fmt.Sprintf("Idempotency-Key must be at most %d characters", idempotencyservice.MaxKeyLength))
+		return events.APIGatewayProxyResponse{}, err
+	}
+	if idempotencyKey != "" {
+		subject, _ := helpers.GetRequestSubject(request)
+		idempotencyKey = fmt.Sprintf("posts.create:%s:%s", subject, idempotencyKey)
+
+		replay, err := idempotencyservice.Begin(idempotencyKey, request.Body, services, ctx)
+		if err != nil {
+			return events.APIGatewayProxyResponse{}, err
+		}
+
+		if replay != nil {
+			return *replay, nil
+		}
+	}
+
+	createdPost, err := postservice.CreatePost(parsedRequest, services, ctx)
+	if err != nil {
+		if idempotencyKey != "" {
+			if releaseErr := idempotencyservice.Release(idempotencyKey, services, ctx); releaseErr != nil {
+				services.Logger.Error("Failed to release idempotency key", "error", releaseErr)
+			}
+		}
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	entry := auditservice.NewEntry(request, auditmodel.ActionPostCreate, createdPost.ID)
+	entry.After = auditservice.PostMetadata(createdPost)
+	auditservice.Record(entry, services, ctx)
+
+	response, err := helpers.MakeSuccessResponse(201, models.PostResponse{Post: createdPost})
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	response.Headers["ETag"] = createdPost.ETag()
+
+	if idempotencyKey != "" {
+		// A claim left in progress would be taken over once its lease runs
+		// out anyway, so free it now rather than block retries until then
+		if err := idempotencyservice.Complete(idempotencyKey, request.Body, response, services, ctx); err != nil {
+			services.Logger.Error("Failed to store idempotent response", "error", err)
+			if releaseErr := idempotencyservice.Release(idempotencyKey, services, ctx); releaseErr != nil {
+				services.Logger.Error("Failed to release idempotency key", "error", releaseErr)
+			}
+		}
+	}
+
+	return response, nil
+}
+
+func getAllPosts(ctx context.Context, request events.APIGatewayProxyRequest, services models.HandlerServices) (events.APIGatewayProxyResponse, error) {
+	parsedRequest, err := helpers.ParseGetPostsInput(request, services.Config.DefaultPageSize)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	posts, metadata, err := postservice.GetAllPosts(parsedRequest, services, ctx)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	response, err := helpers.MakeSuccessResponse(200, models.PostListResponse{Posts: posts, Metadata: metadata})
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	var lastModified time.Time
+	for _, post := range posts {
+		if post.LastModified().After(lastModified) {
+			lastModified = post.LastModified()
+		}
+	}
+
+	// Trashing a post changes the listing without touching any remaining
+	// post's modifiedAt, so only the body ETag can prove it is unchanged
+	etag := helpers.BodyETag(response.Body)
+	maxAge := services.Config.CacheMaxAge
+	if helpers.IsNotModified(request, etag, time.Time{}) {
+		return helpers.MakeNotModifiedResponse(etag, lastModified, maxAge), nil
+	}
+
+	helpers.SetCacheHeaders(&response, etag, lastModified, maxAge)
+
+	return response, nil
+}
+
+var mediaTypes = map[string]string{
+	postmodel.FormatJSON:     "application/json",
+	postmodel.FormatHTML:     "text/html",
+	postmodel.FormatMarkdown: "text/markdown",
+}
+
+func getPostByID(ctx context.Context, request events.APIGatewayProxyRequest, services models.HandlerServices) (events.APIGatewayProxyResponse, error) {
+	parsedRequest, err := helpers.ParseGetPostByIdInput(request)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	if parsedRequest.Format == "" {
+		offers := []string{mediaTypes[postmodel.FormatJSON], mediaTypes[postmodel.FormatHTML], mediaTypes[postmodel.FormatMarkdown]}
+		mediaType, ok := helpers.NegotiateContentType(helpers.GetHeader(request, "Accept"), offers)
+		if !ok {
+			err := apperror.New(apperror.CodeNotAcceptable, fmt.Sprintf("supported media types are %s", strings.Join(offers, ", ")))
+			return events.APIGatewayProxyResponse{}, err
+		}
+
+		for format, offer := range mediaTypes {
+			if offer == mediaType {
+				parsedRequest.Format = format
+			}
+		}
+	}
+
+	if parsedRequest.Format != postmodel.FormatJSON {
+		return getPostContent(parsedRequest, request, services, ctx)
+	}
+
+	post, err := postservice.GetPostWithContent(parsedRequest, services, ctx)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	// Config keeps CacheMaxAge under half the presigned URL expiry, so a
+	// cached body's links outlive it
+	maxAge := services.Config.CacheMaxAge
+	if helpers.IsNotModified(request, post.ETag(), post.LastModified()) {
+		response := helpers.MakeNotModifiedResponse(post.ETag(), post.LastModified(), maxAge)
+		response.Headers["Vary"] = "Accept"
+		return response, nil
+	}
+
+	response, err := helpers.MakeSuccessResponse(200, models.PostResponse{Post: post})
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	helpers.SetCacheHeaders(&response, post.ETag(), post.LastModified(), maxAge)
+	response.Headers["Vary"] = "Accept"
+
+	return response, nil
+}
+
+func getPostContent(input models.GetPostByIdInput, request events.APIGatewayProxyRequest, services models.HandlerServices, ctx context.Context) (events.APIGatewayProxyResponse, error) {
+	post, content, err := postservice.GetPostContent(input.ID, input.Format, services, ctx)
+	if err != nil {
+		// Too large to return from a Lambda, so send the client to S3 instead
+		var tooLargeErr s3.ErrCodeObjectTooLarge
+		if errors.As(err, &tooLargeErr) {
+			return redirectToContent(input, services, ctx)
+		}
+
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	etag := post.FormatETag(input.Format)
+	maxAge := services.Config.CacheMaxAge
+	if helpers.IsNotModified(request, etag, post.LastModified()) {
+		response := helpers.MakeNotModifiedResponse(etag, post.LastModified(), maxAge)
+		response.Headers["Vary"] = "Accept"
+		return response, nil
+	}
+
+	response := helpers.MakeRawResponse(200, mediaTypes[input.Format]+"; charset=utf-8", content)
+	helpers.SetCacheHeaders(&response, etag, post.LastModified(), maxAge)
+	response.Headers["Vary"] = "Accept"
+
+	return response, nil
+}
+
+func redirectToContent(input models.GetPostByIdInput, services models.HandlerServices, ctx context.Context) (events.APIGatewayProxyResponse, error) {
+	post, err := postservice.GetPostByID(input.ID, services, ctx)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	location := post.MdPostUrl
+	if input.Format == postmodel.FormatHTML {
+		location = post.HtmlPostUrl
+	}
+
+	return events.APIGatewayProxyResponse{
+		StatusCode: 303,
+		Headers: map[string]string{
+			"Location":      location,
+			"Cache-Control": "no-store",
+		},
+	}, nil
+}
+
+func updatePost(ctx context.Context, request events.APIGatewayProxyRequest, services models.HandlerServices) (events.APIGatewayProxyResponse, error) {
+	parsedRequest, err := helpers.ParseUpdatePostInput(request)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	origPost, err := services.DynamoDBService.GetPostById(parsedRequest.ID, ctx)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	post, err := postservice.UpdatePost(parsedRequest, services, ctx)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	entry := auditservice.NewEntry(request, auditmodel.ActionPostUpdate, post.ID)
+	entry.Before = auditservice.PostMetadata(origPost)
+	entry.After = auditservice.PostMetadata(post)
+	auditservice.Record(entry, services, ctx)
+
+	response, err := helpers.MakeSuccessResponse(200, models.PostResponse{Post: post})
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+	response.Headers["ETag"] = post.ETag()
+
+	return response, nil
+}
+
+func deletePost(ctx context.Context, request events.APIGatewayProxyRequest, services models.HandlerServices) (events.APIGatewayProxyResponse, error) {
+	parsedRequest, err := helpers.ParseDeletePostInput(request)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	origPost, err := services.DynamoDBService.GetPostById(parsedRequest.ID, ctx)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	err = postservice.DeletePost(parsedRequest.ID, services, ctx)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	entry := auditservice.NewEntry(request, auditmodel.ActionPostDelete, parsedRequest.ID)
+	entry.Before = auditservice.PostMetadata(origPost)
+	auditservice.Record(entry, services, ctx)
+
+	return events.APIGatewayProxyResponse{StatusCode: 204}, nil
+}
+
+func getDeletedPosts(ctx context.Context, request events.APIGatewayProxyRequest, services models.HandlerServices) (events.APIGatewayProxyResponse, error) {
+	parsedRequest, err := helpers.ParseGetPostsInput(request, services.Config.DefaultPageSize)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	posts, metadata, err := postservice.GetDeletedPosts(parsedRequest, services, ctx)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	return helpers.MakeSuccessResponse(200, models.PostListResponse{Posts: posts, Metadata: metadata})
+}
+
+func restorePost(ctx context.Context, request events.APIGatewayProxyRequest, services models.HandlerServices) (events.APIGatewayProxyResponse, error) {
+	parsedRequest, err := helpers.ParseRestorePostInput(request)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	post, err := postservice.RestorePost(parsedRequest.ID, services, ctx)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	entry := auditservice.NewEntry(request, auditmodel.ActionPostRestore, post.ID)
+	entry.After = auditservice.PostMetadata(post)
+	auditservice.Record(entry, services, ctx)
+
+	return helpers.MakeSuccessResponse(200, models.PostResponse{Post: post})
+}
+
+func purgePost(ctx context.Context, request events.APIGatewayProxyRequest, services models.HandlerServices) (events.APIGatewayProxyResponse, error) {
+	parsedRequest, err := helpers.ParsePurgePostInput(request)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	post, err := postservice.PurgePost(parsedRequest.ID, services, ctx)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	entry := auditservice.NewEntry(request, auditmodel.ActionPostPurge, post.ID)
+	entry.Before = auditservice.PostMetadata(post)
+	auditservice.Record(entry, services, ctx)
+
+	return events.APIGatewayProxyResponse{StatusCode: 204}, nil
+}
+
+func syncPosts(ctx context.Context, request events.APIGatewayProxyRequest, services models.HandlerServices) (events.APIGatewayProxyResponse, error) {
+	parsedRequest, err := helpers.ParseSyncPostsInput(request)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	files, err := syncservice.ReadTarball(bytes.NewReader(parsedRequest.Archive))
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	plan, err := syncservice.BuildPlan(files, parsedRequest.Prune, services, ctx)
+	if err != nil {
+		return events.APIGatewayProxyResponse{}, err
+	}
+
+	if parsedRequest.DryRun {
+		return helpers.MakeSuccessResponse(200, plan)
+	}
+
+	// Failures are reported per change, alongside the changes that were made
+	plan, _ = syncservice.Apply(plan, services, ctx)
+
+	syncservice.RecordAudit(plan, func(action, targetID string) auditmodel.AuditEntry {
+		return auditservice.NewEntry(request, action, targetID)
+	}, services, ctx)
+
+	return helpers.MakeSuccessResponse(200, plan)
+}
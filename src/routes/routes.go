@@ -0,0 +1,284 @@
+package routes
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/JaxonAdams/blog-backend/src/middleware"
+	"github.com/JaxonAdams/blog-backend/src/models"
+	apikeymodel "github.com/JaxonAdams/blog-backend/src/models/apikeys"
+	postmodel "github.com/JaxonAdams/blog-backend/src/models/posts"
+	loginservice "github.com/JaxonAdams/blog-backend/src/services/login"
+	"github.com/JaxonAdams/blog-backend/src/services/openapi"
+	syncservice "github.com/JaxonAdams/blog-backend/src/services/sync"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// Route pairs an API endpoint with its handler and the middleware it needs
+// beyond the standard chain. Path uses API Gateway's {param} syntax.
+type Route struct {
+	Method      string
+	Path        string
+	Handle      middleware.Handler
+	Middlewares []middleware.Middleware
+	Doc         openapi.Doc
+}
+
+// Bind wraps the route's handler in the standard middleware.
+func (r Route) Bind(services models.HandlerServices) func(ctx context.Context, request events.APIGatewayProxyRequest) (events.APIGatewayProxyResponse, error) {
+	return middleware.Wrap(services, r.Method+" "+r.Path, r.Handle, r.Middlewares...)
+}
+
+var (
+	CreatePost = Route{
+		Method:      http.MethodPost,
+		Path:        "/api/v1/posts",
+		Handle:      createPost,
+		Middlewares: []middleware.Middleware{middleware.RequireScope(apikeymodel.ScopePostsWrite)},
+		Doc: openapi.Doc{
+			Summary:    "Create a post",
+			Authorized: true,
+			Input:      models.CreatePostInput{},
+			Responses:  map[int]any{201: models.PostResponse{}},
+		},
+	}
+	GetAllPosts = Route{
+		Method: http.MethodGet,
+		Path:   "/api/v1/posts",
+		Handle: getAllPosts,
+		Doc: openapi.Doc{
+			Summary:   "List posts",
+			Input:     models.GetPostsInput{},
+			Responses: map[int]any{200: models.PostListResponse{}, 304: nil},
+		},
+	}
+	GetPostByID = Route{
+		Method: http.MethodGet,
+		Path:   "/api/v1/posts/{post_id}",
+		Handle: getPostByID,
+		Doc: openapi.Doc{
+			Summary:    "Get a post as JSON, HTML or Markdown",
+			Input:      models.GetPostByIdInput{},
+			Responses:  map[int]any{200: models.PostResponse{}, 303: nil, 304: nil},
+			MediaTypes: []string{mediaTypes[postmodel.FormatHTML], mediaTypes[postmodel.FormatMarkdown]},
+		},
+	}
+	UpdatePost = Route{
+		Method:      http.MethodPatch,
+		Path:        "/api/v1/posts/{post_id}",
+		Handle:      updatePost,
+		Middlewares: []middleware.Middleware{middleware.RequireScope(apikeymodel.ScopePostsWrite)},
+		Doc: openapi.Doc{
+			Summary:    "Update a post",
+			Authorized: true,
+			Input:      models.UpdatePostInput{},
+			Responses:  map[int]any{200: models.PostResponse{}},
+		},
+	}
+	DeletePost = Route{
+		Method:      http.MethodDelete,
+		Path:        "/api/v1/posts/{post_id}",
+		Handle:      deletePost,
+		Middlewares: []middleware.Middleware{middleware.RequireScope(apikeymodel.ScopePostsDelete)},
+		Doc: openapi.Doc{
+			Summary:    "Move a post to the trash",
+			Authorized: true,
+			Input:      models.DeletePostInput{},
+			Responses:  map[int]any{204: nil},
+		},
+	}
+	GetDeletedPosts = Route{
+		Method:      http.MethodGet,
+		Path:        "/api/v1/posts/trash",
+		Handle:      getDeletedPosts,
+		Middlewares: []middleware.Middleware{middleware.RequireAdmin()},
+		Doc: openapi.Doc{
+			Summary:    "List posts in the trash",
+			Authorized: true,
+			Input:      models.GetPostsInput{},
+			Responses:  map[int]any{200: models.PostListResponse{}},
+		},
+	}
+	RestorePost = Route{
+		Method:      http.MethodPost,
+		Path:        "/api/v1/posts/{post_id}/restore",
+		Handle:      restorePost,
+		Middlewares: []middleware.Middleware{middleware.RequireAdmin()},
+		Doc: openapi.Doc{
+			Summary:    "Restore a post from the trash",
+			Authorized: true,
+			Input:      models.RestorePostInput{},
+			Responses:  map[int]any{200: models.PostResponse{}},
+		},
+	}
+	PurgePost = Route{
+		Method:      http.MethodDelete,
+		Path:        "/api/v1/posts/{post_id}/purge",
+		Handle:      purgePost,
+		Middlewares: []middleware.Middleware{middleware.RequireAdmin()},
+		Doc: openapi.Doc{
+			Summary:    "Permanently delete a post in the trash",
+			Authorized: true,
+			Input:      models.PurgePostInput{},
+			Responses:  map[int]any{204: nil},
+		},
+	}
+	SyncPosts = Route{
+		Method:      http.MethodPost,
+		Path:        "/api/v1/posts/sync",
+		Handle:      syncPosts,
+		Middlewares: []middleware.Middleware{middleware.RequireAdmin()},
+		Doc: openapi.Doc{
+			Summary:           "Sync posts with a tree of Markdown files",
+			Authorized:        true,
+			Input:             models.SyncPostsInput{},
+			RequestMediaTypes: []string{"application/gzip", "application/x-tar"},
+			Responses:         map[int]any{200: syncservice.Plan{}},
+		},
+	}
+	LogInAdmin = Route{
+		Method: http.MethodPost,
+		Path:   "/api/v1/auth/login/admin",
+		Handle: logInAdmin,
+		Doc: openapi.Doc{
+			Summary:   "Log in as an admin",
+			Input:     models.AdminLoginInput{},
+			Responses: map[int]any{200: loginservice.AdminLoginResult{}},
+		},
+	}
+	CompleteMFALogin = Route{
+		Method: http.MethodPost,
+		Path:   "/api/v1/auth/login/admin/mfa",
+		Handle: completeMFALogin,
+		Doc: openapi.Doc{
+			Summary:   "Complete an admin login with a TOTP or recovery code",
+			Input:     models.AdminMFALoginInput{},
+			Responses: map[int]any{200: models.TokenResponse{}},
+		},
+	}
+	EnrollTOTP = Route{
+		Method:      http.MethodPost,
+		Path:        "/api/v1/auth/totp/enroll",
+		Handle:      enrollTOTP,
+		Middlewares: []middleware.Middleware{middleware.RequireAdmin(), middleware.RequireSubject()},
+		Doc: openapi.Doc{
+			Summary:    "Begin TOTP enrollment",
+			Authorized: true,
+			Responses:  map[int]any{200: loginservice.TOTPEnrollment{}},
+		},
+	}
+	VerifyTOTP = Route{
+		Method:      http.MethodPost,
+		Path:        "/api/v1/auth/totp/verify",
+		Handle:      verifyTOTP,
+		Middlewares: []middleware.Middleware{middleware.RequireAdmin(), middleware.RequireSubject()},
+		Doc: openapi.Doc{
+			Summary:    "Confirm TOTP enrollment",
+			Authorized: true,
+			Input:      models.TOTPVerifyInput{},
+			Responses:  map[int]any{200: models.TOTPVerifyResponse{}},
+		},
+	}
+	CreateAPIKey = Route{
+		Method:      http.MethodPost,
+		Path:        "/api/v1/auth/api-keys",
+		Handle:      createAPIKey,
+		Middlewares: []middleware.Middleware{middleware.RequireAdmin()},
+		Doc: openapi.Doc{
+			Summary:    "Create an API key",
+			Authorized: true,
+			Input:      models.CreateAPIKeyInput{},
+			Responses:  map[int]any{201: models.CreateAPIKeyResponse{}},
+		},
+	}
+	GetAllAPIKeys = Route{
+		Method:      http.MethodGet,
+		Path:        "/api/v1/auth/api-keys",
+		Handle:      getAllAPIKeys,
+		Middlewares: []middleware.Middleware{middleware.RequireAdmin()},
+		Doc: openapi.Doc{
+			Summary:    "List API keys",
+			Authorized: true,
+			Responses:  map[int]any{200: models.APIKeyListResponse{}},
+		},
+	}
+	RevokeAPIKey = Route{
+		Method:      http.MethodDelete,
+		Path:        "/api/v1/auth/api-keys/{key_id}",
+		Handle:      revokeAPIKey,
+		Middlewares: []middleware.Middleware{middleware.RequireAdmin()},
+		Doc: openapi.Doc{
+			Summary:    "Revoke an API key",
+			Authorized: true,
+			Input:      models.RevokeAPIKeyInput{},
+			Responses:  map[int]any{204: nil},
+		},
+	}
+	BeginOIDCLogin = Route{
+		Method: http.MethodGet,
+		Path:   "/api/v1/auth/oidc/authorize",
+		Handle: beginOIDCLogin,
+		Doc: openapi.Doc{
+			Summary:   "Begin an OIDC login",
+			Responses: map[int]any{200: loginservice.OIDCAuthorization{}},
+		},
+	}
+	CompleteOIDCLogin = Route{
+		Method: http.MethodPost,
+		Path:   "/api/v1/auth/oidc/callback",
+		Handle: completeOIDCLogin,
+		Doc: openapi.Doc{
+			Summary:   "Complete an OIDC login",
+			Input:     models.OIDCCallbackInput{},
+			Responses: map[int]any{200: models.TokenResponse{}},
+		},
+	}
+	GetOpenAPIDocument = Route{
+		Method: http.MethodGet,
+		Path:   "/openapi.json",
+		Handle: getOpenAPIDocument,
+		Doc: openapi.Doc{
+			Summary:    "Get this OpenAPI document",
+			Responses:  map[int]any{200: nil, 304: nil},
+			MediaTypes: []string{"application/json"},
+		},
+	}
+	GetAuditEntries = Route{
+		Method:      http.MethodGet,
+		Path:        "/api/v1/audit",
+		Handle:      getAuditEntries,
+		Middlewares: []middleware.Middleware{middleware.RequireAdmin()},
+		Doc: openapi.Doc{
+			Summary:    "List audit log entries",
+			Authorized: true,
+			Input:      models.GetAuditEntriesInput{},
+			Responses:  map[int]any{200: models.AuditEntryListResponse{}},
+		},
+	}
+)
+
+// All lists every API route, in the order they are declared to API Gateway.
+func All() []Route {
+	return []Route{
+		CreatePost,
+		GetAllPosts,
+		UpdatePost,
+		GetPostByID,
+		DeletePost,
+		LogInAdmin,
+		CompleteMFALogin,
+		EnrollTOTP,
+		VerifyTOTP,
+		CreateAPIKey,
+		GetAllAPIKeys,
+		RevokeAPIKey,
+		BeginOIDCLogin,
+		CompleteOIDCLogin,
+		GetAuditEntries,
+		GetDeletedPosts,
+		RestorePost,
+		PurgePost,
+		SyncPosts,
+		GetOpenAPIDocument,
+	}
+}
@@ -0,0 +1,737 @@
+package routes
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"math/big"
+	"mime"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/JaxonAdams/blog-backend/src/models"
+	apikeymodel "github.com/JaxonAdams/blog-backend/src/models/apikeys"
+	auditmodel "github.com/JaxonAdams/blog-backend/src/models/audit"
+	postmodel "github.com/JaxonAdams/blog-backend/src/models/posts"
+	usermodel "github.com/JaxonAdams/blog-backend/src/models/users"
+	"github.com/JaxonAdams/blog-backend/src/services/aws/dynamodb"
+	"github.com/JaxonAdams/blog-backend/src/services/aws/s3"
+	"github.com/JaxonAdams/blog-backend/src/services/config"
+	"github.com/JaxonAdams/blog-backend/src/services/jwt"
+	loginservice "github.com/JaxonAdams/blog-backend/src/services/login"
+	"github.com/JaxonAdams/blog-backend/src/services/oidc"
+	"github.com/JaxonAdams/blog-backend/src/services/secrets"
+	"github.com/JaxonAdams/blog-backend/src/services/totp"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	gojwt "github.com/golang-jwt/jwt/v5"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// memoryStore keeps the tables in memory, with the conditions the handlers
+// rely on.
+type memoryStore struct {
+	dynamodb.Store
+	posts   map[string]postmodel.Post
+	users   map[string]usermodel.AdminUser
+	apiKeys map[string]apikeymodel.APIKey
+	audit   []auditmodel.AuditEntry
+}
+
+func (s *memoryStore) UpsertPost(post postmodel.Post, ctx context.Context) error {
+	s.posts[post.ID] = post
+	return nil
+}
+
+func (s *memoryStore) UpsertPostIfVersion(post postmodel.Post, expectedVersion int64, ctx context.Context) error {
+	if s.posts[post.ID].Version != expectedVersion {
+		return dynamodb.ErrCodeConditionFailed{Msg: post.ID}
+	}
+	s.posts[post.ID] = post
+	return nil
+}
+
+func (s *memoryStore) DeleteTrashedPost(post postmodel.Post, ctx context.Context) error {
+	current, ok := s.posts[post.ID]
+	if !ok || !current.IsDeleted() || current.Version != post.Version {
+		return dynamodb.ErrCodeConditionFailed{Msg: post.ID}
+	}
+	delete(s.posts, post.ID)
+	return nil
+}
+
+func (s *memoryStore) GetAllPosts(pageSize int32, startKey map[string]types.AttributeValue, ctx context.Context) ([]postmodel.Post, string, error) {
+	return s.list(false), "", nil
+}
+
+func (s *memoryStore) GetDeletedPosts(pageSize int32, startKey map[string]types.AttributeValue, ctx context.Context) ([]postmodel.Post, string, error) {
+	return s.list(true), "", nil
+}
+
+func (s *memoryStore) GetAllActivePosts(ctx context.Context) ([]postmodel.Post, error) {
+	return s.list(false), nil
+}
+
+// list returns the posts in or out of the trash, in a stable order so
+// listings keep their ETag.
+func (s *memoryStore) list(deleted bool) []postmodel.Post {
+	posts := []postmodel.Post{}
+	for _, id := range slices.Sorted(maps.Keys(s.posts)) {
+		if s.posts[id].IsDeleted() == deleted {
+			posts = append(posts, s.posts[id])
+		}
+	}
+	return posts
+}
+
+func (s *memoryStore) GetPostById(id string, ctx context.Context) (postmodel.Post, error) {
+	post, ok := s.posts[id]
+	if !ok {
+		return postmodel.Post{}, dynamodb.ErrCodeNotFound{Msg: fmt.Sprintf("no post found with id %s", id)}
+	}
+	return post, nil
+}
+
+func (s *memoryStore) GetAdminUser(username string, ctx context.Context) (usermodel.AdminUser, error) {
+	user, ok := s.users[username]
+	if !ok {
+		return usermodel.AdminUser{}, dynamodb.ErrCodeNotFound{Msg: fmt.Sprintf("no admin user found with username %s", username)}
+	}
+	return user, nil
+}
+
+func (s *memoryStore) UpdateAdminUserMFA(user usermodel.AdminUser, ctx context.Context) error {
+	s.users[user.Username] = user
+	return nil
+}
+
+func (s *memoryStore) RecordTOTPStep(user usermodel.AdminUser, step int64, ctx context.Context) error {
+	user.TOTPLastStep = step
+	s.users[user.Username] = user
+	return nil
+}
+
+func (s *memoryStore) UseRecoveryCode(user usermodel.AdminUser, hash string, ctx context.Context) error {
+	current := s.users[user.Username]
+	i := slices.Index(current.RecoveryCodes, hash)
+	if i == -1 {
+		return dynamodb.ErrCodeConditionFailed{Msg: user.Username}
+	}
+	current.RecoveryCodes = slices.Delete(current.RecoveryCodes, i, i+1)
+	s.users[user.Username] = current
+	return nil
+}
+
+func (s *memoryStore) PutAPIKey(key apikeymodel.APIKey, ctx context.Context) error {
+	s.apiKeys[key.ID] = key
+	return nil
+}
+
+func (s *memoryStore) GetAllAPIKeys(ctx context.Context) ([]apikeymodel.APIKey, error) {
+	return slices.Collect(maps.Values(s.apiKeys)), nil
+}
+
+func (s *memoryStore) RevokeAPIKey(id string, revokedAt int64, ctx context.Context) error {
+	key, ok := s.apiKeys[id]
+	if !ok {
+		return dynamodb.ErrCodeNotFound{Msg: fmt.Sprintf("no api key found with id %s", id)}
+	}
+	key.RevokedAt = revokedAt
+	s.apiKeys[id] = key
+	return nil
+}
+
+func (s *memoryStore) PutAuditEntry(entry auditmodel.AuditEntry, ctx context.Context) error {
+	s.audit = append(s.audit, entry)
+	return nil
+}
+
+func (s *memoryStore) QueryAuditEntries(actor, targetID string, fromMillis, toMillis int64, pageSize int32, startKey map[string]types.AttributeValue, ctx context.Context) ([]auditmodel.AuditEntry, string, error) {
+	return slices.Clone(s.audit), "", nil
+}
+
+// memoryBucket keeps post objects in memory, refusing reads over the limit
+// asked for as S3Service does.
+type memoryBucket struct {
+	s3.Store
+	objects map[string]string
+}
+
+func (b memoryBucket) UploadPostHTML(postID, content string, ctx context.Context) (s3.UploadedObject, error) {
+	return b.upload("posts/"+postID+".html", content), nil
+}
+
+func (b memoryBucket) UploadPostMd(postID, content string, ctx context.Context) (s3.UploadedObject, error) {
+	return b.upload("posts/"+postID+".md", content), nil
+}
+
+func (b memoryBucket) upload(key, content string) s3.UploadedObject {
+	b.objects[key] = content
+	return s3.UploadedObject{Key: key}
+}
+
+func (b memoryBucket) RemoveUpload(object s3.UploadedObject, ctx context.Context) error {
+	delete(b.objects, object.Key)
+	return nil
+}
+
+func (b memoryBucket) GetPostHtmlURL(post postmodel.Post, ctx context.Context) (string, error) {
+	return "https://bucket.example.com/" + post.HtmlS3Key, nil
+}
+
+func (b memoryBucket) GetPostMdURL(post postmodel.Post, ctx context.Context) (string, error) {
+	return "https://bucket.example.com/" + post.MdS3Key, nil
+}
+
+func (b memoryBucket) ReadPostObject(key string, maxBytes int64, ctx context.Context) (string, error) {
+	content, ok := b.objects[key]
+	if !ok {
+		return "", fmt.Errorf("no object %s", key)
+	}
+	if int64(len(content)) > maxBytes {
+		return "", s3.ErrCodeObjectTooLarge{Msg: key}
+	}
+	return content, nil
+}
+
+func (b memoryBucket) DeletePostObjects(postID string, ctx context.Context) error {
+	delete(b.objects, "posts/"+postID+".html")
+	delete(b.objects, "posts/"+postID+".md")
+	return nil
+}
+
+type staticSecrets map[string]string
+
+func (s staticSecrets) GetSecret(ctx context.Context, name string) (string, error) {
+	return s[name], nil
+}
+
+const (
+	oidcClientID = "blog"
+	oidcKeyID    = "test-key"
+)
+
+// oidcProvider serves discovery, JWKS and a token endpoint that signs an ID
+// token for admin@example.com with the nonce of the login it was authorized for.
+type oidcProvider struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+
+	mu     sync.Mutex
+	nonces map[string]string
+}
+
+func newOIDCProvider(t *testing.T) *oidcProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &oidcProvider{t: t, key: key, nonces: map[string]string{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, oidc.ProviderMetadata{
+			Issuer:                p.server.URL,
+			AuthorizationEndpoint: p.server.URL + "/authorize",
+			TokenEndpoint:         p.server.URL + "/token",
+			JWKSURI:               p.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{
+			"keys": []map[string]string{{
+				"kid": oidcKeyID,
+				"kty": "RSA",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("POST /token", p.token)
+
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func (p *oidcProvider) token(w http.ResponseWriter, r *http.Request) {
+	p.mu.Lock()
+	nonce, ok := p.nonces[r.PostFormValue("code")]
+	p.mu.Unlock()
+	if !ok {
+		w.WriteHeader(http.StatusBadRequest)
+		writeJSON(w, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	token := gojwt.NewWithClaims(gojwt.SigningMethodRS256, gojwt.MapClaims{
+		"iss":            p.server.URL,
+		"sub":            "user-1",
+		"aud":            oidcClientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"nonce":          nonce,
+		"email":          "admin@example.com",
+		"email_verified": true,
+	})
+	token.Header["kid"] = oidcKeyID
+	signed, err := token.SignedString(p.key)
+	if err != nil {
+		p.t.Error(err)
+	}
+
+	writeJSON(w, oidc.TokenResponse{AccessToken: "access", IDToken: signed, TokenType: "Bearer", ExpiresIn: 300})
+}
+
+// authorize stands in for the browser's trip through the authorization
+// endpoint, returning the code and state it would be sent back with.
+func (p *oidcProvider) authorize(authURL string) (string, string) {
+	p.t.Helper()
+
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	state := parsed.Query().Get("state")
+
+	p.mu.Lock()
+	p.nonces["code-"+state] = parsed.Query().Get("nonce")
+	p.mu.Unlock()
+	return "code-" + state, state
+}
+
+func writeJSON(w http.ResponseWriter, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
+
+// totpCode is the RFC 6238 code for secret at t, which the totp package
+// does not export.
+func totpCode(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(at.Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(sum[offset:offset+4])&0x7fffffff)%1000000)
+}
+
+// tarball is a tar of Markdown files as content sync reads them.
+func tarball(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	writer := tar.NewWriter(&buf)
+	for _, name := range slices.Sorted(maps.Keys(files)) {
+		if err := writer.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(files[name]))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := writer.Write([]byte(files[name])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+const (
+	password   = "correct horse battery staple"
+	totpSecret = "JBSWY3DPEHPK3PXP"
+)
+
+// Over the largest raw body a Lambda response may carry
+var largeContent = strings.Repeat("a", 5*1024*1024+1)
+
+// Authorizer contexts for the callers requests are sent as
+var (
+	asAdmin        = map[string]any{"sub": "admin", "role": "admin"}
+	asMFAAdmin     = map[string]any{"sub": "mfa-admin", "role": "admin"}
+	asPendingAdmin = map[string]any{"sub": "pending-admin", "role": "admin"}
+	asWriter       = map[string]any{"sub": "key-1", "scopes": apikeymodel.ScopePostsWrite}
+)
+
+type server struct {
+	services models.HandlerServices
+	provider *oidcProvider
+}
+
+// newServer seeds an active post, a trashed one and one too large to
+// return from a Lambda, an admin without MFA, one with TOTP and one part way
+// through enrolling, and an API key.
+func newServer(provider *oidcProvider, passwordHash string) *server {
+	bucket := memoryBucket{objects: map[string]string{
+		"posts/post-1.html": "<p>Hello</p>\n",
+		"posts/post-1.md":   "Hello\n",
+		"posts/post-2.html": "<p>Gone</p>\n",
+		"posts/post-2.md":   "Gone\n",
+		"posts/post-3.html": largeContent,
+		"posts/post-3.md":   largeContent,
+	}}
+
+	store := &memoryStore{
+		posts:   map[string]postmodel.Post{},
+		users:   map[string]usermodel.AdminUser{},
+		apiKeys: map[string]apikeymodel.APIKey{},
+	}
+	for i, title := range []string{"Hello", "Gone", "Long"} {
+		id := fmt.Sprintf("post-%d", i+1)
+		post := postmodel.Post{
+			ID:         id,
+			Title:      title,
+			Summary:    "A post",
+			Tags:       []string{"go"},
+			HtmlS3Key:  "posts/" + id + ".html",
+			MdS3Key:    "posts/" + id + ".md",
+			CreatedAt:  int64(1000 * (i + 1)),
+			ModifiedAt: int64(1000 * (i + 1)),
+			Version:    1,
+		}
+		if title == "Gone" {
+			post.DeletedAt, post.Version = 5000, 2
+		}
+		store.posts[id] = post
+	}
+
+	store.users["admin"] = usermodel.AdminUser{Username: "admin", Role: "admin", HashedPW: passwordHash}
+	store.users["mfa-admin"] = usermodel.AdminUser{
+		Username:      "mfa-admin",
+		Role:          "admin",
+		HashedPW:      passwordHash,
+		TOTPSecret:    totpSecret,
+		TOTPEnabled:   true,
+		RecoveryCodes: []string{totp.HashRecoveryCode("aaaa-bbbb")},
+	}
+	store.users["pending-admin"] = usermodel.AdminUser{Username: "pending-admin", Role: "admin", HashedPW: passwordHash, TOTPSecret: totpSecret}
+
+	store.apiKeys["key-1"] = apikeymodel.APIKey{ID: "key-1", Name: "CI", Scopes: []string{apikeymodel.ScopePostsWrite}, CreatedBy: "admin", CreatedAt: 1000}
+
+	return &server{
+		services: models.HandlerServices{
+			Config: &config.Config{
+				DefaultPageSize:       20,
+				CacheMaxAge:           time.Minute,
+				InlineContentMaxBytes: 1024,
+				OIDC:                  config.OIDCConfig{AdminEmails: []string{"admin@example.com"}},
+			},
+			S3Service:       bucket,
+			DynamoDBService: store,
+			OIDCClient:      oidc.New(oidc.Config{IssuerURL: provider.server.URL, ClientID: oidcClientID, RedirectURI: "https://blog.example.com/callback"}, provider.server.Client()),
+			JWT:             jwt.NewSigner(staticSecrets{secrets.JWTSecret: "test-secret"}),
+			Logger:          slog.New(slog.NewTextHandler(io.Discard, nil)),
+		},
+		provider: provider,
+	}
+}
+
+// ifNoneMatch sends back the ETag the route first responds to the request with.
+func ifNoneMatch(t *testing.T, s *server, route Route, request *events.APIGatewayProxyRequest) {
+	response, err := route.Bind(s.services)(context.Background(), *request)
+	if err != nil || response.Headers["ETag"] == "" {
+		t.Fatalf("first request = %d with ETag %q, %v", response.StatusCode, response.Headers["ETag"], err)
+	}
+	request.Headers["If-None-Match"] = response.Headers["ETag"]
+}
+
+// TestHandlersMatchDocs sends each route requests covering every status it
+// documents, plus its common failures. Successful responses must be
+// documented in Doc.Responses with the body type given there, and failures
+// must be problem documents, which every operation documents as its default.
+func TestHandlersMatchDocs(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := newOIDCProvider(t)
+
+	tests := []struct {
+		name   string
+		route  Route
+		caller map[string]any
+		params map[string]string
+		query  map[string]string
+		header map[string]string
+		body   string
+		// Finishes the request once the server is seeded, if set
+		prepare    func(t *testing.T, s *server, route Route, request *events.APIGatewayProxyRequest)
+		wantStatus int
+	}{
+		{
+			name:       "create a post",
+			route:      CreatePost,
+			caller:     asWriter,
+			body:       `{"title":"New","summary":"A post","tags":["go"],"content":"# New"}`,
+			wantStatus: 201,
+		},
+		{
+			name:       "create a post with an idempotency key",
+			route:      CreatePost,
+			caller:     asAdmin,
+			header:     map[string]string{"Idempotency-Key": strings.Repeat("k", 256)},
+			body:       `{"title":"New","summary":"A post","tags":["go"],"content":"# New"}`,
+			wantStatus: 400,
+		},
+		{name: "create a post anonymously", route: CreatePost, body: `{}`, wantStatus: 403},
+		{name: "create an invalid post", route: CreatePost, caller: asAdmin, body: `{"title":""}`, wantStatus: 400},
+		{name: "list posts", route: GetAllPosts, wantStatus: 200},
+		{name: "list unchanged posts", route: GetAllPosts, prepare: ifNoneMatch, wantStatus: 304},
+		{name: "list posts from an invalid start key", route: GetAllPosts, query: map[string]string{"startKey": "%"}, wantStatus: 400},
+		{
+			name:       "get a post as JSON",
+			route:      GetPostByID,
+			params:     map[string]string{"post_id": "post-1"},
+			query:      map[string]string{"include": "html,md"},
+			header:     map[string]string{"Accept": "application/json"},
+			wantStatus: 200,
+		},
+		{name: "get a post as HTML", route: GetPostByID, params: map[string]string{"post_id": "post-1"}, header: map[string]string{"Accept": "text/html"}, wantStatus: 200},
+		{name: "get a post as Markdown", route: GetPostByID, params: map[string]string{"post_id": "post-1.md"}, wantStatus: 200},
+		{name: "get an unchanged post", route: GetPostByID, params: map[string]string{"post_id": "post-1"}, prepare: ifNoneMatch, wantStatus: 304},
+		{name: "get unchanged HTML", route: GetPostByID, params: map[string]string{"post_id": "post-1.html"}, prepare: ifNoneMatch, wantStatus: 304},
+		{name: "get a large post's Markdown", route: GetPostByID, params: map[string]string{"post_id": "post-3.md"}, wantStatus: 303},
+		{name: "get a post in an unsupported format", route: GetPostByID, params: map[string]string{"post_id": "post-1"}, header: map[string]string{"Accept": "image/png"}, wantStatus: 406},
+		{name: "get a post in the trash", route: GetPostByID, params: map[string]string{"post_id": "post-2"}, wantStatus: 404},
+		{
+			name:       "update a post",
+			route:      UpdatePost,
+			caller:     asWriter,
+			params:     map[string]string{"post_id": "post-1"},
+			header:     map[string]string{"If-Match": `"1"`},
+			body:       `{"title":"Hello again","content":"Hello again"}`,
+			wantStatus: 200,
+		},
+		{name: "update a post without a version", route: UpdatePost, caller: asAdmin, params: map[string]string{"post_id": "post-1"}, body: `{"title":"Hello again"}`, wantStatus: 428},
+		{name: "update a stale post", route: UpdatePost, caller: asAdmin, params: map[string]string{"post_id": "post-1"}, body: `{"title":"Hello again","expectedVersion":0}`, wantStatus: 412},
+		{name: "update a post in the trash", route: UpdatePost, caller: asAdmin, params: map[string]string{"post_id": "post-2"}, body: `{"expectedVersion":2}`, wantStatus: 404},
+		{name: "trash a post", route: DeletePost, caller: asAdmin, params: map[string]string{"post_id": "post-1"}, wantStatus: 204},
+		{name: "trash a post without posts:delete", route: DeletePost, caller: asWriter, params: map[string]string{"post_id": "post-1"}, wantStatus: 403},
+		{name: "trash a post twice", route: DeletePost, caller: asAdmin, params: map[string]string{"post_id": "post-2"}, wantStatus: 404},
+		{name: "list the trash", route: GetDeletedPosts, caller: asAdmin, wantStatus: 200},
+		{name: "list the trash with an API key", route: GetDeletedPosts, caller: asWriter, wantStatus: 403},
+		{name: "restore a post", route: RestorePost, caller: asAdmin, params: map[string]string{"post_id": "post-2"}, wantStatus: 200},
+		{name: "restore a post not in the trash", route: RestorePost, caller: asAdmin, params: map[string]string{"post_id": "post-1"}, wantStatus: 409},
+		{name: "purge a post", route: PurgePost, caller: asAdmin, params: map[string]string{"post_id": "post-2"}, wantStatus: 204},
+		{name: "purge a post not in the trash", route: PurgePost, caller: asAdmin, params: map[string]string{"post_id": "post-1"}, wantStatus: 409},
+		{
+			name:   "plan a sync",
+			route:  SyncPosts,
+			caller: asAdmin,
+			prepare: func(t *testing.T, s *server, route Route, request *events.APIGatewayProxyRequest) {
+				request.Body = tarball(t, map[string]string{
+					"hello.md": "---\nid: post-1\ntitle: Hello\nsummary: A post\ntags: [go]\n---\nHello again\n",
+					"new.md":   "---\ntitle: New\nsummary: A post\ntags: [go]\n---\nNew\n",
+				})
+			},
+			wantStatus: 200,
+		},
+		{name: "sync without a tree", route: SyncPosts, caller: asAdmin, wantStatus: 400},
+		{name: "sync from something other than a tar", route: SyncPosts, caller: asAdmin, body: "posts", wantStatus: 400},
+		{name: "log in", route: LogInAdmin, body: `{"username":"admin","password":"` + password + `"}`, wantStatus: 200},
+		{name: "log in with MFA", route: LogInAdmin, body: `{"username":"mfa-admin","password":"` + password + `"}`, wantStatus: 200},
+		{name: "log in with the wrong password", route: LogInAdmin, body: `{"username":"admin","password":"hunter2"}`, wantStatus: 401},
+		{
+			name:  "complete a login with a recovery code",
+			route: CompleteMFALogin,
+			prepare: func(t *testing.T, s *server, route Route, request *events.APIGatewayProxyRequest) {
+				challenge, err := s.services.JWT.GenerateMFAChallengeJWT("mfa-admin", context.Background())
+				if err != nil {
+					t.Fatal(err)
+				}
+				request.Body = `{"challenge_token":"` + challenge + `","recovery_code":"aaaa-bbbb"}`
+			},
+			wantStatus: 200,
+		},
+		{name: "complete a login without a challenge", route: CompleteMFALogin, body: `{"challenge_token":"forged","code":"123456"}`, wantStatus: 401},
+		{name: "enroll in TOTP", route: EnrollTOTP, caller: asAdmin, wantStatus: 200},
+		{name: "enroll in TOTP twice", route: EnrollTOTP, caller: asMFAAdmin, wantStatus: 409},
+		{
+			name:   "confirm TOTP enrollment",
+			route:  VerifyTOTP,
+			caller: asPendingAdmin,
+			prepare: func(t *testing.T, s *server, route Route, request *events.APIGatewayProxyRequest) {
+				request.Body = `{"code":"` + totpCode(t, totpSecret, time.Now()) + `"}`
+			},
+			wantStatus: 200,
+		},
+		{name: "confirm TOTP without enrolling", route: VerifyTOTP, caller: asAdmin, body: `{"code":"123456"}`, wantStatus: 400},
+		{name: "create an API key", route: CreateAPIKey, caller: asAdmin, body: `{"name":"Deploys","scopes":["posts:write"]}`, wantStatus: 201},
+		{name: "create an API key with an unknown scope", route: CreateAPIKey, caller: asAdmin, body: `{"name":"Deploys","scopes":["everything"]}`, wantStatus: 400},
+		{name: "list API keys", route: GetAllAPIKeys, caller: asAdmin, wantStatus: 200},
+		{name: "revoke an API key", route: RevokeAPIKey, caller: asAdmin, params: map[string]string{"key_id": "key-1"}, wantStatus: 204},
+		{name: "revoke an unknown API key", route: RevokeAPIKey, caller: asAdmin, params: map[string]string{"key_id": "key-2"}, wantStatus: 404},
+		{name: "begin an OIDC login", route: BeginOIDCLogin, wantStatus: 200},
+		{
+			name:  "complete an OIDC login",
+			route: CompleteOIDCLogin,
+			prepare: func(t *testing.T, s *server, route Route, request *events.APIGatewayProxyRequest) {
+				authorization, err := loginservice.BeginOIDCLogin(s.services, context.Background())
+				if err != nil {
+					t.Fatal(err)
+				}
+				code, state := s.provider.authorize(authorization.AuthorizationURL)
+				body, err := json.Marshal(models.OIDCCallbackInput{Code: code, State: state, StateToken: authorization.StateToken})
+				if err != nil {
+					t.Fatal(err)
+				}
+				request.Body = string(body)
+			},
+			wantStatus: 200,
+		},
+		{name: "complete an OIDC login without a state token", route: CompleteOIDCLogin, body: `{"code":"code","state":"state","state_token":"forged"}`, wantStatus: 401},
+		{name: "get the OpenAPI document", route: GetOpenAPIDocument, wantStatus: 200},
+		{name: "get an unchanged OpenAPI document", route: GetOpenAPIDocument, prepare: ifNoneMatch, wantStatus: 304},
+		{name: "list audit entries", route: GetAuditEntries, caller: asAdmin, wantStatus: 200},
+		{name: "list audit entries from an invalid time", route: GetAuditEntries, caller: asAdmin, query: map[string]string{"from": "yesterday"}, wantStatus: 400},
+	}
+
+	produced := map[string]map[int]bool{}
+	ran := 0
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ran++
+			s := newServer(provider, string(hash))
+
+			request := events.APIGatewayProxyRequest{
+				HTTPMethod:            tt.route.Method,
+				Path:                  tt.route.Path,
+				PathParameters:        tt.params,
+				QueryStringParameters: tt.query,
+				Headers:               map[string]string{},
+				Body:                  tt.body,
+			}
+			maps.Copy(request.Headers, tt.header)
+			if tt.caller != nil {
+				request.RequestContext.Authorizer = map[string]any{"lambda": tt.caller}
+			}
+			if tt.prepare != nil {
+				tt.prepare(t, s, tt.route, &request)
+			}
+
+			response, err := tt.route.Bind(s.services)(context.Background(), request)
+			if err != nil {
+				t.Fatalf("handler error = %v", err)
+			}
+			if response.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", response.StatusCode, tt.wantStatus, response.Body)
+			}
+
+			operation := tt.route.Operation()
+			if produced[operation.ID] == nil {
+				produced[operation.ID] = map[int]bool{}
+			}
+			produced[operation.ID][response.StatusCode] = true
+
+			checkResponse(t, tt.route.Doc.Responses, tt.route.Doc.MediaTypes, response)
+			if response.StatusCode < 300 {
+				checkInput(t, tt.route, request)
+			}
+		})
+	}
+
+	// Only meaningful when no case was filtered out
+	if ran < len(tests) {
+		return
+	}
+	for _, route := range All() {
+		operation := route.Operation()
+		for status := range route.Doc.Responses {
+			if !produced[operation.ID][status] {
+				t.Errorf("%s documents %d, which no case produced", operation.ID, status)
+			}
+		}
+	}
+}
+
+// checkResponse checks response against the statuses, body types and media
+// types a route documents.
+func checkResponse(t *testing.T, responses map[int]any, mediaTypes []string, response events.APIGatewayProxyResponse) {
+	t.Helper()
+
+	mediaType, _, _ := mime.ParseMediaType(response.Headers["Content-Type"])
+
+	if response.StatusCode >= 400 {
+		var problem struct {
+			Status int `json:"status"`
+		}
+		if mediaType != "application/problem+json" || json.Unmarshal([]byte(response.Body), &problem) != nil || problem.Status != response.StatusCode {
+			t.Errorf("%d is not a problem document: %s %s", response.StatusCode, mediaType, response.Body)
+		}
+		return
+	}
+
+	documented, ok := responses[response.StatusCode]
+	if !ok {
+		t.Fatalf("responded with %d, which Doc.Responses leaves out", response.StatusCode)
+	}
+
+	switch {
+	case response.Body == "":
+	case documented != nil && mediaType == "application/json":
+		decoder := json.NewDecoder(strings.NewReader(response.Body))
+		decoder.DisallowUnknownFields()
+		envelope := struct {
+			Data any `json:"data"`
+		}{Data: reflect.New(reflect.TypeOf(documented)).Interface()}
+		if err := decoder.Decode(&envelope); err != nil {
+			t.Errorf("%d body is not the documented %T: %v", response.StatusCode, documented, err)
+		}
+	case response.StatusCode == 200 && slices.Contains(mediaTypes, mediaType):
+	default:
+		t.Errorf("%d has an undocumented %s body", response.StatusCode, mediaType)
+	}
+}
+
+// checkInput checks that a JSON body the route accepted is the documented
+// Doc.Input. Routes with RequestMediaTypes take other bodies.
+func checkInput(t *testing.T, route Route, request events.APIGatewayProxyRequest) {
+	t.Helper()
+
+	if request.Body == "" || len(route.Doc.RequestMediaTypes) > 0 {
+		return
+	}
+	if route.Doc.Input == nil {
+		t.Errorf("accepted a body, but Doc.Input is nil")
+		return
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(request.Body))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(reflect.New(reflect.TypeOf(route.Doc.Input)).Interface()); err != nil {
+		t.Errorf("accepted a body that is not the documented %T: %v", route.Doc.Input, err)
+	}
+}
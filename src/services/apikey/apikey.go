@@ -0,0 +1,133 @@
+package apikeyservice
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/JaxonAdams/blog-backend/src/helpers"
+	"github.com/JaxonAdams/blog-backend/src/models"
+	apikeymodel "github.com/JaxonAdams/blog-backend/src/models/apikeys"
+	"github.com/JaxonAdams/blog-backend/src/services/apperror"
+	"github.com/JaxonAdams/blog-backend/src/services/aws/dynamodb"
+)
+
+const keyPrefix = "blog"
+
+func CreateAPIKey(input models.CreateAPIKeyInput, createdBy string, services models.HandlerServices, ctx context.Context) (apikeymodel.APIKey, string, error) {
+	for _, scope := range input.Scopes {
+		if !apikeymodel.IsValidScope(scope) {
+			return apikeymodel.APIKey{}, "", ErrCodeInvalidRequest{Msg: fmt.Sprintf("unknown scope %s", scope)}
+		}
+	}
+
+	now := time.Now().UnixMilli()
+	if input.ExpiresAt != 0 && input.ExpiresAt <= now {
+		return apikeymodel.APIKey{}, "", ErrCodeInvalidRequest{Msg: "expires_at must be in the future"}
+	}
+
+	// Generate the secret; only its hash is ever stored
+	secretBytes := make([]byte, 32)
+	if _, err := rand.Read(secretBytes); err != nil {
+		return apikeymodel.APIKey{}, "", err
+	}
+	secret := hex.EncodeToString(secretBytes)
+
+	key := apikeymodel.APIKey{
+		ID:        helpers.NewID(),
+		Name:      input.Name,
+		KeyHash:   hashSecret(secret),
+		Scopes:    input.Scopes,
+		CreatedBy: createdBy,
+		CreatedAt: now,
+		ExpiresAt: input.ExpiresAt,
+	}
+
+	err := services.DynamoDBService.PutAPIKey(key, ctx)
+	if err != nil {
+		return apikeymodel.APIKey{}, "", err
+	}
+
+	return key, fmt.Sprintf("%s_%s_%s", keyPrefix, key.ID, secret), nil
+}
+
+func GetAllAPIKeys(services models.HandlerServices, ctx context.Context) ([]apikeymodel.APIKey, error) {
+	return services.DynamoDBService.GetAllAPIKeys(ctx)
+}
+
+func RevokeAPIKey(id string, services models.HandlerServices, ctx context.Context) error {
+	return services.DynamoDBService.RevokeAPIKey(id, time.Now().UnixMilli(), ctx)
+}
+
+func Authenticate(rawKey string, services models.HandlerServices, ctx context.Context) (apikeymodel.APIKey, error) {
+	parts := strings.SplitN(rawKey, "_", 3)
+	if len(parts) != 3 || parts[0] != keyPrefix || parts[1] == "" || parts[2] == "" {
+		return apikeymodel.APIKey{}, ErrCodeUnauthorized{Msg: "malformed api key"}
+	}
+
+	key, err := services.DynamoDBService.GetAPIKeyByID(parts[1], ctx)
+	if err != nil {
+		var notFoundErr dynamodb.ErrCodeNotFound
+		if errors.As(err, &notFoundErr) {
+			return apikeymodel.APIKey{}, ErrCodeUnauthorized{Msg: "unknown api key"}
+		}
+		return apikeymodel.APIKey{}, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(key.KeyHash), []byte(hashSecret(parts[2]))) != 1 {
+		return apikeymodel.APIKey{}, ErrCodeUnauthorized{Msg: "invalid api key"}
+	}
+
+	now := time.Now().UnixMilli()
+
+	if key.RevokedAt != 0 {
+		return apikeymodel.APIKey{}, ErrCodeUnauthorized{Msg: "api key has been revoked"}
+	}
+
+	if key.ExpiresAt != 0 && key.ExpiresAt <= now {
+		return apikeymodel.APIKey{}, ErrCodeUnauthorized{Msg: "api key has expired"}
+	}
+
+	err = services.DynamoDBService.TouchAPIKey(key.ID, now, ctx)
+	if err != nil {
+		return apikeymodel.APIKey{}, err
+	}
+	key.LastUsedAt = now
+
+	return key, nil
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+type ErrCodeInvalidRequest struct {
+	Msg string
+}
+
+func (e ErrCodeInvalidRequest) Error() string {
+	return e.Msg
+}
+
+func (e ErrCodeInvalidRequest) ErrorCode() apperror.Code {
+	return apperror.CodeInvalidRequest
+}
+
+type ErrCodeUnauthorized struct {
+	Msg string
+}
+
+func (e ErrCodeUnauthorized) Error() string {
+	return e.Msg
+}
+
+func (e ErrCodeUnauthorized) ErrorCode() apperror.Code {
+	return apperror.CodeUnauthorized
+}
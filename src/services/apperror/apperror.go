@@ -0,0 +1,132 @@
+package apperror
+
+import "errors"
+
+// TypeBaseURI prefixes every problem type, giving clients a stable URI to
+// match on that also documents the error.
+const TypeBaseURI = "https://github.com/JaxonAdams/blog-backend/blob/main/docs/problems.md#"
+
+type Code string
+
+const (
+	CodeInvalidRequest       Code = "invalid-request"
+	CodeValidationFailed     Code = "validation-failed"
+	CodeUnauthorized         Code = "unauthorized"
+	CodeForbidden            Code = "forbidden"
+	CodeNotFound             Code = "not-found"
+	CodeMethodNotAllowed     Code = "method-not-allowed"
+	CodeNotAcceptable        Code = "not-acceptable"
+	CodeConflict             Code = "conflict"
+	CodeRequestInProgress    Code = "request-in-progress"
+	CodeVersionConflict      Code = "version-conflict"
+	CodePayloadTooLarge      Code = "payload-too-large"
+	CodeIdempotencyKeyReused Code = "idempotency-key-reused"
+	CodePreconditionRequired Code = "precondition-required"
+	CodeInternal             Code = "internal"
+)
+
+var definitions = map[Code]struct {
+	status int
+	title  string
+}{
+	CodeInvalidRequest:       {400, "Invalid request"},
+	CodeValidationFailed:     {400, "Validation failed"},
+	CodeUnauthorized:         {401, "Unauthorized"},
+	CodeForbidden:            {403, "Forbidden"},
+	CodeNotFound:             {404, "Not found"},
+	CodeMethodNotAllowed:     {405, "Method not allowed"},
+	CodeNotAcceptable:        {406, "Not acceptable"},
+	CodeConflict:             {409, "Conflict"},
+	CodeRequestInProgress:    {409, "Request in progress"},
+	CodeVersionConflict:      {412, "Version conflict"},
+	CodePayloadTooLarge:      {413, "Payload too large"},
+	CodeIdempotencyKeyReused: {422, "Idempotency key reused"},
+	CodePreconditionRequired: {428, "Precondition required"},
+	CodeInternal:             {500, "Internal server error"},
+}
+
+func (c Code) Status() int {
+	if def, ok := definitions[c]; ok {
+		return def.status
+	}
+	return definitions[CodeInternal].status
+}
+
+func (c Code) Title() string {
+	if def, ok := definitions[c]; ok {
+		return def.title
+	}
+	return definitions[CodeInternal].title
+}
+
+func (c Code) TypeURI() string {
+	return TypeBaseURI + string(c)
+}
+
+// Coded is implemented by every error that maps to a client-facing status.
+// Anything else is treated as internal.
+type Coded interface {
+	error
+	ErrorCode() Code
+}
+
+// Extended errors add members to the problem document, e.g. the current
+// version on a conflict.
+type Extended interface {
+	ProblemExtensions() map[string]any
+}
+
+// Headed errors set response headers alongside the problem document, e.g. the
+// current ETag on a conflict.
+type Headed interface {
+	ProblemHeaders() map[string]string
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is a coded error for failures with no domain-specific type.
+type Error struct {
+	Code   Code
+	Msg    string
+	Fields []FieldError
+}
+
+func (e Error) Error() string {
+	return e.Msg
+}
+
+func (e Error) ErrorCode() Code {
+	return e.Code
+}
+
+func New(code Code, msg string) Error {
+	return Error{Code: code, Msg: msg}
+}
+
+func Validation(fields ...FieldError) Error {
+	return Error{Code: CodeValidationFailed, Msg: "one or more fields are invalid", Fields: fields}
+}
+
+// CodeOf returns the code of the first coded error in err's chain.
+func CodeOf(err error) Code {
+	var coded Coded
+	if errors.As(err, &coded) {
+		return coded.ErrorCode()
+	}
+	return CodeInternal
+}
+
+// FieldsOf returns the field errors carried anywhere in err's chain.
+func FieldsOf(err error) []FieldError {
+	var appErr Error
+	if errors.As(err, &appErr) {
+		return appErr.Fields
+	}
+	return nil
+}
+
+// ErrForbidden is returned when the caller lacks the role or scope an action needs.
+var ErrForbidden = New(CodeForbidden, "you do not have permission to perform this action")
@@ -0,0 +1,112 @@
+package auditservice
+
+import (
+	"context"
+	"time"
+
+	"github.com/JaxonAdams/blog-backend/src/helpers"
+	"github.com/JaxonAdams/blog-backend/src/models"
+	auditmodel "github.com/JaxonAdams/blog-backend/src/models/audit"
+	postmodel "github.com/JaxonAdams/blog-backend/src/models/posts"
+	"github.com/JaxonAdams/blog-backend/src/services/apperror"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+func NewEntry(request events.APIGatewayProxyRequest, action, targetID string) auditmodel.AuditEntry {
+	actor, ok := helpers.GetRequestSubject(request)
+	if !ok {
+		actor = auditmodel.UnauthenticatedUser
+	}
+
+	id := helpers.NewID()
+	timestamp := time.Now().UnixMilli()
+
+	return auditmodel.AuditEntry{
+		ID:        id,
+		Actor:     actor,
+		Action:    action,
+		TargetID:  targetID,
+		SourceIP:  request.RequestContext.Identity.SourceIP,
+		RequestID: request.RequestContext.RequestID,
+		Timestamp: timestamp,
+		SortKey:   auditmodel.MakeSortKey(timestamp, id),
+	}
+}
+
+func NewSystemEntry(actor, action, targetID, requestID string) auditmodel.AuditEntry {
+	id := helpers.NewID()
+	timestamp := time.Now().UnixMilli()
+
+	return auditmodel.AuditEntry{
+		ID:        id,
+		Actor:     actor,
+		Action:    action,
+		TargetID:  targetID,
+		RequestID: requestID,
+		Timestamp: timestamp,
+		SortKey:   auditmodel.MakeSortKey(timestamp, id),
+	}
+}
+
+// Record stores an audit entry. A failure to record is logged rather than
+// returned, so that it never undoes an action that has already completed.
+func Record(entry auditmodel.AuditEntry, services models.HandlerServices, ctx context.Context) {
+	if entry.Actor == "" {
+		entry.Actor = auditmodel.UnauthenticatedUser
+	}
+
+	err := services.DynamoDBService.PutAuditEntry(entry, ctx)
+	if err != nil {
+		services.Logger.Error("Failed to record audit entry", "action", entry.Action, "target_id", entry.TargetID, "error", err)
+	}
+}
+
+func GetAuditEntries(input models.GetAuditEntriesInput, services models.HandlerServices, ctx context.Context) ([]auditmodel.AuditEntry, models.PageMetadata, error) {
+	if input.To == 0 {
+		input.To = time.Now().UnixMilli()
+	}
+
+	if input.From > input.To {
+		return []auditmodel.AuditEntry{}, models.PageMetadata{}, ErrCodeInvalidRequest{Msg: "from must not be after to"}
+	}
+
+	entries, nextStartKey, err := services.DynamoDBService.QueryAuditEntries(
+		input.Actor,
+		input.TargetID,
+		input.From,
+		input.To,
+		int32(input.PageSize),
+		input.StartKey,
+		ctx,
+	)
+	if err != nil {
+		return []auditmodel.AuditEntry{}, models.PageMetadata{}, err
+	}
+
+	return entries, models.PageMetadata{NextStartKey: nextStartKey}, nil
+}
+
+func PostMetadata(post postmodel.Post) map[string]any {
+	return map[string]any{
+		"id":          post.ID,
+		"title":       post.Title,
+		"summary":     post.Summary,
+		"tags":        post.Tags,
+		"html_s3_key": post.HtmlS3Key,
+		"md_s3_key":   post.MdS3Key,
+		"created_at":  post.CreatedAt,
+		"modified_at": post.ModifiedAt,
+	}
+}
+
+type ErrCodeInvalidRequest struct {
+	Msg string
+}
+
+func (e ErrCodeInvalidRequest) Error() string {
+	return e.Msg
+}
+
+func (e ErrCodeInvalidRequest) ErrorCode() apperror.Code {
+	return apperror.CodeInvalidRequest
+}
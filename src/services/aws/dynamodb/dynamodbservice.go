@@ -6,12 +6,19 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
+	apikeymodel "github.com/JaxonAdams/blog-backend/src/models/apikeys"
+	auditmodel "github.com/JaxonAdams/blog-backend/src/models/audit"
+	idempotencymodel "github.com/JaxonAdams/blog-backend/src/models/idempotency"
 	postmodel "github.com/JaxonAdams/blog-backend/src/models/posts"
 	usermodel "github.com/JaxonAdams/blog-backend/src/models/users"
+	"github.com/JaxonAdams/blog-backend/src/services/apperror"
+	appconfig "github.com/JaxonAdams/blog-backend/src/services/config"
+	"github.com/JaxonAdams/blog-backend/src/services/logging"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
@@ -19,79 +26,240 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
 )
 
+// Store is what handlers use of the tables. DynamoDBService implements it;
+// tests can serve the API from memory instead.
+type Store interface {
+	UpsertPost(post postmodel.Post, ctx context.Context) error
+	UpsertPostIfVersion(post postmodel.Post, expectedVersion int64, ctx context.Context) error
+	InsertPost(post postmodel.Post, ctx context.Context) error
+	DeleteTrashedPost(post postmodel.Post, ctx context.Context) error
+	GetAllPosts(pageSize int32, startKey map[string]types.AttributeValue, ctx context.Context) ([]postmodel.Post, string, error)
+	GetDeletedPosts(pageSize int32, startKey map[string]types.AttributeValue, ctx context.Context) ([]postmodel.Post, string, error)
+	GetPostsDeletedBefore(cutoff int64, ctx context.Context) ([]postmodel.Post, error)
+	GetAllActivePosts(ctx context.Context) ([]postmodel.Post, error)
+	GetEveryPost(ctx context.Context) ([]postmodel.Post, error)
+	GetPostById(id string, ctx context.Context) (postmodel.Post, error)
+
+	GetAdminUser(username string, ctx context.Context) (usermodel.AdminUser, error)
+	GetAllAdminUsers(ctx context.Context) ([]usermodel.AdminUser, error)
+	InsertAdminUser(user usermodel.AdminUser, ctx context.Context) error
+	RecordTOTPStep(user usermodel.AdminUser, step int64, ctx context.Context) error
+	UpdateAdminUserMFA(user usermodel.AdminUser, ctx context.Context) error
+	UseRecoveryCode(user usermodel.AdminUser, hash string, ctx context.Context) error
+
+	PutAPIKey(key apikeymodel.APIKey, ctx context.Context) error
+	GetAPIKeyByID(id string, ctx context.Context) (apikeymodel.APIKey, error)
+	GetAllAPIKeys(ctx context.Context) ([]apikeymodel.APIKey, error)
+	RevokeAPIKey(id string, revokedAt int64, ctx context.Context) error
+	TouchAPIKey(id string, lastUsedAt int64, ctx context.Context) error
+
+	PutAuditEntry(entry auditmodel.AuditEntry, ctx context.Context) error
+	QueryAuditEntries(actor, targetID string, fromMillis, toMillis int64, pageSize int32, startKey map[string]types.AttributeValue, ctx context.Context) ([]auditmodel.AuditEntry, string, error)
+
+	GetIdempotencyRecord(key string, ctx context.Context) (idempotencymodel.IdempotencyRecord, error)
+	PutIdempotencyRecord(record idempotencymodel.IdempotencyRecord, claim bool, ctx context.Context) error
+	DeleteIdempotencyRecord(key string, ctx context.Context) error
+}
+
 type DynamoDBService struct {
 	client *dynamodb.Client
+	config *appconfig.Config
 }
 
-func New(ctx context.Context) *DynamoDBService {
+func New(ctx context.Context, appConfig *appconfig.Config) *DynamoDBService {
 	cfg, err := config.LoadDefaultConfig(ctx)
 	if err != nil {
-		log.Fatalf("failed to load config: %v", err)
+		// Runs once at cold start; without AWS config the function cannot serve anything
+		logging.New().Error("Failed to load AWS config", "error", err)
+		os.Exit(1)
 	}
 
 	client := dynamodb.NewFromConfig(cfg)
 	return &DynamoDBService{
 		client: client,
+		config: appConfig,
 	}
 }
 
 func (d DynamoDBService) UpsertPost(post postmodel.Post, ctx context.Context) error {
-	table := os.Getenv("POST_METADATA_TABLE_NAME")
+	table := d.config.PostTableName
 	item := post.DynamoFormat()
 
 	return d.putItem(table, item, ctx)
 }
 
-func (d DynamoDBService) DeletePost(postId string, createdAt int, ctx context.Context) error {
-	table := os.Getenv("POST_METADATA_TABLE_NAME")
-	return d.deleteItem(table, postId, createdAt, ctx)
+func (d DynamoDBService) UpsertPostIfVersion(post postmodel.Post, expectedVersion int64, ctx context.Context) error {
+	table := d.config.PostTableName
+
+	// Posts written before versioning was introduced have no version attribute
+	condition := "version = :expected"
+	if expectedVersion == 0 {
+		condition = "attribute_not_exists(version) OR version = :expected"
+	}
+
+	input := &dynamodb.PutItemInput{
+		TableName:           aws.String(table),
+		Item:                post.DynamoFormat(),
+		ConditionExpression: aws.String(condition),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":expected": &types.AttributeValueMemberN{Value: strconv.FormatInt(expectedVersion, 10)},
+		},
+	}
+
+	_, err := d.client.PutItem(ctx, input)
+	if err != nil {
+		var cce *types.ConditionalCheckFailedException
+		if ok := errors.As(err, &cce); ok {
+			return ErrCodeConditionFailed{Msg: fmt.Sprintf("post %s is not at version %d", post.ID, expectedVersion)}
+		}
+		return err
+	}
+
+	return nil
 }
 
-func (d DynamoDBService) GetAllPosts(pageSize int32, startKey map[string]types.AttributeValue, ctx context.Context) ([]postmodel.Post, string, error) {
-	table := os.Getenv("POST_METADATA_TABLE_NAME")
-	input := &dynamodb.ScanInput{
-		TableName:         &table,
-		Limit:             &pageSize,
-		ExclusiveStartKey: startKey,
+// InsertPost writes a post that must not exist yet, returning
+// ErrCodeConditionFailed if it does.
+func (d DynamoDBService) InsertPost(post postmodel.Post, ctx context.Context) error {
+	table := d.config.PostTableName
+
+	input := &dynamodb.PutItemInput{
+		TableName:           aws.String(table),
+		Item:                post.DynamoFormat(),
+		ConditionExpression: aws.String("attribute_not_exists(id)"),
 	}
 
-	result, err := d.client.Scan(ctx, input)
+	_, err := d.client.PutItem(ctx, input)
 	if err != nil {
-		return []postmodel.Post{}, "", err
+		var cce *types.ConditionalCheckFailedException
+		if ok := errors.As(err, &cce); ok {
+			return ErrCodeConditionFailed{Msg: fmt.Sprintf("post %s already exists", post.ID)}
+		}
+		return err
 	}
 
+	return nil
+}
+
+// DeleteTrashedPost deletes a post only while it is still in the trash at
+// the version it was read at, returning ErrCodeConditionFailed otherwise,
+// e.g. if it was restored in between.
+func (d DynamoDBService) DeleteTrashedPost(post postmodel.Post, ctx context.Context) error {
+	condition := "attribute_exists(deletedAt) AND version = :expected"
+	if post.Version == 0 {
+		condition = "attribute_exists(deletedAt) AND (attribute_not_exists(version) OR version = :expected)"
+	}
+
+	input := &dynamodb.DeleteItemInput{
+		TableName: aws.String(d.config.PostTableName),
+		Key: map[string]types.AttributeValue{
+			"id":        &types.AttributeValueMemberS{Value: post.ID},
+			"createdAt": &types.AttributeValueMemberN{Value: strconv.FormatInt(post.CreatedAt, 10)},
+		},
+		ConditionExpression: aws.String(condition),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":expected": &types.AttributeValueMemberN{Value: strconv.FormatInt(post.Version, 10)},
+		},
+	}
+
+	_, err := d.client.DeleteItem(ctx, input)
+	if err != nil {
+		var cce *types.ConditionalCheckFailedException
+		if ok := errors.As(err, &cce); ok {
+			return ErrCodeConditionFailed{Msg: fmt.Sprintf("post %s is no longer in the trash at version %d", post.ID, post.Version)}
+		}
+		return fmt.Errorf("failed to delete post: %w", err)
+	}
+
+	return nil
+}
+
+func (d DynamoDBService) GetAllPosts(pageSize int32, startKey map[string]types.AttributeValue, ctx context.Context) ([]postmodel.Post, string, error) {
+	return d.scanPosts(pageSize, startKey, "attribute_not_exists(deletedAt)", nil, ctx)
+}
+
+func (d DynamoDBService) GetDeletedPosts(pageSize int32, startKey map[string]types.AttributeValue, ctx context.Context) ([]postmodel.Post, string, error) {
+	return d.scanPosts(pageSize, startKey, "attribute_exists(deletedAt)", nil, ctx)
+}
+
+func (d DynamoDBService) GetPostsDeletedBefore(cutoff int64, ctx context.Context) ([]postmodel.Post, error) {
+	values := map[string]types.AttributeValue{
+		":cutoff": &types.AttributeValueMemberN{Value: strconv.FormatInt(cutoff, 10)},
+	}
+
+	return d.scanAllPosts("deletedAt < :cutoff", values, ctx)
+}
+
+// GetAllActivePosts reads every post not in the trash, across all pages.
+func (d DynamoDBService) GetAllActivePosts(ctx context.Context) ([]postmodel.Post, error) {
+	return d.scanAllPosts("attribute_not_exists(deletedAt)", nil, ctx)
+}
+
+// GetEveryPost reads every post, including those in the trash.
+func (d DynamoDBService) GetEveryPost(ctx context.Context) ([]postmodel.Post, error) {
+	return d.scanAllPosts("", nil, ctx)
+}
+
+func (d DynamoDBService) scanAllPosts(filter string, values map[string]types.AttributeValue, ctx context.Context) ([]postmodel.Post, error) {
 	var posts []postmodel.Post
-	err = attributevalue.UnmarshalListOfMaps(result.Items, &posts)
+	var startKey map[string]types.AttributeValue
+	for {
+		page, nextStartKey, err := d.scanPostsPage(0, startKey, filter, values, ctx)
+		if err != nil {
+			return []postmodel.Post{}, err
+		}
+		posts = append(posts, page...)
+
+		if nextStartKey == nil {
+			break
+		}
+		startKey = nextStartKey
+	}
+
+	return posts, nil
+}
+
+func (d DynamoDBService) scanPosts(pageSize int32, startKey map[string]types.AttributeValue, filter string, values map[string]types.AttributeValue, ctx context.Context) ([]postmodel.Post, string, error) {
+	posts, lastKey, err := d.scanPostsPage(pageSize, startKey, filter, values, ctx)
 	if err != nil {
 		return posts, "", err
 	}
 
-	var nextStartKey string
-	if result.LastEvaluatedKey != nil {
-		// Convert raw AttributeValues to an intermediate JSON-safe map
-		jsonFriendlyKey := make(map[string]map[string]string)
-		for k, v := range result.LastEvaluatedKey {
-			switch attr := v.(type) {
-			case *types.AttributeValueMemberS:
-				jsonFriendlyKey[k] = map[string]string{"S": attr.Value}
-			case *types.AttributeValueMemberN:
-				jsonFriendlyKey[k] = map[string]string{"N": attr.Value}
-			default:
-				continue
-			}
-		}
+	return posts, encodeStartKey(lastKey), nil
+}
+
+func (d DynamoDBService) scanPostsPage(pageSize int32, startKey map[string]types.AttributeValue, filter string, values map[string]types.AttributeValue, ctx context.Context) ([]postmodel.Post, map[string]types.AttributeValue, error) {
+	table := d.config.PostTableName
+	input := &dynamodb.ScanInput{
+		TableName:                 &table,
+		ExclusiveStartKey:         startKey,
+		ExpressionAttributeValues: values,
+	}
+
+	if filter != "" {
+		input.FilterExpression = aws.String(filter)
+	}
+
+	if pageSize > 0 {
+		input.Limit = &pageSize
+	}
+
+	result, err := d.client.Scan(ctx, input)
+	if err != nil {
+		return []postmodel.Post{}, nil, err
+	}
 
-		// Encode in JSON, then base64
-		startKeyJson, _ := json.Marshal(jsonFriendlyKey)
-		encodedStartKey := base64.StdEncoding.EncodeToString(startKeyJson)
-		nextStartKey = encodedStartKey
+	var posts []postmodel.Post
+	err = attributevalue.UnmarshalListOfMaps(result.Items, &posts)
+	if err != nil {
+		return posts, nil, err
 	}
 
-	return posts, nextStartKey, nil
+	return posts, result.LastEvaluatedKey, nil
 }
 
 func (d DynamoDBService) GetPostById(id string, ctx context.Context) (postmodel.Post, error) {
-	table := os.Getenv("POST_METADATA_TABLE_NAME")
+	table := d.config.PostTableName
 
 	input := &dynamodb.QueryInput{
 		TableName:              aws.String(table),
@@ -109,7 +277,6 @@ func (d DynamoDBService) GetPostById(id string, ctx context.Context) (postmodel.
 	}
 
 	if len(result.Items) == 0 {
-		fmt.Printf("No posts found with ID %s", id)
 		return postmodel.Post{}, ErrCodeNotFound{Msg: fmt.Sprintf("no post found with id %s", id)}
 	}
 
@@ -123,7 +290,7 @@ func (d DynamoDBService) GetPostById(id string, ctx context.Context) (postmodel.
 }
 
 func (d DynamoDBService) GetAdminUser(username string, ctx context.Context) (usermodel.AdminUser, error) {
-	table := os.Getenv("AUTH_TABLE_NAME")
+	table := d.config.AuthTableName
 
 	input := &dynamodb.QueryInput{
 		TableName:              aws.String(table),
@@ -136,11 +303,10 @@ func (d DynamoDBService) GetAdminUser(username string, ctx context.Context) (use
 
 	result, err := d.client.Query(ctx, input)
 	if err != nil {
-		return usermodel.AdminUser{}, nil
+		return usermodel.AdminUser{}, fmt.Errorf("failed to read user %s: %w", username, err)
 	}
 
 	if len(result.Items) == 0 {
-		fmt.Printf("No users found with username %s", username)
 		return usermodel.AdminUser{}, ErrCodeNotFound{Msg: fmt.Sprintf("no user found with username %s", username)}
 	}
 
@@ -153,44 +319,495 @@ func (d DynamoDBService) GetAdminUser(username string, ctx context.Context) (use
 	return user, nil
 }
 
-func (d DynamoDBService) putItem(tableName string, item map[string]types.AttributeValue, ctx context.Context) error {
+// GetAllAdminUsers reads every admin user, keeping the latest item for each
+// username.
+func (d DynamoDBService) GetAllAdminUsers(ctx context.Context) ([]usermodel.AdminUser, error) {
+	table := d.config.AuthTableName
+
+	latest := map[string]usermodel.AdminUser{}
+	paginator := dynamodb.NewScanPaginator(d.client, &dynamodb.ScanInput{TableName: aws.String(table)})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return []usermodel.AdminUser{}, err
+		}
+
+		var users []usermodel.AdminUser
+		if err := attributevalue.UnmarshalListOfMaps(page.Items, &users); err != nil {
+			return []usermodel.AdminUser{}, err
+		}
+
+		for _, user := range users {
+			if current, ok := latest[user.Username]; !ok || user.ModifiedAt > current.ModifiedAt {
+				latest[user.Username] = user
+			}
+		}
+	}
+
+	users := make([]usermodel.AdminUser, 0, len(latest))
+	for _, user := range latest {
+		users = append(users, user)
+	}
+
+	return users, nil
+}
+
+// InsertAdminUser writes a user without credentials. It fails with
+// ErrCodeConditionFailed if the same item already exists.
+func (d DynamoDBService) InsertAdminUser(user usermodel.AdminUser, ctx context.Context) error {
+	table := d.config.AuthTableName
+
 	input := &dynamodb.PutItemInput{
-		TableName: &tableName,
-		Item:      item,
+		TableName: aws.String(table),
+		Item: map[string]types.AttributeValue{
+			"username":     &types.AttributeValueMemberS{Value: user.Username},
+			"role":         &types.AttributeValueMemberS{Value: user.Role},
+			"totp_enabled": &types.AttributeValueMemberBOOL{Value: false},
+			"createdAt":    &types.AttributeValueMemberN{Value: strconv.FormatInt(user.CreatedAt, 10)},
+			"modifiedAt":   &types.AttributeValueMemberN{Value: strconv.FormatInt(user.ModifiedAt, 10)},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(username)"),
 	}
 
 	_, err := d.client.PutItem(ctx, input)
 	if err != nil {
+		var cce *types.ConditionalCheckFailedException
+		if ok := errors.As(err, &cce); ok {
+			return ErrCodeConditionFailed{Msg: fmt.Sprintf("user %s already exists", user.Username)}
+		}
 		return err
 	}
 
-	log.Println("Post successfully stored in DynamoDB")
 	return nil
 }
 
-func (d DynamoDBService) deleteItem(tableName, itemId string, itemCreatedAt int, ctx context.Context) error {
-	input := &dynamodb.DeleteItemInput{
-		TableName: aws.String(tableName),
+// RecordTOTPStep stores the time step of an accepted TOTP code. It fails
+// with ErrCodeConditionFailed if that step or a later one was already used,
+// so a code cannot be replayed within its window, even concurrently.
+func (d DynamoDBService) RecordTOTPStep(user usermodel.AdminUser, step int64, ctx context.Context) error {
+	table := d.config.AuthTableName
+
+	input := &dynamodb.UpdateItemInput{
+		TableName: aws.String(table),
 		Key: map[string]types.AttributeValue{
-			"id":        &types.AttributeValueMemberS{Value: itemId},
-			"createdAt": &types.AttributeValueMemberN{Value: strconv.Itoa(itemCreatedAt)},
+			"username":   &types.AttributeValueMemberS{Value: user.Username},
+			"modifiedAt": &types.AttributeValueMemberN{Value: strconv.FormatInt(user.ModifiedAt, 10)},
+		},
+		UpdateExpression: aws.String("SET totp_last_step = :step"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":step": &types.AttributeValueMemberN{Value: strconv.FormatInt(step, 10)},
+		},
+		ConditionExpression: aws.String("attribute_exists(username) AND (attribute_not_exists(totp_last_step) OR totp_last_step < :step)"),
+	}
+
+	_, err := d.client.UpdateItem(ctx, input)
+	if err != nil {
+		var cce *types.ConditionalCheckFailedException
+		if ok := errors.As(err, &cce); ok {
+			return ErrCodeConditionFailed{Msg: fmt.Sprintf("totp step %d has already been used by %s", step, user.Username)}
+		}
+		return fmt.Errorf("failed to record totp step: %w", err)
+	}
+
+	return nil
+}
+
+// UseRecoveryCode removes a recovery code's hash, returning
+// ErrCodeConditionFailed if the user does not have it, e.g. because a
+// concurrent login used it first.
+func (d DynamoDBService) UseRecoveryCode(user usermodel.AdminUser, hash string, ctx context.Context) error {
+	table := d.config.AuthTableName
+
+	input := &dynamodb.UpdateItemInput{
+		TableName: aws.String(table),
+		Key: map[string]types.AttributeValue{
+			"username":   &types.AttributeValueMemberS{Value: user.Username},
+			"modifiedAt": &types.AttributeValueMemberN{Value: strconv.FormatInt(user.ModifiedAt, 10)},
+		},
+		UpdateExpression: aws.String("DELETE recovery_codes :codes"),
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":codes": &types.AttributeValueMemberSS{Value: []string{hash}},
+			":code":  &types.AttributeValueMemberS{Value: hash},
+		},
+		ConditionExpression: aws.String("contains(recovery_codes, :code)"),
+	}
+
+	_, err := d.client.UpdateItem(ctx, input)
+	if err != nil {
+		var cce *types.ConditionalCheckFailedException
+		if ok := errors.As(err, &cce); ok {
+			return ErrCodeConditionFailed{Msg: fmt.Sprintf("%s has no such recovery code", user.Username)}
+		}
+		return fmt.Errorf("failed to use recovery code: %w", err)
+	}
+
+	return nil
+}
+
+func (d DynamoDBService) UpdateAdminUserMFA(user usermodel.AdminUser, ctx context.Context) error {
+	table := d.config.AuthTableName
+
+	values := map[string]types.AttributeValue{
+		":enabled": &types.AttributeValueMemberBOOL{Value: user.TOTPEnabled},
+	}
+
+	setExpr := []string{"totp_enabled = :enabled"}
+	removeExpr := []string{}
+
+	if user.TOTPSecret != "" {
+		setExpr = append(setExpr, "totp_secret = :secret")
+		values[":secret"] = &types.AttributeValueMemberS{Value: user.TOTPSecret}
+	} else {
+		removeExpr = append(removeExpr, "totp_secret")
+	}
+
+	if user.TOTPLastStep > 0 {
+		setExpr = append(setExpr, "totp_last_step = :step")
+		values[":step"] = &types.AttributeValueMemberN{Value: strconv.FormatInt(user.TOTPLastStep, 10)}
+	}
+
+	if len(user.RecoveryCodes) > 0 {
+		setExpr = append(setExpr, "recovery_codes = :codes")
+		values[":codes"] = &types.AttributeValueMemberSS{Value: user.RecoveryCodes}
+	} else {
+		removeExpr = append(removeExpr, "recovery_codes")
+	}
+
+	updateExpr := "SET " + strings.Join(setExpr, ", ")
+	if len(removeExpr) > 0 {
+		updateExpr += " REMOVE " + strings.Join(removeExpr, ", ")
+	}
+
+	input := &dynamodb.UpdateItemInput{
+		TableName: aws.String(table),
+		Key: map[string]types.AttributeValue{
+			"username":   &types.AttributeValueMemberS{Value: user.Username},
+			"modifiedAt": &types.AttributeValueMemberN{Value: strconv.FormatInt(user.ModifiedAt, 10)},
+		},
+		UpdateExpression:          aws.String(updateExpr),
+		ExpressionAttributeValues: values,
+		ConditionExpression:       aws.String("attribute_exists(username)"),
+	}
+
+	_, err := d.client.UpdateItem(ctx, input)
+	if err != nil {
+		var cce *types.ConditionalCheckFailedException
+		if ok := errors.As(err, &cce); ok {
+			return ErrCodeNotFound{Msg: fmt.Sprintf("no user found with username %s", user.Username)}
+		}
+		return fmt.Errorf("failed to update user mfa settings: %w", err)
+	}
+
+	return nil
+}
+
+func (d DynamoDBService) PutAPIKey(key apikeymodel.APIKey, ctx context.Context) error {
+	table := d.config.APIKeyTableName
+	return d.putItem(table, key.DynamoFormat(), ctx)
+}
+
+func (d DynamoDBService) GetAPIKeyByID(id string, ctx context.Context) (apikeymodel.APIKey, error) {
+	table := d.config.APIKeyTableName
+
+	input := &dynamodb.GetItemInput{
+		TableName: aws.String(table),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+	}
+
+	result, err := d.client.GetItem(ctx, input)
+	if err != nil {
+		return apikeymodel.APIKey{}, err
+	}
+
+	if result.Item == nil {
+		return apikeymodel.APIKey{}, ErrCodeNotFound{Msg: fmt.Sprintf("no api key found with id %s", id)}
+	}
+
+	var key apikeymodel.APIKey
+	err = attributevalue.UnmarshalMap(result.Item, &key)
+	if err != nil {
+		return apikeymodel.APIKey{}, err
+	}
+
+	return key, nil
+}
+
+func (d DynamoDBService) GetAllAPIKeys(ctx context.Context) ([]apikeymodel.APIKey, error) {
+	table := d.config.APIKeyTableName
+
+	keys := []apikeymodel.APIKey{}
+	paginator := dynamodb.NewScanPaginator(d.client, &dynamodb.ScanInput{
+		TableName: aws.String(table),
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return []apikeymodel.APIKey{}, err
+		}
+
+		var pageKeys []apikeymodel.APIKey
+		err = attributevalue.UnmarshalListOfMaps(page.Items, &pageKeys)
+		if err != nil {
+			return []apikeymodel.APIKey{}, err
+		}
+		keys = append(keys, pageKeys...)
+	}
+
+	return keys, nil
+}
+
+func (d DynamoDBService) RevokeAPIKey(id string, revokedAt int64, ctx context.Context) error {
+	return d.setAPIKeyTimestamp(id, "revokedAt", revokedAt, ctx)
+}
+
+func (d DynamoDBService) TouchAPIKey(id string, lastUsedAt int64, ctx context.Context) error {
+	return d.setAPIKeyTimestamp(id, "lastUsedAt", lastUsedAt, ctx)
+}
+
+func (d DynamoDBService) setAPIKeyTimestamp(id, attribute string, value int64, ctx context.Context) error {
+	table := d.config.APIKeyTableName
+
+	input := &dynamodb.UpdateItemInput{
+		TableName: aws.String(table),
+		Key: map[string]types.AttributeValue{
+			"id": &types.AttributeValueMemberS{Value: id},
+		},
+		UpdateExpression: aws.String("SET #attr = :value"),
+		ExpressionAttributeNames: map[string]string{
+			"#attr": attribute,
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":value": &types.AttributeValueMemberN{Value: strconv.FormatInt(value, 10)},
 		},
 		ConditionExpression: aws.String("attribute_exists(id)"),
 	}
 
-	_, err := d.client.DeleteItem(ctx, input)
+	_, err := d.client.UpdateItem(ctx, input)
 	if err != nil {
 		var cce *types.ConditionalCheckFailedException
 		if ok := errors.As(err, &cce); ok {
-			return ErrCodeNotFound{Msg: fmt.Sprintf("no post found with id %s", itemId)}
+			return ErrCodeNotFound{Msg: fmt.Sprintf("no api key found with id %s", id)}
 		}
-		return fmt.Errorf("failed to delete post: %w", err)
+		return fmt.Errorf("failed to update api key: %w", err)
+	}
+
+	return nil
+}
+
+func (d DynamoDBService) PutAuditEntry(entry auditmodel.AuditEntry, ctx context.Context) error {
+	table := d.config.AuditLogTableName
+
+	item, err := attributevalue.MarshalMap(entry)
+	if err != nil {
+		return err
+	}
+
+	// Entries are append-only, so never overwrite an existing item
+	input := &dynamodb.PutItemInput{
+		TableName:           aws.String(table),
+		Item:                item,
+		ConditionExpression: aws.String("attribute_not_exists(actor)"),
+	}
+
+	_, err = d.client.PutItem(ctx, input)
+	if err != nil {
+		return fmt.Errorf("failed to store audit entry: %w", err)
 	}
 
-	log.Printf("Post with ID %s successfully deleted.", itemId)
 	return nil
 }
 
+func (d DynamoDBService) QueryAuditEntries(actor, targetID string, fromMillis, toMillis int64, pageSize int32, startKey map[string]types.AttributeValue, ctx context.Context) ([]auditmodel.AuditEntry, string, error) {
+	table := d.config.AuditLogTableName
+
+	from := fmt.Sprintf("%013d", fromMillis)
+	to := fmt.Sprintf("%013d~", toMillis)
+
+	var items []map[string]types.AttributeValue
+	var lastKey map[string]types.AttributeValue
+
+	switch {
+	case actor != "" || targetID != "":
+		queryInput := &dynamodb.QueryInput{
+			TableName:              aws.String(table),
+			KeyConditionExpression: aws.String("actor = :pk AND sortKey BETWEEN :from AND :to"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":pk":   &types.AttributeValueMemberS{Value: actor},
+				":from": &types.AttributeValueMemberS{Value: from},
+				":to":   &types.AttributeValueMemberS{Value: to},
+			},
+			ScanIndexForward:  aws.Bool(false),
+			Limit:             &pageSize,
+			ExclusiveStartKey: startKey,
+		}
+
+		if actor == "" {
+			// Without an actor, look the target up through its index instead
+			queryInput.IndexName = aws.String("TargetIndex")
+			queryInput.KeyConditionExpression = aws.String("targetId = :pk AND sortKey BETWEEN :from AND :to")
+			queryInput.ExpressionAttributeValues[":pk"] = &types.AttributeValueMemberS{Value: targetID}
+		} else if targetID != "" {
+			queryInput.FilterExpression = aws.String("targetId = :target")
+			queryInput.ExpressionAttributeValues[":target"] = &types.AttributeValueMemberS{Value: targetID}
+		}
+
+		result, err := d.client.Query(ctx, queryInput)
+		if err != nil {
+			return []auditmodel.AuditEntry{}, "", err
+		}
+		items, lastKey = result.Items, result.LastEvaluatedKey
+	default:
+		scanInput := &dynamodb.ScanInput{
+			TableName:        aws.String(table),
+			FilterExpression: aws.String("sortKey BETWEEN :from AND :to"),
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":from": &types.AttributeValueMemberS{Value: from},
+				":to":   &types.AttributeValueMemberS{Value: to},
+			},
+			Limit:             &pageSize,
+			ExclusiveStartKey: startKey,
+		}
+
+		result, err := d.client.Scan(ctx, scanInput)
+		if err != nil {
+			return []auditmodel.AuditEntry{}, "", err
+		}
+		items, lastKey = result.Items, result.LastEvaluatedKey
+	}
+
+	entries := []auditmodel.AuditEntry{}
+	err := attributevalue.UnmarshalListOfMaps(items, &entries)
+	if err != nil {
+		return []auditmodel.AuditEntry{}, "", err
+	}
+
+	return entries, encodeStartKey(lastKey), nil
+}
+
+func (d DynamoDBService) GetIdempotencyRecord(key string, ctx context.Context) (idempotencymodel.IdempotencyRecord, error) {
+	table := d.config.IdempotencyTableName
+
+	input := &dynamodb.GetItemInput{
+		TableName: aws.String(table),
+		Key: map[string]types.AttributeValue{
+			"key": &types.AttributeValueMemberS{Value: key},
+		},
+		ConsistentRead: aws.Bool(true),
+	}
+
+	result, err := d.client.GetItem(ctx, input)
+	if err != nil {
+		return idempotencymodel.IdempotencyRecord{}, err
+	}
+
+	if result.Item == nil {
+		return idempotencymodel.IdempotencyRecord{}, ErrCodeNotFound{Msg: fmt.Sprintf("no idempotency record found for key %s", key)}
+	}
+
+	var record idempotencymodel.IdempotencyRecord
+	err = attributevalue.UnmarshalMap(result.Item, &record)
+	if err != nil {
+		return idempotencymodel.IdempotencyRecord{}, err
+	}
+
+	return record, nil
+}
+
+// PutIdempotencyRecord stores record. With claim set, it only does so if the
+// key is unused, its record has expired, or it is an in-progress claim on the
+// same request whose lease has run out.
+func (d DynamoDBService) PutIdempotencyRecord(record idempotencymodel.IdempotencyRecord, claim bool, ctx context.Context) error {
+	table := d.config.IdempotencyTableName
+
+	item, err := attributevalue.MarshalMap(record)
+	if err != nil {
+		return err
+	}
+
+	input := &dynamodb.PutItemInput{
+		TableName: aws.String(table),
+		Item:      item,
+	}
+
+	if claim {
+		// Expired records may linger until DynamoDB's TTL sweep removes them
+		now := time.Now()
+		input.ConditionExpression = aws.String("attribute_not_exists(#key) OR expiresAt < :now OR " +
+			"(#status = :inProgress AND requestHash = :requestHash AND leaseExpiresAt < :nowMilli)")
+		input.ExpressionAttributeNames = map[string]string{"#key": "key", "#status": "status"}
+		input.ExpressionAttributeValues = map[string]types.AttributeValue{
+			":now":         &types.AttributeValueMemberN{Value: strconv.FormatInt(now.Unix(), 10)},
+			":nowMilli":    &types.AttributeValueMemberN{Value: strconv.FormatInt(now.UnixMilli(), 10)},
+			":inProgress":  &types.AttributeValueMemberS{Value: idempotencymodel.StatusInProgress},
+			":requestHash": &types.AttributeValueMemberS{Value: record.RequestHash},
+		}
+	}
+
+	_, err = d.client.PutItem(ctx, input)
+	if err != nil {
+		var cce *types.ConditionalCheckFailedException
+		if ok := errors.As(err, &cce); ok {
+			return ErrCodeConditionFailed{Msg: fmt.Sprintf("idempotency record already exists for key %s", record.Key)}
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (d DynamoDBService) DeleteIdempotencyRecord(key string, ctx context.Context) error {
+	table := d.config.IdempotencyTableName
+
+	_, err := d.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName: aws.String(table),
+		Key: map[string]types.AttributeValue{
+			"key": &types.AttributeValueMemberS{Value: key},
+		},
+	})
+
+	return err
+}
+
+func (d DynamoDBService) putItem(tableName string, item map[string]types.AttributeValue, ctx context.Context) error {
+	input := &dynamodb.PutItemInput{
+		TableName: &tableName,
+		Item:      item,
+	}
+
+	_, err := d.client.PutItem(ctx, input)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func encodeStartKey(lastEvaluatedKey map[string]types.AttributeValue) string {
+	if lastEvaluatedKey == nil {
+		return ""
+	}
+
+	// Convert raw AttributeValues to an intermediate JSON-safe map
+	jsonFriendlyKey := make(map[string]map[string]string)
+	for k, v := range lastEvaluatedKey {
+		switch attr := v.(type) {
+		case *types.AttributeValueMemberS:
+			jsonFriendlyKey[k] = map[string]string{"S": attr.Value}
+		case *types.AttributeValueMemberN:
+			jsonFriendlyKey[k] = map[string]string{"N": attr.Value}
+		default:
+			continue
+		}
+	}
+
+	// Encode in JSON, then base64
+	startKeyJson, _ := json.Marshal(jsonFriendlyKey)
+	return base64.StdEncoding.EncodeToString(startKeyJson)
+}
+
 type ErrCodeNotFound struct {
 	Msg string
 }
@@ -198,3 +815,19 @@ type ErrCodeNotFound struct {
 func (e ErrCodeNotFound) Error() string {
 	return e.Msg
 }
+
+func (e ErrCodeNotFound) ErrorCode() apperror.Code {
+	return apperror.CodeNotFound
+}
+
+type ErrCodeConditionFailed struct {
+	Msg string
+}
+
+func (e ErrCodeConditionFailed) Error() string {
+	return e.Msg
+}
+
+func (e ErrCodeConditionFailed) ErrorCode() apperror.Code {
+	return apperror.CodeConflict
+}
@@ -1,31 +1,55 @@
 package s3
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"io"
-	"log"
 	"os"
-	"strconv"
 	"strings"
 	"time"
 
 	postmodel "github.com/JaxonAdams/blog-backend/src/models/posts"
+	appconfig "github.com/JaxonAdams/blog-backend/src/services/config"
+	"github.com/JaxonAdams/blog-backend/src/services/logging"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
+type UploadedObject struct {
+	Key       string
+	VersionID string
+}
+
+// Store is what handlers use of the bucket. S3Service implements it; tests
+// can serve the API from memory instead.
+type Store interface {
+	UploadPostHTML(postID, content string, ctx context.Context) (UploadedObject, error)
+	UploadPostMd(postID, content string, ctx context.Context) (UploadedObject, error)
+	RemoveUpload(object UploadedObject, ctx context.Context) error
+	GetPostHtmlURL(post postmodel.Post, ctx context.Context) (string, error)
+	GetPostMdURL(post postmodel.Post, ctx context.Context) (string, error)
+	ReadPostObject(key string, maxBytes int64, ctx context.Context) (string, error)
+	DeletePostObjects(postID string, ctx context.Context) error
+	PutObject(key, contentType string, content []byte, ctx context.Context) error
+	ListETags(prefix string, ctx context.Context) (map[string]string, error)
+	DeleteKeys(keys []string, ctx context.Context) error
+}
+
 type S3Service struct {
 	client        *s3.Client
 	presignClient *s3.PresignClient
+	config        *appconfig.Config
 }
 
-func New(ctx context.Context) *S3Service {
+func New(ctx context.Context, appConfig *appconfig.Config) *S3Service {
 	cfg, err := config.LoadDefaultConfig(ctx)
 	if err != nil {
-		log.Fatalf("failed to load config: %v", err)
+		// Runs once at cold start; without AWS config the function cannot serve anything
+		logging.New().Error("Failed to load AWS config", "error", err)
+		os.Exit(1)
 	}
 
 	client := s3.NewFromConfig(cfg)
@@ -33,59 +57,223 @@ func New(ctx context.Context) *S3Service {
 	return &S3Service{
 		client:        client,
 		presignClient: presigner,
+		config:        appConfig,
 	}
 }
 
-func (s S3Service) UploadPostHTML(postID, content string, ctx context.Context) (string, error) {
-	bucket := os.Getenv("S3_BUCKET_NAME")
+func (s S3Service) UploadPostHTML(postID, content string, ctx context.Context) (UploadedObject, error) {
+	bucket := s.config.BucketName
 	key := fmt.Sprintf("posts/%s.html", postID)
 	fileType := "text/html"
 
 	contentReader := strings.NewReader(content)
 
-	_, err := s.uploadFile(
+	output, err := s.uploadFile(
 		&bucket,
 		&key,
 		&fileType,
 		contentReader,
 		ctx,
 	)
+	if err != nil {
+		return UploadedObject{}, err
+	}
 
-	return key, err
+	return UploadedObject{Key: key, VersionID: aws.ToString(output.VersionId)}, nil
 }
 
-func (s S3Service) UploadPostMd(postID, content string, ctx context.Context) (string, error) {
-	bucket := os.Getenv("S3_BUCKET_NAME")
+func (s S3Service) UploadPostMd(postID, content string, ctx context.Context) (UploadedObject, error) {
+	bucket := s.config.BucketName
 	key := fmt.Sprintf("posts/%s.md", postID)
 	fileType := "text/markdown"
 
 	contentReader := strings.NewReader(content)
 
-	_, err := s.uploadFile(
+	output, err := s.uploadFile(
 		&bucket,
 		&key,
 		&fileType,
 		contentReader,
 		ctx,
 	)
+	if err != nil {
+		return UploadedObject{}, err
+	}
 
-	return key, err
+	return UploadedObject{Key: key, VersionID: aws.ToString(output.VersionId)}, nil
 }
 
-func (s S3Service) GetPostHtmlURL(post postmodel.Post, ctx context.Context) (string, error) {
-	bucket := os.Getenv("S3_BUCKET_NAME")
-	expirySeconds, _ := strconv.Atoi(os.Getenv("S3_URL_EXPIRY_SECONDS"))
-	expiry := time.Duration(expirySeconds) * time.Second
+func (s S3Service) RemoveUpload(object UploadedObject, ctx context.Context) error {
+	bucket := s.config.BucketName
 
-	return s.getPresignedGetURL(bucket, post.HtmlS3Key, expiry, ctx)
+	input := &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(object.Key),
+	}
+
+	// Deleting the specific version reverts the key to whatever it held before
+	if object.VersionID != "" {
+		input.VersionId = aws.String(object.VersionID)
+	}
+
+	_, err := s.client.DeleteObject(ctx, input)
+	if err != nil {
+		return fmt.Errorf("failed to remove uploaded object %s: %w", object.Key, err)
+	}
+
+	return nil
+}
+
+func (s S3Service) GetPostHtmlURL(post postmodel.Post, ctx context.Context) (string, error) {
+	return s.getPresignedGetURL(s.config.BucketName, post.HtmlS3Key, s.config.URLExpiry, ctx)
 }
 
 func (s S3Service) GetPostMdURL(post postmodel.Post, ctx context.Context) (string, error) {
-	bucket := os.Getenv("S3_BUCKET_NAME")
-	expirySeconds, _ := strconv.Atoi(os.Getenv("S3_URL_EXPIRY_SECONDS"))
-	expiry := time.Duration(expirySeconds) * time.Second
+	return s.getPresignedGetURL(s.config.BucketName, post.MdS3Key, s.config.URLExpiry, ctx)
+}
+
+// ReadPostObject returns the object's content, or ErrCodeObjectTooLarge if it
+// is bigger than maxBytes.
+func (s S3Service) ReadPostObject(key string, maxBytes int64, ctx context.Context) (string, error) {
+	bucket := s.config.BucketName
+
+	output, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to read object %s: %w", key, err)
+	}
+	defer output.Body.Close()
+
+	tooLarge := ErrCodeObjectTooLarge{Msg: fmt.Sprintf("object %s is larger than %d bytes", key, maxBytes)}
+	if aws.ToInt64(output.ContentLength) > maxBytes {
+		return "", tooLarge
+	}
+
+	// Guard against a missing or wrong Content-Length as well
+	content, err := io.ReadAll(io.LimitReader(output.Body, maxBytes+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read object %s: %w", key, err)
+	}
+	if int64(len(content)) > maxBytes {
+		return "", tooLarge
+	}
+
+	return string(content), nil
+}
+
+func (s S3Service) DeletePostObjects(postID string, ctx context.Context) error {
+	bucket := s.config.BucketName
+	prefix := fmt.Sprintf("posts/%s.", postID)
+
+	// The bucket is versioned, so every version and delete marker has to go
+	var objects []types.ObjectIdentifier
+	paginator := s3.NewListObjectVersionsPaginator(s.client, &s3.ListObjectVersionsInput{
+		Bucket: aws.String(bucket),
+		Prefix: aws.String(prefix),
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to list post objects: %w", err)
+		}
+
+		for _, v := range page.Versions {
+			objects = append(objects, types.ObjectIdentifier{Key: v.Key, VersionId: v.VersionId})
+		}
+		for _, m := range page.DeleteMarkers {
+			objects = append(objects, types.ObjectIdentifier{Key: m.Key, VersionId: m.VersionId})
+		}
+	}
+
+	for start := 0; start < len(objects); start += 1000 {
+		end := min(start+1000, len(objects))
 
-	return s.getPresignedGetURL(bucket, post.MdS3Key, expiry, ctx)
+		output, err := s.client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(bucket),
+			Delete: &types.Delete{
+				Objects: objects[start:end],
+				Quiet:   aws.Bool(true),
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete post objects: %w", err)
+		}
+
+		if len(output.Errors) > 0 {
+			return fmt.Errorf("failed to delete %d post objects: %s", len(output.Errors), aws.ToString(output.Errors[0].Message))
+		}
+	}
+
+	return nil
+}
+
+// PutObject writes an object that is not part of a post, such as a page of
+// the static site export.
+func (s S3Service) PutObject(key, contentType string, content []byte, ctx context.Context) error {
+	bucket := s.config.BucketName
+
+	if _, err := s.uploadFile(&bucket, &key, &contentType, bytes.NewReader(content), ctx); err != nil {
+		return fmt.Errorf("failed to write object %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// ListETags returns the ETag of every current object under prefix, by key,
+// without quotes. A single-part upload's ETag is the MD5 of its content
+// unless the bucket encrypts with KMS.
+func (s S3Service) ListETags(prefix string, ctx context.Context) (map[string]string, error) {
+	etags := map[string]string{}
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.config.BucketName),
+		Prefix: aws.String(prefix),
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list objects under %s: %w", prefix, err)
+		}
+
+		for _, object := range page.Contents {
+			etags[aws.ToString(object.Key)] = strings.Trim(aws.ToString(object.ETag), `"`)
+		}
+	}
+
+	return etags, nil
+}
+
+// DeleteKeys deletes the current version of each object. Earlier versions
+// are kept.
+func (s S3Service) DeleteKeys(keys []string, ctx context.Context) error {
+	for start := 0; start < len(keys); start += 1000 {
+		end := min(start+1000, len(keys))
+
+		objects := make([]types.ObjectIdentifier, 0, end-start)
+		for _, key := range keys[start:end] {
+			objects = append(objects, types.ObjectIdentifier{Key: aws.String(key)})
+		}
+
+		output, err := s.client.DeleteObjects(ctx, &s3.DeleteObjectsInput{
+			Bucket: aws.String(s.config.BucketName),
+			Delete: &types.Delete{
+				Objects: objects,
+				Quiet:   aws.Bool(true),
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to delete objects: %w", err)
+		}
+
+		if len(output.Errors) > 0 {
+			return fmt.Errorf("failed to delete %d objects: %s", len(output.Errors), aws.ToString(output.Errors[0].Message))
+		}
+	}
+
+	return nil
 }
 
 func (s S3Service) getPresignedGetURL(bucket, key string, expiry time.Duration, ctx context.Context) (string, error) {
@@ -114,3 +302,11 @@ func (s S3Service) uploadFile(bucket, key, fileType *string, fileReader io.Reade
 		ContentType: fileType,
 	})
 }
+
+type ErrCodeObjectTooLarge struct {
+	Msg string
+}
+
+func (e ErrCodeObjectTooLarge) Error() string {
+	return e.Msg
+}
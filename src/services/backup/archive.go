@@ -0,0 +1,198 @@
+package backupservice
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"time"
+)
+
+// FormatVersion is bumped whenever the archive layout changes in a way older
+// restores cannot read.
+const FormatVersion = 1
+
+const manifestPath = "manifest.json"
+
+// Manifest describes an archive. It is written last, once every file's
+// checksum is known.
+type Manifest struct {
+	FormatVersion int `json:"format_version"`
+	// Unique to each export; restores derive remapped IDs from it
+	ID        string      `json:"id"`
+	CreatedAt int64       `json:"created_at"`
+	Posts     int         `json:"posts"`
+	Users     int         `json:"users"`
+	Files     []FileEntry `json:"files"`
+}
+
+type FileEntry struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// archiveWriter writes a gzipped tar, recording each file for the manifest.
+type archiveWriter struct {
+	gz    *gzip.Writer
+	tar   *tar.Writer
+	files []FileEntry
+}
+
+func newArchiveWriter(w io.Writer) *archiveWriter {
+	gz := gzip.NewWriter(w)
+	return &archiveWriter{gz: gz, tar: tar.NewWriter(gz)}
+}
+
+func (a *archiveWriter) writeFile(name string, content []byte) error {
+	header := &tar.Header{
+		Name:    name,
+		Mode:    0o644,
+		Size:    int64(len(content)),
+		ModTime: time.Now(),
+	}
+	if err := a.tar.WriteHeader(header); err != nil {
+		return err
+	}
+	if _, err := a.tar.Write(content); err != nil {
+		return err
+	}
+
+	a.files = append(a.files, FileEntry{Path: name, Size: int64(len(content)), SHA256: checksum(content)})
+	return nil
+}
+
+func (a *archiveWriter) writeJSON(name string, value any) error {
+	content, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return err
+	}
+	return a.writeFile(name, append(content, '\n'))
+}
+
+// close writes the manifest and flushes the archive.
+func (a *archiveWriter) close(manifest Manifest) (Manifest, error) {
+	manifest.Files = a.files
+	if err := a.writeJSON(manifestPath, manifest); err != nil {
+		return Manifest{}, err
+	}
+
+	if err := a.tar.Close(); err != nil {
+		return Manifest{}, err
+	}
+	if err := a.gz.Close(); err != nil {
+		return Manifest{}, err
+	}
+
+	return manifest, nil
+}
+
+// archive is a verified archive's files by path.
+type archive struct {
+	manifest Manifest
+	files    map[string][]byte
+}
+
+// readArchive reads a whole archive and checks it against its manifest, so
+// nothing is restored from a truncated or altered backup.
+func readArchive(r io.Reader) (archive, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return archive{}, ErrCodeInvalidArchive{Msg: fmt.Sprintf("invalid gzip stream: %v", err)}
+	}
+	defer gz.Close()
+
+	files := map[string][]byte{}
+	reader := tar.NewReader(gz)
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return archive{}, ErrCodeInvalidArchive{Msg: fmt.Sprintf("invalid tar archive: %v", err)}
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		name := path.Clean(header.Name)
+		if _, ok := files[name]; ok {
+			return archive{}, ErrCodeInvalidArchive{Msg: fmt.Sprintf("%s appears twice", name)}
+		}
+
+		// No file the export writes is larger than an object it reads
+		content, err := io.ReadAll(io.LimitReader(reader, maxObjectBytes+1))
+		if err != nil {
+			return archive{}, ErrCodeInvalidArchive{Msg: fmt.Sprintf("failed to read %s: %v", name, err)}
+		}
+		if int64(len(content)) > maxObjectBytes {
+			return archive{}, ErrCodeInvalidArchive{Msg: fmt.Sprintf("%s is larger than %d bytes", name, maxObjectBytes)}
+		}
+		files[name] = content
+	}
+
+	manifestContent, ok := files[manifestPath]
+	if !ok {
+		return archive{}, ErrCodeInvalidArchive{Msg: "archive has no manifest"}
+	}
+	delete(files, manifestPath)
+
+	var manifest Manifest
+	if err := json.Unmarshal(manifestContent, &manifest); err != nil {
+		return archive{}, ErrCodeInvalidArchive{Msg: fmt.Sprintf("invalid manifest: %v", err)}
+	}
+	if manifest.FormatVersion < 1 || manifest.FormatVersion > FormatVersion {
+		return archive{}, ErrCodeInvalidArchive{Msg: fmt.Sprintf("unsupported archive format version %d; this build reads up to %d", manifest.FormatVersion, FormatVersion)}
+	}
+	if manifest.ID == "" {
+		return archive{}, ErrCodeInvalidArchive{Msg: "manifest has no id"}
+	}
+
+	listed := map[string]bool{}
+	for _, entry := range manifest.Files {
+		content, ok := files[entry.Path]
+		if !ok {
+			return archive{}, ErrCodeInvalidArchive{Msg: fmt.Sprintf("%s is listed in the manifest but missing", entry.Path)}
+		}
+		if int64(len(content)) != entry.Size || checksum(content) != entry.SHA256 {
+			return archive{}, ErrCodeInvalidArchive{Msg: fmt.Sprintf("%s does not match its checksum", entry.Path)}
+		}
+		listed[entry.Path] = true
+	}
+
+	var unlisted []string
+	for name := range files {
+		if !listed[name] {
+			unlisted = append(unlisted, name)
+		}
+	}
+	if len(unlisted) > 0 {
+		sort.Strings(unlisted)
+		return archive{}, ErrCodeInvalidArchive{Msg: fmt.Sprintf("files not in the manifest: %v", unlisted)}
+	}
+
+	return archive{manifest: manifest, files: files}, nil
+}
+
+func (a archive) readJSON(name string, value any) error {
+	content, ok := a.files[name]
+	if !ok {
+		return ErrCodeInvalidArchive{Msg: fmt.Sprintf("archive has no %s", name)}
+	}
+	if err := json.Unmarshal(content, value); err != nil {
+		return ErrCodeInvalidArchive{Msg: fmt.Sprintf("invalid %s: %v", name, err)}
+	}
+	return nil
+}
+
+func checksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,178 @@
+package backupservice
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type tarFile struct {
+	name    string
+	content string
+}
+
+// tarball writes files, then a manifest listing those in listed, as a
+// gzipped tar. edit may change the manifest before it is written.
+func tarball(t *testing.T, files []tarFile, listed []tarFile, edit func(*Manifest)) []byte {
+	t.Helper()
+
+	manifest := Manifest{FormatVersion: FormatVersion, ID: "archive-1"}
+	for _, file := range listed {
+		manifest.Files = append(manifest.Files, FileEntry{Path: file.name, Size: int64(len(file.content)), SHA256: checksum([]byte(file.content))})
+	}
+	if edit != nil {
+		edit(&manifest)
+	}
+	content, err := json.Marshal(manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files = append(files, tarFile{name: manifestPath, content: string(content)})
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	writer := tar.NewWriter(gz)
+	for _, file := range files {
+		if err := writer.WriteHeader(&tar.Header{Name: file.name, Mode: 0o644, Size: int64(len(file.content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := writer.Write([]byte(file.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadArchive(t *testing.T) {
+	users := tarFile{name: "users.json", content: "[]\n"}
+	tags := tarFile{name: "tags.json", content: "{}\n"}
+
+	tests := []struct {
+		name    string
+		archive func(t *testing.T) []byte
+		// Part of the error message, or empty if the archive is valid
+		wantErr string
+	}{
+		{
+			name: "valid",
+			archive: func(t *testing.T) []byte {
+				return tarball(t, []tarFile{users, tags}, []tarFile{users, tags}, nil)
+			},
+		},
+		{
+			name: "listed file is missing",
+			archive: func(t *testing.T) []byte {
+				return tarball(t, []tarFile{users}, []tarFile{users, tags}, nil)
+			},
+			wantErr: "tags.json is listed in the manifest but missing",
+		},
+		{
+			name: "file is not listed",
+			archive: func(t *testing.T) []byte {
+				return tarball(t, []tarFile{users, tags}, []tarFile{users}, nil)
+			},
+			wantErr: "files not in the manifest: [tags.json]",
+		},
+		{
+			name: "file is altered",
+			archive: func(t *testing.T) []byte {
+				altered := tarFile{name: users.name, content: `[{"username":"eve"}]` + "\n"}
+				return tarball(t, []tarFile{altered}, []tarFile{users}, nil)
+			},
+			wantErr: "users.json does not match its checksum",
+		},
+		{
+			name: "file is altered without changing its size",
+			archive: func(t *testing.T) []byte {
+				altered := tarFile{name: tags.name, content: "{]\n"}
+				return tarball(t, []tarFile{altered}, []tarFile{tags}, nil)
+			},
+			wantErr: "tags.json does not match its checksum",
+		},
+		{
+			name: "file appears twice",
+			archive: func(t *testing.T) []byte {
+				return tarball(t, []tarFile{users, users}, []tarFile{users}, nil)
+			},
+			wantErr: "users.json appears twice",
+		},
+		{
+			name: "file is too large",
+			archive: func(t *testing.T) []byte {
+				large := tarFile{name: "posts/post-1/content.html", content: strings.Repeat("a", maxObjectBytes+1)}
+				return tarball(t, []tarFile{large}, []tarFile{large}, nil)
+			},
+			wantErr: "posts/post-1/content.html is larger than",
+		},
+		{
+			name: "newer format",
+			archive: func(t *testing.T) []byte {
+				return tarball(t, nil, nil, func(m *Manifest) { m.FormatVersion = FormatVersion + 1 })
+			},
+			wantErr: "unsupported archive format version",
+		},
+		{
+			name: "manifest without an ID",
+			archive: func(t *testing.T) []byte {
+				return tarball(t, nil, nil, func(m *Manifest) { m.ID = "" })
+			},
+			wantErr: "manifest has no id",
+		},
+		{
+			name: "not gzipped",
+			archive: func(t *testing.T) []byte {
+				return []byte("posts")
+			},
+			wantErr: "invalid gzip stream",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backup, err := readArchive(bytes.NewReader(tt.archive(t)))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("readArchive() error = %v", err)
+				}
+				if len(backup.files) != 2 || backup.files[users.name] == nil {
+					t.Errorf("files = %v, want users.json and tags.json", backup.files)
+				}
+				return
+			}
+
+			var invalid ErrCodeInvalidArchive
+			if !errors.As(err, &invalid) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("readArchive() error = %v, want ErrCodeInvalidArchive containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReadArchiveWithoutManifest(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	writer := tar.NewWriter(gz)
+	if err := writer.WriteHeader(&tar.Header{Name: "users.json", Mode: 0o644, Size: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := writer.Write([]byte("[]\n")); err != nil {
+		t.Fatal(err)
+	}
+	writer.Close()
+	gz.Close()
+
+	_, err := readArchive(&buf)
+	if err == nil || !strings.Contains(err.Error(), "archive has no manifest") {
+		t.Errorf("readArchive() error = %v, want a missing manifest", err)
+	}
+}
@@ -0,0 +1,375 @@
+package backupservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/JaxonAdams/blog-backend/src/helpers"
+	"github.com/JaxonAdams/blog-backend/src/models"
+	postmodel "github.com/JaxonAdams/blog-backend/src/models/posts"
+	usermodel "github.com/JaxonAdams/blog-backend/src/models/users"
+	"github.com/JaxonAdams/blog-backend/src/services/apperror"
+	"github.com/JaxonAdams/blog-backend/src/services/aws/dynamodb"
+	postservice "github.com/JaxonAdams/blog-backend/src/services/post"
+	"github.com/google/uuid"
+)
+
+// Posts' rendered HTML can be well over the Markdown limit
+const maxObjectBytes = 16 * 1024 * 1024
+
+// User is an admin user as exported. Password hashes, TOTP secrets and
+// recovery codes are left out, so a restored user must be given a new
+// password before they can log in.
+type User struct {
+	Username    string `json:"username"`
+	Role        string `json:"role"`
+	TOTPEnabled bool   `json:"totp_enabled"`
+	CreatedAt   int64  `json:"created_at"`
+	ModifiedAt  int64  `json:"modified_at"`
+}
+
+// Export writes every post, in the trash or not, and every admin user to w
+// as a gzipped tar:
+//
+//	posts/<id>/post.json    metadata, tags and timestamps
+//	posts/<id>/content.md
+//	posts/<id>/content.html
+//	tags.json               post IDs by tag
+//	users.json
+//	manifest.json           format version and a checksum for each file
+func Export(w io.Writer, services models.HandlerServices, ctx context.Context) (Manifest, error) {
+	posts, err := services.DynamoDBService.GetEveryPost(ctx)
+	if err != nil {
+		return Manifest{}, fmt.Errorf("failed to read posts: %w", err)
+	}
+	sort.Slice(posts, func(i, j int) bool { return posts[i].CreatedAt < posts[j].CreatedAt })
+
+	users, err := services.DynamoDBService.GetAllAdminUsers(ctx)
+	if err != nil {
+		return Manifest{}, fmt.Errorf("failed to read users: %w", err)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+
+	writer := newArchiveWriter(w)
+	tags := map[string][]string{}
+
+	for _, post := range posts {
+		markdown, err := services.S3Service.ReadPostObject(post.MdS3Key, maxObjectBytes, ctx)
+		if err != nil {
+			return Manifest{}, fmt.Errorf("failed to read post %s: %w", post.ID, err)
+		}
+		html, err := services.S3Service.ReadPostObject(post.HtmlS3Key, maxObjectBytes, ctx)
+		if err != nil {
+			return Manifest{}, fmt.Errorf("failed to read post %s: %w", post.ID, err)
+		}
+
+		// Hashes let restores spot posts they have already written
+		post.ContentHash = postmodel.HashContent(markdown)
+		if err := writer.writeJSON(postPath(post.ID, "post.json"), exportedPost(post)); err != nil {
+			return Manifest{}, err
+		}
+		if err := writer.writeFile(postPath(post.ID, "content.md"), []byte(markdown)); err != nil {
+			return Manifest{}, err
+		}
+		if err := writer.writeFile(postPath(post.ID, "content.html"), []byte(html)); err != nil {
+			return Manifest{}, err
+		}
+
+		for _, tag := range post.Tags {
+			tags[tag] = append(tags[tag], post.ID)
+		}
+	}
+
+	if err := writer.writeJSON("tags.json", tags); err != nil {
+		return Manifest{}, err
+	}
+
+	exportedUsers := make([]User, 0, len(users))
+	for _, user := range users {
+		exportedUsers = append(exportedUsers, User{
+			Username:    user.Username,
+			Role:        user.Role,
+			TOTPEnabled: user.TOTPEnabled,
+			CreatedAt:   user.CreatedAt,
+			ModifiedAt:  user.ModifiedAt,
+		})
+	}
+	if err := writer.writeJSON("users.json", exportedUsers); err != nil {
+		return Manifest{}, err
+	}
+
+	return writer.close(Manifest{
+		FormatVersion: FormatVersion,
+		ID:            helpers.NewID(),
+		CreatedAt:     time.Now().UnixMilli(),
+		Posts:         len(posts),
+		Users:         len(users),
+	})
+}
+
+// exportedPost drops what only makes sense in the source environment.
+func exportedPost(post postmodel.Post) postmodel.Post {
+	post.HtmlPostUrl, post.MdPostUrl = "", ""
+	post.HtmlContent, post.MdContent = "", ""
+	post.HtmlS3Key, post.MdS3Key = "", ""
+	return post
+}
+
+func postPath(id, name string) string {
+	return fmt.Sprintf("posts/%s/%s", id, name)
+}
+
+type RestoreOptions struct {
+	// Give posts new IDs, derived from the archive's ID so that restoring
+	// the same archive again maps to the same posts
+	RemapIDs bool
+	// Report what would be restored without writing anything
+	DryRun bool
+}
+
+type Status string
+
+const (
+	StatusCreated   Status = "created"
+	StatusUnchanged Status = "unchanged"
+	// Something else already has the ID or username; it is left alone
+	StatusConflict Status = "conflict"
+	StatusFailed   Status = "failed"
+)
+
+type Result struct {
+	Kind     string `json:"kind"`
+	SourceID string `json:"source_id"`
+	TargetID string `json:"target_id"`
+	Status   Status `json:"status"`
+	Error    string `json:"error,omitempty"`
+
+	// The restored post, for audit entries
+	Post *postmodel.Post `json:"-"`
+}
+
+type Report struct {
+	Manifest Manifest `json:"manifest"`
+	DryRun   bool     `json:"dry_run"`
+	Results  []Result `json:"results"`
+	Failed   int      `json:"failed"`
+}
+
+// Restore writes an archive's posts and users into the environment. It only
+// ever creates: posts and users that already exist are reported as unchanged
+// or as conflicts, so restoring the same archive twice is safe.
+func Restore(r io.Reader, options RestoreOptions, services models.HandlerServices, ctx context.Context) (Report, error) {
+	backup, err := readArchive(r)
+	if err != nil {
+		return Report{}, err
+	}
+
+	posts, err := backup.posts()
+	if err != nil {
+		return Report{}, err
+	}
+
+	var users []User
+	if err := backup.readJSON("users.json", &users); err != nil {
+		return Report{}, err
+	}
+
+	report := Report{Manifest: backup.manifest, DryRun: options.DryRun}
+
+	for _, archived := range posts {
+		targetID := archived.post.ID
+		if options.RemapIDs {
+			targetID = remapID(backup.manifest.ID, archived.post.ID)
+		}
+
+		result := restorePost(archived, targetID, options.DryRun, services, ctx)
+		if result.Status == StatusFailed {
+			services.Logger.Error("Failed to restore post", "source_id", result.SourceID, "target_id", targetID, "error", result.Error)
+			report.Failed++
+		}
+		report.Results = append(report.Results, result)
+	}
+
+	for _, user := range users {
+		result := restoreUser(user, options.DryRun, services, ctx)
+		if result.Status == StatusFailed {
+			services.Logger.Error("Failed to restore user", "username", user.Username, "error", result.Error)
+			report.Failed++
+		}
+		report.Results = append(report.Results, result)
+	}
+
+	if report.Failed > 0 {
+		return report, fmt.Errorf("%d of %d items failed to restore", report.Failed, len(report.Results))
+	}
+	return report, nil
+}
+
+type archivedPost struct {
+	post     postmodel.Post
+	markdown string
+	html     string
+}
+
+func (a archive) posts() ([]archivedPost, error) {
+	var posts []archivedPost
+	for name := range a.files {
+		rest, isPost := strings.CutPrefix(name, "posts/")
+		id, isMetadata := strings.CutSuffix(rest, "/post.json")
+		if !isPost || !isMetadata {
+			continue
+		}
+
+		var post postmodel.Post
+		if err := a.readJSON(name, &post); err != nil {
+			return nil, err
+		}
+		if post.ID != id {
+			return nil, ErrCodeInvalidArchive{Msg: fmt.Sprintf("%s holds post %s", name, post.ID)}
+		}
+
+		markdown, ok := a.files[postPath(id, "content.md")]
+		if !ok {
+			return nil, ErrCodeInvalidArchive{Msg: fmt.Sprintf("post %s has no Markdown", id)}
+		}
+		html, ok := a.files[postPath(id, "content.html")]
+		if !ok {
+			return nil, ErrCodeInvalidArchive{Msg: fmt.Sprintf("post %s has no HTML", id)}
+		}
+		if postmodel.HashContent(string(markdown)) != post.ContentHash {
+			return nil, ErrCodeInvalidArchive{Msg: fmt.Sprintf("post %s's Markdown does not match its content hash", id)}
+		}
+
+		posts = append(posts, archivedPost{post: post, markdown: string(markdown), html: string(html)})
+	}
+
+	if len(posts) != a.manifest.Posts {
+		return nil, ErrCodeInvalidArchive{Msg: fmt.Sprintf("manifest lists %d posts but the archive holds %d", a.manifest.Posts, len(posts))}
+	}
+
+	sort.Slice(posts, func(i, j int) bool { return posts[i].post.CreatedAt < posts[j].post.CreatedAt })
+	return posts, nil
+}
+
+func restorePost(archived archivedPost, targetID string, dryRun bool, services models.HandlerServices, ctx context.Context) Result {
+	result := Result{Kind: "post", SourceID: archived.post.ID, TargetID: targetID}
+
+	existing, err := services.DynamoDBService.GetPostById(targetID, ctx)
+	var notFound dynamodb.ErrCodeNotFound
+	switch {
+	case err == nil:
+		result.Status = StatusConflict
+		if existing.ContentHash == archived.post.ContentHash && existing.Version == archived.post.Version {
+			result.Status = StatusUnchanged
+		}
+		return result
+	case !errors.As(err, &notFound):
+		return failed(result, err)
+	}
+
+	result.Status = StatusCreated
+	if dryRun {
+		return result
+	}
+
+	post := archived.post
+	post.ID = targetID
+
+	post, err = postservice.InsertPost(post, archived.markdown, archived.html, services, ctx)
+	if err != nil {
+		var conflict dynamodb.ErrCodeConditionFailed
+		if errors.As(err, &conflict) {
+			result.Status = StatusConflict
+			return result
+		}
+		return failed(result, err)
+	}
+
+	result.Post = &post
+	return result
+}
+
+func restoreUser(user User, dryRun bool, services models.HandlerServices, ctx context.Context) Result {
+	result := Result{Kind: "user", SourceID: user.Username, TargetID: user.Username}
+
+	existing, err := services.DynamoDBService.GetAdminUser(user.Username, ctx)
+	var notFound dynamodb.ErrCodeNotFound
+	switch {
+	case err == nil && existing.Username != "":
+		result.Status = StatusConflict
+		if existing.Role == user.Role {
+			result.Status = StatusUnchanged
+		}
+		return result
+	case err == nil:
+		return failed(result, fmt.Errorf("failed to read user %s", user.Username))
+	case !errors.As(err, &notFound):
+		return failed(result, err)
+	}
+
+	result.Status = StatusCreated
+	if dryRun {
+		return result
+	}
+
+	err = services.DynamoDBService.InsertAdminUser(usermodel.AdminUser{
+		Username:   user.Username,
+		Role:       user.Role,
+		CreatedAt:  user.CreatedAt,
+		ModifiedAt: user.ModifiedAt,
+	}, ctx)
+	if err != nil {
+		return failed(result, err)
+	}
+
+	return result
+}
+
+func failed(result Result, err error) Result {
+	result.Status = StatusFailed
+	result.Error = err.Error()
+	return result
+}
+
+// remapID derives a post's new ID from the archive and its old ID, so the
+// mapping is the same every time the archive is restored.
+func remapID(archiveID, id string) string {
+	return uuid.NewSHA1(uuid.NameSpaceURL, []byte("blog-backup:"+archiveID+"/"+id)).String()
+}
+
+// Counts tallies the report's results by status.
+func (r Report) Counts() map[Status]int {
+	counts := map[Status]int{}
+	for _, result := range r.Results {
+		counts[result.Status]++
+	}
+	return counts
+}
+
+// CreatedUsers lists the users the restore created, who need a password set.
+func (r Report) CreatedUsers() []string {
+	var usernames []string
+	for _, result := range r.Results {
+		if result.Kind == "user" && result.Status == StatusCreated {
+			usernames = append(usernames, result.TargetID)
+		}
+	}
+	return usernames
+}
+
+type ErrCodeInvalidArchive struct {
+	Msg string
+}
+
+func (e ErrCodeInvalidArchive) Error() string {
+	return e.Msg
+}
+
+func (e ErrCodeInvalidArchive) ErrorCode() apperror.Code {
+	return apperror.CodeInvalidRequest
+}
@@ -0,0 +1,364 @@
+package backupservice
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/JaxonAdams/blog-backend/src/models"
+	postmodel "github.com/JaxonAdams/blog-backend/src/models/posts"
+	usermodel "github.com/JaxonAdams/blog-backend/src/models/users"
+	"github.com/JaxonAdams/blog-backend/src/services/aws/dynamodb"
+	"github.com/JaxonAdams/blog-backend/src/services/aws/s3"
+	"github.com/google/uuid"
+)
+
+// backupStore keeps posts and users in memory, inserting them on the same
+// terms as the table.
+type backupStore struct {
+	dynamodb.Store
+	posts map[string]postmodel.Post
+	users map[string]usermodel.AdminUser
+}
+
+func (s *backupStore) GetEveryPost(ctx context.Context) ([]postmodel.Post, error) {
+	return slices.Collect(maps.Values(s.posts)), nil
+}
+
+func (s *backupStore) GetPostById(id string, ctx context.Context) (postmodel.Post, error) {
+	post, ok := s.posts[id]
+	if !ok {
+		return postmodel.Post{}, dynamodb.ErrCodeNotFound{Msg: id}
+	}
+	return post, nil
+}
+
+func (s *backupStore) InsertPost(post postmodel.Post, ctx context.Context) error {
+	if _, ok := s.posts[post.ID]; ok {
+		return dynamodb.ErrCodeConditionFailed{Msg: post.ID}
+	}
+	s.posts[post.ID] = post
+	return nil
+}
+
+func (s *backupStore) GetAllAdminUsers(ctx context.Context) ([]usermodel.AdminUser, error) {
+	return slices.Collect(maps.Values(s.users)), nil
+}
+
+func (s *backupStore) GetAdminUser(username string, ctx context.Context) (usermodel.AdminUser, error) {
+	user, ok := s.users[username]
+	if !ok {
+		return usermodel.AdminUser{}, dynamodb.ErrCodeNotFound{Msg: username}
+	}
+	return user, nil
+}
+
+func (s *backupStore) InsertAdminUser(user usermodel.AdminUser, ctx context.Context) error {
+	s.users[user.Username] = user
+	return nil
+}
+
+type backupBucket struct {
+	s3.Store
+	objects map[string]string
+}
+
+func (b *backupBucket) ReadPostObject(key string, maxBytes int64, ctx context.Context) (string, error) {
+	content, ok := b.objects[key]
+	if !ok {
+		return "", errors.New("no such key " + key)
+	}
+	return content, nil
+}
+
+func (b *backupBucket) UploadPostMd(postID, content string, ctx context.Context) (s3.UploadedObject, error) {
+	return b.upload("posts/"+postID+".md", content), nil
+}
+
+func (b *backupBucket) UploadPostHTML(postID, content string, ctx context.Context) (s3.UploadedObject, error) {
+	return b.upload("posts/"+postID+".html", content), nil
+}
+
+func (b *backupBucket) upload(key, content string) s3.UploadedObject {
+	b.objects[key] = content
+	return s3.UploadedObject{Key: key}
+}
+
+func newServices() (models.HandlerServices, *backupStore, *backupBucket) {
+	store := &backupStore{posts: map[string]postmodel.Post{}, users: map[string]usermodel.AdminUser{}}
+	bucket := &backupBucket{objects: map[string]string{}}
+	services := models.HandlerServices{
+		DynamoDBService: store,
+		S3Service:       bucket,
+		Logger:          slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+	return services, store, bucket
+}
+
+// source is an environment with a live post, a trashed one and a user.
+func source(t *testing.T) (models.HandlerServices, *backupStore) {
+	t.Helper()
+	services, store, bucket := newServices()
+
+	for _, post := range []postmodel.Post{
+		{ID: "post-1", Title: "First", Summary: "One", Tags: []string{"go"}, CreatedAt: 1, ModifiedAt: 2, Version: 2},
+		{ID: "post-2", Title: "Second", Summary: "Two", Tags: []string{"go", "aws"}, CreatedAt: 3, ModifiedAt: 3, Version: 1, DeletedAt: 4},
+	} {
+		post.MdS3Key, post.HtmlS3Key = "posts/"+post.ID+".md", "posts/"+post.ID+".html"
+		markdown := "# " + post.Title
+		post.ContentHash = postmodel.HashContent(markdown)
+		bucket.objects[post.MdS3Key] = markdown
+		bucket.objects[post.HtmlS3Key] = "<h1>" + post.Title + "</h1>"
+		store.posts[post.ID] = post
+	}
+	store.users["admin"] = usermodel.AdminUser{
+		Username:      "admin",
+		Role:          "admin",
+		HashedPW:      "$2a$10$hash",
+		TOTPSecret:    "JBSWY3DPEHPK3PXP",
+		TOTPEnabled:   true,
+		RecoveryCodes: []string{"code-hash"},
+		CreatedAt:     1,
+		ModifiedAt:    1,
+	}
+
+	return services, store
+}
+
+func export(t *testing.T, services models.HandlerServices) ([]byte, Manifest) {
+	t.Helper()
+	var buf bytes.Buffer
+	manifest, err := Export(&buf, services, context.Background())
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+	return buf.Bytes(), manifest
+}
+
+func TestExport(t *testing.T) {
+	services, _ := source(t)
+	archived, manifest := export(t, services)
+
+	if manifest.FormatVersion != FormatVersion || manifest.ID == "" || manifest.Posts != 2 || manifest.Users != 1 {
+		t.Errorf("manifest = %+v, want format %d, an ID, 2 posts and 1 user", manifest, FormatVersion)
+	}
+
+	// Read the tar directly rather than through readArchive, so this checks
+	// what the export wrote and not what restores accept
+	gz, err := gzip.NewReader(bytes.NewReader(archived))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := tar.NewReader(gz)
+	var names []string
+	files := map[string][]byte{}
+	for {
+		header, err := reader.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, header.Name)
+		files[header.Name] = content
+	}
+
+	wantNames := []string{
+		"posts/post-1/post.json", "posts/post-1/content.md", "posts/post-1/content.html",
+		"posts/post-2/post.json", "posts/post-2/content.md", "posts/post-2/content.html",
+		"tags.json", "users.json", manifestPath,
+	}
+	if !slices.Equal(names, wantNames) {
+		t.Errorf("archive files = %v, want %v", names, wantNames)
+	}
+
+	var written Manifest
+	if err := json.Unmarshal(files[manifestPath], &written); err != nil {
+		t.Fatal(err)
+	}
+	if written.ID != manifest.ID || len(written.Files) != len(wantNames)-1 {
+		t.Errorf("written manifest = %+v, want %+v", written, manifest)
+	}
+	for _, entry := range written.Files {
+		content := files[entry.Path]
+		if entry.Size != int64(len(content)) || entry.SHA256 != checksum(content) {
+			t.Errorf("manifest entry %+v does not match %s", entry, entry.Path)
+		}
+	}
+
+	var post postmodel.Post
+	if err := json.Unmarshal(files["posts/post-2/post.json"], &post); err != nil {
+		t.Fatal(err)
+	}
+	if post.DeletedAt != 4 || post.MdS3Key != "" || post.HtmlS3Key != "" || post.ContentHash != postmodel.HashContent("# Second") {
+		t.Errorf("post.json = %+v, want the trashed post without S3 keys", post)
+	}
+
+	var tags map[string][]string
+	if err := json.Unmarshal(files["tags.json"], &tags); err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(tags["go"], []string{"post-1", "post-2"}) || !slices.Equal(tags["aws"], []string{"post-2"}) {
+		t.Errorf("tags.json = %v", tags)
+	}
+
+	for _, secret := range []string{"$2a$10$hash", "JBSWY3DPEHPK3PXP", "code-hash"} {
+		if bytes.Contains(files["users.json"], []byte(secret)) {
+			t.Errorf("users.json contains %q", secret)
+		}
+	}
+}
+
+func TestRestore(t *testing.T) {
+	tests := []struct {
+		name    string
+		options RestoreOptions
+		// Restore into the exporting environment rather than an empty one
+		intoSource  bool
+		wantFirst   map[Status]int
+		wantSecond  map[Status]int
+		wantWritten bool
+	}{
+		{
+			name:        "into an empty environment",
+			wantFirst:   map[Status]int{StatusCreated: 3},
+			wantSecond:  map[Status]int{StatusUnchanged: 3},
+			wantWritten: true,
+		},
+		{
+			name:        "with remapped IDs",
+			options:     RestoreOptions{RemapIDs: true},
+			wantFirst:   map[Status]int{StatusCreated: 3},
+			wantSecond:  map[Status]int{StatusUnchanged: 3},
+			wantWritten: true,
+		},
+		{
+			name:       "into the source",
+			intoSource: true,
+			wantFirst:  map[Status]int{StatusUnchanged: 3},
+			wantSecond: map[Status]int{StatusUnchanged: 3},
+		},
+		{
+			name:       "with remapped IDs into the source",
+			options:    RestoreOptions{RemapIDs: true},
+			intoSource: true,
+			wantFirst:  map[Status]int{StatusCreated: 2, StatusUnchanged: 1},
+			wantSecond: map[Status]int{StatusUnchanged: 3},
+		},
+		{
+			name:       "dry run",
+			options:    RestoreOptions{DryRun: true},
+			wantFirst:  map[Status]int{StatusCreated: 3},
+			wantSecond: map[Status]int{StatusCreated: 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sourceServices, sourceStore := source(t)
+			archived, manifest := export(t, sourceServices)
+
+			services, store := sourceServices, sourceStore
+			if !tt.intoSource {
+				services, store, _ = newServices()
+			}
+
+			first, err := Restore(bytes.NewReader(archived), tt.options, services, context.Background())
+			if err != nil {
+				t.Fatalf("first Restore() error = %v", err)
+			}
+			if !maps.Equal(first.Counts(), tt.wantFirst) {
+				t.Errorf("first Restore() counts = %v, want %v", first.Counts(), tt.wantFirst)
+			}
+
+			second, err := Restore(bytes.NewReader(archived), tt.options, services, context.Background())
+			if err != nil {
+				t.Fatalf("second Restore() error = %v", err)
+			}
+			if !maps.Equal(second.Counts(), tt.wantSecond) {
+				t.Errorf("second Restore() counts = %v, want %v", second.Counts(), tt.wantSecond)
+			}
+			if !slices.Equal(resultTargets(first), resultTargets(second)) {
+				t.Errorf("restores mapped posts to %v, then %v", resultTargets(first), resultTargets(second))
+			}
+
+			if !tt.wantWritten {
+				return
+			}
+			for _, result := range first.Results {
+				if result.Kind != "post" {
+					continue
+				}
+				wantID := result.SourceID
+				if tt.options.RemapIDs {
+					wantID = remapID(manifest.ID, result.SourceID)
+				}
+				restored, ok := store.posts[wantID]
+				if !ok || result.TargetID != wantID {
+					t.Errorf("post %s was restored as %s, want %s", result.SourceID, result.TargetID, wantID)
+					continue
+				}
+				original := sourceStore.posts[result.SourceID]
+				if restored.ContentHash != original.ContentHash || restored.DeletedAt != original.DeletedAt || restored.Version != original.Version {
+					t.Errorf("restored post = %+v, want %+v", restored, original)
+				}
+			}
+			if user := store.users["admin"]; user.HashedPW != "" || user.TOTPSecret != "" {
+				t.Errorf("restored user = %+v, want no credentials", user)
+			}
+		})
+	}
+}
+
+func TestRestoreRejectsAnUnverifiedArchive(t *testing.T) {
+	sourceServices, _ := source(t)
+	archived, _ := export(t, sourceServices)
+	services, store, _ := newServices()
+
+	// Cutting the archive short drops the manifest written at its end
+	_, err := Restore(bytes.NewReader(archived[:len(archived)/2]), RestoreOptions{}, services, context.Background())
+	var invalid ErrCodeInvalidArchive
+	if !errors.As(err, &invalid) {
+		t.Errorf("Restore() error = %v, want ErrCodeInvalidArchive", err)
+	}
+	if len(store.posts) != 0 || len(store.users) != 0 {
+		t.Errorf("Restore() wrote %d posts and %d users from a truncated archive", len(store.posts), len(store.users))
+	}
+}
+
+func TestRemapID(t *testing.T) {
+	id := remapID("archive-1", "post-1")
+
+	if _, err := uuid.Parse(id); err != nil {
+		t.Errorf("remapID() = %q, want a UUID: %v", id, err)
+	}
+	if again := remapID("archive-1", "post-1"); again != id {
+		t.Errorf("remapID() = %q, then %q", id, again)
+	}
+	for _, other := range []string{remapID("archive-2", "post-1"), remapID("archive-1", "post-2"), remapID("archive-1/post", "1")} {
+		if other == id {
+			t.Errorf("remapID() = %q for different inputs", id)
+		}
+	}
+}
+
+func resultTargets(report Report) []string {
+	var ids []string
+	for _, result := range report.Results {
+		ids = append(ids, result.Kind+":"+result.TargetID)
+	}
+	return ids
+}
@@ -0,0 +1,362 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JaxonAdams/blog-backend/src/services/logging"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+)
+
+// Setting names. The same names are used in the environment, the config file
+// and under the SSM path.
+const (
+	PostTableName         = "POST_METADATA_TABLE_NAME"
+	AuthTableName         = "AUTH_TABLE_NAME"
+	APIKeyTableName       = "API_KEY_TABLE_NAME"
+	AuditLogTableName     = "AUDIT_LOG_TABLE_NAME"
+	IdempotencyTableName  = "IDEMPOTENCY_TABLE_NAME"
+	BucketName            = "S3_BUCKET_NAME"
+	URLExpirySeconds      = "S3_URL_EXPIRY_SECONDS"
+	CacheMaxAgeSeconds    = "CACHE_MAX_AGE_SECONDS"
+	InlineContentMaxBytes = "INLINE_CONTENT_MAX_BYTES"
+	DefaultPageSize       = "DEFAULT_PAGE_SIZE"
+	TrashRetentionDays    = "TRASH_RETENTION_DAYS"
+	CORSAllowedOrigins    = "CORS_ALLOWED_ORIGINS"
+	OIDCIssuerURL         = "OIDC_ISSUER_URL"
+	OIDCClientID          = "OIDC_CLIENT_ID"
+	OIDCRedirectURI       = "OIDC_REDIRECT_URI"
+	OIDCScopes            = "OIDC_SCOPES"
+	OIDCAdminEmails       = "OIDC_ADMIN_EMAILS"
+	OIDCAdminGroups       = "OIDC_ADMIN_GROUPS"
+	OIDCGroupsClaim       = "OIDC_GROUPS_CLAIM"
+	SecretsProvider       = "SECRETS_PROVIDER"
+	SecretsDir            = "SECRETS_DIR"
+	SecretsPrefix         = "SECRETS_PREFIX"
+	SecretsCacheTTL       = "SECRETS_CACHE_TTL_SECONDS"
+	SiteURL               = "SITE_URL"
+	SiteTitle             = "SITE_TITLE"
+	SiteExportPrefix      = "SITE_EXPORT_PREFIX"
+)
+
+// settings are the names read from the environment.
+var settings = []string{
+	PostTableName, AuthTableName, APIKeyTableName, AuditLogTableName, IdempotencyTableName, BucketName,
+	URLExpirySeconds, CacheMaxAgeSeconds, InlineContentMaxBytes, DefaultPageSize, TrashRetentionDays, CORSAllowedOrigins,
+	OIDCIssuerURL, OIDCClientID, OIDCRedirectURI, OIDCScopes, OIDCAdminEmails, OIDCAdminGroups, OIDCGroupsClaim,
+	SecretsProvider, SecretsDir, SecretsPrefix, SecretsCacheTTL,
+	SiteURL, SiteTitle, SiteExportPrefix,
+}
+
+// Backends for SECRETS_PROVIDER
+const (
+	SecretsFromEnv            = "env"
+	SecretsFromFile           = "file"
+	SecretsFromSecretsManager = "secretsmanager"
+	SecretsFromSSM            = "ssm"
+)
+
+// Where optional settings are read from, before the environment
+const (
+	fileEnv    = "CONFIG_FILE"
+	ssmPathEnv = "CONFIG_SSM_PATH"
+)
+
+type Config struct {
+	PostTableName        string
+	AuthTableName        string
+	APIKeyTableName      string
+	AuditLogTableName    string
+	IdempotencyTableName string
+	BucketName           string
+
+	URLExpiry             time.Duration
+	CacheMaxAge           time.Duration
+	InlineContentMaxBytes int64
+	DefaultPageSize       int
+	TrashRetention        time.Duration
+	CORSAllowedOrigins    []string
+
+	OIDC    OIDCConfig
+	Secrets SecretsConfig
+	Site    SiteConfig
+}
+
+// SiteConfig describes the static site export. URL is where the site is
+// served, without a trailing slash; ExportPrefix is where the Lambda writes
+// it in the bucket.
+type SiteConfig struct {
+	URL          string
+	Title        string
+	ExportPrefix string
+}
+
+// SecretsConfig picks where secrets such as JWT_SECRET are read from. Prefix
+// is prepended to secret names in Secrets Manager and SSM.
+type SecretsConfig struct {
+	Provider string
+	Dir      string
+	Prefix   string
+	CacheTTL time.Duration
+}
+
+type OIDCConfig struct {
+	IssuerURL   string
+	ClientID    string
+	RedirectURI string
+	Scopes      []string
+	AdminEmails []string
+	AdminGroups []string
+	GroupsClaim string
+}
+
+// Load reads settings from the JSON file named by CONFIG_FILE, then the SSM
+// parameters under CONFIG_SSM_PATH, then the environment, each overriding the
+// last. Every invalid value and every missing required setting is reported.
+func Load(ctx context.Context, required ...string) (*Config, error) {
+	values, err := gather(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	l := loader{values: values}
+	for _, name := range required {
+		if values[name] == "" {
+			l.errs = append(l.errs, fmt.Errorf("%s is required but not set", name))
+		}
+	}
+
+	cfg := &Config{
+		PostTableName:        values[PostTableName],
+		AuthTableName:        values[AuthTableName],
+		APIKeyTableName:      values[APIKeyTableName],
+		AuditLogTableName:    values[AuditLogTableName],
+		IdempotencyTableName: values[IdempotencyTableName],
+		BucketName:           values[BucketName],
+
+		URLExpiry:             l.seconds(URLExpirySeconds, 3600, 1),
+		CacheMaxAge:           l.seconds(CacheMaxAgeSeconds, 300, 0),
+		InlineContentMaxBytes: int64(l.int(InlineContentMaxBytes, 512*1024, 1, 5*1024*1024)),
+		DefaultPageSize:       l.int(DefaultPageSize, 20, 1, 100),
+		TrashRetention:        time.Duration(l.int(TrashRetentionDays, 30, 1, 3650)) * 24 * time.Hour,
+		CORSAllowedOrigins:    l.list(CORSAllowedOrigins, ","),
+
+		OIDC: OIDCConfig{
+			IssuerURL:   values[OIDCIssuerURL],
+			ClientID:    values[OIDCClientID],
+			RedirectURI: values[OIDCRedirectURI],
+			Scopes:      strings.Fields(values[OIDCScopes]),
+			AdminEmails: lowercase(l.list(OIDCAdminEmails, ",")),
+			AdminGroups: lowercase(l.list(OIDCAdminGroups, ",")),
+			GroupsClaim: l.string(OIDCGroupsClaim, "groups"),
+		},
+
+		Secrets: SecretsConfig{
+			Provider: l.oneOf(SecretsProvider, SecretsFromEnv, SecretsFromFile, SecretsFromSecretsManager, SecretsFromSSM),
+			Dir:      l.string(SecretsDir, "/run/secrets"),
+			Prefix:   values[SecretsPrefix],
+			CacheTTL: l.seconds(SecretsCacheTTL, 300, 0),
+		},
+
+		Site: SiteConfig{
+			URL:          strings.TrimRight(l.url(SiteURL), "/"),
+			Title:        l.string(SiteTitle, "Blog"),
+			ExportPrefix: l.prefix(SiteExportPrefix, "site/"),
+		},
+	}
+
+	// A cached post must never hand out presigned links that have expired
+	cfg.CacheMaxAge = min(cfg.CacheMaxAge, cfg.URLExpiry/2)
+
+	if err := errors.Join(l.errs...); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// MustLoad is Load for cold starts: a function without its configuration
+// cannot serve anything, so it logs the problem and exits.
+func MustLoad(ctx context.Context, required ...string) *Config {
+	cfg, err := Load(ctx, required...)
+	if err != nil {
+		logging.New().Error("Failed to load configuration", "error", err)
+		os.Exit(1)
+	}
+
+	return cfg
+}
+
+func gather(ctx context.Context) (map[string]string, error) {
+	values := map[string]string{}
+
+	if path := os.Getenv(fileEnv); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", fileEnv, err)
+		}
+
+		var fileValues map[string]string
+		if err := json.Unmarshal(data, &fileValues); err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+
+		for name, value := range fileValues {
+			values[name] = value
+		}
+	}
+
+	if path := os.Getenv(ssmPathEnv); path != "" {
+		parameters, err := ssmParameters(ctx, path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load SSM parameters under %s: %w", path, err)
+		}
+
+		for name, value := range parameters {
+			values[name] = value
+		}
+	}
+
+	for _, name := range settings {
+		// CDK passes unset optional settings through as empty strings
+		if value := os.Getenv(name); value != "" {
+			values[name] = value
+		}
+	}
+
+	return values, nil
+}
+
+// ssmParameters is replaced in tests, which cannot reach SSM.
+var ssmParameters = loadSSMParameters
+
+// loadSSMParameters reads every parameter under path, named by the rest of
+// its path, e.g. /blog/prod/DEFAULT_PAGE_SIZE.
+func loadSSMParameters(ctx context.Context, path string) (map[string]string, error) {
+	awsCfg, err := awsconfig.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	paginator := ssm.NewGetParametersByPathPaginator(ssm.NewFromConfig(awsCfg), &ssm.GetParametersByPathInput{
+		Path:           aws.String(path),
+		Recursive:      aws.Bool(true),
+		WithDecryption: aws.Bool(true),
+	})
+
+	values := map[string]string{}
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, parameter := range page.Parameters {
+			name := strings.Trim(strings.TrimPrefix(aws.ToString(parameter.Name), path), "/")
+			values[name] = aws.ToString(parameter.Value)
+		}
+	}
+
+	return values, nil
+}
+
+type loader struct {
+	values map[string]string
+	errs   []error
+}
+
+func (l *loader) string(name, fallback string) string {
+	if value := l.values[name]; value != "" {
+		return value
+	}
+	return fallback
+}
+
+// oneOf returns the setting if it is one of allowed, defaulting to the first.
+func (l *loader) oneOf(name string, allowed ...string) string {
+	value := l.values[name]
+	if value == "" {
+		return allowed[0]
+	}
+
+	if !slices.Contains(allowed, value) {
+		l.errs = append(l.errs, fmt.Errorf("%s must be one of %s, got %q", name, strings.Join(allowed, ", "), value))
+		return allowed[0]
+	}
+
+	return value
+}
+
+// url returns an absolute http or https URL, or "" if the setting is unset.
+func (l *loader) url(name string) string {
+	value := l.values[name]
+	if value == "" {
+		return ""
+	}
+
+	parsed, err := url.Parse(value)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		l.errs = append(l.errs, fmt.Errorf("%s must be an absolute http or https URL, got %q", name, value))
+		return ""
+	}
+
+	return value
+}
+
+// prefix returns a bucket prefix ending in "/". Post content lives under
+// posts/, so a prefix that could overlap it is rejected.
+func (l *loader) prefix(name, fallback string) string {
+	value := strings.Trim(l.string(name, fallback), "/") + "/"
+	if value == "/" || strings.HasPrefix("posts/", value) || strings.HasPrefix(value, "posts/") {
+		l.errs = append(l.errs, fmt.Errorf("%s must be a prefix outside posts/, got %q", name, l.values[name]))
+		return fallback
+	}
+
+	return value
+}
+
+func (l *loader) int(name string, fallback, minimum, maximum int) int {
+	value := l.values[name]
+	if value == "" {
+		return fallback
+	}
+
+	parsed, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || parsed < minimum || parsed > maximum {
+		l.errs = append(l.errs, fmt.Errorf("%s must be an integer from %d to %d, got %q", name, minimum, maximum, value))
+		return fallback
+	}
+
+	return parsed
+}
+
+func (l *loader) seconds(name string, fallback, minimum int) time.Duration {
+	return time.Duration(l.int(name, fallback, minimum, 7*24*60*60)) * time.Second
+}
+
+func (l *loader) list(name, sep string) []string {
+	var items []string
+	for _, item := range strings.Split(l.values[name], sep) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+func lowercase(items []string) []string {
+	for i, item := range items {
+		items[i] = strings.ToLower(item)
+	}
+	return items
+}
@@ -0,0 +1,225 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setup clears every setting from the environment, then sets env and points
+// CONFIG_FILE and CONFIG_SSM_PATH at file and ssm if they are given.
+func setup(t *testing.T, file, ssm, env map[string]string) {
+	t.Helper()
+
+	for _, name := range append(slices.Clone(settings), fileEnv, ssmPathEnv) {
+		t.Setenv(name, "")
+	}
+	for name, value := range env {
+		t.Setenv(name, value)
+	}
+
+	if file != nil {
+		data, err := json.Marshal(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(t.TempDir(), "config.json")
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		t.Setenv(fileEnv, path)
+	}
+
+	original := ssmParameters
+	t.Cleanup(func() { ssmParameters = original })
+	ssmParameters = func(ctx context.Context, path string) (map[string]string, error) {
+		t.Fatalf("read SSM parameters under %s without CONFIG_SSM_PATH set", path)
+		return nil, nil
+	}
+	if ssm != nil {
+		t.Setenv(ssmPathEnv, "/blog/test")
+		ssmParameters = func(ctx context.Context, path string) (map[string]string, error) {
+			return ssm, nil
+		}
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	tests := []struct {
+		name      string
+		file      map[string]string
+		ssm       map[string]string
+		env       map[string]string
+		wantTitle string
+	}{
+		{name: "default", wantTitle: "Blog"},
+		{name: "file", file: map[string]string{SiteTitle: "File"}, wantTitle: "File"},
+		{name: "SSM over the file", file: map[string]string{SiteTitle: "File"}, ssm: map[string]string{SiteTitle: "SSM"}, wantTitle: "SSM"},
+		{name: "environment over SSM", ssm: map[string]string{SiteTitle: "SSM"}, env: map[string]string{SiteTitle: "Env"}, wantTitle: "Env"},
+		{
+			name:      "empty environment value is unset",
+			file:      map[string]string{SiteTitle: "File"},
+			ssm:       map[string]string{},
+			env:       map[string]string{SiteTitle: ""},
+			wantTitle: "File",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setup(t, tt.file, tt.ssm, tt.env)
+
+			cfg, err := Load(context.Background())
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if cfg.Site.Title != tt.wantTitle {
+				t.Errorf("Site.Title = %q, want %q", cfg.Site.Title, tt.wantTitle)
+			}
+		})
+	}
+}
+
+func TestGatherReadsOnlySettingsFromTheEnvironment(t *testing.T) {
+	setup(t, nil, nil, map[string]string{BucketName: "bucket", "AWS_SECRET_ACCESS_KEY": "secret"})
+
+	values, err := gather(context.Background())
+	if err != nil {
+		t.Fatalf("gather() error = %v", err)
+	}
+	if len(values) != 1 || values[BucketName] != "bucket" {
+		t.Errorf("gather() = %v, want only %s", values, BucketName)
+	}
+}
+
+func TestLoadRequired(t *testing.T) {
+	setup(t, nil, nil, map[string]string{BucketName: "bucket"})
+
+	_, err := Load(context.Background(), BucketName, PostTableName, SiteURL)
+	if err == nil {
+		t.Fatal("Load() error = nil, want the missing settings")
+	}
+	for _, name := range []string{PostTableName, SiteURL} {
+		if !strings.Contains(err.Error(), name+" is required") {
+			t.Errorf("Load() error = %v, want %s reported", err, name)
+		}
+	}
+	if strings.Contains(err.Error(), BucketName) {
+		t.Errorf("Load() error = %v, reports %s which is set", err, BucketName)
+	}
+}
+
+func TestLoadPrefix(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{value: "", want: "site/"},
+		{value: "public", want: "public/"},
+		{value: "/public/site/", want: "public/site/"},
+		{value: "postscript", want: "postscript/"},
+		{value: "/", wantErr: true},
+		{value: "posts", wantErr: true},
+		{value: "posts/", wantErr: true},
+		{value: "posts/site", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			setup(t, nil, nil, map[string]string{SiteExportPrefix: tt.value})
+
+			cfg, err := Load(context.Background())
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), SiteExportPrefix) {
+					t.Errorf("Load() error = %v, want %s rejected", err, SiteExportPrefix)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if cfg.Site.ExportPrefix != tt.want {
+				t.Errorf("Site.ExportPrefix = %q, want %q", cfg.Site.ExportPrefix, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadInt(t *testing.T) {
+	tests := []struct {
+		name    string
+		setting string
+		value   string
+		get     func(*Config) int64
+		want    int64
+		wantErr bool
+	}{
+		{name: "page size default", setting: DefaultPageSize, get: pageSize, want: 20},
+		{name: "page size minimum", setting: DefaultPageSize, value: "1", get: pageSize, want: 1},
+		{name: "page size maximum", setting: DefaultPageSize, value: "100", get: pageSize, want: 100},
+		{name: "page size with spaces", setting: DefaultPageSize, value: " 50 ", get: pageSize, want: 50},
+		{name: "page size below minimum", setting: DefaultPageSize, value: "0", wantErr: true},
+		{name: "page size above maximum", setting: DefaultPageSize, value: "101", wantErr: true},
+		{name: "page size not a number", setting: DefaultPageSize, value: "ten", wantErr: true},
+		{name: "URL expiry minimum", setting: URLExpirySeconds, value: "1", get: urlExpiry, want: 1},
+		{name: "URL expiry of zero", setting: URLExpirySeconds, value: "0", wantErr: true},
+		{name: "URL expiry over a week", setting: URLExpirySeconds, value: "604801", wantErr: true},
+		{name: "cache max age of zero", setting: CacheMaxAgeSeconds, value: "0", get: cacheMaxAge, want: 0},
+		{name: "trash retention maximum", setting: TrashRetentionDays, value: "3650", get: trashRetentionDays, want: 3650},
+		{name: "trash retention above maximum", setting: TrashRetentionDays, value: "3651", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setup(t, nil, nil, map[string]string{tt.setting: tt.value})
+
+			cfg, err := Load(context.Background())
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), tt.setting+" must be an integer") {
+					t.Errorf("Load() error = %v, want %s rejected", err, tt.setting)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if got := tt.get(cfg); got != tt.want {
+				t.Errorf("%s = %d, want %d", tt.setting, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadReportsEveryInvalidValue(t *testing.T) {
+	setup(t, map[string]string{DefaultPageSize: "0"}, nil, map[string]string{SecretsProvider: "vault", SiteURL: "example.com"})
+
+	_, err := Load(context.Background())
+	for _, name := range []string{DefaultPageSize, SecretsProvider, SiteURL} {
+		if err == nil || !strings.Contains(err.Error(), name) {
+			t.Errorf("Load() error = %v, want %s reported", err, name)
+		}
+	}
+}
+
+func TestLoadCapsCacheMaxAge(t *testing.T) {
+	setup(t, nil, nil, map[string]string{URLExpirySeconds: "600", CacheMaxAgeSeconds: "3600"})
+
+	cfg, err := Load(context.Background())
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if cfg.CacheMaxAge != 5*time.Minute {
+		t.Errorf("CacheMaxAge = %v, want half the URL expiry", cfg.CacheMaxAge)
+	}
+}
+
+func pageSize(cfg *Config) int64           { return int64(cfg.DefaultPageSize) }
+func urlExpiry(cfg *Config) int64          { return int64(cfg.URLExpiry / time.Second) }
+func cacheMaxAge(cfg *Config) int64        { return int64(cfg.CacheMaxAge / time.Second) }
+func trashRetentionDays(cfg *Config) int64 { return int64(cfg.TrashRetention / (24 * time.Hour)) }
@@ -0,0 +1,65 @@
+package frontmatter
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const delimiter = "---"
+
+// Post is the front matter of a post's Markdown file. ID is empty until the
+// post is created; Slug defaults to the slug of the title.
+type Post struct {
+	ID      string   `yaml:"id,omitempty"`
+	Slug    string   `yaml:"slug,omitempty"`
+	Title   string   `yaml:"title"`
+	Summary string   `yaml:"summary"`
+	Tags    []string `yaml:"tags"`
+}
+
+// Parse decodes the YAML front matter of content into metadata and returns
+// the Markdown that follows it. Content without front matter is all body.
+func Parse(content []byte, metadata any) (string, error) {
+	text := strings.ReplaceAll(string(content), "\r\n", "\n")
+
+	rest, ok := strings.CutPrefix(text, delimiter+"\n")
+	if !ok {
+		return text, nil
+	}
+
+	header, body, ok := strings.Cut(rest, "\n"+delimiter+"\n")
+	if !ok {
+		header, ok = strings.CutSuffix(rest, "\n"+delimiter)
+		if !ok {
+			return "", fmt.Errorf("front matter is not closed by %s", delimiter)
+		}
+		body = ""
+	}
+
+	if err := yaml.Unmarshal([]byte(header), metadata); err != nil {
+		return "", fmt.Errorf("invalid front matter: %w", err)
+	}
+
+	return strings.TrimPrefix(body, "\n"), nil
+}
+
+// Format writes metadata as front matter followed by body.
+func Format(metadata any, body string) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteString(delimiter + "\n")
+
+	encoder := yaml.NewEncoder(&b)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(metadata); err != nil {
+		return nil, fmt.Errorf("failed to encode front matter: %w", err)
+	}
+	encoder.Close()
+
+	b.WriteString(delimiter + "\n\n")
+	b.WriteString(body)
+
+	return b.Bytes(), nil
+}
@@ -0,0 +1,155 @@
+package idempotencyservice
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/JaxonAdams/blog-backend/src/models"
+	idempotencymodel "github.com/JaxonAdams/blog-backend/src/models/idempotency"
+	"github.com/JaxonAdams/blog-backend/src/services/apperror"
+	"github.com/JaxonAdams/blog-backend/src/services/aws/dynamodb"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+const (
+	recordTTL      = 24 * time.Hour
+	MaxKeyLength   = 255
+	ReplayedHeader = "Idempotent-Replayed"
+)
+
+// A claim is held until just after the invocation that made it times out,
+// so it is only taken over once that invocation can no longer finish
+const (
+	leaseMargin = 5 * time.Second
+	// Used when the context has no deadline, e.g. outside Lambda
+	defaultLease = 30 * time.Second
+)
+
+// Begin claims key for a request with the given body. It returns the stored
+// response when the request has already been handled, or nil when the caller
+// now owns the key and must call Complete or Release. A claim whose lease has
+// run out, because its invocation timed out or crashed, is taken over.
+func Begin(key, body string, services models.HandlerServices, ctx context.Context) (*events.APIGatewayProxyResponse, error) {
+	now := time.Now()
+	requestHash := hashBody(body)
+
+	record := idempotencymodel.IdempotencyRecord{
+		Key:         key,
+		RequestHash: requestHash,
+		Status:      idempotencymodel.StatusInProgress,
+		CreatedAt:   now.UnixMilli(),
+		ExpiresAt:   now.Add(recordTTL).Unix(),
+		// Lambda sets the deadline from the function's timeout
+		LeaseExpiresAt: leaseExpiry(now, ctx).UnixMilli(),
+	}
+
+	err := services.DynamoDBService.PutIdempotencyRecord(record, true, ctx)
+	if err == nil {
+		return nil, nil
+	}
+
+	var conditionErr dynamodb.ErrCodeConditionFailed
+	if !errors.As(err, &conditionErr) {
+		return nil, err
+	}
+
+	// Someone has used this key before, so compare against what they sent
+	existing, err := services.DynamoDBService.GetIdempotencyRecord(key, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if existing.RequestHash != requestHash {
+		return nil, ErrCodeKeyReused{Msg: "Idempotency-Key has already been used with a different request body"}
+	}
+
+	if existing.Status != idempotencymodel.StatusCompleted {
+		return nil, ErrCodeInProgress{
+			Msg:        "a request with this Idempotency-Key is still being processed",
+			RetryAfter: time.UnixMilli(existing.LeaseExpiresAt).Sub(now),
+		}
+	}
+
+	headers := map[string]string{}
+	for k, v := range existing.ResponseHeaders {
+		headers[k] = v
+	}
+	headers[ReplayedHeader] = "true"
+
+	return &events.APIGatewayProxyResponse{
+		StatusCode: existing.ResponseStatus,
+		Headers:    headers,
+		Body:       existing.ResponseBody,
+	}, nil
+}
+
+func Complete(key, body string, response events.APIGatewayProxyResponse, services models.HandlerServices, ctx context.Context) error {
+	now := time.Now()
+
+	record := idempotencymodel.IdempotencyRecord{
+		Key:             key,
+		RequestHash:     hashBody(body),
+		Status:          idempotencymodel.StatusCompleted,
+		ResponseStatus:  response.StatusCode,
+		ResponseBody:    response.Body,
+		ResponseHeaders: response.Headers,
+		CreatedAt:       now.UnixMilli(),
+		ExpiresAt:       now.Add(recordTTL).Unix(),
+	}
+
+	return services.DynamoDBService.PutIdempotencyRecord(record, false, ctx)
+}
+
+// Release gives up a claimed key so that a retry can run the request again.
+func Release(key string, services models.HandlerServices, ctx context.Context) error {
+	return services.DynamoDBService.DeleteIdempotencyRecord(key, ctx)
+}
+
+func leaseExpiry(now time.Time, ctx context.Context) time.Time {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = now.Add(defaultLease)
+	}
+	return deadline.Add(leaseMargin)
+}
+
+func hashBody(body string) string {
+	sum := sha256.Sum256([]byte(body))
+	return hex.EncodeToString(sum[:])
+}
+
+type ErrCodeKeyReused struct {
+	Msg string
+}
+
+func (e ErrCodeKeyReused) Error() string {
+	return e.Msg
+}
+
+func (e ErrCodeKeyReused) ErrorCode() apperror.Code {
+	return apperror.CodeIdempotencyKeyReused
+}
+
+type ErrCodeInProgress struct {
+	Msg string
+	// Time left on the claim's lease; a retry after it takes the claim over
+	RetryAfter time.Duration
+}
+
+func (e ErrCodeInProgress) Error() string {
+	return e.Msg
+}
+
+func (e ErrCodeInProgress) ErrorCode() apperror.Code {
+	return apperror.CodeRequestInProgress
+}
+
+func (e ErrCodeInProgress) ProblemHeaders() map[string]string {
+	seconds := int64(math.Ceil(e.RetryAfter.Seconds()))
+	return map[string]string{"Retry-After": strconv.FormatInt(max(seconds, 1), 10)}
+}
@@ -0,0 +1,169 @@
+package idempotencyservice
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/JaxonAdams/blog-backend/src/models"
+	idempotencymodel "github.com/JaxonAdams/blog-backend/src/models/idempotency"
+	"github.com/JaxonAdams/blog-backend/src/services/aws/dynamodb"
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// recordStore keeps records in memory, claiming keys on the same terms as
+// the table's condition expression.
+type recordStore struct {
+	dynamodb.Store
+	records map[string]idempotencymodel.IdempotencyRecord
+}
+
+func (s *recordStore) GetIdempotencyRecord(key string, ctx context.Context) (idempotencymodel.IdempotencyRecord, error) {
+	record, ok := s.records[key]
+	if !ok {
+		return idempotencymodel.IdempotencyRecord{}, dynamodb.ErrCodeNotFound{Msg: key}
+	}
+	return record, nil
+}
+
+func (s *recordStore) PutIdempotencyRecord(record idempotencymodel.IdempotencyRecord, claim bool, ctx context.Context) error {
+	existing, ok := s.records[record.Key]
+	if claim && ok {
+		now := time.Now()
+		expired := existing.ExpiresAt < now.Unix()
+		abandoned := existing.Status == idempotencymodel.StatusInProgress &&
+			existing.RequestHash == record.RequestHash &&
+			existing.LeaseExpiresAt < now.UnixMilli()
+		if !expired && !abandoned {
+			return dynamodb.ErrCodeConditionFailed{Msg: record.Key}
+		}
+	}
+	s.records[record.Key] = record
+	return nil
+}
+
+func (s *recordStore) DeleteIdempotencyRecord(key string, ctx context.Context) error {
+	delete(s.records, key)
+	return nil
+}
+
+func TestBegin(t *testing.T) {
+	const key = "posts.create:admin:key-1"
+	const body = `{"title":"Hello"}`
+	created := events.APIGatewayProxyResponse{
+		StatusCode: 201,
+		Headers:    map[string]string{"Content-Type": "application/json", "ETag": `"1"`},
+		Body:       `{"post":{"id":"post-1"}}`,
+	}
+
+	claimed := func(lease time.Duration) idempotencymodel.IdempotencyRecord {
+		now := time.Now()
+		return idempotencymodel.IdempotencyRecord{
+			Key:            key,
+			RequestHash:    hashBody(body),
+			Status:         idempotencymodel.StatusInProgress,
+			CreatedAt:      now.UnixMilli(),
+			ExpiresAt:      now.Add(recordTTL).Unix(),
+			LeaseExpiresAt: now.Add(lease).UnixMilli(),
+		}
+	}
+
+	tests := []struct {
+		name string
+		// Stored before the request, if set
+		existing *idempotencymodel.IdempotencyRecord
+		// Completes the existing claim with created before the request
+		completed  bool
+		body       string
+		wantReplay bool
+		wantErr    error
+	}{
+		{name: "unused key is claimed", body: body},
+		{name: "completed request is replayed", existing: ptr(claimed(time.Minute)), completed: true, body: body, wantReplay: true},
+		{name: "different body", existing: ptr(claimed(time.Minute)), completed: true, body: `{"title":"Other"}`, wantErr: ErrCodeKeyReused{}},
+		{name: "claim in progress", existing: ptr(claimed(time.Minute)), body: body, wantErr: ErrCodeInProgress{}},
+		{name: "claim past its lease is taken over", existing: ptr(claimed(-time.Second)), body: body},
+		{name: "claim past its lease with a different body", existing: ptr(claimed(-time.Second)), body: `{"title":"Other"}`, wantErr: ErrCodeKeyReused{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &recordStore{records: map[string]idempotencymodel.IdempotencyRecord{}}
+			services := models.HandlerServices{DynamoDBService: store}
+			if tt.existing != nil {
+				store.records[key] = *tt.existing
+			}
+			if tt.completed {
+				if err := Complete(key, body, created, services, context.Background()); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			replay, err := Begin(key, tt.body, services, context.Background())
+
+			switch want := tt.wantErr.(type) {
+			case ErrCodeKeyReused:
+				if !errors.As(err, &want) {
+					t.Fatalf("Begin() error = %v, want ErrCodeKeyReused", err)
+				}
+				return
+			case ErrCodeInProgress:
+				if !errors.As(err, &want) {
+					t.Fatalf("Begin() error = %v, want ErrCodeInProgress", err)
+				}
+				if want.RetryAfter <= 0 || want.RetryAfter > time.Minute {
+					t.Errorf("RetryAfter = %v, want the time left on the lease", want.RetryAfter)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Begin() error = %v", err)
+			}
+
+			if !tt.wantReplay {
+				if replay != nil {
+					t.Fatalf("Begin() = %+v, want the key claimed", replay)
+				}
+				record := store.records[key]
+				if record.Status != idempotencymodel.StatusInProgress || record.LeaseExpiresAt <= time.Now().UnixMilli() {
+					t.Errorf("record = %+v, want a fresh claim", record)
+				}
+				return
+			}
+
+			if replay == nil {
+				t.Fatal("Begin() = nil, want the stored response")
+			}
+			if replay.StatusCode != created.StatusCode || replay.Body != created.Body || replay.Headers["ETag"] != created.Headers["ETag"] {
+				t.Errorf("Begin() = %+v, want %+v", replay, created)
+			}
+			if replay.Headers[ReplayedHeader] != "true" {
+				t.Errorf("%s header = %q, want true", ReplayedHeader, replay.Headers[ReplayedHeader])
+			}
+			if _, ok := created.Headers[ReplayedHeader]; ok {
+				t.Errorf("replay changed the stored headers")
+			}
+		})
+	}
+}
+
+func TestReleaseLetsARetryRun(t *testing.T) {
+	const key = "posts.create:admin:key-1"
+	store := &recordStore{records: map[string]idempotencymodel.IdempotencyRecord{}}
+	services := models.HandlerServices{DynamoDBService: store}
+
+	if replay, err := Begin(key, "{}", services, context.Background()); replay != nil || err != nil {
+		t.Fatalf("Begin() = %v, %v, want the key claimed", replay, err)
+	}
+	if err := Release(key, services, context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if replay, err := Begin(key, "{}", services, context.Background()); replay != nil || err != nil {
+		t.Errorf("Begin() after Release = %v, %v, want the key claimed", replay, err)
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,161 @@
+package importservice
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+type ghostExport struct {
+	DB   []struct{ Data ghostData } `json:"db"`
+	Data *ghostData                 `json:"data"`
+}
+
+type ghostData struct {
+	Posts     []ghostPost `json:"posts"`
+	Tags      []ghostTag  `json:"tags"`
+	PostsTags []struct {
+		PostID ghostID `json:"post_id"`
+		TagID  ghostID `json:"tag_id"`
+	} `json:"posts_tags"`
+}
+
+type ghostPost struct {
+	ID              ghostID         `json:"id"`
+	Title           string          `json:"title"`
+	Slug            string          `json:"slug"`
+	HTML            string          `json:"html"`
+	Markdown        string          `json:"markdown"`
+	Type            string          `json:"type"`
+	Page            json.RawMessage `json:"page"`
+	Status          string          `json:"status"`
+	Visibility      string          `json:"visibility"`
+	CustomExcerpt   string          `json:"custom_excerpt"`
+	MetaDescription string          `json:"meta_description"`
+	PublishedAt     json.RawMessage `json:"published_at"`
+	CreatedAt       json.RawMessage `json:"created_at"`
+	UpdatedAt       json.RawMessage `json:"updated_at"`
+}
+
+type ghostTag struct {
+	ID   ghostID `json:"id"`
+	Name string  `json:"name"`
+}
+
+// ghostID is an object id: a string, or a number in Ghost 0.x exports.
+type ghostID string
+
+func (id *ghostID) UnmarshalJSON(data []byte) error {
+	var number json.Number
+	if err := json.Unmarshal(data, &number); err == nil {
+		*id = ghostID(number)
+		return nil
+	}
+	return json.Unmarshal(data, (*string)(id))
+}
+
+// Marks raw HTML the author pasted into the Ghost editor
+const ghostHTMLCard = "<!--kg-card-begin: html-->"
+
+// ReadGhost converts the published posts in a Ghost JSON export, from the
+// Ghost admin's Labs page. Internal tags, whose names start with "#", are
+// dropped.
+func ReadGhost(r io.Reader, options Options) (Result, error) {
+	var export ghostExport
+	if err := json.NewDecoder(r).Decode(&export); err != nil {
+		return Result{}, ErrCodeInvalidExport{Msg: fmt.Sprintf("invalid Ghost export: %v", err)}
+	}
+
+	var data ghostData
+	switch {
+	case len(export.DB) > 0:
+		data = export.DB[0].Data
+	case export.Data != nil:
+		data = *export.Data
+	default:
+		return Result{}, ErrCodeInvalidExport{Msg: "invalid Ghost export: no db or data section"}
+	}
+
+	tagNames := map[ghostID]string{}
+	for _, tag := range data.Tags {
+		tagNames[tag.ID] = tag.Name
+	}
+	postTags := map[ghostID][]string{}
+	for _, link := range data.PostsTags {
+		if name, ok := tagNames[link.TagID]; ok && !strings.HasPrefix(name, "#") {
+			postTags[link.PostID] = append(postTags[link.PostID], name)
+		}
+	}
+
+	var result Result
+	for _, post := range data.Posts {
+		source := "ghost post " + post.Slug
+
+		switch {
+		case post.Type == "page" || string(post.Page) == "true" || string(post.Page) == "1":
+			result.skip(source, "%q is a page, not a post", post.Title)
+			continue
+		case post.Status != "published":
+			result.skip(source, "%q is %s, not published", post.Title, post.Status)
+			continue
+		case post.Visibility != "" && post.Visibility != "public":
+			result.note(source, "was visible to %s only; it will be public", post.Visibility)
+		}
+
+		e := entry{
+			source:   source,
+			title:    post.Title,
+			summary:  post.CustomExcerpt,
+			tags:     postTags[post.ID],
+			created:  ghostDate(post.PublishedAt),
+			modified: ghostDate(post.UpdatedAt),
+		}
+		if e.summary == "" {
+			e.summary = post.MetaDescription
+		}
+		if e.created.IsZero() {
+			e.created = ghostDate(post.CreatedAt)
+		}
+
+		switch {
+		case post.HTML != "":
+			e.body = post.HTML
+			e.isHTML = true
+			if strings.Contains(post.HTML, ghostHTMLCard) {
+				result.note(source, "has an HTML card; check it converted as intended")
+			}
+		case post.Markdown != "":
+			// Ghost 0.x kept the Markdown itself
+			e.body = post.Markdown
+		default:
+			result.skip(source, "%q has no HTML; export it again from a Ghost version that renders posts", post.Title)
+			continue
+		}
+
+		result.add(e, options)
+	}
+
+	return result, nil
+}
+
+// ghostDate reads an RFC 3339 date, or the Unix milliseconds of old exports.
+func ghostDate(raw json.RawMessage) time.Time {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		if t, err := time.Parse(time.RFC3339, s); err == nil {
+			return t.UTC()
+		}
+		if t, err := time.Parse("2006-01-02 15:04:05", s); err == nil {
+			return t
+		}
+		return time.Time{}
+	}
+
+	var ms int64
+	if err := json.Unmarshal(raw, &ms); err == nil && ms > 0 {
+		return time.UnixMilli(ms).UTC()
+	}
+	return time.Time{}
+}
@@ -0,0 +1,343 @@
+package importservice
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/JaxonAdams/blog-backend/src/helpers"
+	"github.com/JaxonAdams/blog-backend/src/models"
+	postmodel "github.com/JaxonAdams/blog-backend/src/models/posts"
+	"github.com/JaxonAdams/blog-backend/src/services/apperror"
+	"github.com/JaxonAdams/blog-backend/src/services/markdown"
+	postservice "github.com/JaxonAdams/blog-backend/src/services/post"
+)
+
+// Limits from CreatePostInput's validation
+const (
+	maxTitleLength   = 200
+	maxSummaryLength = 500
+	maxTags          = 10
+	maxTagLength     = 32
+	maxContentLength = 1000000
+)
+
+// Generated summaries stop at a word boundary near this length
+const generatedSummaryLength = 280
+
+type Options struct {
+	// Renames categories and tags, by name or slug, before they are turned
+	// into tags. Mapping to "" drops them.
+	TagMap map[string]string
+	// Given to posts that end up with no tags, as every post needs one
+	DefaultTag string
+}
+
+type Status string
+
+const (
+	StatusReady   Status = "ready"
+	StatusCreated Status = "created"
+	// A post with the same slug exists, e.g. from an earlier run
+	StatusExists Status = "exists"
+	StatusFailed Status = "failed"
+)
+
+// Post is a post converted from another blog, ready to be created.
+type Post struct {
+	// Where it came from, e.g. a file path or "wordpress post 12"
+	Source     string                 `json:"source"`
+	Input      models.CreatePostInput `json:"-"`
+	CreatedAt  time.Time              `json:"created_at"`
+	ModifiedAt time.Time              `json:"modified_at"`
+	Status     Status                 `json:"status"`
+	PostID     string                 `json:"post_id,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+
+	// The created post, for audit entries
+	Created *postmodel.Post `json:"-"`
+}
+
+// Issue is something that could not be converted faithfully. Skipped issues
+// mean the item was not imported at all.
+type Issue struct {
+	Source  string `json:"source"`
+	Message string `json:"message"`
+	Skipped bool   `json:"skipped"`
+}
+
+type Result struct {
+	Posts  []Post  `json:"posts"`
+	Issues []Issue `json:"issues"`
+}
+
+func (r *Result) note(source, format string, args ...any) {
+	r.Issues = append(r.Issues, Issue{Source: source, Message: fmt.Sprintf(format, args...)})
+}
+
+func (r *Result) skip(source, format string, args ...any) {
+	r.Issues = append(r.Issues, Issue{Source: source, Message: fmt.Sprintf(format, args...), Skipped: true})
+}
+
+// entry is a post as read from an export, before conversion.
+type entry struct {
+	source   string
+	title    string
+	summary  string
+	body     string
+	isHTML   bool
+	tags     []string
+	created  time.Time
+	modified time.Time
+	// Template syntax of the source platform, e.g. Hugo shortcodes, with
+	// the name captured
+	shortcodes *regexp.Regexp
+}
+
+var (
+	markdownLink   = regexp.MustCompile(`!?\[([^\]]*)\]\([^)]*\)`)
+	markdownMarker = regexp.MustCompile(`[*_~#>` + "`" + `\\]+`)
+)
+
+// add converts e into a post, noting anything lost on the way, or skips it
+// if it cannot become a valid post.
+func (r *Result) add(e entry, options Options) {
+	body := e.body
+	if e.isHTML {
+		var unsupported []string
+		body, unsupported = markdown.HTMLToMd(e.body)
+		if len(unsupported) > 0 {
+			r.note(e.source, "dropped HTML it could not convert: <%s>", strings.Join(unsupported, ">, <"))
+		}
+	}
+	body = strings.TrimSpace(body)
+
+	if e.shortcodes != nil {
+		var names []string
+		for _, match := range e.shortcodes.FindAllStringSubmatch(e.body, -1) {
+			// The name is in whichever group matched
+			for _, name := range match[1:] {
+				if name != "" && !slices.Contains(names, name) {
+					names = append(names, name)
+				}
+			}
+		}
+		if len(names) > 0 {
+			r.note(e.source, "left shortcodes as text: %s", strings.Join(names, ", "))
+		}
+	}
+
+	title := strings.TrimSpace(e.title)
+	switch {
+	case title == "":
+		r.skip(e.source, "has no title")
+		return
+	case body == "":
+		r.skip(e.source, "has no content")
+		return
+	case utf8.RuneCountInString(body) > maxContentLength:
+		r.skip(e.source, "content is longer than %d characters", maxContentLength)
+		return
+	}
+
+	if utf8.RuneCountInString(title) > maxTitleLength {
+		title = truncate(title, maxTitleLength)
+		r.note(e.source, "title shortened to %d characters", maxTitleLength)
+	}
+
+	summary := strings.Join(strings.Fields(e.summary), " ")
+	if summary == "" {
+		summary = summarize(body)
+		r.note(e.source, "has no excerpt; summary taken from the first paragraph")
+	}
+	if utf8.RuneCountInString(summary) > maxSummaryLength {
+		summary = truncate(summary, maxSummaryLength)
+		r.note(e.source, "summary shortened to %d characters", maxSummaryLength)
+	}
+
+	tags := r.tags(e, options)
+
+	created, modified := e.created, e.modified
+	if created.IsZero() {
+		r.note(e.source, "has no publish date; the import time will be used")
+	}
+	if modified.Before(created) {
+		modified = created
+	}
+
+	post := Post{
+		Source: e.source,
+		Input: models.CreatePostInput{
+			Title:   title,
+			Summary: summary,
+			Tags:    tags,
+			Content: body + "\n",
+		},
+		CreatedAt:  created,
+		ModifiedAt: modified,
+		Status:     StatusReady,
+	}
+
+	if err := helpers.ValidateInput(post.Input); err != nil {
+		var problems []string
+		for _, field := range apperror.FieldsOf(err) {
+			problems = append(problems, field.Field+" "+field.Message)
+		}
+		r.skip(e.source, "is not a valid post: %s", strings.Join(problems, "; "))
+		return
+	}
+
+	r.Posts = append(r.Posts, post)
+}
+
+// tags maps categories and tags to tag slugs, within the limits posts allow.
+func (r *Result) tags(e entry, options Options) []string {
+	var tags []string
+	for _, name := range e.tags {
+		name = strings.TrimSpace(name)
+		if mapped, ok := options.TagMap[name]; ok {
+			name = mapped
+		} else if mapped, ok := options.TagMap[postmodel.Slugify(name)]; ok {
+			name = mapped
+		}
+		if name == "" {
+			continue
+		}
+
+		tag := postmodel.Slugify(name)
+		if tag == "" {
+			r.note(e.source, "dropped tag %q, which has no letters or digits", name)
+			continue
+		}
+		if len(tag) > maxTagLength {
+			// Cut at a word where there is one. The character past the
+			// limit tells whether the last word fits whole.
+			if i := strings.LastIndex(tag[:maxTagLength+1], "-"); i > maxTagLength/2 {
+				tag = tag[:i]
+			} else {
+				tag = tag[:maxTagLength]
+			}
+			tag = strings.TrimRight(tag, "-")
+			r.note(e.source, "tag %q shortened to %q", name, tag)
+		}
+		if !slices.Contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+
+	if len(tags) > maxTags {
+		r.note(e.source, "kept the first %d of %d tags; dropped %s", maxTags, len(tags), strings.Join(tags[maxTags:], ", "))
+		tags = tags[:maxTags]
+	}
+
+	if len(tags) == 0 && options.DefaultTag != "" {
+		tags = []string{options.DefaultTag}
+		r.note(e.source, "has no tags; tagged %q", options.DefaultTag)
+	}
+
+	return tags
+}
+
+// summarize takes the first paragraph of plain prose from Markdown.
+func summarize(body string) string {
+	for _, paragraph := range strings.Split(body, "\n\n") {
+		paragraph = strings.TrimSpace(paragraph)
+		if paragraph == "" || strings.HasPrefix(paragraph, "#") || strings.HasPrefix(paragraph, "```") || strings.HasPrefix(paragraph, "|") {
+			continue
+		}
+
+		text := markdownLink.ReplaceAllString(paragraph, "$1")
+		text = markdownMarker.ReplaceAllString(text, "")
+		text = strings.Join(strings.Fields(text), " ")
+		if text != "" {
+			return truncate(text, generatedSummaryLength)
+		}
+	}
+	return ""
+}
+
+// truncate shortens s to at most limit characters, at a word boundary where
+// there is one, ending with an ellipsis.
+func truncate(s string, limit int) string {
+	runes := []rune(s)
+	if len(runes) <= limit {
+		return s
+	}
+
+	// Keep the last word if it ends right at the cut
+	cut := string(runes[:limit-1])
+	if runes[limit-1] != ' ' {
+		if i := strings.LastIndex(cut, " "); i > len(cut)/2 {
+			cut = cut[:i]
+		}
+	}
+	return strings.TrimRight(cut, " ,.;:") + "…"
+}
+
+// Apply creates the posts in order of publication. Posts whose slug, or
+// title if it has no slug, is already taken are left alone, so running an
+// import again does not duplicate it.
+func Apply(result *Result, services models.HandlerServices, ctx context.Context) error {
+	existing, err := services.DynamoDBService.GetAllActivePosts(ctx)
+	if err != nil {
+		return err
+	}
+
+	slugs := map[string]string{}
+	for _, post := range existing {
+		slugs[dedupKey(post.Title)] = post.ID
+	}
+
+	sort.SliceStable(result.Posts, func(i, j int) bool { return result.Posts[i].CreatedAt.Before(result.Posts[j].CreatedAt) })
+
+	var failed int
+	for i := range result.Posts {
+		post := &result.Posts[i]
+
+		slug := dedupKey(post.Input.Title)
+		if id, ok := slugs[slug]; ok {
+			post.Status = StatusExists
+			post.PostID = id
+			continue
+		}
+
+		createdAt, modifiedAt := post.CreatedAt, post.ModifiedAt
+		if createdAt.IsZero() {
+			createdAt = time.Now()
+			modifiedAt = createdAt
+		}
+
+		created, err := postservice.ImportPost(post.Input, createdAt, modifiedAt, services, ctx)
+		if err != nil {
+			services.Logger.Error("Failed to import post", "source", post.Source, "error", err)
+			post.Status = StatusFailed
+			post.Error = err.Error()
+			failed++
+			continue
+		}
+
+		post.Status = StatusCreated
+		post.PostID = created.ID
+		post.Created = &created
+		slugs[slug] = created.ID
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d posts failed to import", failed, len(result.Posts))
+	}
+	return nil
+}
+
+// dedupKey is the slug of a title. Titles with no ASCII letters or digits
+// have no slug, so they are told apart by the title itself.
+func dedupKey(title string) string {
+	if slug := postmodel.Slugify(title); slug != "" {
+		return slug
+	}
+	return "title:" + strings.TrimSpace(title)
+}
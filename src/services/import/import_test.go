@@ -0,0 +1,450 @@
+package importservice
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/JaxonAdams/blog-backend/src/models"
+	postmodel "github.com/JaxonAdams/blog-backend/src/models/posts"
+	"github.com/JaxonAdams/blog-backend/src/services/aws/dynamodb"
+	"github.com/JaxonAdams/blog-backend/src/services/aws/s3"
+)
+
+// fromFile reads an export from testdata with read.
+func fromFile(read func(io.Reader, Options) (Result, error), name string) func(Options) (Result, error) {
+	return func(options Options) (Result, error) {
+		file, err := os.Open(filepath.Join("testdata", name))
+		if err != nil {
+			return Result{}, err
+		}
+		defer file.Close()
+		return read(file, options)
+	}
+}
+
+func fromDir(read func(string, Options) (Result, error), name string) func(Options) (Result, error) {
+	return func(options Options) (Result, error) {
+		return read(filepath.Join("testdata", name), options)
+	}
+}
+
+func ready(source string, input models.CreatePostInput, created, modified time.Time) Post {
+	return Post{Source: source, Input: input, CreatedAt: created, ModifiedAt: modified, Status: StatusReady}
+}
+
+func date(value string) time.Time {
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestReaders(t *testing.T) {
+	tests := []struct {
+		name    string
+		read    func(Options) (Result, error)
+		options Options
+		want    Result
+	}{
+		{
+			name:    "WordPress",
+			read:    fromFile(ReadWordPress, "wordpress.xml"),
+			options: Options{TagMap: map[string]string{"uncategorized": "", "Go": "golang"}},
+			want: Result{
+				Posts: []Post{
+					ready("wordpress post 10", models.CreatePostInput{
+						Title:   "Classic editor post",
+						Summary: "An excerpt over two lines.",
+						Tags:    []string{"golang", "web-development"},
+						Content: "First paragraph  \nwith a line break.\n\n" +
+							`\[gallery ids="1,2,3"\]` + "\n\n" +
+							`\[caption id="attachment\_4" width="300"\]![A cat](https://example.com/cat.jpg) A cat\[/caption\]` + "\n\n" +
+							"- Item\n",
+					}, date("2019-03-05T14:30:00Z"), date("2019-04-01T09:00:00Z")),
+					ready("wordpress post 11", models.CreatePostInput{
+						Title:   "Block editor post",
+						Summary: "Already has paragraphs. And no breaks.",
+						Tags:    []string{"a-very-long-tag-name-that-goes"},
+						Content: "Already has paragraphs. And no breaks.\n",
+					}, date("2019-03-06T10:00:00Z"), date("2019-03-06T10:00:00Z")),
+				},
+				Issues: []Issue{
+					{Source: "wordpress post 10", Message: "left shortcodes as text: gallery, caption"},
+					{Source: "wordpress post 11", Message: "has no excerpt; summary taken from the first paragraph"},
+					{Source: "wordpress post 11", Message: `tag "A very long tag name that goes past the limit" shortened to "a-very-long-tag-name-that-goes"`},
+					{Source: "wordpress post 12", Message: `"Draft" is draft, not published`, Skipped: true},
+					{Source: "wordpress page 13", Message: `"About" is a page, not a post`, Skipped: true},
+					{Source: "wordpress post 14", Message: `"Members only" is password protected`, Skipped: true},
+				},
+			},
+		},
+		{
+			name: "Ghost",
+			read: fromFile(ReadGhost, "ghost.json"),
+			want: Result{
+				Posts: []Post{
+					ready("ghost post current-export", models.CreatePostInput{
+						Title:   "Current export",
+						Summary: "From the meta description",
+						Tags:    []string{"getting-started", "news"},
+						Content: "Hello from **Ghost**.\n\nRaw\n",
+					}, date("2023-06-01T08:15:00Z"), date("2023-06-02T10:00:00Z")),
+				},
+				Issues: []Issue{
+					{Source: "ghost post current-export", Message: "was visible to members only; it will be public"},
+					{Source: "ghost post current-export", Message: "has an HTML card; check it converted as intended"},
+					{Source: "ghost post about", Message: `"About" is a page, not a post`, Skipped: true},
+					{Source: "ghost post unfinished", Message: `"Unfinished" is draft, not published`, Skipped: true},
+				},
+			},
+		},
+		{
+			name:    "Ghost 0.x with millisecond dates",
+			read:    fromFile(ReadGhost, "ghost-legacy.json"),
+			options: Options{DefaultTag: "imported"},
+			want: Result{
+				Posts: []Post{
+					ready("ghost post legacy-export", models.CreatePostInput{
+						Title:   "Legacy export",
+						Summary: "Kept as Markdown",
+						Tags:    []string{"imported"},
+						Content: "Written in *Ghost 0.x*.\n",
+					}, date("2015-01-01T00:00:00Z"), date("2015-01-02T00:00:00.123Z")),
+				},
+				Issues: []Issue{
+					{Source: "ghost post legacy-export", Message: `has no tags; tagged "imported"`},
+					{Source: "ghost post old-page", Message: `"Old page" is a page, not a post`, Skipped: true},
+				},
+			},
+		},
+		{
+			name: "Hugo",
+			read: fromDir(ReadHugo, "hugo"),
+			want: Result{
+				Posts: []Post{
+					ready("hugo posts/toml.md", models.CreatePostInput{
+						Title:   "TOML front matter",
+						Summary: "The manual summary.",
+						Tags:    []string{"hugo", "static-sites", "notes"},
+						Content: "The manual summary.\n\n{{< youtube abc123 >}}\n\nRest of the post with {{% note %}}a note{{% /note %}}.\n",
+					}, date("2021-02-03T04:05:06Z"), date("2021-03-01T00:00:00Z")),
+					ready("hugo posts/yaml.md", models.CreatePostInput{
+						Title:   "YAML front matter",
+						Summary: "From the description",
+						Tags:    []string{"single"},
+						Content: "Body text.\n",
+					}, date("2021-05-06T07:08:09Z"), date("2021-05-06T07:08:09Z")),
+				},
+				Issues: []Issue{
+					{Source: "hugo posts/draft.md", Message: "is a draft", Skipped: true},
+					{Source: "hugo posts/toml.md", Message: "left shortcodes as text: youtube, note"},
+				},
+			},
+		},
+		{
+			name: "Jekyll",
+			read: fromDir(ReadJekyll, "jekyll"),
+			want: Result{
+				Posts: []Post{
+					ready("jekyll _posts/2020-01-02-from-the-file-name.md", models.CreatePostInput{
+						Title:   "from the file name",
+						Summary: "Uses {% highlight ruby %}puts 1{% endhighlight %} and {{ site.title }}.",
+						Tags:    []string{"ruby", "jekyll", "blogging"},
+						Content: "Uses {% highlight ruby %}puts 1{% endhighlight %} and {{ site.title }}.\n",
+					}, date("2020-01-02T00:00:00Z"), date("2020-01-02T00:00:00Z")),
+					ready("jekyll _posts/2020-02-03-json.html", models.CreatePostInput{
+						Title:   "JSON front matter",
+						Summary: "From the excerpt",
+						Tags:    []string{"html"},
+						Content: "Written in *HTML*.\n",
+					}, date("2020-02-04T09:00:00Z"), date("2020-02-04T09:00:00Z")),
+				},
+				Issues: []Issue{
+					{Source: "jekyll _posts/2020-01-02-from-the-file-name.md", Message: `has no title; using "from the file name" from its file name`},
+					{Source: "jekyll _posts/2020-01-02-from-the-file-name.md", Message: "left shortcodes as text: highlight, endhighlight, site.title"},
+					{Source: "jekyll _posts/2020-01-02-from-the-file-name.md", Message: "has no excerpt; summary taken from the first paragraph"},
+					{Source: "jekyll _posts/2020-03-04-hidden.md", Message: "is not published", Skipped: true},
+				},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.read(tt.options)
+			if err != nil {
+				t.Fatalf("read error = %v", err)
+			}
+
+			if len(got.Posts) != len(tt.want.Posts) {
+				t.Errorf("got %d posts, want %d", len(got.Posts), len(tt.want.Posts))
+			}
+			for i := range min(len(got.Posts), len(tt.want.Posts)) {
+				if !reflect.DeepEqual(got.Posts[i], tt.want.Posts[i]) {
+					t.Errorf("post %d =\n%+v\nwant\n%+v", i, got.Posts[i], tt.want.Posts[i])
+				}
+			}
+			if !reflect.DeepEqual(got.Issues, tt.want.Issues) {
+				t.Errorf("issues =\n%+v\nwant\n%+v", got.Issues, tt.want.Issues)
+			}
+		})
+	}
+}
+
+func TestGhostDate(t *testing.T) {
+	tests := []struct {
+		raw  string
+		want time.Time
+	}{
+		{raw: `"2023-06-01T08:15:00.000Z"`, want: date("2023-06-01T08:15:00Z")},
+		{raw: `"2023-06-01T10:15:00+02:00"`, want: date("2023-06-01T08:15:00Z")},
+		{raw: `"2014-12-31 23:59:59"`, want: date("2014-12-31T23:59:59Z")},
+		{raw: `1420070400000`, want: date("2015-01-01T00:00:00Z")},
+		{raw: `1420070400999`, want: date("2015-01-01T00:00:00.999Z")},
+		{raw: `0`},
+		{raw: `null`},
+		{raw: `"soon"`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			if got := ghostDate(json.RawMessage(tt.raw)); !got.Equal(tt.want) {
+				t.Errorf("ghostDate(%s) = %v, want %v", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAutop(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{
+			name:    "blank lines separate paragraphs",
+			content: "One\r\n\r\nTwo\n  \nThree",
+			want:    "<p>One</p>\n<p>Two</p>\n<p>Three</p>\n",
+		},
+		{
+			name:    "single newlines are line breaks",
+			content: "Line one\nline two",
+			want:    "<p>Line one<br>\nline two</p>\n",
+		},
+		{
+			name:    "blocks are not wrapped",
+			content: "<h2>Heading</h2>\n\nText\n\n<!-- more -->\n\n<blockquote>Quote</blockquote>",
+			want:    "<h2>Heading</h2>\n<p>Text</p>\n<!-- more -->\n<blockquote>Quote</blockquote>\n",
+		},
+		{
+			name:    "content with paragraphs is left alone",
+			content: "<p class=\"lead\">Already\nwrapped</p>\n\nLoose",
+			want:    "<p class=\"lead\">Already\nwrapped</p>\n\nLoose",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := autop(tt.content); got != tt.want {
+				t.Errorf("autop() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTags(t *testing.T) {
+	many := make([]string, 12)
+	for i := range many {
+		many[i] = string(rune('a' + i))
+	}
+
+	tests := []struct {
+		name       string
+		tags       []string
+		options    Options
+		want       []string
+		wantIssues []string
+	}{
+		{
+			name: "names become slugs without duplicates",
+			tags: []string{"Go", " go ", "Web Development"},
+			want: []string{"go", "web-development"},
+		},
+		{
+			name:    "mapped by name or slug, and dropped when mapped to nothing",
+			tags:    []string{"Golang", "Web Development", "Uncategorized"},
+			options: Options{TagMap: map[string]string{"Golang": "go", "web-development": "Web", "uncategorized": ""}},
+			want:    []string{"go", "web"},
+		},
+		{
+			name:       "long tags are cut at a word",
+			tags:       []string{"Building distributed systems with Go"},
+			want:       []string{"building-distributed-systems"},
+			wantIssues: []string{`tag "Building distributed systems with Go" shortened to "building-distributed-systems"`},
+		},
+		{
+			name:       "long tags without words are cut at the limit",
+			tags:       []string{strings.Repeat("x", 40)},
+			want:       []string{strings.Repeat("x", maxTagLength)},
+			wantIssues: []string{`tag "` + strings.Repeat("x", 40) + `" shortened to "` + strings.Repeat("x", maxTagLength) + `"`},
+		},
+		{
+			name:       "tags without letters are dropped",
+			tags:       []string{"!!!", "ok"},
+			want:       []string{"ok"},
+			wantIssues: []string{`dropped tag "!!!", which has no letters or digits`},
+		},
+		{
+			name:       "only the first tags are kept",
+			tags:       many,
+			want:       many[:maxTags],
+			wantIssues: []string{"kept the first 10 of 12 tags; dropped k, l"},
+		},
+		{
+			name:       "posts with no tags get the default",
+			tags:       []string{"Uncategorized"},
+			options:    Options{TagMap: map[string]string{"Uncategorized": ""}, DefaultTag: "imported"},
+			want:       []string{"imported"},
+			wantIssues: []string{`has no tags; tagged "imported"`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var result Result
+			got := result.tags(entry{source: "test", tags: tt.tags}, tt.options)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("tags() = %v, want %v", got, tt.want)
+			}
+
+			var issues []string
+			for _, issue := range result.Issues {
+				issues = append(issues, issue.Message)
+			}
+			if !reflect.DeepEqual(issues, tt.wantIssues) {
+				t.Errorf("issues = %q, want %q", issues, tt.wantIssues)
+			}
+		})
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		s     string
+		limit int
+		want  string
+	}{
+		{s: "short", limit: 10, want: "short"},
+		{s: "exactly ten", limit: 11, want: "exactly ten"},
+		{s: "cut at the last word that fits", limit: 16, want: "cut at the last…"},
+		{s: "trailing punctuation, dropped", limit: 24, want: "trailing punctuation…"},
+		{s: "averyveryverylongword", limit: 10, want: "averyvery…"},
+		{s: "héllo wörld ünïcode", limit: 12, want: "héllo wörld…"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got := truncate(tt.s, tt.limit)
+			if got != tt.want {
+				t.Errorf("truncate(%q, %d) = %q, want %q", tt.s, tt.limit, got, tt.want)
+			}
+			if n := len([]rune(got)); n > tt.limit {
+				t.Errorf("truncate(%q, %d) has %d characters", tt.s, tt.limit, n)
+			}
+		})
+	}
+}
+
+// importStore keeps created posts in memory, as Apply reads and writes them.
+type importStore struct {
+	dynamodb.Store
+	posts []postmodel.Post
+}
+
+func (s *importStore) GetAllActivePosts(ctx context.Context) ([]postmodel.Post, error) {
+	return s.posts, nil
+}
+
+func (s *importStore) UpsertPost(post postmodel.Post, ctx context.Context) error {
+	s.posts = append(s.posts, post)
+	return nil
+}
+
+type importBucket struct {
+	s3.Store
+}
+
+func (importBucket) UploadPostHTML(postID, content string, ctx context.Context) (s3.UploadedObject, error) {
+	return s3.UploadedObject{Key: "posts/" + postID + ".html"}, nil
+}
+
+func (importBucket) UploadPostMd(postID, content string, ctx context.Context) (s3.UploadedObject, error) {
+	return s3.UploadedObject{Key: "posts/" + postID + ".md"}, nil
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		fixture string
+		titles  []string
+	}{
+		{name: "ASCII titles", fixture: "wordpress.xml", titles: []string{"Classic editor post", "Block editor post"}},
+		{name: "titles with no slug", fixture: "wordpress-unicode.xml", titles: []string{"Привет", "こんにちは"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &importStore{}
+			services := models.HandlerServices{
+				DynamoDBService: store,
+				S3Service:       importBucket{},
+				Logger:          slog.New(slog.NewTextHandler(io.Discard, nil)),
+			}
+
+			first, err := fromFile(ReadWordPress, tt.fixture)(Options{})
+			if err != nil {
+				t.Fatalf("ReadWordPress() error = %v", err)
+			}
+			if err := Apply(&first, services, context.Background()); err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+
+			ids := map[string]string{}
+			for _, post := range first.Posts {
+				if post.Status != StatusCreated {
+					t.Fatalf("first import: %q is %s, want created", post.Input.Title, post.Status)
+				}
+				ids[post.Input.Title] = post.PostID
+			}
+			if len(ids) != len(tt.titles) || len(store.posts) != len(tt.titles) {
+				t.Fatalf("first import created %v, want %v", ids, tt.titles)
+			}
+
+			// Running it again finds each post by its own slug or title
+			again, err := fromFile(ReadWordPress, tt.fixture)(Options{})
+			if err != nil {
+				t.Fatalf("ReadWordPress() error = %v", err)
+			}
+			if err := Apply(&again, services, context.Background()); err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			for _, post := range again.Posts {
+				if post.Status != StatusExists || post.PostID != ids[post.Input.Title] {
+					t.Errorf("second import: %q is %s as %s, want exists as %s", post.Input.Title, post.Status, post.PostID, ids[post.Input.Title])
+				}
+			}
+			if len(store.posts) != len(tt.titles) {
+				t.Errorf("second import stored %d posts, want %d", len(store.posts), len(tt.titles))
+			}
+		})
+	}
+}
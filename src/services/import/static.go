@@ -0,0 +1,325 @@
+package importservice
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/JaxonAdams/blog-backend/src/services/frontmatter"
+)
+
+var (
+	hugoShortcode   = regexp.MustCompile(`\{\{[<%]-?\s*/?\s*([A-Za-z0-9_/-]+)`)
+	liquidTag       = regexp.MustCompile(`\{%-?\s*([a-z_]+)|\{\{-?\s*([A-Za-z0-9_.]+)`)
+	jekyllPostName  = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})-(.+)$`)
+	hugoSummaryMark = regexp.MustCompile(`(?i)<!--\s*more\s*-->`)
+)
+
+// Date formats seen in front matter, most specific first
+var frontMatterDateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05 -07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// ReadHugo converts the pages under a Hugo site's content directory, or
+// under root itself if it has none. Section indexes and drafts are skipped.
+func ReadHugo(root string, options Options) (Result, error) {
+	dir := filepath.Join(root, "content")
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		dir = root
+	}
+
+	var result Result
+	err := walkSite(dir, func(name string, content []byte) {
+		source := "hugo " + name
+		if strings.HasPrefix(path.Base(name), "_index.") {
+			return
+		}
+
+		metadata, body, err := parseFrontMatter(content)
+		if err != nil {
+			result.skip(source, "%v", err)
+			return
+		}
+		if isTrue(metadata["draft"]) {
+			result.skip(source, "is a draft")
+			return
+		}
+
+		e := entry{
+			source:     source,
+			title:      stringField(metadata, "title"),
+			summary:    stringField(metadata, "summary", "description"),
+			body:       body,
+			isHTML:     path.Ext(name) == ".html",
+			tags:       append(listField(metadata, "tags", false), listField(metadata, "categories", false)...),
+			created:    dateField(metadata, "date", "publishDate", "pubdate", "published"),
+			modified:   dateField(metadata, "lastmod", "modified"),
+			shortcodes: hugoShortcode,
+		}
+		// Hugo's manual summary split
+		if before, after, ok := splitRegexp(hugoSummaryMark, e.body); ok {
+			if e.summary == "" && !e.isHTML {
+				e.summary = summarize(before)
+			}
+			e.body = strings.TrimRight(before, "\n") + "\n\n" + strings.TrimLeft(after, "\n")
+		}
+
+		result.add(e, options)
+	})
+
+	return result, err
+}
+
+// ReadJekyll converts the posts in a Jekyll site's _posts directory. Posts
+// without a date in their front matter take it from their file name.
+func ReadJekyll(root string, options Options) (Result, error) {
+	dir := filepath.Join(root, "_posts")
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return Result{}, ErrCodeInvalidExport{Msg: fmt.Sprintf("%s has no _posts directory", root)}
+	}
+
+	var result Result
+	err := walkSite(dir, func(name string, content []byte) {
+		source := "jekyll _posts/" + name
+
+		metadata, body, err := parseFrontMatter(content)
+		if err != nil {
+			result.skip(source, "%v", err)
+			return
+		}
+		if published, ok := metadata["published"]; ok && !isTrue(published) {
+			result.skip(source, "is not published")
+			return
+		}
+
+		e := entry{
+			source:     source,
+			title:      stringField(metadata, "title"),
+			summary:    stringField(metadata, "excerpt", "description", "summary"),
+			body:       body,
+			isHTML:     path.Ext(name) == ".html",
+			tags:       append(listField(metadata, "tags", true), listField(metadata, "categories", true)...),
+			created:    dateField(metadata, "date"),
+			modified:   dateField(metadata, "last_modified_at", "updated"),
+			shortcodes: liquidTag,
+		}
+		e.tags = append(e.tags, listField(metadata, "category", true)...)
+
+		// Jekyll takes the date, and the title if there is none, from the
+		// file name
+		base := strings.TrimSuffix(path.Base(name), path.Ext(name))
+		if match := jekyllPostName.FindStringSubmatch(base); match != nil {
+			if e.created.IsZero() {
+				e.created, _ = time.Parse("2006-01-02", match[1])
+			}
+			if e.title == "" {
+				e.title = strings.ReplaceAll(match[2], "-", " ")
+				result.note(source, "has no title; using %q from its file name", e.title)
+			}
+		}
+
+		result.add(e, options)
+	})
+
+	return result, err
+}
+
+// walkSite calls visit for every Markdown or HTML file under dir, with its
+// slash-separated path relative to dir. Hidden files and directories are
+// skipped.
+func walkSite(dir string, visit func(name string, content []byte)) error {
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		switch strings.ToLower(filepath.Ext(p)) {
+		case ".md", ".markdown", ".html":
+		default:
+			return nil
+		}
+
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		name, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		visit(filepath.ToSlash(name), content)
+		return nil
+	})
+}
+
+// parseFrontMatter reads YAML (---), TOML (+++) or JSON front matter.
+func parseFrontMatter(content []byte) (map[string]any, string, error) {
+	text := strings.ReplaceAll(string(content), "\r\n", "\n")
+	metadata := map[string]any{}
+
+	switch {
+	case strings.HasPrefix(text, "+++\n"):
+		header, body, ok := strings.Cut(text[4:], "\n+++")
+		if !ok {
+			return nil, "", fmt.Errorf("front matter is not closed by +++")
+		}
+		toml, err := parseTOML(header)
+		return toml, strings.TrimLeft(body, "\n"), err
+
+	case strings.HasPrefix(text, "{"):
+		decoder := json.NewDecoder(strings.NewReader(text))
+		if err := decoder.Decode(&metadata); err != nil {
+			return nil, "", fmt.Errorf("invalid front matter: %w", err)
+		}
+		return metadata, strings.TrimLeft(text[decoder.InputOffset():], "\n"), nil
+
+	default:
+		body, err := frontmatter.Parse([]byte(text), &metadata)
+		return metadata, body, err
+	}
+}
+
+// parseTOML reads the top-level keys of TOML front matter: strings,
+// booleans, numbers, dates and single-line arrays. Tables such as [params]
+// are ignored.
+func parseTOML(header string) (map[string]any, error) {
+	metadata := map[string]any{}
+	for i, line := range strings.Split(header, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			break
+		}
+
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid front matter on line %d: %q", i+1, line)
+		}
+		key = strings.Trim(strings.TrimSpace(key), `"'`)
+		value = strings.TrimSpace(value)
+
+		if inner, ok := strings.CutPrefix(value, "["); ok {
+			inner, ok = strings.CutSuffix(inner, "]")
+			if !ok {
+				return nil, fmt.Errorf("invalid front matter on line %d: arrays must be on one line", i+1)
+			}
+			var items []any
+			for _, item := range strings.Split(inner, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, tomlValue(item))
+				}
+			}
+			metadata[key] = items
+			continue
+		}
+		metadata[key] = tomlValue(value)
+	}
+	return metadata, nil
+}
+
+func tomlValue(value string) any {
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		if value[0] == '"' {
+			if unquoted, err := strconv.Unquote(value); err == nil {
+				return unquoted
+			}
+		}
+		return value[1 : len(value)-1]
+	}
+	if value == "true" || value == "false" {
+		return value == "true"
+	}
+	// Dates, numbers and anything else are kept as text
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return value
+}
+
+func stringField(metadata map[string]any, keys ...string) string {
+	for _, key := range keys {
+		if s, ok := metadata[key].(string); ok && strings.TrimSpace(s) != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// listField reads a list, or a single string. Jekyll separates a string of
+// tags with spaces.
+func listField(metadata map[string]any, key string, splitSpaces bool) []string {
+	switch value := metadata[key].(type) {
+	case string:
+		if splitSpaces {
+			return strings.Fields(value)
+		}
+		return []string{value}
+	case []any:
+		var list []string
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	}
+	return nil
+}
+
+func dateField(metadata map[string]any, keys ...string) time.Time {
+	for _, key := range keys {
+		switch value := metadata[key].(type) {
+		case time.Time:
+			return value.UTC()
+		case string:
+			for _, layout := range frontMatterDateLayouts {
+				if t, err := time.Parse(layout, strings.TrimSpace(value)); err == nil {
+					return t.UTC()
+				}
+			}
+		}
+	}
+	return time.Time{}
+}
+
+func isTrue(value any) bool {
+	switch value := value.(type) {
+	case bool:
+		return value
+	case string:
+		return value == "true" || value == "yes"
+	}
+	return false
+}
+
+func splitRegexp(re *regexp.Regexp, s string) (string, string, bool) {
+	loc := re.FindStringIndex(s)
+	if loc == nil {
+		return s, "", false
+	}
+	return s[:loc[0]], s[loc[1]:], true
+}
@@ -0,0 +1,155 @@
+package importservice
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/JaxonAdams/blog-backend/src/services/apperror"
+)
+
+type wxrDocument struct {
+	Items []wxrItem `xml:"channel>item"`
+}
+
+// wxrItem is a post, page or attachment. Unqualified tags match the wp:
+// elements of every WXR version.
+type wxrItem struct {
+	Title        string        `xml:"title"`
+	PubDate      string        `xml:"pubDate"`
+	Encoded      []wxrEncoded  `xml:"encoded"`
+	PostID       string        `xml:"post_id"`
+	PostDateGMT  string        `xml:"post_date_gmt"`
+	ModifiedGMT  string        `xml:"post_modified_gmt"`
+	Status       string        `xml:"status"`
+	PostType     string        `xml:"post_type"`
+	Categories   []wxrCategory `xml:"category"`
+	PostPassword string        `xml:"post_password"`
+}
+
+// wxrEncoded is content:encoded or excerpt:encoded, told apart by namespace.
+type wxrEncoded struct {
+	XMLName xml.Name
+	Value   string `xml:",chardata"`
+}
+
+type wxrCategory struct {
+	Domain string `xml:"domain,attr"`
+	Name   string `xml:",chardata"`
+}
+
+const wordPressDateLayout = "2006-01-02 15:04:05"
+
+var (
+	// Core shortcodes, and the closing tag of any other
+	wordPressShortcode = regexp.MustCompile(`\[(?:(gallery|caption|embed|video|audio|playlist)\b[^\]]*|/([a-z][a-z0-9_-]*))\]`)
+	paragraphBreak     = regexp.MustCompile(`\n\s*\n`)
+	blockStart         = regexp.MustCompile(`^<(?:p|div|h[1-6]|ul|ol|li|blockquote|pre|table|figure|hr|!--)[\s>/]`)
+)
+
+// ReadWordPress converts the published posts in a WordPress export (WXR).
+// Categories and tags both become tags.
+func ReadWordPress(r io.Reader, options Options) (Result, error) {
+	var document wxrDocument
+	if err := xml.NewDecoder(r).Decode(&document); err != nil {
+		return Result{}, ErrCodeInvalidExport{Msg: fmt.Sprintf("invalid WordPress export: %v", err)}
+	}
+
+	var result Result
+	for _, item := range document.Items {
+		source := fmt.Sprintf("wordpress %s %s", item.PostType, item.PostID)
+
+		switch {
+		case item.PostType == "attachment":
+			// Media are linked from posts by URL and are not copied
+			continue
+		case item.PostType != "post":
+			result.skip(source, "%q is a %s, not a post", item.Title, item.PostType)
+			continue
+		case item.Status != "publish":
+			result.skip(source, "%q is %s, not published", item.Title, item.Status)
+			continue
+		case item.PostPassword != "":
+			result.skip(source, "%q is password protected", item.Title)
+			continue
+		}
+
+		e := entry{
+			source:     source,
+			title:      item.Title,
+			isHTML:     true,
+			created:    wordPressDate(item.PostDateGMT, item.PubDate),
+			modified:   wordPressDate(item.ModifiedGMT, ""),
+			shortcodes: wordPressShortcode,
+		}
+
+		for _, encoded := range item.Encoded {
+			switch {
+			case strings.Contains(encoded.XMLName.Space, "/excerpt/"):
+				e.summary = encoded.Value
+			case strings.Contains(encoded.XMLName.Space, "/content/"):
+				e.body = autop(encoded.Value)
+			}
+		}
+
+		for _, category := range item.Categories {
+			if category.Domain == "category" || category.Domain == "post_tag" {
+				e.tags = append(e.tags, category.Name)
+			}
+		}
+
+		result.add(e, options)
+	}
+
+	return result, nil
+}
+
+// wordPressDate reads a GMT date, falling back to the RSS pubDate. Drafts
+// have a zero GMT date.
+func wordPressDate(gmt, pubDate string) time.Time {
+	if t, err := time.Parse(wordPressDateLayout, gmt); err == nil && t.Year() > 1 {
+		return t
+	}
+	if t, err := time.Parse(time.RFC1123Z, pubDate); err == nil {
+		return t.UTC()
+	}
+	return time.Time{}
+}
+
+// autop adds the paragraphs WordPress stores implicitly: blank lines
+// separate paragraphs and single newlines are line breaks. Content that
+// already has paragraph tags, as from the block editor, is left alone.
+func autop(content string) string {
+	if strings.Contains(content, "<p>") || strings.Contains(content, "<p ") {
+		return content
+	}
+
+	var b strings.Builder
+	for _, chunk := range paragraphBreak.Split(strings.ReplaceAll(content, "\r\n", "\n"), -1) {
+		chunk = strings.TrimSpace(chunk)
+		if chunk == "" {
+			continue
+		}
+		if blockStart.MatchString(chunk) {
+			b.WriteString(chunk + "\n")
+			continue
+		}
+		b.WriteString("<p>" + strings.ReplaceAll(chunk, "\n", "<br>\n") + "</p>\n")
+	}
+	return b.String()
+}
+
+type ErrCodeInvalidExport struct {
+	Msg string
+}
+
+func (e ErrCodeInvalidExport) Error() string {
+	return e.Msg
+}
+
+func (e ErrCodeInvalidExport) ErrorCode() apperror.Code {
+	return apperror.CodeInvalidRequest
+}
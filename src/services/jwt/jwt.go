@@ -1,47 +1,174 @@
 package jwt
 
 import (
-	"os"
+	"context"
+	"errors"
 	"time"
 
+	"github.com/JaxonAdams/blog-backend/src/services/apperror"
+	"github.com/JaxonAdams/blog-backend/src/services/secrets"
 	"github.com/golang-jwt/jwt/v5"
 )
 
-var jwtSecret = []byte(os.Getenv("JWT_SECRET"))
+const (
+	mfaChallengePurpose = "mfa_challenge"
+	oidcStatePurpose    = "oidc_state"
+)
+
+// Signer signs and verifies tokens with JWT_SECRET, read through secrets so a
+// rotated secret is picked up without redeploying.
+type Signer struct {
+	secrets secrets.Provider
+}
+
+func NewSigner(provider secrets.Provider) *Signer {
+	return &Signer{secrets: provider}
+}
+
+type OIDCStateClaims struct {
+	State        string `json:"state"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+	Purpose      string `json:"purpose"`
+	jwt.RegisteredClaims
+}
 
 type CustomClaims struct {
-	Role string `json:"role"`
+	Role    string `json:"role"`
+	Purpose string `json:"purpose,omitempty"`
 	jwt.RegisteredClaims
 }
 
-func GenerateJWT(username, role string) (string, error) {
+func (s *Signer) GenerateJWT(username, role string, ctx context.Context) (string, error) {
 	claims := jwt.MapClaims{
 		"sub":  username,
 		"role": role,
 		"iat":  time.Now().Unix(),
 		"exp":  time.Now().Add(time.Hour * 1).Unix(),
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	return s.sign(claims, ctx)
+}
+
+func (s *Signer) ParseJWT(tokenString string, ctx context.Context) (*CustomClaims, error) {
+	claims, err := s.parseClaims(tokenString, ctx)
+	if err != nil {
+		return &CustomClaims{}, err
+	}
+
+	if claims.Role == "" || claims.Purpose != "" {
+		return &CustomClaims{}, &ErrCodeInvalidToken{Msg: "token is not an access token"}
+	}
+
+	return claims, nil
+}
+
+func (s *Signer) GenerateMFAChallengeJWT(username string, ctx context.Context) (string, error) {
+	claims := jwt.MapClaims{
+		"sub":     username,
+		"purpose": mfaChallengePurpose,
+		"iat":     time.Now().Unix(),
+		"exp":     time.Now().Add(time.Minute * 5).Unix(),
+	}
+	return s.sign(claims, ctx)
+}
+
+func (s *Signer) ParseMFAChallengeJWT(tokenString string, ctx context.Context) (*CustomClaims, error) {
+	claims, err := s.parseClaims(tokenString, ctx)
+	if err != nil {
+		return &CustomClaims{}, err
+	}
+
+	if claims.Purpose != mfaChallengePurpose || claims.Subject == "" {
+		return &CustomClaims{}, &ErrCodeInvalidToken{Msg: "token is not an mfa challenge token"}
+	}
+
+	return claims, nil
+}
+
+func (s *Signer) GenerateOIDCStateJWT(state, nonce, codeVerifier string, ctx context.Context) (string, error) {
+	claims := jwt.MapClaims{
+		"state":         state,
+		"nonce":         nonce,
+		"code_verifier": codeVerifier,
+		"purpose":       oidcStatePurpose,
+		"iat":           time.Now().Unix(),
+		"exp":           time.Now().Add(time.Minute * 10).Unix(),
+	}
+	return s.sign(claims, ctx)
 }
 
-func ParseJWT(tokenString string) (*CustomClaims, error) {
+func (s *Signer) ParseOIDCStateJWT(tokenString string, ctx context.Context) (*OIDCStateClaims, error) {
+	key, err := s.key(ctx)
+	if err != nil {
+		return &OIDCStateClaims{}, err
+	}
+
+	token, err := jwt.ParseWithClaims(tokenString, &OIDCStateClaims{}, func(token *jwt.Token) (any, error) {
+		return key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+
+	if err != nil {
+		return &OIDCStateClaims{}, &ErrCodeInvalidToken{Msg: err.Error()}
+	}
+
+	claims, ok := token.Claims.(*OIDCStateClaims)
+	if !ok || !token.Valid || claims.Purpose != oidcStatePurpose {
+		return &OIDCStateClaims{}, &ErrCodeInvalidToken{Msg: "token is not an oidc state token"}
+	}
+
+	return claims, nil
+}
+
+func (s *Signer) parseClaims(tokenString string, ctx context.Context) (*CustomClaims, error) {
+	key, err := s.key(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	token, err := jwt.ParseWithClaims(tokenString, &CustomClaims{}, func(token *jwt.Token) (any, error) {
-		return jwtSecret, nil
-	})
+		return key, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
 
-	if err != nil || !token.Valid {
-		return &CustomClaims{}, &ErrCodeInvalidToken{Msg: err.Error()}
+	if err != nil {
+		return nil, &ErrCodeInvalidToken{Msg: err.Error()}
+	}
+
+	if !token.Valid {
+		return nil, &ErrCodeInvalidToken{Msg: "token is invalid"}
 	}
 
 	claims, ok := token.Claims.(*CustomClaims)
-	if !ok || claims.Role == "" {
-		return &CustomClaims{}, &ErrCodeInvalidToken{Msg: err.Error()}
+	if !ok {
+		return nil, &ErrCodeInvalidToken{Msg: "unexpected token claims"}
 	}
 
 	return claims, nil
 }
 
+func (s *Signer) sign(claims jwt.MapClaims, ctx context.Context) (string, error) {
+	key, err := s.key(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(key)
+}
+
+// key refuses an empty secret, which would otherwise sign tokens anyone can forge.
+func (s *Signer) key(ctx context.Context) ([]byte, error) {
+	secret, err := s.secrets.GetSecret(ctx, secrets.JWTSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	if secret == "" {
+		return nil, errors.New("JWT_SECRET is empty")
+	}
+
+	return []byte(secret), nil
+}
+
 type ErrCodeInvalidToken struct {
 	Msg string
 }
@@ -49,3 +176,7 @@ type ErrCodeInvalidToken struct {
 func (e *ErrCodeInvalidToken) Error() string {
 	return e.Msg
 }
+
+func (e ErrCodeInvalidToken) ErrorCode() apperror.Code {
+	return apperror.CodeUnauthorized
+}
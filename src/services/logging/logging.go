@@ -0,0 +1,105 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-lambda-go/lambdacontext"
+)
+
+const Redacted = "[REDACTED]"
+
+// Attribute keys containing any of these are never written out
+var sensitiveKeyParts = []string{
+	"password",
+	"secret",
+	"token",
+	"authorization",
+	"api_key",
+	"apikey",
+	"cookie",
+	"credential",
+	"recovery",
+	"verifier",
+	"hash",
+}
+
+// Short keys that only leak credentials as an exact match
+var sensitiveKeys = []string{"code", "otp", "pin"}
+
+// New returns the JSON logger handed to services. LOG_LEVEL picks the
+// minimum level and defaults to info.
+func New() *slog.Logger {
+	var level slog.Level
+	if value := os.Getenv("LOG_LEVEL"); value != "" {
+		if err := level.UnmarshalText([]byte(value)); err != nil {
+			level = slog.LevelInfo
+		}
+	}
+
+	handler := slog.NewJSONHandler(os.Stdout, &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redact,
+	})
+
+	return slog.New(handler)
+}
+
+// ForInvocation tags logger with the Lambda request ID from ctx.
+func ForInvocation(logger *slog.Logger, ctx context.Context) *slog.Logger {
+	if logger == nil {
+		logger = New()
+	}
+
+	if lc, ok := lambdacontext.FromContext(ctx); ok {
+		logger = logger.With(slog.String("request_id", lc.AwsRequestID))
+	}
+
+	return logger
+}
+
+func redact(groups []string, attr slog.Attr) slog.Attr {
+	if isSensitiveKey(attr.Key) {
+		return slog.String(attr.Key, Redacted)
+	}
+
+	if attr.Value.Kind() == slog.KindString && isSensitiveValue(attr.Value.String()) {
+		return slog.String(attr.Key, Redacted)
+	}
+
+	if err, ok := attr.Value.Any().(error); ok && isSensitiveValue(err.Error()) {
+		return slog.String(attr.Key, Redacted)
+	}
+
+	return attr
+}
+
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+
+	for _, part := range sensitiveKeyParts {
+		if strings.Contains(key, part) {
+			return true
+		}
+	}
+
+	for _, sensitive := range sensitiveKeys {
+		if key == sensitive {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isSensitiveValue catches credentials logged under an innocent key, such as
+// a bearer header or a JWT inside an error message.
+func isSensitiveValue(value string) bool {
+	if strings.HasPrefix(strings.ToLower(value), "bearer ") {
+		return true
+	}
+
+	return strings.Contains(value, "eyJ") && strings.Count(value, ".") >= 2
+}
@@ -2,32 +2,188 @@ package loginservice
 
 import (
 	"context"
-	"fmt"
+	"errors"
+	"slices"
+	"time"
 
 	"github.com/JaxonAdams/blog-backend/src/models"
-	"github.com/JaxonAdams/blog-backend/src/services/jwt"
+	"github.com/JaxonAdams/blog-backend/src/services/apperror"
+	"github.com/JaxonAdams/blog-backend/src/services/aws/dynamodb"
+	"github.com/JaxonAdams/blog-backend/src/services/totp"
 	"golang.org/x/crypto/bcrypt"
 )
 
-func LogInAdmin(input models.AdminLoginInput, services models.HandlerServices, ctx context.Context) (string, error) {
+type AdminLoginResult struct {
+	Token          string `json:"token,omitempty"`
+	MFARequired    bool   `json:"mfa_required"`
+	ChallengeToken string `json:"challenge_token,omitempty"`
+}
 
-	fmt.Printf("Fetching user with input: %+v", input)
+type TOTPEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
 
+func LogInAdmin(input models.AdminLoginInput, services models.HandlerServices, ctx context.Context) (AdminLoginResult, error) {
 	// Fetch the stored password hash from dynamodb
 	adminUser, err := services.DynamoDBService.GetAdminUser(input.Username, ctx)
 	if err != nil {
-		return "", err
+		var notFoundErr dynamodb.ErrCodeNotFound
+		if errors.As(err, &notFoundErr) {
+			return AdminLoginResult{}, ErrCodeUnauthorized{Msg: err.Error()}
+		}
+		return AdminLoginResult{}, err
 	}
-	fmt.Printf("Found user with username %s: %+v", input.Username, adminUser)
 
 	// Compare the input password to the fetched hash
 	err = bcrypt.CompareHashAndPassword([]byte(adminUser.HashedPW), []byte(input.Password))
 	if err != nil {
-		return "", ErrCodeUnauthorized{Msg: err.Error()}
+		return AdminLoginResult{}, ErrCodeUnauthorized{Msg: err.Error()}
+	}
+
+	// If the user has enabled TOTP, hand back a short-lived challenge instead
+	if adminUser.TOTPEnabled {
+		challengeToken, err := services.JWT.GenerateMFAChallengeJWT(adminUser.Username, ctx)
+		if err != nil {
+			return AdminLoginResult{}, err
+		}
+
+		return AdminLoginResult{MFARequired: true, ChallengeToken: challengeToken}, nil
 	}
 
 	// If correct, generate and return a new JWT
-	return jwt.GenerateJWT(adminUser.Username, "admin")
+	token, err := services.JWT.GenerateJWT(adminUser.Username, "admin", ctx)
+	if err != nil {
+		return AdminLoginResult{}, err
+	}
+
+	return AdminLoginResult{Token: token}, nil
+}
+
+func CompleteAdminMFALogin(input models.AdminMFALoginInput, services models.HandlerServices, ctx context.Context) (string, error) {
+	claims, err := services.JWT.ParseMFAChallengeJWT(input.ChallengeToken, ctx)
+	if err != nil {
+		return "", ErrCodeUnauthorized{Msg: err.Error()}
+	}
+
+	adminUser, err := services.DynamoDBService.GetAdminUser(claims.Subject, ctx)
+	if err != nil {
+		var notFoundErr dynamodb.ErrCodeNotFound
+		if errors.As(err, &notFoundErr) {
+			return "", ErrCodeUnauthorized{Msg: err.Error()}
+		}
+		return "", err
+	}
+
+	if !adminUser.TOTPEnabled || adminUser.TOTPSecret == "" {
+		return "", ErrCodeUnauthorized{Msg: "totp is not enabled for this user"}
+	}
+
+	switch {
+	case input.Code != "":
+		step, ok := totp.Match(adminUser.TOTPSecret, input.Code, time.Now())
+		if !ok {
+			return "", ErrCodeUnauthorized{Msg: "invalid totp code"}
+		}
+		if step <= adminUser.TOTPLastStep {
+			return "", ErrCodeUnauthorized{Msg: "totp code has already been used"}
+		}
+
+		err = services.DynamoDBService.RecordTOTPStep(adminUser, step, ctx)
+		if err != nil {
+			var conditionErr dynamodb.ErrCodeConditionFailed
+			if errors.As(err, &conditionErr) {
+				return "", ErrCodeUnauthorized{Msg: "totp code has already been used"}
+			}
+			return "", err
+		}
+	case input.RecoveryCode != "":
+		// Recovery codes are single use. Removing the hash only if it is
+		// still there stops two logins using the same code.
+		hash := totp.HashRecoveryCode(input.RecoveryCode)
+		if !slices.Contains(adminUser.RecoveryCodes, hash) {
+			return "", ErrCodeUnauthorized{Msg: "invalid recovery code"}
+		}
+
+		err = services.DynamoDBService.UseRecoveryCode(adminUser, hash, ctx)
+		if err != nil {
+			var conditionErr dynamodb.ErrCodeConditionFailed
+			if errors.As(err, &conditionErr) {
+				return "", ErrCodeUnauthorized{Msg: "invalid recovery code"}
+			}
+			return "", err
+		}
+	default:
+		return "", ErrCodeInvalidRequest{Msg: "one of code or recovery_code is required"}
+	}
+
+	return services.JWT.GenerateJWT(adminUser.Username, "admin", ctx)
+}
+
+func EnrollTOTP(username string, services models.HandlerServices, ctx context.Context) (TOTPEnrollment, error) {
+	adminUser, err := services.DynamoDBService.GetAdminUser(username, ctx)
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+
+	if adminUser.TOTPEnabled {
+		return TOTPEnrollment{}, ErrCodeConflict{Msg: "totp is already enabled for this user"}
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+
+	// Store the pending secret; it only takes effect once verified
+	adminUser.TOTPSecret = secret
+	adminUser.RecoveryCodes = nil
+	err = services.DynamoDBService.UpdateAdminUserMFA(adminUser, ctx)
+	if err != nil {
+		return TOTPEnrollment{}, err
+	}
+
+	return TOTPEnrollment{
+		Secret: secret,
+		URI:    totp.ProvisioningURI(secret, adminUser.Username),
+	}, nil
+}
+
+func VerifyTOTP(username string, input models.TOTPVerifyInput, services models.HandlerServices, ctx context.Context) ([]string, error) {
+	adminUser, err := services.DynamoDBService.GetAdminUser(username, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if adminUser.TOTPEnabled {
+		return nil, ErrCodeConflict{Msg: "totp is already enabled for this user"}
+	}
+
+	if adminUser.TOTPSecret == "" {
+		return nil, ErrCodeInvalidRequest{Msg: "totp enrollment has not been started"}
+	}
+
+	step, ok := totp.Match(adminUser.TOTPSecret, input.Code, time.Now())
+	if !ok {
+		return nil, ErrCodeInvalidRequest{Msg: "invalid totp code"}
+	}
+
+	// Generate recovery codes; only the hashes are persisted
+	codes, hashes, err := totp.GenerateRecoveryCodes()
+	if err != nil {
+		return nil, err
+	}
+
+	// The code that confirmed enrollment cannot also complete a login
+	adminUser.TOTPEnabled = true
+	adminUser.TOTPLastStep = step
+	adminUser.RecoveryCodes = hashes
+	err = services.DynamoDBService.UpdateAdminUserMFA(adminUser, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
 }
 
 type ErrCodeUnauthorized struct {
@@ -37,3 +193,31 @@ type ErrCodeUnauthorized struct {
 func (e ErrCodeUnauthorized) Error() string {
 	return e.Msg
 }
+
+func (e ErrCodeUnauthorized) ErrorCode() apperror.Code {
+	return apperror.CodeUnauthorized
+}
+
+type ErrCodeConflict struct {
+	Msg string
+}
+
+func (e ErrCodeConflict) Error() string {
+	return e.Msg
+}
+
+func (e ErrCodeConflict) ErrorCode() apperror.Code {
+	return apperror.CodeConflict
+}
+
+type ErrCodeInvalidRequest struct {
+	Msg string
+}
+
+func (e ErrCodeInvalidRequest) Error() string {
+	return e.Msg
+}
+
+func (e ErrCodeInvalidRequest) ErrorCode() apperror.Code {
+	return apperror.CodeInvalidRequest
+}
@@ -0,0 +1,94 @@
+package loginservice
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/JaxonAdams/blog-backend/src/models"
+	usermodel "github.com/JaxonAdams/blog-backend/src/models/users"
+	"github.com/JaxonAdams/blog-backend/src/services/aws/dynamodb"
+	"github.com/JaxonAdams/blog-backend/src/services/jwt"
+	"github.com/JaxonAdams/blog-backend/src/services/secrets"
+	"github.com/JaxonAdams/blog-backend/src/services/totp"
+)
+
+type staticSecrets map[string]string
+
+func (s staticSecrets) GetSecret(ctx context.Context, name string) (string, error) {
+	return s[name], nil
+}
+
+// recoveryStore serves every login the user as first read, as two
+// concurrent logins would see it, while keeping the stored codes apart.
+type recoveryStore struct {
+	dynamodb.Store
+	read  usermodel.AdminUser
+	codes []string
+}
+
+func (s *recoveryStore) GetAdminUser(username string, ctx context.Context) (usermodel.AdminUser, error) {
+	return s.read, nil
+}
+
+func (s *recoveryStore) UseRecoveryCode(user usermodel.AdminUser, hash string, ctx context.Context) error {
+	i := slices.Index(s.codes, hash)
+	if i == -1 {
+		return dynamodb.ErrCodeConditionFailed{Msg: "no such recovery code"}
+	}
+	s.codes = slices.Delete(s.codes, i, i+1)
+	return nil
+}
+
+func TestRecoveryCodeIsSingleUse(t *testing.T) {
+	codes := []string{totp.HashRecoveryCode("aaaa-bbbb"), totp.HashRecoveryCode("cccc-dddd")}
+	store := &recoveryStore{
+		read: usermodel.AdminUser{
+			Username:      "admin",
+			TOTPEnabled:   true,
+			TOTPSecret:    "JBSWY3DPEHPK3PXP",
+			TOTPLastStep:  100,
+			RecoveryCodes: slices.Clone(codes),
+		},
+		codes: slices.Clone(codes),
+	}
+	signer := jwt.NewSigner(staticSecrets{secrets.JWTSecret: "test-secret"})
+	services := models.HandlerServices{DynamoDBService: store, JWT: signer}
+
+	challenge, err := signer.GenerateMFAChallengeJWT("admin", context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		code    string
+		wantErr bool
+	}{
+		{name: "unknown code", code: "eeee-ffff", wantErr: true},
+		{name: "first use", code: "AAAA-BBBB"},
+		{name: "second use of the same code", code: "aaaa-bbbb", wantErr: true},
+		{name: "another code", code: "cccc-dddd"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token, err := CompleteAdminMFALogin(models.AdminMFALoginInput{ChallengeToken: challenge, RecoveryCode: tt.code}, services, context.Background())
+			if tt.wantErr {
+				var unauthorized ErrCodeUnauthorized
+				if !errors.As(err, &unauthorized) {
+					t.Fatalf("CompleteAdminMFALogin() error = %v, want ErrCodeUnauthorized", err)
+				}
+				return
+			}
+			if err != nil || token == "" {
+				t.Fatalf("CompleteAdminMFALogin() = %q, %v", token, err)
+			}
+		})
+	}
+
+	if len(store.codes) != 0 {
+		t.Errorf("codes left = %v, want none", store.codes)
+	}
+}
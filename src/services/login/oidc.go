@@ -0,0 +1,114 @@
+package loginservice
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"strings"
+
+	"github.com/JaxonAdams/blog-backend/src/models"
+	"github.com/JaxonAdams/blog-backend/src/services/config"
+	"github.com/JaxonAdams/blog-backend/src/services/oidc"
+)
+
+type OIDCAuthorization struct {
+	AuthorizationURL string `json:"authorization_url"`
+	StateToken       string `json:"state_token"`
+}
+
+func BeginOIDCLogin(services models.HandlerServices, ctx context.Context) (OIDCAuthorization, error) {
+	state, err := oidc.GenerateNonce()
+	if err != nil {
+		return OIDCAuthorization{}, err
+	}
+
+	nonce, err := oidc.GenerateNonce()
+	if err != nil {
+		return OIDCAuthorization{}, err
+	}
+
+	codeVerifier, err := oidc.GenerateCodeVerifier()
+	if err != nil {
+		return OIDCAuthorization{}, err
+	}
+
+	authURL, err := services.OIDCClient.AuthCodeURL(ctx, state, nonce, codeVerifier)
+	if err != nil {
+		return OIDCAuthorization{}, err
+	}
+
+	// The verifier and nonce travel back with the client in a signed token,
+	// so no server-side session storage is needed
+	stateToken, err := services.JWT.GenerateOIDCStateJWT(state, nonce, codeVerifier, ctx)
+	if err != nil {
+		return OIDCAuthorization{}, err
+	}
+
+	return OIDCAuthorization{
+		AuthorizationURL: authURL,
+		StateToken:       stateToken,
+	}, nil
+}
+
+func CompleteOIDCLogin(input models.OIDCCallbackInput, services models.HandlerServices, ctx context.Context) (string, error) {
+	stateClaims, err := services.JWT.ParseOIDCStateJWT(input.StateToken, ctx)
+	if err != nil {
+		return "", ErrCodeUnauthorized{Msg: err.Error()}
+	}
+
+	if stateClaims.State != input.State {
+		return "", ErrCodeUnauthorized{Msg: "state mismatch"}
+	}
+
+	tokens, err := services.OIDCClient.Exchange(ctx, input.Code, stateClaims.CodeVerifier)
+	if err != nil {
+		var exchangeErr oidc.ErrCodeTokenExchange
+		if errors.As(err, &exchangeErr) {
+			return "", ErrCodeUnauthorized{Msg: err.Error()}
+		}
+		return "", err
+	}
+
+	claims, err := services.OIDCClient.VerifyIDToken(ctx, tokens.IDToken, stateClaims.Nonce)
+	if err != nil {
+		var idTokenErr oidc.ErrCodeInvalidIDToken
+		if errors.As(err, &idTokenErr) {
+			return "", ErrCodeUnauthorized{Msg: err.Error()}
+		}
+		return "", err
+	}
+
+	role, ok := mapOIDCRole(claims, services.Config.OIDC)
+	if !ok {
+		return "", ErrCodeUnauthorized{Msg: "identity is not mapped to a blog role"}
+	}
+
+	return services.JWT.GenerateJWT(oidcSubject(claims), role, ctx)
+}
+
+// oidcSubject names an OIDC user apart from local admin users, so their
+// audit entries and MFA enrollment can never be taken for a local user's.
+// The email is only used once verified, as anyone can claim one.
+func oidcSubject(claims oidc.IDTokenClaims) string {
+	if claims.Email != "" && claims.EmailVerified != nil && *claims.EmailVerified {
+		return "oidc:" + strings.ToLower(claims.Email)
+	}
+	return "oidc:" + claims.Subject
+}
+
+func mapOIDCRole(claims oidc.IDTokenClaims, oidcConfig config.OIDCConfig) (string, bool) {
+	// Anyone can put an address they do not own on an unverified account, so
+	// a missing email_verified claim does not count
+	emailVerified := claims.EmailVerified != nil && *claims.EmailVerified
+	if claims.Email != "" && emailVerified && slices.Contains(oidcConfig.AdminEmails, strings.ToLower(claims.Email)) {
+		return "admin", true
+	}
+
+	for _, group := range claims.StringSlice(oidcConfig.GroupsClaim) {
+		if slices.Contains(oidcConfig.AdminGroups, strings.ToLower(group)) {
+			return "admin", true
+		}
+	}
+
+	return "", false
+}
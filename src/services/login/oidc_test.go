@@ -0,0 +1,101 @@
+package loginservice
+
+import (
+	"testing"
+
+	"github.com/JaxonAdams/blog-backend/src/services/config"
+	"github.com/JaxonAdams/blog-backend/src/services/oidc"
+	gojwt "github.com/golang-jwt/jwt/v5"
+)
+
+func TestMapOIDCRole(t *testing.T) {
+	verified, unverified := true, false
+	oidcConfig := config.OIDCConfig{
+		AdminEmails: []string{"admin@example.com"},
+		AdminGroups: []string{"blog-admins"},
+		GroupsClaim: "groups",
+	}
+
+	tests := []struct {
+		name   string
+		claims oidc.IDTokenClaims
+		want   bool
+	}{
+		{
+			name:   "verified admin email",
+			claims: oidc.IDTokenClaims{Email: "Admin@Example.com", EmailVerified: &verified},
+			want:   true,
+		},
+		{
+			name:   "unverified admin email",
+			claims: oidc.IDTokenClaims{Email: "admin@example.com", EmailVerified: &unverified},
+		},
+		{
+			name:   "admin email without email_verified",
+			claims: oidc.IDTokenClaims{Email: "admin@example.com"},
+		},
+		{
+			name:   "verified email of someone else",
+			claims: oidc.IDTokenClaims{Email: "reader@example.com", EmailVerified: &verified},
+		},
+		{
+			name: "admin group",
+			claims: oidc.IDTokenClaims{
+				Email: "reader@example.com",
+				Extra: map[string]any{"groups": []any{"Blog-Admins"}},
+			},
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			role, ok := mapOIDCRole(tt.claims, oidcConfig)
+			if ok != tt.want {
+				t.Fatalf("mapOIDCRole() ok = %v, want %v", ok, tt.want)
+			}
+			if ok && role != "admin" {
+				t.Errorf("mapOIDCRole() role = %q, want admin", role)
+			}
+		})
+	}
+}
+
+func TestOIDCSubject(t *testing.T) {
+	verified, unverified := true, false
+
+	tests := []struct {
+		name   string
+		claims oidc.IDTokenClaims
+		want   string
+	}{
+		{
+			name:   "verified email",
+			claims: oidc.IDTokenClaims{RegisteredClaims: gojwt.RegisteredClaims{Subject: "1234"}, Email: "Admin@Example.com", EmailVerified: &verified},
+			want:   "oidc:admin@example.com",
+		},
+		{
+			name:   "unverified email",
+			claims: oidc.IDTokenClaims{RegisteredClaims: gojwt.RegisteredClaims{Subject: "1234"}, Email: "admin", EmailVerified: &unverified},
+			want:   "oidc:1234",
+		},
+		{
+			name:   "email without email_verified",
+			claims: oidc.IDTokenClaims{RegisteredClaims: gojwt.RegisteredClaims{Subject: "1234"}, Email: "admin"},
+			want:   "oidc:1234",
+		},
+		{
+			name:   "no email",
+			claims: oidc.IDTokenClaims{RegisteredClaims: gojwt.RegisteredClaims{Subject: "admin"}},
+			want:   "oidc:admin",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := oidcSubject(tt.claims); got != tt.want {
+				t.Errorf("oidcSubject() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
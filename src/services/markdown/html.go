@@ -0,0 +1,436 @@
+package markdown
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Elements with no Markdown equivalent. Media keep a link to their source.
+var unsupportedElements = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Iframe:   true,
+	atom.Video:    true,
+	atom.Audio:    true,
+	atom.Embed:    true,
+	atom.Object:   true,
+	atom.Form:     true,
+	atom.Canvas:   true,
+	atom.Svg:      true,
+	atom.Noscript: true,
+}
+
+var blockElements = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Section: true, atom.Article: true,
+	atom.Header: true, atom.Footer: true, atom.Main: true, atom.Aside: true,
+	atom.Nav: true, atom.Figure: true, atom.Figcaption: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Ul: true, atom.Ol: true, atom.Blockquote: true, atom.Pre: true,
+	atom.Hr: true, atom.Table: true, atom.Dl: true,
+}
+
+var (
+	spaceRun        = regexp.MustCompile(`[ \t\r\n\f]+`)
+	blockLineMarker = regexp.MustCompile(`^(#|>|[-+] |\d+[.)] )`)
+	listItem        = regexp.MustCompile(`^(- |\d+\. )`)
+	blankIndent     = regexp.MustCompile(`(?m)^ +$`)
+	markdownSpecial = strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`)
+)
+
+// HTMLToMd converts HTML, e.g. a post exported from another blog, to
+// Markdown. It also returns the elements it could not convert, which are
+// dropped or, for media, replaced by a link.
+func HTMLToMd(source string) (string, []string) {
+	nodes, err := html.ParseFragment(strings.NewReader(source), &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body})
+	if err != nil {
+		return strings.TrimSpace(source), []string{"unparseable HTML"}
+	}
+
+	root := &html.Node{Type: html.ElementNode, Data: "body", DataAtom: atom.Body}
+	for _, node := range nodes {
+		root.AppendChild(node)
+	}
+
+	c := converter{unsupported: map[string]bool{}}
+	md := c.blocks(root, false)
+
+	var unsupported []string
+	for name := range c.unsupported {
+		unsupported = append(unsupported, name)
+	}
+	sort.Strings(unsupported)
+
+	return strings.TrimSpace(md) + "\n", unsupported
+}
+
+type converter struct {
+	unsupported map[string]bool
+}
+
+// blocks renders n's children as Markdown blocks, gathering runs of inline
+// content into paragraphs. Tight blocks, as in list items, put nested lists
+// directly under their text.
+func (c *converter) blocks(n *html.Node, tight bool) string {
+	var parts []string
+	var inline strings.Builder
+
+	flush := func() {
+		if text := c.finishInline(inline.String()); text != "" {
+			parts = append(parts, text)
+		}
+		inline.Reset()
+	}
+
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.ElementNode && (blockElements[child.DataAtom] || unsupportedElements[child.DataAtom]) {
+			flush()
+			if block := c.block(child); block != "" {
+				parts = append(parts, block)
+			}
+			continue
+		}
+		inline.WriteString(c.inline(child))
+	}
+	flush()
+
+	var b strings.Builder
+	for i, part := range parts {
+		if i > 0 {
+			if tight && isList(part) {
+				b.WriteString("\n")
+			} else {
+				b.WriteString("\n\n")
+			}
+		}
+		b.WriteString(part)
+	}
+	return b.String()
+}
+
+func isList(block string) bool {
+	return listItem.MatchString(block)
+}
+
+func (c *converter) block(n *html.Node) string {
+	if unsupportedElements[n.DataAtom] {
+		return c.unsupportedElement(n)
+	}
+
+	switch n.DataAtom {
+	case atom.P, atom.Figcaption:
+		return c.finishInline(c.inlineChildren(n))
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+		level := int(n.Data[1] - '0')
+		text := c.finishInline(c.inlineChildren(n))
+		if text == "" {
+			return ""
+		}
+		return strings.Repeat("#", level) + " " + strings.ReplaceAll(text, "  \n", " ")
+	case atom.Ul, atom.Ol:
+		return c.list(n)
+	case atom.Blockquote:
+		inner := c.blocks(n, false)
+		if inner == "" {
+			return ""
+		}
+		return prefixLines(inner, "> ", ">")
+	case atom.Pre:
+		return codeBlock(n)
+	case atom.Hr:
+		return "---"
+	case atom.Table:
+		return c.table(n)
+	case atom.Dl:
+		return c.definitionList(n)
+	default:
+		return c.blocks(n, false)
+	}
+}
+
+func (c *converter) unsupportedElement(n *html.Node) string {
+	c.unsupported[n.Data] = true
+
+	src := attr(n, "src")
+	if src == "" {
+		if source := findElement(n, atom.Source); source != nil {
+			src = attr(source, "src")
+		}
+	}
+	if src == "" || n.DataAtom == atom.Script {
+		return ""
+	}
+	return fmt.Sprintf("[%s](%s)", n.Data, src)
+}
+
+func (c *converter) list(n *html.Node) string {
+	var items []string
+	number := 1
+	if start := attr(n, "start"); start != "" {
+		fmt.Sscanf(start, "%d", &number)
+	}
+
+	for item := n.FirstChild; item != nil; item = item.NextSibling {
+		if item.Type != html.ElementNode || item.DataAtom != atom.Li {
+			continue
+		}
+
+		marker := "- "
+		if n.DataAtom == atom.Ol {
+			marker = fmt.Sprintf("%d. ", number)
+			number++
+		}
+
+		content := c.blocks(item, true)
+		indent := strings.Repeat(" ", len(marker))
+		items = append(items, marker+strings.ReplaceAll(content, "\n", "\n"+indent))
+	}
+
+	// Blank continuation lines must not carry the indent
+	return blankIndent.ReplaceAllString(strings.Join(items, "\n"), "")
+}
+
+func (c *converter) table(n *html.Node) string {
+	var rows [][]string
+	var walk func(*html.Node)
+	walk = func(node *html.Node) {
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type != html.ElementNode {
+				continue
+			}
+			if child.DataAtom != atom.Tr {
+				walk(child)
+				continue
+			}
+
+			var cells []string
+			for cell := child.FirstChild; cell != nil; cell = cell.NextSibling {
+				if cell.Type == html.ElementNode && (cell.DataAtom == atom.Td || cell.DataAtom == atom.Th) {
+					text := c.finishInline(c.inlineChildren(cell))
+					text = strings.ReplaceAll(strings.ReplaceAll(text, "  \n", " "), "|", `\|`)
+					cells = append(cells, text)
+				}
+			}
+			rows = append(rows, cells)
+		}
+	}
+	walk(n)
+
+	if len(rows) == 0 {
+		return ""
+	}
+
+	width := 0
+	for _, row := range rows {
+		width = max(width, len(row))
+	}
+
+	var b strings.Builder
+	for i, row := range rows {
+		for len(row) < width {
+			row = append(row, "")
+		}
+		b.WriteString("| " + strings.Join(row, " | ") + " |\n")
+		if i == 0 {
+			b.WriteString("|" + strings.Repeat(" --- |", width) + "\n")
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func (c *converter) definitionList(n *html.Node) string {
+	var lines []string
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type != html.ElementNode {
+			continue
+		}
+		text := c.finishInline(c.inlineChildren(child))
+		switch child.DataAtom {
+		case atom.Dt:
+			lines = append(lines, "**"+text+"**")
+		case atom.Dd:
+			lines = append(lines, ": "+text)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func codeBlock(n *html.Node) string {
+	code := textContent(n)
+	language := ""
+	if inner := findElement(n, atom.Code); inner != nil {
+		for _, class := range strings.Fields(attr(inner, "class")) {
+			if lang, ok := strings.CutPrefix(class, "language-"); ok {
+				language = lang
+			}
+		}
+	}
+
+	fence := "```"
+	for strings.Contains(code, fence) {
+		fence += "`"
+	}
+	return fence + language + "\n" + strings.TrimSuffix(code, "\n") + "\n" + fence
+}
+
+func (c *converter) inlineChildren(n *html.Node) string {
+	var b strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		b.WriteString(c.inline(child))
+	}
+	return b.String()
+}
+
+// Hard line breaks are marked while inline content is built, as whitespace
+// is collapsed afterwards
+const lineBreak = "\x00"
+
+func (c *converter) inline(n *html.Node) string {
+	switch n.Type {
+	case html.TextNode:
+		return markdownSpecial.Replace(n.Data)
+	case html.ElementNode:
+	default:
+		return ""
+	}
+
+	if unsupportedElements[n.DataAtom] {
+		return c.unsupportedElement(n)
+	}
+
+	switch n.DataAtom {
+	case atom.Br:
+		return lineBreak
+	case atom.Strong, atom.B:
+		return wrap(c.inlineChildren(n), "**")
+	case atom.Em, atom.I:
+		return wrap(c.inlineChildren(n), "*")
+	case atom.Del, atom.S, atom.Strike:
+		return wrap(c.inlineChildren(n), "~~")
+	case atom.Code, atom.Kbd, atom.Samp, atom.Tt:
+		return inlineCode(textContent(n))
+	case atom.A:
+		text := c.inlineChildren(n)
+		href := attr(n, "href")
+		if href == "" || strings.TrimSpace(text) == "" {
+			return text
+		}
+		return fmt.Sprintf("[%s](%s%s)", strings.TrimSpace(text), escapeURL(href), title(n))
+	case atom.Img:
+		src := attr(n, "src")
+		if src == "" {
+			return ""
+		}
+		return fmt.Sprintf("![%s](%s%s)", markdownSpecial.Replace(attr(n, "alt")), escapeURL(src), title(n))
+	default:
+		// Block content nested in inline content, e.g. a list in a link,
+		// is flattened
+		if blockElements[n.DataAtom] {
+			return " " + c.inlineChildren(n) + " "
+		}
+		return c.inlineChildren(n)
+	}
+}
+
+// finishInline collapses whitespace and turns the line break markers into
+// Markdown hard breaks.
+func (c *converter) finishInline(text string) string {
+	text = spaceRun.ReplaceAllString(text, " ")
+	text = strings.ReplaceAll(text, " "+lineBreak, lineBreak)
+	text = strings.ReplaceAll(text, lineBreak+" ", lineBreak)
+	text = strings.Trim(text, " "+lineBreak)
+
+	lines := strings.Split(text, lineBreak)
+	for i, line := range lines {
+		// Escape text that would otherwise start a heading, quote or list
+		if blockLineMarker.MatchString(line) {
+			lines[i] = `\` + line
+		}
+	}
+	return strings.Join(lines, "  \n")
+}
+
+// wrap puts markers around text, keeping surrounding spaces outside them so
+// the emphasis still parses.
+func wrap(text, marker string) string {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return text
+	}
+
+	leading := text[:len(text)-len(strings.TrimLeft(text, " \t\n"))]
+	trailing := text[len(strings.TrimRight(text, " \t\n")):]
+	return leading + marker + trimmed + marker + trailing
+}
+
+func inlineCode(code string) string {
+	code = spaceRun.ReplaceAllString(code, " ")
+	fence := "`"
+	for strings.Contains(code, fence) {
+		fence += "`"
+	}
+	if strings.HasPrefix(code, "`") || strings.HasSuffix(code, "`") {
+		code = " " + code + " "
+	}
+	return fence + code + fence
+}
+
+func title(n *html.Node) string {
+	if t := attr(n, "title"); t != "" {
+		return fmt.Sprintf(" %q", t)
+	}
+	return ""
+}
+
+func escapeURL(url string) string {
+	return strings.NewReplacer(" ", "%20", "(", "%28", ")", "%29").Replace(url)
+}
+
+func prefixLines(text, prefix, emptyPrefix string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		if line == "" {
+			lines[i] = emptyPrefix
+		} else {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func attr(n *html.Node, name string) string {
+	for _, a := range n.Attr {
+		if a.Key == name {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func findElement(n *html.Node, a atom.Atom) *html.Node {
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.ElementNode && child.DataAtom == a {
+			return child
+		}
+		if found := findElement(child, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func textContent(n *html.Node) string {
+	if n.Type == html.TextNode {
+		return n.Data
+	}
+
+	var b strings.Builder
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		b.WriteString(textContent(child))
+	}
+	return b.String()
+}
@@ -0,0 +1,99 @@
+package markdown
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestHTMLToMd(t *testing.T) {
+	tests := []struct {
+		name            string
+		html            string
+		want            string
+		wantUnsupported []string
+	}{
+		{
+			name: "paragraphs and inline markup",
+			html: "<p>Some <strong>bold</strong>, <em>italic</em> and <code>code</code>.</p>\n<p>A <a href=\"https://example.com/a b\" title=\"Example\">link</a><br>and a break.</p>",
+			want: "Some **bold**, *italic* and `code`.\n\nA [link](https://example.com/a%20b \"Example\")  \nand a break.\n",
+		},
+		{
+			name: "unordered list",
+			html: "<ul>\n<li>One</li>\n<li>Two</li>\n</ul>",
+			want: "- One\n- Two\n",
+		},
+		{
+			name: "ordered list with start",
+			html: `<ol start="3"><li>Three</li><li>Four</li></ol>`,
+			want: "3. Three\n4. Four\n",
+		},
+		{
+			name: "nested list",
+			html: "<ul><li>Fruit<ul><li>Apple</li><li>Pear</li></ul></li><li>Bread</li></ul>",
+			want: "- Fruit\n  - Apple\n  - Pear\n- Bread\n",
+		},
+		{
+			name: "list item with paragraphs",
+			html: "<ol><li><p>First</p><p>More</p></li><li><p>Second</p></li></ol>",
+			want: "1. First\n\n   More\n2. Second\n",
+		},
+		{
+			name: "code block keeps its text and language",
+			html: "<pre><code class=\"language-go\">if a &lt; b {\n\treturn *p\n}\n</code></pre>",
+			want: "```go\nif a < b {\n\treturn *p\n}\n```\n",
+		},
+		{
+			name: "code block containing a fence",
+			html: "<pre>```\nfenced\n```</pre>",
+			want: "````\n```\nfenced\n```\n````\n",
+		},
+		{
+			name: "blockquote",
+			html: "<blockquote><p>Quoted</p><p>Second paragraph</p></blockquote>",
+			want: "> Quoted\n>\n> Second paragraph\n",
+		},
+		{
+			name: "nested blockquote",
+			html: "<blockquote><p>Outer</p><blockquote><p>Inner</p></blockquote></blockquote>",
+			want: "> Outer\n>\n> > Inner\n",
+		},
+		{
+			name: "entities are decoded and Markdown is escaped",
+			html: "<p>Fish &amp; chips &mdash; 5 &lt; 6 &quot;quoted&quot; &#8220;curly&#8221; *not bold* [x]</p>",
+			want: "Fish & chips — 5 < 6 \"quoted\" “curly” \\*not bold\\* \\[x\\]\n",
+		},
+		{
+			name: "text that would start a block is escaped",
+			html: "<p># not a heading</p><p>1. not a list</p>",
+			want: "\\# not a heading\n\n\\1. not a list\n",
+		},
+		{
+			name: "headings and rules",
+			html: "<h2>Title</h2><hr><h3>Sub</h3>",
+			want: "## Title\n\n---\n\n### Sub\n",
+		},
+		{
+			name: "table",
+			html: "<table><tr><th>A</th><th>B</th></tr><tr><td>1</td><td>x|y</td></tr></table>",
+			want: "| A | B |\n| --- | --- |\n| 1 | x\\|y |\n",
+		},
+		{
+			name:            "unsupported elements are reported",
+			html:            "<p>Before</p><script>alert(1)</script><iframe src=\"https://example.com/embed\"></iframe>",
+			want:            "Before\n\n[iframe](https://example.com/embed)\n",
+			wantUnsupported: []string{"iframe", "script"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, unsupported := HTMLToMd(tt.html)
+			if got != tt.want {
+				t.Errorf("HTMLToMd() =\n%q\nwant\n%q", got, tt.want)
+			}
+			if !slices.Equal(unsupported, tt.wantUnsupported) {
+				t.Errorf("unsupported = %v, want %v", unsupported, tt.wantUnsupported)
+			}
+		})
+	}
+}
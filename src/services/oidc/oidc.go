@@ -0,0 +1,394 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/JaxonAdams/blog-backend/src/services/apperror"
+	appconfig "github.com/JaxonAdams/blog-backend/src/services/config"
+	"github.com/JaxonAdams/blog-backend/src/services/secrets"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type ProviderMetadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+type Config struct {
+	IssuerURL   string
+	ClientID    string
+	RedirectURI string
+	Scopes      []string
+	// Supplies OIDC_CLIENT_SECRET. Public clients have none and authenticate
+	// with PKCE alone.
+	Secrets secrets.Provider
+}
+
+type Client struct {
+	config     Config
+	httpClient *http.Client
+
+	mu       sync.Mutex
+	metadata *ProviderMetadata
+	keys     map[string]*rsa.PublicKey
+}
+
+type IDTokenClaims struct {
+	Email         string `json:"email"`
+	EmailVerified *bool  `json:"email_verified,omitempty"`
+	Nonce         string `json:"nonce"`
+	jwt.RegisteredClaims
+	Extra map[string]any `json:"-"`
+}
+
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	IDToken     string `json:"id_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+func New(config Config, httpClient *http.Client) *Client {
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "email", "profile"}
+	}
+
+	return &Client{
+		config:     config,
+		httpClient: httpClient,
+	}
+}
+
+func NewFromConfig(appConfig *appconfig.Config, secretProvider secrets.Provider) *Client {
+	return New(Config{
+		IssuerURL:   appConfig.OIDC.IssuerURL,
+		ClientID:    appConfig.OIDC.ClientID,
+		RedirectURI: appConfig.OIDC.RedirectURI,
+		Scopes:      appConfig.OIDC.Scopes,
+		Secrets:     secretProvider,
+	}, nil)
+}
+
+func (c *Client) Discover(ctx context.Context) (ProviderMetadata, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.metadata != nil {
+		return *c.metadata, nil
+	}
+
+	wellKnown := strings.TrimSuffix(c.config.IssuerURL, "/") + "/.well-known/openid-configuration"
+
+	var metadata ProviderMetadata
+	if err := c.getJSON(ctx, wellKnown, &metadata); err != nil {
+		return ProviderMetadata{}, fmt.Errorf("failed to fetch provider metadata: %w", err)
+	}
+
+	if strings.TrimSuffix(metadata.Issuer, "/") != strings.TrimSuffix(c.config.IssuerURL, "/") {
+		return ProviderMetadata{}, fmt.Errorf("issuer mismatch: expected %s, got %s", c.config.IssuerURL, metadata.Issuer)
+	}
+
+	if metadata.AuthorizationEndpoint == "" || metadata.TokenEndpoint == "" || metadata.JWKSURI == "" {
+		return ProviderMetadata{}, fmt.Errorf("provider metadata is missing required endpoints")
+	}
+
+	c.metadata = &metadata
+	return metadata, nil
+}
+
+func (c *Client) AuthCodeURL(ctx context.Context, state, nonce, codeVerifier string) (string, error) {
+	metadata, err := c.Discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", c.config.ClientID)
+	params.Set("redirect_uri", c.config.RedirectURI)
+	params.Set("scope", strings.Join(c.config.Scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", CodeChallenge(codeVerifier))
+	params.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(metadata.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return metadata.AuthorizationEndpoint + separator + params.Encode(), nil
+}
+
+func (c *Client) Exchange(ctx context.Context, code, codeVerifier string) (TokenResponse, error) {
+	metadata, err := c.Discover(ctx)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", c.config.RedirectURI)
+	form.Set("client_id", c.config.ClientID)
+	form.Set("code_verifier", codeVerifier)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	clientSecret, err := c.clientSecret(ctx)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+	if clientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(c.config.ClientID), url.QueryEscape(clientSecret))
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return TokenResponse{}, fmt.Errorf("token request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return TokenResponse{}, ErrCodeTokenExchange{Msg: fmt.Sprintf("token endpoint returned %d: %s", resp.StatusCode, body)}
+	}
+
+	var tokens TokenResponse
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return TokenResponse{}, fmt.Errorf("invalid token response: %w", err)
+	}
+
+	if tokens.IDToken == "" {
+		return TokenResponse{}, ErrCodeTokenExchange{Msg: "token response did not include an id_token"}
+	}
+
+	return tokens, nil
+}
+
+func (c *Client) VerifyIDToken(ctx context.Context, rawIDToken, expectedNonce string) (IDTokenClaims, error) {
+	metadata, err := c.Discover(ctx)
+	if err != nil {
+		return IDTokenClaims{}, err
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(rawIDToken, claims, func(token *jwt.Token) (any, error) {
+		kid, _ := token.Header["kid"].(string)
+		return c.publicKey(ctx, metadata.JWKSURI, kid)
+	},
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512"}),
+		jwt.WithIssuer(metadata.Issuer),
+		jwt.WithAudience(c.config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return IDTokenClaims{}, ErrCodeInvalidIDToken{Msg: err.Error()}
+	}
+
+	raw, err := json.Marshal(claims)
+	if err != nil {
+		return IDTokenClaims{}, err
+	}
+
+	var idClaims IDTokenClaims
+	if err := json.Unmarshal(raw, &idClaims); err != nil {
+		return IDTokenClaims{}, ErrCodeInvalidIDToken{Msg: err.Error()}
+	}
+	idClaims.Extra = claims
+
+	if idClaims.Nonce != expectedNonce {
+		return IDTokenClaims{}, ErrCodeInvalidIDToken{Msg: "id token nonce mismatch"}
+	}
+
+	return idClaims, nil
+}
+
+func (c IDTokenClaims) StringSlice(claim string) []string {
+	switch v := c.Extra[claim].(type) {
+	case []any:
+		values := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	case string:
+		return strings.Fields(v)
+	default:
+		return nil
+	}
+}
+
+func GenerateCodeVerifier() (string, error) {
+	return randomString(32)
+}
+
+func GenerateNonce() (string, error) {
+	return randomString(16)
+}
+
+func CodeChallenge(codeVerifier string) string {
+	sum := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// clientSecret is read on each exchange, so a rotated secret is picked up
+// once the provider's cache refreshes.
+func (c *Client) clientSecret(ctx context.Context) (string, error) {
+	if c.config.Secrets == nil {
+		return "", nil
+	}
+
+	secret, err := c.config.Secrets.GetSecret(ctx, secrets.OIDCClientSecret)
+	if err != nil {
+		var notFound secrets.ErrCodeSecretNotFound
+		if errors.As(err, &notFound) {
+			return "", nil
+		}
+		return "", fmt.Errorf("failed to read the OIDC client secret: %w", err)
+	}
+
+	return secret, nil
+}
+
+func (c *Client) publicKey(ctx context.Context, jwksURI, kid string) (*rsa.PublicKey, error) {
+	c.mu.Lock()
+	key, ok := c.keys[kid]
+	c.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	// Unknown key ID, so the provider may have rotated its keys
+	var jwks struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+		} `json:"keys"`
+	}
+	if err := c.getJSON(ctx, jwksURI, &jwks); err != nil {
+		return nil, fmt.Errorf("failed to fetch jwks: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, k := range jwks.Keys {
+		if k.Kty != "RSA" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			continue
+		}
+
+		keys[k.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+
+	c.mu.Lock()
+	c.keys = keys
+	c.mu.Unlock()
+
+	key, ok = keys[kid]
+	if !ok {
+		// Providers with a single key may omit kid from the token header
+		if kid == "" && len(keys) == 1 {
+			for _, only := range keys {
+				return only, nil
+			}
+		}
+		return nil, fmt.Errorf("no signing key found for kid %q", kid)
+	}
+
+	return key, nil
+}
+
+func (c *Client) getJSON(ctx context.Context, target string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %d", target, resp.StatusCode)
+	}
+
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(out)
+}
+
+func randomString(size int) (string, error) {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+type ErrCodeTokenExchange struct {
+	Msg string
+}
+
+func (e ErrCodeTokenExchange) Error() string {
+	return e.Msg
+}
+
+type ErrCodeInvalidIDToken struct {
+	Msg string
+}
+
+func (e ErrCodeInvalidIDToken) Error() string {
+	return e.Msg
+}
+
+func (e ErrCodeInvalidIDToken) ErrorCode() apperror.Code {
+	return apperror.CodeUnauthorized
+}
@@ -0,0 +1,348 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/JaxonAdams/blog-backend/src/services/secrets"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID = "blog"
+	testKeyID    = "test-key"
+)
+
+// mockProvider is an identity provider serving discovery, JWKS and the token
+// endpoint. Codes are issued with authorize, standing in for the
+// browser's trip through the authorization endpoint.
+type mockProvider struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	// Required as HTTP basic auth by the token endpoint if set
+	clientSecret string
+
+	mu    sync.Mutex
+	codes map[string]issuedCode
+}
+
+type issuedCode struct {
+	challenge string
+	claims    jwt.MapClaims
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &mockProvider{t: t, key: key, codes: map[string]issuedCode{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, ProviderMetadata{
+			Issuer:                p.server.URL,
+			AuthorizationEndpoint: p.server.URL + "/authorize",
+			TokenEndpoint:         p.server.URL + "/token",
+			JWKSURI:               p.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{
+			"keys": []map[string]string{{
+				"kid": testKeyID,
+				"kty": "RSA",
+				"use": "sig",
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("POST /token", p.token)
+
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+	return p
+}
+
+func (p *mockProvider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	p.mu.Lock()
+	issued, ok := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.mu.Unlock()
+
+	if p.clientSecret != "" {
+		id, secret, _ := r.BasicAuth()
+		if id != testClientID || secret != p.clientSecret {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+			return
+		}
+	}
+
+	if !ok || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	if CodeChallenge(r.PostForm.Get("code_verifier")) != issued.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, TokenResponse{
+		AccessToken: "access",
+		IDToken:     p.sign(issued.claims),
+		TokenType:   "Bearer",
+		ExpiresIn:   300,
+	})
+}
+
+// authorize follows the authorization URL as a browser would and issues a
+// code for the challenge and nonce it carries.
+func (p *mockProvider) authorize(authURL string, claims jwt.MapClaims) string {
+	p.t.Helper()
+
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	query := parsed.Query()
+	if query.Get("code_challenge_method") != "S256" {
+		p.t.Fatalf("code_challenge_method = %q, want S256", query.Get("code_challenge_method"))
+	}
+	if _, ok := claims["nonce"]; !ok {
+		claims["nonce"] = query.Get("nonce")
+	}
+
+	code := "code-" + query.Get("state")
+	p.mu.Lock()
+	p.codes[code] = issuedCode{challenge: query.Get("code_challenge"), claims: claims}
+	p.mu.Unlock()
+	return code
+}
+
+func (p *mockProvider) sign(claims jwt.MapClaims) string {
+	p.t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = testKeyID
+	signed, err := token.SignedString(p.key)
+	if err != nil {
+		p.t.Fatal(err)
+	}
+	return signed
+}
+
+func (p *mockProvider) claims(now time.Time) jwt.MapClaims {
+	return jwt.MapClaims{
+		"iss":            p.server.URL,
+		"sub":            "user-1",
+		"aud":            testClientID,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+		"email":          "admin@example.com",
+		"email_verified": true,
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func TestLogin(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name string
+		// Changes the ID token's claims before the provider signs it
+		claims func(jwt.MapClaims)
+		// Verifier sent to the token endpoint, if not the one the URL was made from
+		verifier string
+		// Nonce expected when verifying, if not the one sent to the provider
+		nonce        string
+		wantExchange bool
+		wantIDToken  bool
+	}{
+		{
+			name: "valid login",
+		},
+		{
+			name:         "PKCE verifier does not match the challenge",
+			verifier:     "not-the-verifier",
+			wantExchange: true,
+		},
+		{
+			name:        "nonce mismatch",
+			nonce:       "another-login",
+			wantIDToken: true,
+		},
+		{
+			name:        "wrong audience",
+			claims:      func(c jwt.MapClaims) { c["aud"] = "another-client" },
+			wantIDToken: true,
+		},
+		{
+			name: "expired token",
+			claims: func(c jwt.MapClaims) {
+				c["iat"] = now.Add(-time.Hour).Unix()
+				c["exp"] = now.Add(-10 * time.Minute).Unix()
+			},
+			wantIDToken: true,
+		},
+		{
+			name:        "wrong issuer",
+			claims:      func(c jwt.MapClaims) { c["iss"] = "https://attacker.example.com" },
+			wantIDToken: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newMockProvider(t)
+			client := New(Config{
+				IssuerURL:   provider.server.URL,
+				ClientID:    testClientID,
+				RedirectURI: "https://blog.example.com/callback",
+			}, provider.server.Client())
+			ctx := context.Background()
+
+			verifier, err := GenerateCodeVerifier()
+			if err != nil {
+				t.Fatal(err)
+			}
+			nonce, err := GenerateNonce()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			authURL, err := client.AuthCodeURL(ctx, "state", nonce, verifier)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			claims := provider.claims(now)
+			if tt.claims != nil {
+				tt.claims(claims)
+			}
+			code := provider.authorize(authURL, claims)
+
+			exchangeVerifier := verifier
+			if tt.verifier != "" {
+				exchangeVerifier = tt.verifier
+			}
+			tokens, err := client.Exchange(ctx, code, exchangeVerifier)
+			if tt.wantExchange {
+				var exchangeErr ErrCodeTokenExchange
+				if !errors.As(err, &exchangeErr) {
+					t.Fatalf("Exchange() error = %v, want ErrCodeTokenExchange", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Exchange() error = %v", err)
+			}
+
+			expectedNonce := nonce
+			if tt.nonce != "" {
+				expectedNonce = tt.nonce
+			}
+			idClaims, err := client.VerifyIDToken(ctx, tokens.IDToken, expectedNonce)
+			if tt.wantIDToken {
+				var idTokenErr ErrCodeInvalidIDToken
+				if !errors.As(err, &idTokenErr) {
+					t.Fatalf("VerifyIDToken() error = %v, want ErrCodeInvalidIDToken", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyIDToken() error = %v", err)
+			}
+
+			if idClaims.Email != "admin@example.com" || idClaims.EmailVerified == nil || !*idClaims.EmailVerified {
+				t.Errorf("claims = %+v, want the provider's verified email", idClaims)
+			}
+		})
+	}
+}
+
+// staticSecrets holds secrets in memory; missing ones are not found.
+type staticSecrets map[string]string
+
+func (s staticSecrets) GetSecret(ctx context.Context, name string) (string, error) {
+	value, ok := s[name]
+	if !ok {
+		return "", secrets.ErrCodeSecretNotFound{Msg: name + " is not set"}
+	}
+	return value, nil
+}
+
+func TestExchangeClientSecret(t *testing.T) {
+	tests := []struct {
+		name           string
+		providerSecret string
+		stored         staticSecrets
+		wantErr        bool
+	}{
+		{
+			name:           "confidential client",
+			providerSecret: "s3cret",
+			stored:         staticSecrets{secrets.OIDCClientSecret: "s3cret"},
+		},
+		{
+			name:           "wrong secret",
+			providerSecret: "s3cret",
+			stored:         staticSecrets{secrets.OIDCClientSecret: "rotated-away"},
+			wantErr:        true,
+		},
+		{
+			name:   "public client without a stored secret",
+			stored: staticSecrets{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newMockProvider(t)
+			provider.clientSecret = tt.providerSecret
+			client := New(Config{
+				IssuerURL:   provider.server.URL,
+				ClientID:    testClientID,
+				RedirectURI: "https://blog.example.com/callback",
+				Secrets:     tt.stored,
+			}, provider.server.Client())
+			ctx := context.Background()
+
+			authURL, err := client.AuthCodeURL(ctx, "state", "nonce", "verifier")
+			if err != nil {
+				t.Fatal(err)
+			}
+			code := provider.authorize(authURL, provider.claims(time.Now()))
+
+			_, err = client.Exchange(ctx, code, "verifier")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Exchange() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
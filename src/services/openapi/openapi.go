@@ -0,0 +1,496 @@
+package openapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/JaxonAdams/blog-backend/src/helpers"
+	"github.com/JaxonAdams/blog-backend/src/services/apperror"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+const Version = "3.1.0"
+
+// Doc describes a route for the generated document. The types it names must
+// be the ones its handler parses and responds with; the routes package's
+// tests check each handler's responses against them.
+type Doc struct {
+	Summary string
+	// Whether the API Gateway authorizer runs before the handler
+	Authorized bool
+	// Fields named in the path are path parameters. The rest are query
+	// parameters for GET and DELETE routes and for routes with a raw body,
+	// and body fields otherwise.
+	Input any
+	// Media types of a raw request body, e.g. an uploaded archive
+	RequestMediaTypes []string
+	// Response data by status, wrapped in the data envelope. nil means no body.
+	Responses map[int]any
+	// Other representations of the 200 response
+	MediaTypes []string
+}
+
+type Operation struct {
+	ID     string
+	Method string
+	Path   string
+	Doc
+}
+
+type Document struct {
+	OpenAPI    string                               `json:"openapi"`
+	Info       Info                                 `json:"info"`
+	Paths      map[string]map[string]*PathOperation `json:"paths"`
+	Components Components                           `json:"components"`
+}
+
+type Info struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type PathOperation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+type Parameter struct {
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required,omitempty"`
+	Style    string  `json:"style,omitempty"`
+	Explode  *bool   `json:"explode,omitempty"`
+	Schema   *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	Name         string `json:"name,omitempty"`
+	In           string `json:"in,omitempty"`
+}
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	MinLength            *int64             `json:"minLength,omitempty"`
+	MaxLength            *int64             `json:"maxLength,omitempty"`
+	Minimum              *int64             `json:"minimum,omitempty"`
+	Maximum              *int64             `json:"maximum,omitempty"`
+	ExclusiveMinimum     *int64             `json:"exclusiveMinimum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	MinItems             *int64             `json:"minItems,omitempty"`
+	MaxItems             *int64             `json:"maxItems,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+}
+
+var (
+	pathParamPattern = regexp.MustCompile(`\{([^}]+)\}`)
+	startKeyType     = reflect.TypeFor[map[string]types.AttributeValue]()
+	security         = []map[string][]string{{"bearerAuth": {}}, {"apiKey": {}}}
+)
+
+// Generate builds the document for operations, reporting every operation
+// whose types do not fit its route.
+func Generate(title, version string, operations []Operation) (Document, error) {
+	g := generator{
+		schemas: map[string]*Schema{},
+		types:   map[string]reflect.Type{},
+	}
+
+	document := Document{
+		OpenAPI: Version,
+		Info:    Info{Title: title, Version: version},
+		Paths:   map[string]map[string]*PathOperation{},
+	}
+
+	for _, operation := range operations {
+		method := strings.ToLower(operation.Method)
+		if document.Paths[operation.Path] == nil {
+			document.Paths[operation.Path] = map[string]*PathOperation{}
+		}
+		if document.Paths[operation.Path][method] != nil {
+			g.errorf("%s %s is declared twice", operation.Method, operation.Path)
+			continue
+		}
+
+		document.Paths[operation.Path][method] = g.operation(operation)
+	}
+
+	document.Components = Components{
+		Schemas: g.schemas,
+		SecuritySchemes: map[string]SecurityScheme{
+			"bearerAuth": {Type: "http", Scheme: "bearer", BearerFormat: "JWT"},
+			"apiKey":     {Type: "apiKey", Name: "X-API-Key", In: "header"},
+		},
+	}
+	document.Components.Schemas["Problem"] = g.problemSchema()
+
+	return document, errors.Join(g.errs...)
+}
+
+type generator struct {
+	schemas map[string]*Schema
+	// The Go type behind each named schema, so two types cannot share a name
+	types map[string]reflect.Type
+	errs  []error
+}
+
+func (g *generator) errorf(format string, args ...any) {
+	g.errs = append(g.errs, fmt.Errorf(format, args...))
+}
+
+func (g *generator) operation(operation Operation) *PathOperation {
+	result := &PathOperation{
+		OperationID: operation.ID,
+		Summary:     operation.Summary,
+		Responses:   map[string]Response{},
+	}
+
+	if operation.Authorized {
+		result.Security = security
+	}
+
+	var bodyFields []reflect.StructField
+	pathParams := pathParamPattern.FindAllStringSubmatch(operation.Path, -1)
+	found := map[string]bool{}
+
+	if operation.Input != nil {
+		inputType := reflect.TypeOf(operation.Input)
+		if inputType.Kind() != reflect.Struct {
+			g.errorf("%s %s: input must be a struct, not %s", operation.Method, operation.Path, inputType)
+		} else {
+			for _, field := range fields(inputType) {
+				name := jsonName(field)
+				if slices.ContainsFunc(pathParams, func(match []string) bool { return match[1] == name }) {
+					result.Parameters = append(result.Parameters, Parameter{
+						Name:     name,
+						In:       "path",
+						Required: true,
+						Schema:   g.fieldSchema(field, true),
+					})
+					found[name] = true
+					continue
+				}
+
+				// Embedded inputs name the resource, so only their path
+				// parameters are documented
+				if isEmbedded(field) {
+					continue
+				}
+
+				if operation.Method == http.MethodGet || operation.Method == http.MethodDelete || len(operation.RequestMediaTypes) > 0 {
+					result.Parameters = append(result.Parameters, g.queryParameter(field))
+				} else {
+					bodyFields = append(bodyFields, field)
+				}
+			}
+		}
+	}
+
+	for _, match := range pathParams {
+		if !found[match[1]] {
+			g.errorf("%s %s: path parameter %s has no input field", operation.Method, operation.Path, match[1])
+			result.Parameters = append(result.Parameters, Parameter{Name: match[1], In: "path", Required: true, Schema: &Schema{Type: "string"}})
+		}
+	}
+
+	if len(operation.RequestMediaTypes) > 0 {
+		result.RequestBody = &RequestBody{Required: true, Content: map[string]MediaType{}}
+		for _, mediaType := range operation.RequestMediaTypes {
+			result.RequestBody.Content[mediaType] = MediaType{Schema: &Schema{Type: "string", Format: "binary"}}
+		}
+	} else if len(bodyFields) > 0 {
+		result.RequestBody = &RequestBody{
+			Required: true,
+			Content: map[string]MediaType{
+				"application/json": {Schema: g.namedSchema(reflect.TypeOf(operation.Input), func() *Schema {
+					return g.objectSchema(bodyFields, true)
+				})},
+			},
+		}
+	}
+
+	for status, data := range operation.Responses {
+		response := Response{Description: http.StatusText(status)}
+		if data != nil {
+			response.Content = map[string]MediaType{
+				"application/json": {Schema: &Schema{
+					Type:       "object",
+					Properties: map[string]*Schema{"data": g.schemaFor(reflect.TypeOf(data), false)},
+					Required:   []string{"data"},
+				}},
+			}
+		}
+
+		if status == http.StatusOK {
+			for _, mediaType := range operation.MediaTypes {
+				if response.Content == nil {
+					response.Content = map[string]MediaType{}
+				}
+				response.Content[mediaType] = MediaType{Schema: &Schema{}}
+			}
+		}
+
+		result.Responses[strconv.Itoa(status)] = response
+	}
+
+	if len(operation.Responses) == 0 {
+		g.errorf("%s %s: no responses documented", operation.Method, operation.Path)
+	}
+
+	result.Responses["default"] = Response{
+		Description: "Problem details",
+		Content: map[string]MediaType{
+			"application/problem+json": {Schema: &Schema{Ref: "#/components/schemas/Problem"}},
+		},
+	}
+
+	return result
+}
+
+func (g *generator) queryParameter(field reflect.StructField) Parameter {
+	parameter := Parameter{
+		Name:     jsonName(field),
+		In:       "query",
+		Required: slices.Contains(rules(field), "required"),
+		Schema:   g.fieldSchema(field, true),
+	}
+
+	// Lists are sent comma-separated, e.g. include=html,md
+	if parameter.Schema.Type == "array" {
+		explode := false
+		parameter.Style = "form"
+		parameter.Explode = &explode
+	}
+
+	return parameter
+}
+
+// schemaFor returns a reference for named structs and an inline schema for
+// everything else. Input schemas take their required fields from validate
+// tags; response schemas require every field not marked omitempty.
+func (g *generator) schemaFor(t reflect.Type, input bool) *Schema {
+	if t == startKeyType {
+		return &Schema{Type: "string", Description: "The nextStartKey of the previous page"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.schemaFor(t.Elem(), input)
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int32:
+		return &Schema{Type: "integer"}
+	case reflect.Int64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: g.schemaFor(t.Elem(), input)}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schemaFor(t.Elem(), input)}
+	case reflect.Interface:
+		return &Schema{}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t, input)
+		}
+		return g.namedSchema(t, func() *Schema { return g.structSchema(t, input) })
+	default:
+		g.errorf("%s has no JSON schema", t)
+		return &Schema{}
+	}
+}
+
+func (g *generator) namedSchema(t reflect.Type, build func() *Schema) *Schema {
+	name := t.Name()
+	if existing, ok := g.types[name]; ok && existing != t {
+		g.errorf("%s and %s would share the schema name %s", existing, t, name)
+	}
+
+	if _, ok := g.types[name]; !ok {
+		g.types[name] = t
+		// Registered first so recursive types end at a reference
+		g.schemas[name] = &Schema{}
+		*g.schemas[name] = *build()
+	}
+
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// structSchema documents t. Embedded inputs name the resource in the path,
+// so their fields are left out of input schemas.
+func (g *generator) structSchema(t reflect.Type, input bool) *Schema {
+	var structFields []reflect.StructField
+	for _, field := range fields(t) {
+		if !input || !isEmbedded(field) {
+			structFields = append(structFields, field)
+		}
+	}
+
+	return g.objectSchema(structFields, input)
+}
+
+func (g *generator) objectSchema(structFields []reflect.StructField, input bool) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+
+	for _, field := range structFields {
+		name := jsonName(field)
+		schema.Properties[name] = g.fieldSchema(field, input)
+
+		_, options, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if input && slices.Contains(rules(field), "required") ||
+			!input && !slices.Contains(strings.Split(options, ","), "omitempty") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+
+	return schema
+}
+
+// fieldSchema applies the field's validate rules to its type's schema.
+// Rules after dive apply to each item.
+func (g *generator) fieldSchema(field reflect.StructField, input bool) *Schema {
+	schema := g.schemaFor(field.Type, input)
+	if !input {
+		return schema
+	}
+
+	fieldRules, itemRules := splitRules(field)
+	applyRules(schema, fieldRules)
+	if schema.Items != nil {
+		applyRules(schema.Items, itemRules)
+	}
+
+	return schema
+}
+
+func applyRules(schema *Schema, rules []string) {
+	for _, rule := range rules {
+		name, param, _ := strings.Cut(rule, "=")
+		limit, err := strconv.ParseInt(param, 10, 64)
+		hasLimit := err == nil
+
+		switch {
+		case name == "oneof":
+			schema.Enum = strings.Fields(param)
+		case name == "numeric":
+			schema.Pattern = "^[0-9]+$"
+		case name == "slug":
+			schema.Pattern = helpers.SlugPattern.String()
+		case name == "gt" && hasLimit:
+			schema.ExclusiveMinimum = &limit
+		case (name == "min" || name == "max" || name == "len") && hasLimit:
+			var lower, upper **int64
+			switch schema.Type {
+			case "string":
+				lower, upper = &schema.MinLength, &schema.MaxLength
+			case "array":
+				lower, upper = &schema.MinItems, &schema.MaxItems
+			default:
+				lower, upper = &schema.Minimum, &schema.Maximum
+			}
+			if name != "max" {
+				*lower = &limit
+			}
+			if name != "min" {
+				*upper = &limit
+			}
+		}
+	}
+}
+
+func (g *generator) problemSchema() *Schema {
+	return &Schema{
+		Type:        "object",
+		Description: "An RFC 7807 problem. Some problems add fields of their own; see docs/problems.md.",
+		Properties: map[string]*Schema{
+			"type":      {Type: "string"},
+			"title":     {Type: "string"},
+			"status":    {Type: "integer"},
+			"detail":    {Type: "string"},
+			"instance":  {Type: "string"},
+			"requestId": {Type: "string"},
+			"errors":    {Type: "array", Items: g.schemaFor(reflect.TypeFor[apperror.FieldError](), false)},
+		},
+		Required: []string{"type", "title", "status", "detail"},
+	}
+}
+
+// fields lists the JSON-visible fields of t, including those of embedded
+// structs.
+func fields(t reflect.Type) []reflect.StructField {
+	var result []reflect.StructField
+	for _, field := range reflect.VisibleFields(t) {
+		if field.Anonymous || !field.IsExported() || jsonName(field) == "-" {
+			continue
+		}
+		result = append(result, field)
+	}
+	return result
+}
+
+func isEmbedded(field reflect.StructField) bool {
+	return len(field.Index) > 1
+}
+
+func jsonName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		return field.Name
+	}
+	return name
+}
+
+func rules(field reflect.StructField) []string {
+	fieldRules, _ := splitRules(field)
+	return fieldRules
+}
+
+// splitRules separates the field's validate rules from those after dive.
+func splitRules(field reflect.StructField) (fieldRules, itemRules []string) {
+	all := strings.Split(field.Tag.Get("validate"), ",")
+	if i := slices.Index(all, "dive"); i >= 0 {
+		return all[:i], all[i+1:]
+	}
+	return all, nil
+}
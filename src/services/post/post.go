@@ -2,68 +2,147 @@ package postservice
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"time"
 
 	"github.com/JaxonAdams/blog-backend/src/helpers"
 	"github.com/JaxonAdams/blog-backend/src/models"
 	postmodel "github.com/JaxonAdams/blog-backend/src/models/posts"
+	"github.com/JaxonAdams/blog-backend/src/services/apperror"
+	"github.com/JaxonAdams/blog-backend/src/services/aws/dynamodb"
+	"github.com/JaxonAdams/blog-backend/src/services/aws/s3"
 	"github.com/JaxonAdams/blog-backend/src/services/markdown"
 )
 
+// Lambda responses are capped at 6 MB, so keep inlined content well below it
+const (
+	maxRawContentBytes = 5 * 1024 * 1024
+)
+
+// contentStore is the part of S3 that writing a post's content needs.
+type contentStore interface {
+	UploadPostHTML(postID, content string, ctx context.Context) (s3.UploadedObject, error)
+	UploadPostMd(postID, content string, ctx context.Context) (s3.UploadedObject, error)
+	RemoveUpload(object s3.UploadedObject, ctx context.Context) error
+}
+
+// metadataStore is the part of DynamoDB that writing a post's metadata needs.
+type metadataStore interface {
+	GetPostById(id string, ctx context.Context) (postmodel.Post, error)
+	UpsertPost(post postmodel.Post, ctx context.Context) error
+	InsertPost(post postmodel.Post, ctx context.Context) error
+	UpsertPostIfVersion(post postmodel.Post, expectedVersion int64, ctx context.Context) error
+}
+
+// writer creates and updates posts, undoing its S3 uploads if a later step
+// fails.
+type writer struct {
+	content  contentStore
+	metadata metadataStore
+	logger   *slog.Logger
+}
+
+func newWriter(services models.HandlerServices) writer {
+	return writer{
+		content:  services.S3Service,
+		metadata: services.DynamoDBService,
+		logger:   services.Logger,
+	}
+}
+
 func CreatePost(input models.CreatePostInput, services models.HandlerServices, ctx context.Context) (postmodel.Post, error) {
+	now := time.Now().UnixMilli()
+	return newWriter(services).create(input, now, now, ctx)
+}
+
+// ImportPost creates a post brought over from another blog, keeping the
+// dates it was originally published and last modified.
+func ImportPost(input models.CreatePostInput, createdAt, modifiedAt time.Time, services models.HandlerServices, ctx context.Context) (postmodel.Post, error) {
+	return newWriter(services).create(input, createdAt.UnixMilli(), modifiedAt.UnixMilli(), ctx)
+}
+
+func UpdatePost(input models.UpdatePostInput, services models.HandlerServices, ctx context.Context) (postmodel.Post, error) {
+	return newWriter(services).update(input, ctx)
+}
+
+// InsertPost stores post as it is, e.g. from a backup, with its content. If a
+// post with its ID already exists it fails with
+// dynamodb.ErrCodeConditionFailed, leaving that post's objects as they were.
+func InsertPost(post postmodel.Post, markdown, html string, services models.HandlerServices, ctx context.Context) (postmodel.Post, error) {
+	return newWriter(services).insert(post, markdown, html, ctx)
+}
+
+func (w writer) create(input models.CreatePostInput, createdAt, modifiedAt int64, ctx context.Context) (postmodel.Post, error) {
 	// Create a unique ID for the post
 	postID := helpers.NewID()
 
 	// Convert the markdown to HTML
 	html := markdown.MdToHTML([]byte(input.Content))
-	fmt.Printf("HTML Content: %s", html)
+	w.logger.Debug("Rendered post markdown", "post_id", postID, "html_bytes", len(html))
+
+	undo := rollback{logger: w.logger}
 
 	// Store the HTML and Markdown in S3
-	htmlS3Key, err := services.S3Service.UploadPostHTML(postID, string(html), ctx)
+	htmlObject, err := w.content.UploadPostHTML(postID, string(html), ctx)
 	if err != nil {
-		log.Fatalf("failed to upload md to s3: %v", err)
-		return postmodel.Post{}, err
+		return postmodel.Post{}, undo.fail(fmt.Errorf("failed to upload html to s3: %w", err), ctx)
 	}
+	undo.add(w.removeUpload(htmlObject))
 
-	mdS3Key, err := services.S3Service.UploadPostMd(postID, input.Content, ctx)
+	mdObject, err := w.content.UploadPostMd(postID, input.Content, ctx)
 	if err != nil {
-		log.Fatalf("failed to upload html to s3: %v", err)
-		return postmodel.Post{}, err
+		return postmodel.Post{}, undo.fail(fmt.Errorf("failed to upload md to s3: %w", err), ctx)
 	}
+	undo.add(w.removeUpload(mdObject))
 
 	post := postmodel.Post{
-		ID:         postID,
-		Summary:    input.Summary,
-		Title:      input.Title,
-		Tags:       input.Tags,
-		HtmlS3Key:  htmlS3Key,
-		MdS3Key:    mdS3Key,
-		CreatedAt:  time.Now().UnixMilli(),
-		ModifiedAt: time.Now().UnixMilli(),
+		ID:          postID,
+		Summary:     input.Summary,
+		Title:       input.Title,
+		Tags:        input.Tags,
+		HtmlS3Key:   htmlObject.Key,
+		MdS3Key:     mdObject.Key,
+		CreatedAt:   createdAt,
+		ModifiedAt:  modifiedAt,
+		Version:     1,
+		ContentHash: postmodel.HashContent(input.Content),
 	}
 
 	// Store metadata in DynamoDB, including S3 key
-	err = services.DynamoDBService.UpsertPost(post, ctx)
+	err = w.metadata.UpsertPost(post, ctx)
 	if err != nil {
-		log.Fatalf("failed to store post metadata in dynamo: %v", err)
-		return postmodel.Post{}, err
+		return postmodel.Post{}, undo.fail(fmt.Errorf("failed to store post metadata in dynamo: %w", err), ctx)
 	}
 
 	return post, nil
 }
 
-func UpdatePost(input models.UpdatePostInput, services models.HandlerServices, ctx context.Context) (postmodel.Post, error) {
-	origPost, err := GetPostByID(input.ID, services, ctx)
+func (w writer) update(input models.UpdatePostInput, ctx context.Context) (postmodel.Post, error) {
+	origPost, err := w.metadata.GetPostById(input.ID, ctx)
 	if err != nil {
 		return postmodel.Post{}, err
 	}
+	if origPost.IsDeleted() {
+		return postmodel.Post{}, dynamodb.ErrCodeNotFound{Msg: fmt.Sprintf("no post found with id %s", input.ID)}
+	}
 
-	post := origPost
+	if input.ExpectedVersion == nil {
+		return postmodel.Post{}, ErrCodePreconditionRequired{Msg: "an If-Match header or expectedVersion field is required"}
+	}
+
+	// Reject stale edits before touching S3; the conditional write below
+	// catches anything that slips in between
+	expectedVersion := *input.ExpectedVersion
+	if origPost.Version != expectedVersion {
+		return postmodel.Post{}, ErrCodeVersionConflict{
+			Msg:            fmt.Sprintf("post has been modified; current version is %d", origPost.Version),
+			CurrentVersion: origPost.Version,
+		}
+	}
 
-	post.HtmlPostUrl = ""
-	post.MdPostUrl = ""
+	post := origPost
 
 	if input.Title != nil {
 		post.Title = *input.Title
@@ -80,42 +159,95 @@ func UpdatePost(input models.UpdatePostInput, services models.HandlerServices, c
 		}
 	}
 
+	undo := rollback{logger: w.logger}
+
 	if input.Content != nil {
 		// Convert the markdown to HTML
 		html := markdown.MdToHTML([]byte(*input.Content))
-		fmt.Printf("HTML Content: %s", html)
+		w.logger.Debug("Rendered post markdown", "post_id", post.ID, "html_bytes", len(html))
 
 		// Store the HTML and Markdown in S3
-		htmlS3Key, err := services.S3Service.UploadPostHTML(post.ID, string(html), ctx)
+		htmlObject, err := w.content.UploadPostHTML(post.ID, string(html), ctx)
 		if err != nil {
-			log.Fatalf("failed to upload md to s3: %v", err)
-			return postmodel.Post{}, err
+			return postmodel.Post{}, undo.fail(fmt.Errorf("failed to upload html to s3: %w", err), ctx)
 		}
+		undo.add(w.revertUpload(htmlObject))
 
-		mdS3Key, err := services.S3Service.UploadPostMd(post.ID, *input.Content, ctx)
+		mdObject, err := w.content.UploadPostMd(post.ID, *input.Content, ctx)
 		if err != nil {
-			log.Fatalf("failed to upload html to s3: %v", err)
-			return postmodel.Post{}, err
+			return postmodel.Post{}, undo.fail(fmt.Errorf("failed to upload md to s3: %w", err), ctx)
 		}
+		undo.add(w.revertUpload(mdObject))
 
-		post.HtmlS3Key = htmlS3Key
-		post.MdS3Key = mdS3Key
-
+		post.HtmlS3Key = htmlObject.Key
+		post.MdS3Key = mdObject.Key
+		post.ContentHash = postmodel.HashContent(*input.Content)
 	}
 
 	post.ModifiedAt = time.Now().UnixMilli()
+	post.Version = expectedVersion + 1
 
-	err = services.DynamoDBService.UpsertPost(post, ctx)
+	err = w.metadata.UpsertPostIfVersion(post, expectedVersion, ctx)
 	if err != nil {
-		log.Fatalf("failed to store post metadata in dynamo: %v", err)
-		return postmodel.Post{}, err
+		var conditionErr dynamodb.ErrCodeConditionFailed
+		if errors.As(err, &conditionErr) {
+			err = versionConflict(post.ID, w.metadata, ctx)
+			return postmodel.Post{}, undo.fail(err, ctx)
+		}
+		return postmodel.Post{}, undo.fail(fmt.Errorf("failed to store post metadata in dynamo: %w", err), ctx)
 	}
 
 	return post, nil
 }
 
+func (w writer) insert(post postmodel.Post, markdown, html string, ctx context.Context) (postmodel.Post, error) {
+	undo := rollback{logger: w.logger}
+
+	// The keys may belong to a post that exists after all, so failures
+	// revert to whatever the uploads replaced
+	mdObject, err := w.content.UploadPostMd(post.ID, markdown, ctx)
+	if err != nil {
+		return postmodel.Post{}, undo.fail(fmt.Errorf("failed to upload md to s3: %w", err), ctx)
+	}
+	undo.add(w.revertUpload(mdObject))
+
+	htmlObject, err := w.content.UploadPostHTML(post.ID, html, ctx)
+	if err != nil {
+		return postmodel.Post{}, undo.fail(fmt.Errorf("failed to upload html to s3: %w", err), ctx)
+	}
+	undo.add(w.revertUpload(htmlObject))
+
+	post.MdS3Key, post.HtmlS3Key = mdObject.Key, htmlObject.Key
+
+	err = w.metadata.InsertPost(post, ctx)
+	if err != nil {
+		return postmodel.Post{}, undo.fail(fmt.Errorf("failed to store post metadata in dynamo: %w", err), ctx)
+	}
+
+	return post, nil
+}
+
+// removeUpload deletes an object uploaded for a new post.
+func (w writer) removeUpload(object s3.UploadedObject) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		return w.content.RemoveUpload(object, ctx)
+	}
+}
+
+// revertUpload restores the version an upload overwrote. Without a version ID
+// there is nothing to revert to, so the new content is left in place.
+func (w writer) revertUpload(object s3.UploadedObject) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		if object.VersionID == "" {
+			w.logger.Warn("Cannot revert upload without a version ID", "s3_key", object.Key)
+			return nil
+		}
+		return w.content.RemoveUpload(object, ctx)
+	}
+}
+
 func GetPostByID(id string, services models.HandlerServices, ctx context.Context) (postmodel.Post, error) {
-	post, err := services.DynamoDBService.GetPostById(id, ctx)
+	post, err := getActivePost(id, services, ctx)
 	if err != nil {
 		return postmodel.Post{}, err
 	}
@@ -131,27 +263,226 @@ func GetPostByID(id string, services models.HandlerServices, ctx context.Context
 	return post, nil
 }
 
-func GetAllPosts(input models.GetPostsInput, services models.HandlerServices, ctx context.Context) ([]postmodel.Post, map[string]any, error) {
-	posts, nextStartKey, err := services.DynamoDBService.GetAllPosts(int32(input.PageSize), input.StartKey, ctx)
+// GetPostWithContent embeds the requested formats in the post. Content over
+// the size limit is left to the presigned URL.
+func GetPostWithContent(input models.GetPostByIdInput, services models.HandlerServices, ctx context.Context) (postmodel.Post, error) {
+	post, err := GetPostByID(input.ID, services, ctx)
+	if err != nil {
+		return postmodel.Post{}, err
+	}
+
+	maxBytes := services.Config.InlineContentMaxBytes
+	for _, format := range input.Include {
+		switch format {
+		case "html":
+			content, ok, err := readInlineContent(post.HtmlS3Key, maxBytes, services, ctx)
+			if err != nil {
+				return postmodel.Post{}, err
+			}
+			if ok {
+				post.HtmlContent = content
+				post.HtmlPostUrl = ""
+			}
+		case "md":
+			content, ok, err := readInlineContent(post.MdS3Key, maxBytes, services, ctx)
+			if err != nil {
+				return postmodel.Post{}, err
+			}
+			if ok {
+				post.MdContent = content
+				post.MdPostUrl = ""
+			}
+		}
+	}
+
+	return post, nil
+}
+
+// GetPostContent reads a post's HTML or Markdown object. Objects too large for
+// a Lambda response return s3.ErrCodeObjectTooLarge.
+func GetPostContent(id, format string, services models.HandlerServices, ctx context.Context) (postmodel.Post, string, error) {
+	post, err := getActivePost(id, services, ctx)
+	if err != nil {
+		return postmodel.Post{}, "", err
+	}
+
+	key := post.MdS3Key
+	if format == postmodel.FormatHTML {
+		key = post.HtmlS3Key
+	}
+
+	content, err := services.S3Service.ReadPostObject(key, maxRawContentBytes, ctx)
 	if err != nil {
-		return []postmodel.Post{}, map[string]any{}, err
+		return postmodel.Post{}, "", err
 	}
 
-	metadata := map[string]any{
-		"nextStartKey": nextStartKey,
+	return post, content, nil
+}
+
+func GetAllPosts(input models.GetPostsInput, services models.HandlerServices, ctx context.Context) ([]postmodel.Post, models.PageMetadata, error) {
+	posts, nextStartKey, err := services.DynamoDBService.GetAllPosts(int32(input.PageSize), input.StartKey, ctx)
+	if err != nil {
+		return []postmodel.Post{}, models.PageMetadata{}, err
 	}
 
-	return posts, metadata, nil
+	return posts, models.PageMetadata{NextStartKey: nextStartKey}, nil
 }
 
 func DeletePost(id string, services models.HandlerServices, ctx context.Context) error {
+	post, err := getActivePost(id, services, ctx)
+	if err != nil {
+		return err
+	}
+
+	// Move the post to the trash; it is purged once its retention period ends
+	services.Logger.Info("Moving post to the trash", "post_id", id)
+	expectedVersion := post.Version
+	post.DeletedAt = time.Now().UnixMilli()
+	post.Version++
+
+	return upsertIfUnchanged(post, expectedVersion, services, ctx)
+}
+
+func RestorePost(id string, services models.HandlerServices, ctx context.Context) (postmodel.Post, error) {
+	post, err := services.DynamoDBService.GetPostById(id, ctx)
+	if err != nil {
+		return postmodel.Post{}, err
+	}
+
+	if !post.IsDeleted() {
+		return postmodel.Post{}, ErrCodeConflict{Msg: "post is not in the trash"}
+	}
+
+	expectedVersion := post.Version
+	post.DeletedAt = 0
+	post.ModifiedAt = time.Now().UnixMilli()
+	post.Version++
+
+	err = upsertIfUnchanged(post, expectedVersion, services, ctx)
+	if err != nil {
+		return postmodel.Post{}, err
+	}
+
+	return post, nil
+}
+
+func GetDeletedPosts(input models.GetPostsInput, services models.HandlerServices, ctx context.Context) ([]postmodel.Post, models.PageMetadata, error) {
+	posts, nextStartKey, err := services.DynamoDBService.GetDeletedPosts(int32(input.PageSize), input.StartKey, ctx)
+	if err != nil {
+		return []postmodel.Post{}, models.PageMetadata{}, err
+	}
+
+	return posts, models.PageMetadata{NextStartKey: nextStartKey}, nil
+}
+
+func PurgePost(id string, services models.HandlerServices, ctx context.Context) (postmodel.Post, error) {
 	post, err := services.DynamoDBService.GetPostById(id, ctx)
 	if err != nil {
+		return postmodel.Post{}, err
+	}
+
+	if !post.IsDeleted() {
+		return postmodel.Post{}, ErrCodeConflict{Msg: "only posts in the trash can be purged"}
+	}
+
+	err = purgePost(post, services, ctx)
+	var conditionErr dynamodb.ErrCodeConditionFailed
+	if errors.As(err, &conditionErr) {
+		return postmodel.Post{}, ErrCodeConflict{Msg: "post was restored or changed while purging it"}
+	}
+	if err != nil {
+		return postmodel.Post{}, err
+	}
+
+	return post, nil
+}
+
+func PurgeExpiredPosts(retention time.Duration, services models.HandlerServices, ctx context.Context) ([]string, error) {
+	cutoff := time.Now().Add(-retention).UnixMilli()
+
+	posts, err := services.DynamoDBService.GetPostsDeletedBefore(cutoff, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	purged := make([]string, 0, len(posts))
+	for _, post := range posts {
+		err := purgePost(post, services, ctx)
+		var conditionErr dynamodb.ErrCodeConditionFailed
+		if errors.As(err, &conditionErr) {
+			services.Logger.Info("Skipping post changed since it was read", "post_id", post.ID)
+			continue
+		}
+		if err != nil {
+			return purged, fmt.Errorf("failed to purge post %s: %w", post.ID, err)
+		}
+		purged = append(purged, post.ID)
+	}
+
+	return purged, nil
+}
+
+// purgePost deletes the metadata first, and only if the post is still in
+// the trash as read, so a post restored in between keeps its content.
+func purgePost(post postmodel.Post, services models.HandlerServices, ctx context.Context) error {
+	services.Logger.Info("Purging post", "post_id", post.ID)
+	if err := services.DynamoDBService.DeleteTrashedPost(post, ctx); err != nil {
 		return err
 	}
 
-	fmt.Printf("Attempting to delete post with ID %s", id)
-	return services.DynamoDBService.DeletePost(id, int(post.CreatedAt), ctx)
+	if err := services.S3Service.DeletePostObjects(post.ID, ctx); err != nil {
+		return fmt.Errorf("purged post %s but not its content: %w", post.ID, err)
+	}
+	return nil
+}
+
+// upsertIfUnchanged writes post only if it is still at the version it was
+// read at, so a change made in between is not overwritten.
+func upsertIfUnchanged(post postmodel.Post, expectedVersion int64, services models.HandlerServices, ctx context.Context) error {
+	err := services.DynamoDBService.UpsertPostIfVersion(post, expectedVersion, ctx)
+	var conditionErr dynamodb.ErrCodeConditionFailed
+	if errors.As(err, &conditionErr) {
+		return versionConflict(post.ID, services.DynamoDBService, ctx)
+	}
+	return err
+}
+
+func versionConflict(id string, metadata metadataStore, ctx context.Context) error {
+	current, err := metadata.GetPostById(id, ctx)
+	if err != nil {
+		return err
+	}
+
+	return ErrCodeVersionConflict{
+		Msg:            fmt.Sprintf("post has been modified; current version is %d", current.Version),
+		CurrentVersion: current.Version,
+	}
+}
+
+func getActivePost(id string, services models.HandlerServices, ctx context.Context) (postmodel.Post, error) {
+	post, err := services.DynamoDBService.GetPostById(id, ctx)
+	if err != nil {
+		return postmodel.Post{}, err
+	}
+
+	if post.IsDeleted() {
+		return postmodel.Post{}, dynamodb.ErrCodeNotFound{Msg: fmt.Sprintf("no post found with id %s", id)}
+	}
+
+	return post, nil
+}
+
+func readInlineContent(key string, maxBytes int64, services models.HandlerServices, ctx context.Context) (string, bool, error) {
+	content, err := services.S3Service.ReadPostObject(key, maxBytes, ctx)
+	if err != nil {
+		var tooLargeErr s3.ErrCodeObjectTooLarge
+		if errors.As(err, &tooLargeErr) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+
+	return content, true, nil
 }
 
 func getPresignedUrlsForPost(post postmodel.Post, services models.HandlerServices, ctx context.Context) (string, string, error) {
@@ -175,3 +506,52 @@ type ErrCodeInvalidRequest struct {
 func (e ErrCodeInvalidRequest) Error() string {
 	return e.Msg
 }
+
+func (e ErrCodeInvalidRequest) ErrorCode() apperror.Code {
+	return apperror.CodeInvalidRequest
+}
+
+type ErrCodeConflict struct {
+	Msg string
+}
+
+func (e ErrCodeConflict) Error() string {
+	return e.Msg
+}
+
+func (e ErrCodeConflict) ErrorCode() apperror.Code {
+	return apperror.CodeConflict
+}
+
+type ErrCodePreconditionRequired struct {
+	Msg string
+}
+
+func (e ErrCodePreconditionRequired) Error() string {
+	return e.Msg
+}
+
+func (e ErrCodePreconditionRequired) ErrorCode() apperror.Code {
+	return apperror.CodePreconditionRequired
+}
+
+type ErrCodeVersionConflict struct {
+	Msg            string
+	CurrentVersion int64
+}
+
+func (e ErrCodeVersionConflict) Error() string {
+	return e.Msg
+}
+
+func (e ErrCodeVersionConflict) ErrorCode() apperror.Code {
+	return apperror.CodeVersionConflict
+}
+
+func (e ErrCodeVersionConflict) ProblemExtensions() map[string]any {
+	return map[string]any{"currentVersion": e.CurrentVersion}
+}
+
+func (e ErrCodeVersionConflict) ProblemHeaders() map[string]string {
+	return map[string]string{"ETag": postmodel.VersionETag(e.CurrentVersion)}
+}
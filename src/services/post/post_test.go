@@ -0,0 +1,557 @@
+package postservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/JaxonAdams/blog-backend/src/models"
+	postmodel "github.com/JaxonAdams/blog-backend/src/models/posts"
+	"github.com/JaxonAdams/blog-backend/src/services/aws/dynamodb"
+	"github.com/JaxonAdams/blog-backend/src/services/aws/s3"
+)
+
+// fakeContent keeps every version of each key, like a versioned bucket.
+type fakeContent struct {
+	versions map[string][]string
+	uploads  int
+	failHTML error
+	failMd   error
+	removed  []s3.UploadedObject
+}
+
+func newFakeContent() *fakeContent {
+	return &fakeContent{versions: map[string][]string{}}
+}
+
+func (f *fakeContent) UploadPostHTML(postID, content string, ctx context.Context) (s3.UploadedObject, error) {
+	if f.failHTML != nil {
+		return s3.UploadedObject{}, f.failHTML
+	}
+	return f.put("posts/" + postID + ".html"), nil
+}
+
+func (f *fakeContent) UploadPostMd(postID, content string, ctx context.Context) (s3.UploadedObject, error) {
+	if f.failMd != nil {
+		return s3.UploadedObject{}, f.failMd
+	}
+	return f.put("posts/" + postID + ".md"), nil
+}
+
+func (f *fakeContent) RemoveUpload(object s3.UploadedObject, ctx context.Context) error {
+	f.removed = append(f.removed, object)
+	f.versions[object.Key] = slices.DeleteFunc(f.versions[object.Key], func(v string) bool { return v == object.VersionID })
+	return nil
+}
+
+func (f *fakeContent) put(key string) s3.UploadedObject {
+	f.uploads++
+	version := fmt.Sprintf("v%d", f.uploads)
+	f.versions[key] = append(f.versions[key], version)
+	return s3.UploadedObject{Key: key, VersionID: version}
+}
+
+// current is the version a plain GET of key would return.
+func (f *fakeContent) current(key string) string {
+	versions := f.versions[key]
+	if len(versions) == 0 {
+		return ""
+	}
+	return versions[len(versions)-1]
+}
+
+type fakeMetadata struct {
+	posts   map[string]postmodel.Post
+	failPut error
+	// Runs before a conditional write, e.g. to make a concurrent edit
+	beforePut func()
+}
+
+func (f *fakeMetadata) GetPostById(id string, ctx context.Context) (postmodel.Post, error) {
+	post, ok := f.posts[id]
+	if !ok {
+		return postmodel.Post{}, dynamodb.ErrCodeNotFound{Msg: "no post found with id " + id}
+	}
+	return post, nil
+}
+
+func (f *fakeMetadata) UpsertPost(post postmodel.Post, ctx context.Context) error {
+	if f.failPut != nil {
+		return f.failPut
+	}
+	f.posts[post.ID] = post
+	return nil
+}
+
+func (f *fakeMetadata) InsertPost(post postmodel.Post, ctx context.Context) error {
+	if f.beforePut != nil {
+		f.beforePut()
+	}
+	if f.failPut != nil {
+		return f.failPut
+	}
+	if _, ok := f.posts[post.ID]; ok {
+		return dynamodb.ErrCodeConditionFailed{Msg: "post " + post.ID + " already exists"}
+	}
+	f.posts[post.ID] = post
+	return nil
+}
+
+func (f *fakeMetadata) UpsertPostIfVersion(post postmodel.Post, expectedVersion int64, ctx context.Context) error {
+	if f.beforePut != nil {
+		f.beforePut()
+	}
+	if f.failPut != nil {
+		return f.failPut
+	}
+	if f.posts[post.ID].Version != expectedVersion {
+		return dynamodb.ErrCodeConditionFailed{Msg: "version mismatch"}
+	}
+	f.posts[post.ID] = post
+	return nil
+}
+
+func newTestWriter(content *fakeContent, metadata *fakeMetadata) writer {
+	return writer{
+		content:  content,
+		metadata: metadata,
+		logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+}
+
+func TestCreateRollback(t *testing.T) {
+	errUpload := errors.New("s3 unavailable")
+	errPut := errors.New("dynamodb unavailable")
+
+	tests := []struct {
+		name     string
+		failHTML error
+		failMd   error
+		failPut  error
+		wantErr  error
+		// Keys of the uploads expected to be removed, in order
+		wantRemoved []string
+	}{
+		{
+			name: "success",
+		},
+		{
+			name:     "html upload fails",
+			failHTML: errUpload,
+			wantErr:  errUpload,
+		},
+		{
+			name:        "md upload fails",
+			failMd:      errUpload,
+			wantErr:     errUpload,
+			wantRemoved: []string{".html"},
+		},
+		{
+			name:        "metadata write fails",
+			failPut:     errPut,
+			wantErr:     errPut,
+			wantRemoved: []string{".md", ".html"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := newFakeContent()
+			content.failHTML, content.failMd = tt.failHTML, tt.failMd
+			metadata := &fakeMetadata{posts: map[string]postmodel.Post{}, failPut: tt.failPut}
+
+			post, err := newTestWriter(content, metadata).create(models.CreatePostInput{
+				Title:   "Title",
+				Content: "# Hello",
+				Tags:    []string{"go"},
+			}, 1, 1, context.Background())
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("create() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil {
+				if _, ok := metadata.posts[post.ID]; !ok {
+					t.Error("create() did not store the post")
+				}
+			} else if len(metadata.posts) != 0 {
+				t.Error("create() stored a post despite failing")
+			}
+
+			if len(content.removed) != len(tt.wantRemoved) {
+				t.Fatalf("removed %v, want uploads ending in %v", content.removed, tt.wantRemoved)
+			}
+			for i, object := range content.removed {
+				if object.VersionID == "" || !strings.HasSuffix(object.Key, tt.wantRemoved[i]) {
+					t.Errorf("removed[%d] = %+v, want a version of the %s upload", i, object, tt.wantRemoved[i])
+				}
+			}
+			// A new post's objects only had the one version, so nothing is left
+			if tt.wantErr != nil {
+				for key, versions := range content.versions {
+					if len(versions) != 0 {
+						t.Errorf("%s still has versions %v", key, versions)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateRollback(t *testing.T) {
+	errUpload := errors.New("s3 unavailable")
+	errPut := errors.New("dynamodb unavailable")
+
+	const (
+		postID  = "post-1"
+		htmlKey = "posts/post-1.html"
+		mdKey   = "posts/post-1.md"
+	)
+
+	tests := []struct {
+		name        string
+		failHTML    error
+		failMd      error
+		failPut     error
+		concurrent  bool
+		wantErr     func(error) bool
+		wantRemoved int
+	}{
+		{
+			name:    "success",
+			wantErr: func(err error) bool { return err == nil },
+		},
+		{
+			name:     "html upload fails",
+			failHTML: errUpload,
+			wantErr:  func(err error) bool { return errors.Is(err, errUpload) },
+		},
+		{
+			name:        "md upload fails",
+			failMd:      errUpload,
+			wantErr:     func(err error) bool { return errors.Is(err, errUpload) },
+			wantRemoved: 1,
+		},
+		{
+			name:        "metadata write fails",
+			failPut:     errPut,
+			wantErr:     func(err error) bool { return errors.Is(err, errPut) },
+			wantRemoved: 2,
+		},
+		{
+			name:       "post changes before the metadata write",
+			concurrent: true,
+			wantErr: func(err error) bool {
+				var conflict ErrCodeVersionConflict
+				return errors.As(err, &conflict) && conflict.CurrentVersion == 4
+			},
+			wantRemoved: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := newFakeContent()
+			priorHTML := content.put(htmlKey).VersionID
+			priorMd := content.put(mdKey).VersionID
+			content.failHTML, content.failMd = tt.failHTML, tt.failMd
+
+			metadata := &fakeMetadata{
+				posts: map[string]postmodel.Post{postID: {
+					ID:        postID,
+					Title:     "Title",
+					Tags:      []string{"go"},
+					HtmlS3Key: htmlKey,
+					MdS3Key:   mdKey,
+					Version:   3,
+				}},
+				failPut: tt.failPut,
+			}
+			if tt.concurrent {
+				metadata.beforePut = func() {
+					post := metadata.posts[postID]
+					post.Version = 4
+					metadata.posts[postID] = post
+				}
+			}
+
+			newContent := "# Changed"
+			expectedVersion := int64(3)
+			_, err := newTestWriter(content, metadata).update(models.UpdatePostInput{
+				GetPostByIdInput: models.GetPostByIdInput{ID: postID},
+				Content:          &newContent,
+				ExpectedVersion:  &expectedVersion,
+			}, context.Background())
+
+			if !tt.wantErr(err) {
+				t.Fatalf("update() error = %v", err)
+			}
+
+			if len(content.removed) != tt.wantRemoved {
+				t.Fatalf("removed %v, want %d uploads", content.removed, tt.wantRemoved)
+			}
+			for _, object := range content.removed {
+				if object.VersionID == "" || object.VersionID == priorHTML || object.VersionID == priorMd {
+					t.Errorf("removed %+v, want only a version this update uploaded", object)
+				}
+			}
+
+			if err == nil {
+				if metadata.posts[postID].Version != 4 {
+					t.Errorf("version = %d, want 4", metadata.posts[postID].Version)
+				}
+				return
+			}
+			// A failed update leaves both keys on the content they held before
+			if got := content.current(htmlKey); got != priorHTML {
+				t.Errorf("%s is at version %s, want %s", htmlKey, got, priorHTML)
+			}
+			if got := content.current(mdKey); got != priorMd {
+				t.Errorf("%s is at version %s, want %s", mdKey, got, priorMd)
+			}
+		})
+	}
+}
+
+func TestInsertRollback(t *testing.T) {
+	errUpload := errors.New("s3 unavailable")
+	errPut := errors.New("dynamodb unavailable")
+
+	const (
+		postID  = "post-1"
+		htmlKey = "posts/post-1.html"
+		mdKey   = "posts/post-1.md"
+	)
+
+	tests := []struct {
+		name     string
+		failHTML error
+		failMd   error
+		failPut  error
+		// Another post with the ID is stored between the caller's check and
+		// the insert, its objects already in the bucket
+		concurrent  bool
+		wantErr     func(error) bool
+		wantRemoved int
+	}{
+		{
+			name:    "success",
+			wantErr: func(err error) bool { return err == nil },
+		},
+		{
+			name:    "md upload fails",
+			failMd:  errUpload,
+			wantErr: func(err error) bool { return errors.Is(err, errUpload) },
+		},
+		{
+			name:        "html upload fails",
+			failHTML:    errUpload,
+			wantErr:     func(err error) bool { return errors.Is(err, errUpload) },
+			wantRemoved: 1,
+		},
+		{
+			name:        "metadata write fails",
+			failPut:     errPut,
+			wantErr:     func(err error) bool { return errors.Is(err, errPut) },
+			wantRemoved: 2,
+		},
+		{
+			name:       "post with the ID already exists",
+			concurrent: true,
+			wantErr: func(err error) bool {
+				var conflict dynamodb.ErrCodeConditionFailed
+				return errors.As(err, &conflict)
+			},
+			wantRemoved: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			content := newFakeContent()
+			metadata := &fakeMetadata{posts: map[string]postmodel.Post{}, failPut: tt.failPut}
+
+			var otherHTML, otherMd string
+			if tt.concurrent {
+				otherHTML, otherMd = content.put(htmlKey).VersionID, content.put(mdKey).VersionID
+				metadata.posts[postID] = postmodel.Post{ID: postID, Title: "Another post", HtmlS3Key: htmlKey, MdS3Key: mdKey, Version: 1}
+			}
+			content.failHTML, content.failMd = tt.failHTML, tt.failMd
+
+			_, err := newTestWriter(content, metadata).insert(postmodel.Post{
+				ID:      postID,
+				Title:   "Restored",
+				Tags:    []string{"go"},
+				Version: 2,
+			}, "# Restored", "<h1>Restored</h1>", context.Background())
+
+			if !tt.wantErr(err) {
+				t.Fatalf("insert() error = %v", err)
+			}
+
+			if len(content.removed) != tt.wantRemoved {
+				t.Fatalf("removed %v, want %d uploads", content.removed, tt.wantRemoved)
+			}
+			for _, object := range content.removed {
+				if object.VersionID == "" || object.VersionID == otherHTML || object.VersionID == otherMd {
+					t.Errorf("removed %+v, want only a version this insert uploaded", object)
+				}
+			}
+
+			if err == nil {
+				if metadata.posts[postID].Title != "Restored" {
+					t.Errorf("stored %+v, want the restored post", metadata.posts[postID])
+				}
+				return
+			}
+			// A failed insert leaves the keys as they were: another post's
+			// objects, or nothing at all
+			if got := content.current(htmlKey); got != otherHTML {
+				t.Errorf("%s is at version %q, want %q", htmlKey, got, otherHTML)
+			}
+			if got := content.current(mdKey); got != otherMd {
+				t.Errorf("%s is at version %q, want %q", mdKey, got, otherMd)
+			}
+			if tt.concurrent && metadata.posts[postID].Title != "Another post" {
+				t.Errorf("stored %+v, want the other post left alone", metadata.posts[postID])
+			}
+		})
+	}
+}
+
+// trashStore serves what purging reads and deletes.
+type trashStore struct {
+	dynamodb.Store
+	posts map[string]postmodel.Post
+	// Runs before the delete, e.g. to restore the post
+	beforeDelete func()
+}
+
+func (s *trashStore) GetPostById(id string, ctx context.Context) (postmodel.Post, error) {
+	post, ok := s.posts[id]
+	if !ok {
+		return postmodel.Post{}, dynamodb.ErrCodeNotFound{Msg: "no post found with id " + id}
+	}
+	return post, nil
+}
+
+func (s *trashStore) GetPostsDeletedBefore(cutoff int64, ctx context.Context) ([]postmodel.Post, error) {
+	var posts []postmodel.Post
+	for _, post := range s.posts {
+		if post.IsDeleted() && post.DeletedAt < cutoff {
+			posts = append(posts, post)
+		}
+	}
+	slices.SortFunc(posts, func(a, b postmodel.Post) int { return strings.Compare(a.ID, b.ID) })
+	return posts, nil
+}
+
+func (s *trashStore) DeleteTrashedPost(post postmodel.Post, ctx context.Context) error {
+	if s.beforeDelete != nil {
+		s.beforeDelete()
+	}
+	current, ok := s.posts[post.ID]
+	if !ok || !current.IsDeleted() || current.Version != post.Version {
+		return dynamodb.ErrCodeConditionFailed{Msg: "post is no longer in the trash"}
+	}
+	delete(s.posts, post.ID)
+	return nil
+}
+
+type purgedContent struct {
+	s3.Store
+	deleted []string
+}
+
+func (c *purgedContent) DeletePostObjects(postID string, ctx context.Context) error {
+	c.deleted = append(c.deleted, postID)
+	return nil
+}
+
+func TestPurgePost(t *testing.T) {
+	trashed := postmodel.Post{ID: "post-1", CreatedAt: 1700000000000, DeletedAt: 1, Version: 3}
+
+	tests := []struct {
+		name       string
+		restore    bool
+		wantErr    bool
+		wantPurged bool
+	}{
+		{name: "trashed post is purged", wantPurged: true},
+		{name: "post restored during the purge keeps everything", restore: true, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &trashStore{posts: map[string]postmodel.Post{trashed.ID: trashed}}
+			if tt.restore {
+				store.beforeDelete = func() {
+					restored := trashed
+					restored.DeletedAt = 0
+					restored.Version++
+					store.posts[trashed.ID] = restored
+				}
+			}
+			content := &purgedContent{}
+			services := models.HandlerServices{
+				DynamoDBService: store,
+				S3Service:       content,
+				Logger:          slog.New(slog.NewTextHandler(io.Discard, nil)),
+			}
+
+			_, err := PurgePost(trashed.ID, services, context.Background())
+			if tt.wantErr {
+				var conflict ErrCodeConflict
+				if !errors.As(err, &conflict) {
+					t.Fatalf("PurgePost() error = %v, want ErrCodeConflict", err)
+				}
+			} else if err != nil {
+				t.Fatalf("PurgePost() error = %v", err)
+			}
+
+			_, exists := store.posts[trashed.ID]
+			if exists == tt.wantPurged {
+				t.Errorf("post stored = %v, want %v", exists, !tt.wantPurged)
+			}
+			if purged := len(content.deleted) > 0; purged != tt.wantPurged {
+				t.Errorf("content deleted = %v, want %v", content.deleted, tt.wantPurged)
+			}
+		})
+	}
+}
+
+func TestPurgeExpiredPostsSkipsRestored(t *testing.T) {
+	store := &trashStore{posts: map[string]postmodel.Post{
+		"post-1": {ID: "post-1", DeletedAt: 1, Version: 2},
+		"post-2": {ID: "post-2", DeletedAt: 1, Version: 5},
+	}}
+	store.beforeDelete = func() {
+		// post-1 is restored after the job listed it
+		if post := store.posts["post-1"]; post.IsDeleted() {
+			post.DeletedAt = 0
+			post.Version++
+			store.posts["post-1"] = post
+		}
+	}
+	content := &purgedContent{}
+	services := models.HandlerServices{
+		DynamoDBService: store,
+		S3Service:       content,
+		Logger:          slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+
+	purged, err := PurgeExpiredPosts(0, services, context.Background())
+	if err != nil {
+		t.Fatalf("PurgeExpiredPosts() error = %v", err)
+	}
+	if want := []string{"post-2"}; !slices.Equal(purged, want) || !slices.Equal(content.deleted, want) {
+		t.Errorf("purged %v with content %v, want %v", purged, content.deleted, want)
+	}
+	if _, ok := store.posts["post-1"]; !ok {
+		t.Error("restored post was deleted")
+	}
+}
@@ -0,0 +1,37 @@
+package postservice
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+)
+
+// rollback collects compensating actions for the steps of a multi-step
+// write, so a failure part way through can undo the steps that succeeded.
+type rollback struct {
+	logger *slog.Logger
+	steps  []func(ctx context.Context) error
+}
+
+func (r *rollback) add(step func(ctx context.Context) error) {
+	r.steps = append(r.steps, step)
+}
+
+// fail undoes every recorded step in reverse order and returns cause joined
+// with any errors hit while compensating.
+func (r *rollback) fail(cause error, ctx context.Context) error {
+	errs := []error{cause}
+
+	// Compensate even if the request context has already been cancelled
+	ctx = context.WithoutCancel(ctx)
+
+	for i := len(r.steps) - 1; i >= 0; i-- {
+		if err := r.steps[i](ctx); err != nil {
+			r.logger.Error("Rollback step failed", "error", err)
+			errs = append(errs, fmt.Errorf("rollback: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
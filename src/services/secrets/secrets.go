@@ -0,0 +1,204 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	appconfig "github.com/JaxonAdams/blog-backend/src/services/config"
+	"github.com/JaxonAdams/blog-backend/src/services/logging"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	smtypes "github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+)
+
+// Secret names
+const (
+	JWTSecret        = "JWT_SECRET"
+	OIDCClientSecret = "OIDC_CLIENT_SECRET"
+)
+
+// How long past its TTL a secret is still served while it cannot be fetched
+const maxStale = 15 * time.Minute
+
+type Provider interface {
+	GetSecret(ctx context.Context, name string) (string, error)
+}
+
+// New returns the provider chosen by SECRETS_PROVIDER, cached for
+// SECRETS_CACHE_TTL_SECONDS.
+func New(ctx context.Context, appConfig *appconfig.Config) Provider {
+	var provider Provider
+
+	switch appConfig.Secrets.Provider {
+	case appconfig.SecretsFromFile:
+		provider = FileProvider{Dir: appConfig.Secrets.Dir}
+	case appconfig.SecretsFromSecretsManager, appconfig.SecretsFromSSM:
+		cfg, err := config.LoadDefaultConfig(ctx)
+		if err != nil {
+			// Runs once at cold start; without AWS config the function cannot serve anything
+			logging.New().Error("Failed to load AWS config", "error", err)
+			os.Exit(1)
+		}
+
+		if appConfig.Secrets.Provider == appconfig.SecretsFromSSM {
+			provider = SSMProvider{client: ssm.NewFromConfig(cfg), prefix: appConfig.Secrets.Prefix}
+		} else {
+			provider = SecretsManagerProvider{client: secretsmanager.NewFromConfig(cfg), prefix: appConfig.Secrets.Prefix}
+		}
+	default:
+		provider = EnvProvider{}
+	}
+
+	if appConfig.Secrets.CacheTTL == 0 {
+		return provider
+	}
+
+	return NewCache(provider, appConfig.Secrets.CacheTTL)
+}
+
+// EnvProvider reads secrets from environment variables of the same name.
+type EnvProvider struct{}
+
+func (EnvProvider) GetSecret(ctx context.Context, name string) (string, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return "", ErrCodeSecretNotFound{Msg: fmt.Sprintf("secret %s is not set in the environment", name)}
+	}
+
+	return value, nil
+}
+
+// FileProvider reads each secret from a file named after it in Dir, as
+// mounted by Docker or Kubernetes.
+type FileProvider struct {
+	Dir string
+}
+
+func (p FileProvider) GetSecret(ctx context.Context, name string) (string, error) {
+	data, err := os.ReadFile(filepath.Join(p.Dir, name))
+	if os.IsNotExist(err) {
+		return "", ErrCodeSecretNotFound{Msg: fmt.Sprintf("secret %s not found in %s", name, p.Dir)}
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret %s: %w", name, err)
+	}
+
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+type SecretsManagerProvider struct {
+	client *secretsmanager.Client
+	prefix string
+}
+
+func (p SecretsManagerProvider) GetSecret(ctx context.Context, name string) (string, error) {
+	output, err := p.client.GetSecretValue(ctx, &secretsmanager.GetSecretValueInput{
+		SecretId: aws.String(p.prefix + name),
+	})
+	if err != nil {
+		var notFound *smtypes.ResourceNotFoundException
+		if errors.As(err, &notFound) {
+			return "", ErrCodeSecretNotFound{Msg: fmt.Sprintf("secret %s does not exist", p.prefix+name)}
+		}
+		return "", fmt.Errorf("failed to get secret %s: %w", p.prefix+name, err)
+	}
+
+	if output.SecretString == nil {
+		return "", ErrCodeSecretNotFound{Msg: fmt.Sprintf("secret %s has no string value", p.prefix+name)}
+	}
+
+	return *output.SecretString, nil
+}
+
+type SSMProvider struct {
+	client *ssm.Client
+	prefix string
+}
+
+func (p SSMProvider) GetSecret(ctx context.Context, name string) (string, error) {
+	output, err := p.client.GetParameter(ctx, &ssm.GetParameterInput{
+		Name:           aws.String(p.prefix + name),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		var notFound *ssmtypes.ParameterNotFound
+		if errors.As(err, &notFound) {
+			return "", ErrCodeSecretNotFound{Msg: fmt.Sprintf("parameter %s does not exist", p.prefix+name)}
+		}
+		return "", fmt.Errorf("failed to get parameter %s: %w", p.prefix+name, err)
+	}
+
+	return aws.ToString(output.Parameter.Value), nil
+}
+
+// Cache keeps secrets for ttl. A read after that fetches the secret again
+// within the caller's request rather than in the background, as Lambda
+// freezes anything still running once it has responded, so a rotated secret
+// takes effect within ttl. If that fetch fails the last value is served, but
+// only until it is maxStale past ttl.
+type Cache struct {
+	provider Provider
+	ttl      time.Duration
+	now      func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+type cacheEntry struct {
+	value     string
+	fetchedAt time.Time
+}
+
+func NewCache(provider Provider, ttl time.Duration) *Cache {
+	return &Cache{
+		provider: provider,
+		ttl:      ttl,
+		now:      time.Now,
+		entries:  map[string]cacheEntry{},
+	}
+}
+
+func (c *Cache) GetSecret(ctx context.Context, name string) (string, error) {
+	c.mu.Lock()
+	entry, ok := c.entries[name]
+	c.mu.Unlock()
+
+	age := c.now().Sub(entry.fetchedAt)
+	if ok && age < c.ttl {
+		return entry.value, nil
+	}
+
+	value, err := c.provider.GetSecret(ctx, name)
+	if err != nil {
+		if ok && age < c.ttl+maxStale {
+			// Keep serving the last good value rather than failing requests
+			logging.New().Warn("Failed to refresh secret", "name", name, "error", err)
+			return entry.value, nil
+		}
+		return "", err
+	}
+
+	c.mu.Lock()
+	c.entries[name] = cacheEntry{value: value, fetchedAt: c.now()}
+	c.mu.Unlock()
+
+	return value, nil
+}
+
+type ErrCodeSecretNotFound struct {
+	Msg string
+}
+
+func (e ErrCodeSecretNotFound) Error() string {
+	return e.Msg
+}
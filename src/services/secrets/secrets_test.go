@@ -0,0 +1,145 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// rotatingProvider serves whatever value is current, counting fetches.
+type rotatingProvider struct {
+	value   string
+	err     error
+	fetches int
+}
+
+func (p *rotatingProvider) GetSecret(ctx context.Context, name string) (string, error) {
+	p.fetches++
+	if p.err != nil {
+		return "", p.err
+	}
+	return p.value, nil
+}
+
+func TestCache(t *testing.T) {
+	const ttl = 5 * time.Minute
+	errUnavailable := errors.New("secrets manager unavailable")
+
+	type step struct {
+		// How long after the first read this one happens
+		after time.Duration
+		// Changes the provider before the read
+		rotate      string
+		fail        bool
+		want        string
+		wantErr     bool
+		wantFetches int
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "fresh value is served from the cache",
+			steps: []step{
+				{want: "v1", wantFetches: 1},
+				{after: ttl - time.Second, rotate: "v2", want: "v1", wantFetches: 1},
+			},
+		},
+		{
+			name: "rotated value is fetched once the TTL expires",
+			steps: []step{
+				{want: "v1", wantFetches: 1},
+				{after: ttl, rotate: "v2", want: "v2", wantFetches: 2},
+				{after: ttl + time.Minute, want: "v2", wantFetches: 2},
+			},
+		},
+		{
+			name: "failed refresh serves the last value",
+			steps: []step{
+				{want: "v1", wantFetches: 1},
+				{after: ttl + time.Minute, fail: true, want: "v1", wantFetches: 2},
+				{after: ttl + 2*time.Minute, fail: true, want: "v1", wantFetches: 3},
+			},
+		},
+		{
+			name: "failed refresh past the max age is an error",
+			steps: []step{
+				{want: "v1", wantFetches: 1},
+				{after: ttl + maxStale, fail: true, wantErr: true, wantFetches: 2},
+			},
+		},
+		{
+			name: "refresh after a failure picks up the rotated value",
+			steps: []step{
+				{want: "v1", wantFetches: 1},
+				{after: ttl, fail: true, want: "v1", wantFetches: 2},
+				{after: ttl + time.Minute, rotate: "v2", want: "v2", wantFetches: 3},
+			},
+		},
+		{
+			name: "errors are not cached",
+			steps: []step{
+				{fail: true, wantErr: true, wantFetches: 1},
+				{want: "v1", wantFetches: 2},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := &rotatingProvider{value: "v1"}
+			start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+			now := start
+
+			cache := NewCache(provider, ttl)
+			cache.now = func() time.Time { return now }
+
+			for i, step := range tt.steps {
+				now = start.Add(step.after)
+				if step.rotate != "" {
+					provider.value = step.rotate
+				}
+				provider.err = nil
+				if step.fail {
+					provider.err = errUnavailable
+				}
+
+				got, err := cache.GetSecret(context.Background(), JWTSecret)
+				if step.wantErr {
+					if !errors.Is(err, errUnavailable) {
+						t.Errorf("read %d: error = %v, want %v", i, err, errUnavailable)
+					}
+				} else if err != nil || got != step.want {
+					t.Errorf("read %d: GetSecret() = %q, %v, want %q", i, got, err, step.want)
+				}
+				if provider.fetches != step.wantFetches {
+					t.Errorf("read %d: %d fetches, want %d", i, provider.fetches, step.wantFetches)
+				}
+			}
+		})
+	}
+}
+
+func TestFileProvider(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, JWTSecret), []byte("s3cret\r\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	provider := FileProvider{Dir: dir}
+
+	got, err := provider.GetSecret(context.Background(), JWTSecret)
+	if err != nil || got != "s3cret" {
+		t.Errorf("GetSecret(%s) = %q, %v, want s3cret", JWTSecret, got, err)
+	}
+
+	_, err = provider.GetSecret(context.Background(), OIDCClientSecret)
+	var notFound ErrCodeSecretNotFound
+	if !errors.As(err, &notFound) {
+		t.Errorf("GetSecret(%s) error = %v, want ErrCodeSecretNotFound", OIDCClientSecret, err)
+	}
+}
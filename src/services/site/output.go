@@ -0,0 +1,98 @@
+package siteservice
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/JaxonAdams/blog-backend/src/models"
+)
+
+// DirOutput writes the site into a directory on disk.
+type DirOutput struct {
+	Root string
+}
+
+func (o DirOutput) WriteFile(name string, content []byte) error {
+	target := filepath.Join(o.Root, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(target, content, 0o644)
+}
+
+// S3Output writes the site under a prefix of the blog's bucket. Files
+// whose content the bucket already holds are not written again, so an
+// export that changes nothing adds no object versions.
+type S3Output struct {
+	prefix   string
+	services models.HandlerServices
+	ctx      context.Context
+	// ETags of the objects under the prefix, listed on the first write
+	existing  map[string]string
+	written   map[string]bool
+	unchanged int
+}
+
+func NewS3Output(prefix string, services models.HandlerServices, ctx context.Context) *S3Output {
+	return &S3Output{prefix: prefix, services: services, ctx: ctx, written: map[string]bool{}}
+}
+
+func (o *S3Output) WriteFile(name string, content []byte) error {
+	if o.existing == nil {
+		existing, err := o.services.S3Service.ListETags(o.prefix, o.ctx)
+		if err != nil {
+			return err
+		}
+		o.existing = existing
+	}
+
+	key := o.prefix + name
+	sum := md5.Sum(content)
+	if o.existing[key] == hex.EncodeToString(sum[:]) {
+		o.written[key] = true
+		o.unchanged++
+		return nil
+	}
+
+	if err := o.services.S3Service.PutObject(key, mime.TypeByExtension(path.Ext(name)), content, o.ctx); err != nil {
+		return err
+	}
+	o.written[key] = true
+	return nil
+}
+
+// Unchanged returns how many files were skipped as the bucket already held
+// them.
+func (o *S3Output) Unchanged() int {
+	return o.unchanged
+}
+
+// RemoveStale deletes what an earlier export left under the prefix that
+// this one did not write, such as the pages of deleted posts. Call it only
+// once the whole site has been written.
+func (o *S3Output) RemoveStale() (int, error) {
+	etags, err := o.services.S3Service.ListETags(o.prefix, o.ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	var stale []string
+	for key := range etags {
+		if !o.written[key] {
+			stale = append(stale, key)
+		}
+	}
+	sort.Strings(stale)
+
+	if err := o.services.S3Service.DeleteKeys(stale, o.ctx); err != nil {
+		return 0, fmt.Errorf("failed to remove stale pages: %w", err)
+	}
+	return len(stale), nil
+}
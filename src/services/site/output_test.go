@@ -0,0 +1,84 @@
+package siteservice
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/JaxonAdams/blog-backend/src/models"
+	"github.com/JaxonAdams/blog-backend/src/services/aws/s3"
+)
+
+// etagBucket serves what S3Output uses of the bucket, with ETags as S3
+// gives single-part uploads.
+type etagBucket struct {
+	s3.Store
+	objects map[string][]byte
+	puts    []string
+	deletes []string
+}
+
+func (b *etagBucket) ListETags(prefix string, ctx context.Context) (map[string]string, error) {
+	etags := map[string]string{}
+	for key, content := range b.objects {
+		sum := md5.Sum(content)
+		etags[key] = hex.EncodeToString(sum[:])
+	}
+	return etags, nil
+}
+
+func (b *etagBucket) PutObject(key, contentType string, content []byte, ctx context.Context) error {
+	b.objects[key] = content
+	b.puts = append(b.puts, key)
+	return nil
+}
+
+func (b *etagBucket) DeleteKeys(keys []string, ctx context.Context) error {
+	for _, key := range keys {
+		delete(b.objects, key)
+	}
+	b.deletes = append(b.deletes, keys...)
+	return nil
+}
+
+func TestS3Output(t *testing.T) {
+	bucket := &etagBucket{objects: map[string][]byte{
+		"site/index.html":           []byte("<p>Home</p>"),
+		"site/posts/old/index.html": []byte("<p>Old</p>"),
+		"site/feed.xml":             []byte("<rss>old</rss>"),
+	}}
+	output := NewS3Output("site/", models.HandlerServices{S3Service: bucket}, context.Background())
+
+	files := map[string]string{
+		"index.html":           "<p>Home</p>",
+		"feed.xml":             "<rss>new</rss>",
+		"posts/new/index.html": "<p>New</p>",
+	}
+	for name, content := range files {
+		if err := output.WriteFile(name, []byte(content)); err != nil {
+			t.Fatalf("WriteFile(%s) error = %v", name, err)
+		}
+	}
+
+	removed, err := output.RemoveStale()
+	if err != nil {
+		t.Fatalf("RemoveStale() error = %v", err)
+	}
+
+	slices.Sort(bucket.puts)
+	if want := []string{"site/feed.xml", "site/posts/new/index.html"}; !reflect.DeepEqual(bucket.puts, want) {
+		t.Errorf("written = %v, want %v", bucket.puts, want)
+	}
+	if got := output.Unchanged(); got != 1 {
+		t.Errorf("Unchanged() = %d, want 1", got)
+	}
+	if want := []string{"site/posts/old/index.html"}; removed != 1 || !reflect.DeepEqual(bucket.deletes, want) {
+		t.Errorf("removed %d: %v, want %v", removed, bucket.deletes, want)
+	}
+	if _, ok := bucket.objects["site/index.html"]; !ok {
+		t.Error("unchanged file was removed as stale")
+	}
+}
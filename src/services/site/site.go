@@ -0,0 +1,425 @@
+package siteservice
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/JaxonAdams/blog-backend/src/models"
+	"github.com/JaxonAdams/blog-backend/src/services/apperror"
+)
+
+//go:embed templates
+var embedded embed.FS
+
+// Posts' rendered HTML can be well over the Markdown limit
+const maxObjectBytes = 16 * 1024 * 1024
+
+// Feeds carry the most recent posts only
+const feedSize = 20
+
+// Pages are rendered from these templates. layout.html is shared by the
+// HTML pages.
+var (
+	pageTemplates = []string{"list.html", "post.html", "tags.html"}
+	xmlTemplates  = []string{"rss.xml", "atom.xml", "sitemap.xml"}
+)
+
+type Options struct {
+	// Templates in this directory replace the built-in ones of the same name
+	TemplateDir string
+	// Posts per index and tag page; the configured default page size if 0
+	PageSize int
+}
+
+// Output receives each file of the site, named by its slash-separated path
+// from the site's root.
+type Output interface {
+	WriteFile(name string, content []byte) error
+}
+
+type Summary struct {
+	Posts int `json:"posts"`
+	Tags  int `json:"tags"`
+	Files int `json:"files"`
+}
+
+type Site struct {
+	Title string
+	// Absolute, without a trailing slash
+	URL string
+	// Path of the site's root, e.g. / or /blog/
+	Base      string
+	Generated time.Time
+}
+
+type Post struct {
+	ID        string
+	Title     string
+	Summary   string
+	Path      string
+	Tags      []Tag
+	Published time.Time
+	Modified  time.Time
+	HTML      template.HTML
+}
+
+type Tag struct {
+	Name  string
+	Path  string
+	Count int
+}
+
+type ListPage struct {
+	Site  Site
+	Tag   string
+	Posts []Post
+	Page  int
+	Pages int
+	// Paths of the neighbouring pages, "" at either end
+	Prev, Next string
+	Feed       string
+}
+
+type PostPage struct {
+	Site Site
+	Post Post
+}
+
+type TagsPage struct {
+	Site Site
+	Tags []Tag
+}
+
+type Feed struct {
+	Site    Site
+	Title   string
+	Path    string
+	Link    string
+	Updated time.Time
+	Posts   []Post
+}
+
+type Sitemap struct {
+	Site  Site
+	Pages []SitemapPage
+}
+
+type SitemapPage struct {
+	Path     string
+	Modified time.Time
+}
+
+type renderer struct {
+	out      Output
+	pages    map[string]*template.Template
+	xmlPages map[string]*texttemplate.Template
+	files    int
+}
+
+// Generate renders every published post to out: paginated index and tag
+// pages, a page per post from its HTML in S3, RSS and Atom feeds, and a
+// sitemap. Posts live at posts/<slug>/; an older post keeps the plain slug
+// if two titles share one.
+func Generate(out Output, options Options, services models.HandlerServices, ctx context.Context) (Summary, error) {
+	cfg := services.Config.Site
+	if cfg.URL == "" {
+		return Summary{}, ErrCodeInvalidRequest{Msg: "SITE_URL is required to export the site"}
+	}
+	base, err := url.Parse(cfg.URL)
+	if err != nil {
+		return Summary{}, ErrCodeInvalidRequest{Msg: fmt.Sprintf("invalid SITE_URL: %v", err)}
+	}
+
+	site := Site{
+		Title:     cfg.Title,
+		URL:       cfg.URL,
+		Base:      strings.TrimRight(base.Path, "/") + "/",
+		Generated: time.Now().UTC(),
+	}
+
+	r := &renderer{out: out}
+	if err := r.parse(options.TemplateDir, site); err != nil {
+		return Summary{}, err
+	}
+
+	records, err := services.DynamoDBService.GetAllActivePosts(ctx)
+	if err != nil {
+		return Summary{}, fmt.Errorf("failed to read posts: %w", err)
+	}
+	// Oldest first, so the older of two posts with one slug keeps it
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].CreatedAt != records[j].CreatedAt {
+			return records[i].CreatedAt < records[j].CreatedAt
+		}
+		return records[i].ID < records[j].ID
+	})
+
+	tagged := map[string][]Post{}
+	slugs := map[string]bool{}
+	posts := make([]Post, 0, len(records))
+	for _, record := range records {
+		html, err := services.S3Service.ReadPostObject(record.HtmlS3Key, maxObjectBytes, ctx)
+		if err != nil {
+			return Summary{}, fmt.Errorf("failed to read post %s: %w", record.ID, err)
+		}
+
+		slug := record.Slug()
+		if slug == "" || slugs[slug] {
+			slug = record.SlugWithID()
+		}
+		slugs[slug] = true
+
+		post := Post{
+			ID:        record.ID,
+			Title:     record.Title,
+			Summary:   record.Summary,
+			Path:      "posts/" + slug + "/",
+			Published: time.UnixMilli(record.CreatedAt).UTC(),
+			Modified:  time.UnixMilli(record.ModifiedAt).UTC(),
+			// Rendered by the blog from its own Markdown, as the API serves it
+			HTML: template.HTML(html),
+		}
+		for _, name := range record.Tags {
+			post.Tags = append(post.Tags, Tag{Name: name, Path: tagPath(name)})
+		}
+		sort.Slice(post.Tags, func(i, j int) bool { return post.Tags[i].Name < post.Tags[j].Name })
+
+		posts = append(posts, post)
+	}
+
+	// Newest first from here on
+	sort.SliceStable(posts, func(i, j int) bool { return posts[i].Published.After(posts[j].Published) })
+
+	pageSize := options.PageSize
+	if pageSize <= 0 {
+		pageSize = services.Config.DefaultPageSize
+	}
+
+	sitemap := Sitemap{Site: site, Pages: []SitemapPage{{Path: ""}, {Path: "tags/"}}}
+	if len(posts) > 0 {
+		sitemap.Pages[0].Modified = latest(posts)
+	}
+
+	for _, post := range posts {
+		if err := r.page("post.html", post.Path, PostPage{Site: site, Post: post}); err != nil {
+			return Summary{}, err
+		}
+		sitemap.Pages = append(sitemap.Pages, SitemapPage{Path: post.Path, Modified: post.Modified})
+
+		for _, tag := range post.Tags {
+			tagged[tag.Name] = append(tagged[tag.Name], post)
+		}
+	}
+
+	if err := r.list(site, "", "", "feed.xml", posts, pageSize); err != nil {
+		return Summary{}, err
+	}
+	for _, feed := range []struct{ template, path string }{{"rss.xml", "feed.xml"}, {"atom.xml", "atom.xml"}} {
+		if err := r.feed(feed.template, feed.path, Feed{
+			Site:    site,
+			Title:   site.Title,
+			Path:    feed.path,
+			Updated: latest(posts),
+			Posts:   posts[:min(feedSize, len(posts))],
+		}); err != nil {
+			return Summary{}, err
+		}
+	}
+
+	tags := make([]Tag, 0, len(tagged))
+	for name, tagPosts := range tagged {
+		tags = append(tags, Tag{Name: name, Path: tagPath(name), Count: len(tagPosts)})
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i].Name < tags[j].Name })
+
+	for _, tag := range tags {
+		tagPosts := tagged[tag.Name]
+		if err := r.list(site, tag.Name, tag.Path, tag.Path+"feed.xml", tagPosts, pageSize); err != nil {
+			return Summary{}, err
+		}
+		if err := r.feed("rss.xml", tag.Path+"feed.xml", Feed{
+			Site:    site,
+			Title:   "#" + tag.Name + " · " + site.Title,
+			Path:    tag.Path + "feed.xml",
+			Link:    tag.Path,
+			Updated: latest(tagPosts),
+			Posts:   tagPosts[:min(feedSize, len(tagPosts))],
+		}); err != nil {
+			return Summary{}, err
+		}
+		sitemap.Pages = append(sitemap.Pages, SitemapPage{Path: tag.Path, Modified: latest(tagPosts)})
+	}
+
+	if err := r.page("tags.html", "tags/", TagsPage{Site: site, Tags: tags}); err != nil {
+		return Summary{}, err
+	}
+	if err := r.feed("sitemap.xml", "sitemap.xml", sitemap); err != nil {
+		return Summary{}, err
+	}
+
+	return Summary{Posts: len(posts), Tags: len(tags), Files: r.files}, nil
+}
+
+// list renders posts as numbered pages under dir: dir itself, then
+// dir/page/2/ and so on.
+func (r *renderer) list(site Site, tag, dir, feed string, posts []Post, pageSize int) error {
+	pages := max(1, (len(posts)+pageSize-1)/pageSize)
+	pagePath := func(n int) string {
+		if n == 1 {
+			return dir
+		}
+		return fmt.Sprintf("%spage/%d/", dir, n)
+	}
+
+	for n := 1; n <= pages; n++ {
+		page := ListPage{
+			Site:  site,
+			Tag:   tag,
+			Posts: posts[min((n-1)*pageSize, len(posts)):min(n*pageSize, len(posts))],
+			Page:  n,
+			Pages: pages,
+			Feed:  feed,
+		}
+		if n > 1 {
+			page.Prev = pagePath(n - 1)
+		}
+		if n < pages {
+			page.Next = pagePath(n + 1)
+		}
+
+		if err := r.page("list.html", pagePath(n), page); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *renderer) page(name, dir string, data any) error {
+	var b bytes.Buffer
+	if err := r.pages[name].ExecuteTemplate(&b, "layout", data); err != nil {
+		return fmt.Errorf("failed to render %s: %w", dir+"index.html", err)
+	}
+	return r.write(dir+"index.html", b.Bytes())
+}
+
+func (r *renderer) feed(name, path string, data any) error {
+	var b bytes.Buffer
+	if err := r.xmlPages[name].Execute(&b, data); err != nil {
+		return fmt.Errorf("failed to render %s: %w", path, err)
+	}
+	return r.write(path, b.Bytes())
+}
+
+func (r *renderer) write(name string, content []byte) error {
+	if err := r.out.WriteFile(name, content); err != nil {
+		return err
+	}
+	r.files++
+	return nil
+}
+
+// parse reads each template from dir if it is there, or else the built-in
+// one. Links are written with link, relative to the site's root, and abs,
+// as absolute URLs.
+func (r *renderer) parse(dir string, site Site) error {
+	read := func(name string) (string, error) {
+		if dir != "" {
+			content, err := os.ReadFile(filepath.Join(dir, name))
+			if err == nil {
+				return string(content), nil
+			}
+			if !os.IsNotExist(err) {
+				return "", err
+			}
+		}
+		content, err := fs.ReadFile(embedded, "templates/"+name)
+		return string(content), err
+	}
+
+	funcs := map[string]any{
+		"link": func(path string) string { return site.Base + path },
+		"abs":  func(path string) string { return site.URL + "/" + path },
+		"xml": func(s string) string {
+			var b strings.Builder
+			xml.EscapeText(&b, []byte(s))
+			return b.String()
+		},
+	}
+
+	layoutText, err := read("layout.html")
+	if err != nil {
+		return err
+	}
+	layout, err := template.New("layout.html").Funcs(funcs).Parse(layoutText)
+	if err != nil {
+		return ErrCodeInvalidRequest{Msg: fmt.Sprintf("invalid template layout.html: %v", err)}
+	}
+
+	r.pages = map[string]*template.Template{}
+	for _, name := range pageTemplates {
+		text, err := read(name)
+		if err != nil {
+			return err
+		}
+		page, err := template.Must(layout.Clone()).New(name).Parse(text)
+		if err != nil {
+			return ErrCodeInvalidRequest{Msg: fmt.Sprintf("invalid template %s: %v", name, err)}
+		}
+		r.pages[name] = page
+	}
+
+	r.xmlPages = map[string]*texttemplate.Template{}
+	for _, name := range xmlTemplates {
+		text, err := read(name)
+		if err != nil {
+			return err
+		}
+		feed, err := texttemplate.New(name).Funcs(funcs).Parse(text)
+		if err != nil {
+			return ErrCodeInvalidRequest{Msg: fmt.Sprintf("invalid template %s: %v", name, err)}
+		}
+		r.xmlPages[name] = feed
+	}
+
+	return nil
+}
+
+func tagPath(name string) string {
+	return "tags/" + url.PathEscape(name) + "/"
+}
+
+// latest is when any of posts last changed.
+func latest(posts []Post) time.Time {
+	var t time.Time
+	for _, post := range posts {
+		if post.Modified.After(t) {
+			t = post.Modified
+		}
+	}
+	return t
+}
+
+type ErrCodeInvalidRequest struct {
+	Msg string
+}
+
+func (e ErrCodeInvalidRequest) Error() string {
+	return e.Msg
+}
+
+func (e ErrCodeInvalidRequest) ErrorCode() apperror.Code {
+	return apperror.CodeInvalidRequest
+}
@@ -0,0 +1,264 @@
+package siteservice
+
+import (
+	"context"
+	"encoding/xml"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/JaxonAdams/blog-backend/src/models"
+	postmodel "github.com/JaxonAdams/blog-backend/src/models/posts"
+	"github.com/JaxonAdams/blog-backend/src/services/aws/dynamodb"
+	"github.com/JaxonAdams/blog-backend/src/services/aws/s3"
+	"github.com/JaxonAdams/blog-backend/src/services/config"
+)
+
+type postStore struct {
+	dynamodb.Store
+	posts []postmodel.Post
+}
+
+func (s postStore) GetAllActivePosts(ctx context.Context) ([]postmodel.Post, error) {
+	return slices.Clone(s.posts), nil
+}
+
+type htmlBucket struct {
+	s3.Store
+	objects map[string]string
+}
+
+func (b htmlBucket) ReadPostObject(key string, maxBytes int64, ctx context.Context) (string, error) {
+	return b.objects[key], nil
+}
+
+type mapOutput map[string]string
+
+func (o mapOutput) WriteFile(name string, content []byte) error {
+	o[name] = string(content)
+	return nil
+}
+
+const awkwardTitle = `Ben & Jerry's <Tips>`
+
+// generate renders five posts, two pages to an index, under /blog/.
+func generate(t *testing.T) (mapOutput, Summary) {
+	t.Helper()
+
+	records := []postmodel.Post{
+		{ID: "aaaaaaaa-0001", Title: "Hello, World", Tags: []string{"go"}, CreatedAt: 1000},
+		{ID: "bbbbbbbb-0002", Title: "Hello World!", Tags: []string{"go", "q&a"}, CreatedAt: 2000},
+		{ID: "cccccccc-0003", Title: "こんにちは", Tags: []string{"go"}, CreatedAt: 3000},
+		{ID: "dddddddd-0004", Title: awkwardTitle, Summary: `"Cones" < tubs`, Tags: []string{"q&a"}, CreatedAt: 4000},
+		{ID: "eeeeeeee-0005", Title: "Fifth", CreatedAt: 5000},
+	}
+	bucket := htmlBucket{objects: map[string]string{}}
+	for i := range records {
+		records[i].ModifiedAt = records[i].CreatedAt
+		records[i].HtmlS3Key = "posts/" + records[i].ID + ".html"
+		bucket.objects[records[i].HtmlS3Key] = "<p>" + records[i].ID + " &amp; more</p>"
+	}
+
+	// Reversed, as Generate must not rely on the store's order
+	stored := slices.Clone(records)
+	slices.Reverse(stored)
+
+	services := models.HandlerServices{
+		Config: &config.Config{
+			DefaultPageSize: 10,
+			Site:            config.SiteConfig{URL: "https://example.com/blog", Title: "Notes & Thoughts"},
+		},
+		DynamoDBService: postStore{posts: stored},
+		S3Service:       bucket,
+	}
+
+	out := mapOutput{}
+	summary, err := Generate(out, Options{PageSize: 2}, services, context.Background())
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+	return out, summary
+}
+
+func TestGenerateFiles(t *testing.T) {
+	out, summary := generate(t)
+
+	want := []string{
+		"atom.xml",
+		"feed.xml",
+		"index.html",
+		"page/2/index.html",
+		"page/3/index.html",
+		"posts/ben-jerry-s-tips/index.html",
+		"posts/cccccccc/index.html",
+		"posts/fifth/index.html",
+		"posts/hello-world-bbbbbbbb/index.html",
+		"posts/hello-world/index.html",
+		"sitemap.xml",
+		"tags/go/feed.xml",
+		"tags/go/index.html",
+		"tags/go/page/2/index.html",
+		"tags/index.html",
+		"tags/q&a/feed.xml",
+		"tags/q&a/index.html",
+	}
+	if got := slices.Sorted(maps.Keys(out)); !slices.Equal(got, want) {
+		t.Errorf("files = %v, want %v", got, want)
+	}
+	if summary != (Summary{Posts: 5, Tags: 2, Files: len(want)}) {
+		t.Errorf("Generate() = %+v", summary)
+	}
+
+	if page := out["posts/hello-world/index.html"]; !strings.Contains(page, "aaaaaaaa-0001") {
+		t.Errorf("the older post does not keep the plain slug:\n%s", page)
+	}
+}
+
+func TestGeneratePagination(t *testing.T) {
+	out, _ := generate(t)
+
+	tests := []struct {
+		file string
+		// Post paths on the page, newest first
+		posts      []string
+		prev, next string
+	}{
+		{file: "index.html", posts: []string{"posts/fifth/", "posts/ben-jerry-s-tips/"}, next: "page/2/"},
+		{file: "page/2/index.html", posts: []string{"posts/cccccccc/", "posts/hello-world-bbbbbbbb/"}, prev: "", next: "page/3/"},
+		{file: "page/3/index.html", posts: []string{"posts/hello-world/"}, prev: "page/2/"},
+		{file: "tags/go/index.html", posts: []string{"posts/cccccccc/", "posts/hello-world-bbbbbbbb/"}, next: "tags/go/page/2/"},
+		{file: "tags/go/page/2/index.html", posts: []string{"posts/hello-world/"}, prev: "tags/go/"},
+		{file: "tags/q&amp;a/index.html", posts: []string{"posts/ben-jerry-s-tips/", "posts/hello-world-bbbbbbbb/"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			page, ok := out[strings.ReplaceAll(tt.file, "&amp;", "&")]
+			if !ok {
+				t.Fatalf("%s was not written", tt.file)
+			}
+
+			var got []string
+			for _, part := range strings.Split(page, `<h2><a href="/blog/`)[1:] {
+				got = append(got, part[:strings.Index(part, `"`)])
+			}
+			if !slices.Equal(got, tt.posts) {
+				t.Errorf("posts = %v, want %v", got, tt.posts)
+			}
+
+			for rel, want := range map[string]string{"prev": tt.prev, "next": tt.next} {
+				link := `rel="` + rel + `"`
+				switch {
+				case want == "" && strings.Contains(page, link):
+					t.Errorf("page links a %s page, want none", rel)
+				case want != "" && !strings.Contains(page, `<a href="/blog/`+want+`" `+link):
+					t.Errorf("page does not link %s to %s", rel, want)
+				}
+			}
+		})
+	}
+}
+
+// rss, atom and sitemap hold what the tests read back from each feed.
+type rss struct {
+	Channel struct {
+		Title string `xml:"title"`
+		// The channel's link, then its atom:link to the feed itself
+		Links []string `xml:"link"`
+		Items []struct {
+			Title       string   `xml:"title"`
+			Link        string   `xml:"link"`
+			Categories  []string `xml:"category"`
+			Description string   `xml:"description"`
+		} `xml:"item"`
+	} `xml:"channel"`
+}
+
+type atom struct {
+	Title   string `xml:"title"`
+	Entries []struct {
+		Title   string `xml:"title"`
+		Summary string `xml:"summary"`
+		Content string `xml:"content"`
+	} `xml:"entry"`
+}
+
+type sitemap struct {
+	URLs []struct {
+		Loc     string `xml:"loc"`
+		LastMod string `xml:"lastmod"`
+	} `xml:"url"`
+}
+
+func TestGenerateFeeds(t *testing.T) {
+	out, _ := generate(t)
+
+	var feed rss
+	if err := xml.Unmarshal([]byte(out["feed.xml"]), &feed); err != nil {
+		t.Fatalf("feed.xml is not valid XML: %v", err)
+	}
+	if feed.Channel.Title != "Notes & Thoughts" || len(feed.Channel.Items) != 5 {
+		t.Errorf("feed.xml has title %q and %d items", feed.Channel.Title, len(feed.Channel.Items))
+	}
+	item := feed.Channel.Items[1]
+	if item.Title != awkwardTitle || item.Link != "https://example.com/blog/posts/ben-jerry-s-tips/" {
+		t.Errorf("feed.xml item = %q at %q", item.Title, item.Link)
+	}
+	if item.Description != "<p>dddddddd-0004 &amp; more</p>" || !slices.Equal(item.Categories, []string{"q&a"}) {
+		t.Errorf("feed.xml item has description %q and categories %v", item.Description, item.Categories)
+	}
+
+	var tagFeed rss
+	if err := xml.Unmarshal([]byte(out["tags/q&a/feed.xml"]), &tagFeed); err != nil {
+		t.Fatalf("tags/q&a/feed.xml is not valid XML: %v", err)
+	}
+	if tagFeed.Channel.Title != "#q&a · Notes & Thoughts" || !slices.Contains(tagFeed.Channel.Links, "https://example.com/blog/tags/q&a/") || len(tagFeed.Channel.Items) != 2 {
+		t.Errorf("tags/q&a/feed.xml = %q at %q with %d items", tagFeed.Channel.Title, tagFeed.Channel.Links, len(tagFeed.Channel.Items))
+	}
+
+	var atomFeed atom
+	if err := xml.Unmarshal([]byte(out["atom.xml"]), &atomFeed); err != nil {
+		t.Fatalf("atom.xml is not valid XML: %v", err)
+	}
+	entry := atomFeed.Entries[1]
+	if entry.Title != awkwardTitle || entry.Summary != `"Cones" < tubs` || entry.Content != "<p>dddddddd-0004 &amp; more</p>" {
+		t.Errorf("atom.xml entry = %+v", entry)
+	}
+
+	var pages sitemap
+	if err := xml.Unmarshal([]byte(out["sitemap.xml"]), &pages); err != nil {
+		t.Fatalf("sitemap.xml is not valid XML: %v", err)
+	}
+	var locs []string
+	for _, url := range pages.URLs {
+		locs = append(locs, url.Loc)
+	}
+	for _, want := range []string{
+		"https://example.com/blog/",
+		"https://example.com/blog/tags/",
+		"https://example.com/blog/posts/hello-world-bbbbbbbb/",
+		"https://example.com/blog/tags/q&a/",
+	} {
+		if !slices.Contains(locs, want) {
+			t.Errorf("sitemap.xml does not list %s: %v", want, locs)
+		}
+	}
+	if len(locs) != 9 {
+		t.Errorf("sitemap.xml lists %d pages, want 9: %v", len(locs), locs)
+	}
+}
+
+func TestGenerateEscapesHTML(t *testing.T) {
+	out, _ := generate(t)
+
+	for _, file := range []string{"index.html", "posts/ben-jerry-s-tips/index.html", "tags/q&a/index.html"} {
+		page := out[file]
+		if strings.Contains(page, "<Tips>") || !strings.Contains(page, "Ben &amp; Jerry&#39;s &lt;Tips&gt;") {
+			t.Errorf("%s does not escape the title:\n%s", file, page)
+		}
+	}
+	if page := out["posts/ben-jerry-s-tips/index.html"]; !strings.Contains(page, "<p>dddddddd-0004 &amp; more</p>") {
+		t.Errorf("post page does not hold its HTML as is:\n%s", page)
+	}
+}
@@ -0,0 +1,136 @@
+package syncservice
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Extracted trees may hold at most this much Markdown, so a small compressed
+// upload cannot expand without bound
+const maxTreeBytes = 64 * 1024 * 1024
+
+// SourceFile is a Markdown file in the content tree, e.g. posts/hello.md.
+type SourceFile struct {
+	Path    string
+	Content []byte
+}
+
+// ReadDir reads every .md file under root. Hidden files and directories,
+// such as .git, are skipped.
+func ReadDir(root string) ([]SourceFile, error) {
+	var files []SourceFile
+	var total int64
+
+	err := filepath.WalkDir(root, func(filePath string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if filePath != root && strings.HasPrefix(entry.Name(), ".") {
+			if entry.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if entry.IsDir() || !isMarkdown(entry.Name()) {
+			return nil
+		}
+
+		content, err := os.ReadFile(filePath)
+		if err != nil {
+			return err
+		}
+
+		total += int64(len(content))
+		if total > maxTreeBytes {
+			return ErrCodeInvalidRequest{Msg: fmt.Sprintf("content tree is larger than %d bytes", maxTreeBytes)}
+		}
+
+		relative, err := filepath.Rel(root, filePath)
+		if err != nil {
+			return err
+		}
+
+		files = append(files, SourceFile{Path: filepath.ToSlash(relative), Content: content})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// ReadTarball reads every .md file in a tar archive, gzipped or not.
+func ReadTarball(r io.Reader) ([]SourceFile, error) {
+	buffered := bufio.NewReader(r)
+	if magic, err := buffered.Peek(2); err == nil && bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return nil, ErrCodeInvalidRequest{Msg: fmt.Sprintf("invalid gzip stream: %v", err)}
+		}
+		defer gz.Close()
+		r = gz
+	} else {
+		r = buffered
+	}
+
+	var files []SourceFile
+	var total int64
+
+	archive := tar.NewReader(r)
+	for {
+		header, err := archive.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, ErrCodeInvalidRequest{Msg: fmt.Sprintf("invalid tar archive: %v", err)}
+		}
+
+		name := path.Clean(strings.TrimPrefix(header.Name, "./"))
+		if header.Typeflag != tar.TypeReg || !isMarkdown(name) || isHidden(name) {
+			continue
+		}
+
+		content, err := io.ReadAll(io.LimitReader(archive, maxTreeBytes-total+1))
+		if err != nil {
+			return nil, ErrCodeInvalidRequest{Msg: fmt.Sprintf("invalid tar archive: %v", err)}
+		}
+
+		total += int64(len(content))
+		if total > maxTreeBytes {
+			return nil, ErrCodeInvalidRequest{Msg: fmt.Sprintf("content tree is larger than %d bytes", maxTreeBytes)}
+		}
+
+		files = append(files, SourceFile{Path: name, Content: content})
+	}
+
+	return files, nil
+}
+
+func isMarkdown(name string) bool {
+	return strings.EqualFold(path.Ext(name), ".md")
+}
+
+// isHidden reports whether any part of the path starts with a dot, e.g. a
+// .git directory or macOS's ._ resource files.
+func isHidden(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") {
+			return true
+		}
+	}
+	return false
+}
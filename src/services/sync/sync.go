@@ -0,0 +1,300 @@
+package syncservice
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+
+	"github.com/JaxonAdams/blog-backend/src/helpers"
+	"github.com/JaxonAdams/blog-backend/src/models"
+	auditmodel "github.com/JaxonAdams/blog-backend/src/models/audit"
+	postmodel "github.com/JaxonAdams/blog-backend/src/models/posts"
+	"github.com/JaxonAdams/blog-backend/src/services/apperror"
+	auditservice "github.com/JaxonAdams/blog-backend/src/services/audit"
+	"github.com/JaxonAdams/blog-backend/src/services/frontmatter"
+	postservice "github.com/JaxonAdams/blog-backend/src/services/post"
+)
+
+type Action string
+
+const (
+	ActionCreate    Action = "create"
+	ActionUpdate    Action = "update"
+	ActionDelete    Action = "delete"
+	ActionUnchanged Action = "unchanged"
+)
+
+// Change brings one post in line with the tree.
+type Change struct {
+	Action Action `json:"action"`
+	// The source file; empty for deletes
+	Path   string `json:"path,omitempty"`
+	PostID string `json:"post_id,omitempty"`
+	Title  string `json:"title"`
+	// What an update changes: title, summary, tags or content
+	Fields []string `json:"fields,omitempty"`
+	// Set by Apply when the change failed
+	Error string `json:"error,omitempty"`
+
+	// The post before and after the change, for audit entries
+	Before *postmodel.Post `json:"-"`
+	After  *postmodel.Post `json:"-"`
+
+	input models.CreatePostInput
+}
+
+// Plan lists the changes that make the posts match the tree. When pruning,
+// posts no file matches are deleted, moving them to the trash.
+type Plan struct {
+	Changes []Change `json:"changes"`
+	Applied bool     `json:"applied"`
+	// How many changes Apply could not make
+	Failed int `json:"failed"`
+}
+
+// Counts tallies the plan's changes by action.
+func (p Plan) Counts() map[Action]int {
+	counts := map[Action]int{}
+	for _, change := range p.Changes {
+		counts[change.Action]++
+	}
+	return counts
+}
+
+// BuildPlan compares files with the active posts. Files match posts by the
+// id in their front matter, or otherwise by a non-empty slug. Posts no file matches are
+// only deleted if prune is set. Every invalid file is reported at once, as a
+// plan missing a file would delete its post, and a tree with no files at all
+// is refused, as it is far more likely a mistake than an empty blog.
+func BuildPlan(files []SourceFile, prune bool, services models.HandlerServices, ctx context.Context) (Plan, error) {
+	if len(files) == 0 {
+		return Plan{}, ErrCodeInvalidRequest{Msg: "the content tree has no Markdown files"}
+	}
+
+	posts, err := services.DynamoDBService.GetAllActivePosts(ctx)
+	if err != nil {
+		return Plan{}, err
+	}
+
+	byID := map[string]postmodel.Post{}
+	bySlug := map[string]postmodel.Post{}
+	for _, post := range posts {
+		byID[post.ID] = post
+		// Titles with no ASCII letters or digits have no slug to match by
+		if slug := post.Slug(); slug != "" {
+			bySlug[slug] = post
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+
+	var plan Plan
+	var problems []apperror.FieldError
+	matched := map[string]string{}
+
+	for _, file := range files {
+		var metadata frontmatter.Post
+		markdown, err := frontmatter.Parse(file.Content, &metadata)
+		if err != nil {
+			problems = append(problems, apperror.FieldError{Field: file.Path, Message: err.Error()})
+			continue
+		}
+
+		input := models.CreatePostInput{
+			Title:   metadata.Title,
+			Summary: metadata.Summary,
+			Tags:    metadata.Tags,
+			Content: markdown,
+		}
+		if err := helpers.ValidateInput(input); err != nil {
+			for _, field := range apperror.FieldsOf(err) {
+				problems = append(problems, apperror.FieldError{Field: file.Path, Message: fmt.Sprintf("%s %s", field.Field, field.Message)})
+			}
+			continue
+		}
+
+		slug := metadata.Slug
+		if slug == "" {
+			slug = postmodel.Slugify(metadata.Title)
+		}
+
+		post, found := byID[metadata.ID]
+		if metadata.ID == "" {
+			// Posts are matched by the slug of their title, so creating it
+			// would create it again on every sync
+			if postmodel.Slugify(metadata.Title) == "" {
+				problems = append(problems, apperror.FieldError{Field: file.Path, Message: "title has no ASCII letters or digits to match a post by; create the post first and set its id in the front matter"})
+				continue
+			}
+			post, found = bySlug[slug]
+		} else if !found {
+			problems = append(problems, apperror.FieldError{Field: file.Path, Message: fmt.Sprintf("no post found with id %s", metadata.ID)})
+			continue
+		}
+
+		if !found {
+			plan.Changes = append(plan.Changes, Change{Action: ActionCreate, Path: file.Path, Title: input.Title, input: input})
+			continue
+		}
+
+		if other, ok := matched[post.ID]; ok {
+			problems = append(problems, apperror.FieldError{Field: file.Path, Message: fmt.Sprintf("matches the same post as %s", other)})
+			continue
+		}
+		matched[post.ID] = file.Path
+
+		fields, err := changedFields(post, input, services, ctx)
+		if err != nil {
+			return Plan{}, err
+		}
+
+		change := Change{Action: ActionUpdate, Path: file.Path, PostID: post.ID, Title: input.Title, Fields: fields, Before: &post, input: input}
+		if len(fields) == 0 {
+			change.Action = ActionUnchanged
+		}
+		plan.Changes = append(plan.Changes, change)
+	}
+
+	if len(problems) > 0 {
+		return Plan{}, apperror.Validation(problems...)
+	}
+
+	for _, post := range posts {
+		if _, ok := matched[post.ID]; !ok && prune {
+			post := post
+			plan.Changes = append(plan.Changes, Change{Action: ActionDelete, PostID: post.ID, Title: post.Title, Before: &post})
+		}
+	}
+
+	return plan, nil
+}
+
+// changedFields compares content by hash. Posts saved before hashes were
+// recorded have their Markdown read from S3 instead.
+func changedFields(post postmodel.Post, input models.CreatePostInput, services models.HandlerServices, ctx context.Context) ([]string, error) {
+	var fields []string
+	if post.Title != input.Title {
+		fields = append(fields, "title")
+	}
+	if post.Summary != input.Summary {
+		fields = append(fields, "summary")
+	}
+	if !slices.Equal(post.Tags, input.Tags) {
+		fields = append(fields, "tags")
+	}
+
+	currentHash := post.ContentHash
+	if currentHash == "" {
+		_, markdown, err := postservice.GetPostContent(post.ID, postmodel.FormatMarkdown, services, ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read post %s: %w", post.ID, err)
+		}
+		currentHash = postmodel.HashContent(markdown)
+	}
+	if currentHash != postmodel.HashContent(input.Content) {
+		fields = append(fields, "content")
+	}
+
+	return fields, nil
+}
+
+// Apply makes each change in turn through postservice, recording failures
+// on the change and carrying on. Updates expect the version the plan saw, so
+// a post edited since planning is left alone.
+func Apply(plan Plan, services models.HandlerServices, ctx context.Context) (Plan, error) {
+	for i := range plan.Changes {
+		change := &plan.Changes[i]
+
+		var err error
+		switch change.Action {
+		case ActionCreate:
+			var post postmodel.Post
+			post, err = postservice.CreatePost(change.input, services, ctx)
+			if err == nil {
+				change.PostID = post.ID
+				change.After = &post
+			}
+		case ActionUpdate:
+			var post postmodel.Post
+			post, err = postservice.UpdatePost(updateInput(*change), services, ctx)
+			if err == nil {
+				change.After = &post
+			}
+		case ActionDelete:
+			err = postservice.DeletePost(change.PostID, services, ctx)
+		}
+
+		if err != nil {
+			services.Logger.Error("Failed to apply sync change", "action", change.Action, "path", change.Path, "post_id", change.PostID, "error", err)
+			change.Error = err.Error()
+			plan.Failed++
+		}
+	}
+
+	plan.Applied = true
+	if plan.Failed > 0 {
+		return plan, fmt.Errorf("%d of %d sync changes failed", plan.Failed, len(plan.Changes))
+	}
+	return plan, nil
+}
+
+// RecordAudit records an entry for each change Apply made. newEntry builds
+// the entry for the caller, e.g. from the request or as a system actor.
+func RecordAudit(plan Plan, newEntry func(action, targetID string) auditmodel.AuditEntry, services models.HandlerServices, ctx context.Context) {
+	actions := map[Action]string{
+		ActionCreate: auditmodel.ActionPostCreate,
+		ActionUpdate: auditmodel.ActionPostUpdate,
+		ActionDelete: auditmodel.ActionPostDelete,
+	}
+
+	for _, change := range plan.Changes {
+		action, ok := actions[change.Action]
+		if !ok || change.Error != "" {
+			continue
+		}
+
+		entry := newEntry(action, change.PostID)
+		if change.Before != nil {
+			entry.Before = auditservice.PostMetadata(*change.Before)
+		}
+		if change.After != nil {
+			entry.After = auditservice.PostMetadata(*change.After)
+		}
+		auditservice.Record(entry, services, ctx)
+	}
+}
+
+// updateInput sends only the fields that changed, so unchanged content is
+// not re-rendered and re-uploaded.
+func updateInput(change Change) models.UpdatePostInput {
+	input := models.UpdatePostInput{ExpectedVersion: &change.Before.Version}
+	input.ID = change.PostID
+
+	for _, field := range change.Fields {
+		switch field {
+		case "title":
+			input.Title = &change.input.Title
+		case "summary":
+			input.Summary = &change.input.Summary
+		case "tags":
+			input.Tags = &change.input.Tags
+		case "content":
+			input.Content = &change.input.Content
+		}
+	}
+
+	return input
+}
+
+type ErrCodeInvalidRequest struct {
+	Msg string
+}
+
+func (e ErrCodeInvalidRequest) Error() string {
+	return e.Msg
+}
+
+func (e ErrCodeInvalidRequest) ErrorCode() apperror.Code {
+	return apperror.CodeInvalidRequest
+}
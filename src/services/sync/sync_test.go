@@ -0,0 +1,110 @@
+package syncservice
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/JaxonAdams/blog-backend/src/models"
+	postmodel "github.com/JaxonAdams/blog-backend/src/models/posts"
+	"github.com/JaxonAdams/blog-backend/src/services/apperror"
+	"github.com/JaxonAdams/blog-backend/src/services/aws/dynamodb"
+)
+
+// activePosts serves GetAllActivePosts; BuildPlan reads nothing else.
+type activePosts struct {
+	dynamodb.Store
+	posts []postmodel.Post
+}
+
+func (a activePosts) GetAllActivePosts(ctx context.Context) ([]postmodel.Post, error) {
+	return a.posts, nil
+}
+
+func TestBuildPlan(t *testing.T) {
+	const markdown = "# Hello\n"
+
+	posts := []postmodel.Post{
+		{ID: "post-1", Title: "Hello", Summary: "A post", Tags: []string{"go"}, ContentHash: postmodel.HashContent(markdown)},
+		{ID: "post-2", Title: "Only in the blog", Summary: "A post", Tags: []string{"go"}, ContentHash: postmodel.HashContent(markdown)},
+		{ID: "post-3", Title: "こんにちは", Summary: "A post", Tags: []string{"go"}, ContentHash: postmodel.HashContent(markdown)},
+	}
+	hello := SourceFile{Path: "hello.md", Content: []byte("---\nid: post-1\ntitle: Hello\nsummary: A post\ntags: [go]\n---\n" + markdown)}
+	unslugged := SourceFile{Path: "privet.md", Content: []byte("---\ntitle: Привет\nsummary: A post\ntags: [go]\n---\n" + markdown)}
+	withID := SourceFile{Path: "privet.md", Content: []byte("---\nid: post-3\ntitle: Привет\nsummary: A post\ntags: [go]\n---\n" + markdown)}
+	slugged := SourceFile{Path: "privet.md", Content: []byte("---\nslug: privet\ntitle: Привет\nsummary: A post\ntags: [go]\n---\n" + markdown)}
+
+	tests := []struct {
+		name        string
+		files       []SourceFile
+		prune       bool
+		wantErr     bool
+		wantActions map[string]Action
+	}{
+		{
+			name:    "empty tree is refused",
+			wantErr: true,
+		},
+		{
+			name:    "empty tree is refused when pruning",
+			prune:   true,
+			wantErr: true,
+		},
+		{
+			name:        "unmatched post is kept",
+			files:       []SourceFile{hello},
+			wantActions: map[string]Action{"post-1": ActionUnchanged},
+		},
+		{
+			name:        "unmatched post is deleted when pruning",
+			files:       []SourceFile{hello},
+			prune:       true,
+			wantActions: map[string]Action{"post-1": ActionUnchanged, "post-2": ActionDelete, "post-3": ActionDelete},
+		},
+		{
+			name:    "file with no slug or id is refused rather than matched by an empty slug",
+			files:   []SourceFile{hello, unslugged},
+			wantErr: true,
+		},
+		{
+			name:    "file with no ASCII in its title is refused even with a slug",
+			files:   []SourceFile{hello, slugged},
+			wantErr: true,
+		},
+		{
+			name:        "file with no ASCII in its title matches by id",
+			files:       []SourceFile{hello, withID},
+			wantActions: map[string]Action{"post-1": ActionUnchanged, "post-3": ActionUpdate},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			services := models.HandlerServices{DynamoDBService: activePosts{posts: posts}}
+
+			plan, err := BuildPlan(slices.Clone(tt.files), tt.prune, services, context.Background())
+			if tt.wantErr {
+				if code := apperror.CodeOf(err); code != apperror.CodeInvalidRequest && code != apperror.CodeValidationFailed {
+					t.Fatalf("BuildPlan() error = %v, want an invalid request", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("BuildPlan() error = %v", err)
+			}
+
+			got := map[string]Action{}
+			for _, change := range plan.Changes {
+				got[change.PostID] = change.Action
+			}
+			if len(got) != len(tt.wantActions) {
+				t.Errorf("plan = %v, want %v", got, tt.wantActions)
+			}
+			for id, action := range tt.wantActions {
+				if got[id] != action {
+					t.Errorf("post %s: action = %q, want %q", id, got[id], action)
+				}
+			}
+		})
+	}
+}
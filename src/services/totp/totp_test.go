@@ -0,0 +1,50 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMatch(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Unix(1_700_000_000, 0)
+	step := now.Unix() / period
+
+	tests := []struct {
+		name     string
+		codeStep int64
+		wantOK   bool
+	}{
+		{"current step", step, true},
+		{"previous step within skew", step - 1, true},
+		{"next step within skew", step + 1, true},
+		{"outside the window", step - 2, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := generateCode(secret, tt.codeStep)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, ok := Match(secret, code, now)
+			if ok != tt.wantOK {
+				t.Fatalf("Match() ok = %v, want %v", ok, tt.wantOK)
+			}
+			// The step is what replay protection compares, so it must be the
+			// code's own step rather than the current one
+			if ok && got != tt.codeStep {
+				t.Errorf("Match() step = %d, want %d", got, tt.codeStep)
+			}
+		})
+	}
+
+	if _, ok := Match(secret, "12345", now); ok {
+		t.Error("Match() accepted a code of the wrong length")
+	}
+}